@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// setupArray defines the Array constructor and Array.prototype, which
+// arrays inherit from unless given another prototype.
+func (i *Interpreter) setupArray() {
+	i.arrayPrototype = i.newObject()
+	array := i.newNativeFunction("Array", 1, func(this Value, args []Value) Value {
+		return i.arrayConstructor(args, Undefined)
+	})
+	array.Data.(*NativeFunction).Construct = i.arrayConstructor
+	array.Object.Properties["prototype"] = i.arrayPrototype
+	i.arrayPrototype.Object.Properties["constructor"] = array
+	setAttributes(i.arrayPrototype, stringKey("constructor"), nonEnumerable)
+
+	i.defineMethod(array, "isArray", 1, func(this Value, args []Value) Value {
+		arg := argument(args, 0)
+		return Value{Type: TypeBoolean, Data: arg.Type == TypeObject && arg.Data == "Array"}
+	})
+	i.defineMethod(i.arrayPrototype, "join", 1, i.arrayJoin)
+	i.defineMethod(i.arrayPrototype, "toString", 0, func(this Value, args []Value) Value {
+		if isNullish(this) {
+			i.throwError("TypeError", "Cannot convert undefined or null to object")
+		}
+		if join := i.getProperty(this, "join"); join.Type == TypeFunction {
+			return i.applyFunction(join, this, nil)
+		}
+		return i.objectToString(this, nil)
+	})
+
+	i.env.Set("Array", array)
+}
+
+// arrayConstructor implements both Array(...) and new Array(...). A
+// single number is the length of an array without elements; any other
+// arguments are the elements.
+func (i *Interpreter) arrayConstructor(args []Value, newTarget Value) Value {
+	var arr Value
+	if len(args) == 1 && args[0].Type == TypeNumber {
+		length := args[0].Data.(float64)
+		if length < 0 || length != math.Trunc(length) || length > math.MaxUint32 {
+			i.throwError("RangeError", "Invalid array length")
+		}
+		i.checkArrayLength(int64(length))
+		arr = i.newArray(nil)
+		arr.Object.Properties["length"] = Value{Type: TypeNumber, Data: length}
+	} else {
+		i.checkArrayLength(int64(len(args)))
+		arr = i.newArray(append([]Value(nil), args...))
+	}
+
+	if newTarget.Type != TypeUndefined {
+		if p := i.getProperty(newTarget, "prototype"); isObject(p) {
+			arr.Object.Prototype = p
+		}
+	}
+	return arr
+}
+
+// arrayJoin implements Array.prototype.join. Missing, undefined and null
+// elements join as empty strings, and so does an array inside itself,
+// which would otherwise join forever.
+func (i *Interpreter) arrayJoin(this Value, args []Value) Value {
+	if isNullish(this) {
+		i.throwError("TypeError", "Array.prototype.join called on null or undefined")
+	}
+	separator := ","
+	if sep := argument(args, 0); sep.Type != TypeUndefined {
+		separator = i.toString(sep)
+	}
+	if !isObject(this) {
+		return Value{Type: TypeString, Data: ""}
+	}
+	for _, obj := range i.joining {
+		if obj == this.Object {
+			return Value{Type: TypeString, Data: ""}
+		}
+	}
+	i.joining = append(i.joining, this.Object)
+	defer func() { i.joining = i.joining[:len(i.joining)-1] }()
+
+	var b strings.Builder
+	length := toLength(i.getProperty(this, "length"))
+	for idx := 0; idx < length; idx++ {
+		i.checkInterrupt()
+		if idx > 0 {
+			b.WriteString(separator)
+		}
+		if el := i.getProperty(this, strconv.Itoa(idx)); !isNullish(el) {
+			b.WriteString(i.toString(el))
+		}
+		if b.Len() > i.limits.MaxStringLength {
+			i.throwError("RangeError", "Invalid string length")
+		}
+	}
+	s := b.String()
+	i.allocateString(s)
+	return Value{Type: TypeString, Data: s}
+}
@@ -1,5 +1,10 @@
 package engine
 
+import (
+	"math/big"
+	"sync/atomic"
+)
+
 type Node interface {
 	TokenLiteral() string
 }
@@ -16,6 +21,11 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Strict     bool
+	source     *source
+	// code is the bytecode of the program's top-level code, once it has
+	// been compiled.
+	code atomic.Pointer[bytecode]
 }
 
 type Identifier struct {
@@ -34,6 +44,25 @@ type NumberLiteral struct {
 func (nl *NumberLiteral) TokenLiteral() string { return nl.Token.Literal }
 func (nl *NumberLiteral) expressionNode()      {}
 
+// BigIntLiteral is an integer literal with the n suffix, such as 10n.
+type BigIntLiteral struct {
+	Token Token
+	Value *big.Int
+}
+
+func (bl *BigIntLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BigIntLiteral) expressionNode()      {}
+
+// RegExpLiteral is a regular expression literal, /Pattern/Flags.
+type RegExpLiteral struct {
+	Token   Token
+	Pattern string
+	Flags   string
+}
+
+func (rl *RegExpLiteral) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RegExpLiteral) expressionNode()      {}
+
 type StringLiteral struct {
 	Token Token
 	Value string
@@ -50,24 +79,218 @@ type BooleanLiteral struct {
 func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
 func (b *BooleanLiteral) expressionNode()      {}
 
+type NullLiteral struct {
+	Token Token
+}
+
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) expressionNode()      {}
+
 type FunctionLiteral struct {
 	Token      Token
+	Name       string
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Strict     bool
+	Generator  bool
+	Async      bool
+	// Arrow marks an arrow function, which takes this, super and
+	// new.target from the enclosing function. A concise body is parsed as
+	// a block returning the expression.
+	Arrow bool
+	// text is the source code of the function.
+	text string
+	// code is the bytecode of the body, once it has been compiled.
+	code atomic.Pointer[bytecode]
 }
 
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) expressionNode()      {}
 
+type ThisExpression struct {
+	Token Token
+}
+
+func (te *ThisExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *ThisExpression) expressionNode()      {}
+
+type ArrayLiteral struct {
+	Token    Token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) expressionNode()      {}
+
+// PropertyKind tells a property of an object literal written key: value
+// from a method or accessor, whose Value is a *FunctionLiteral.
+type PropertyKind int
+
+const (
+	PropertyValue PropertyKind = iota
+	PropertyMethod
+	PropertyGetter
+	PropertySetter
+)
+
+type ObjectProperty struct {
+	Kind PropertyKind
+	Key  string
+	// ComputedKey is the key expression of a property written [key]: value,
+	// in which case Key is empty.
+	ComputedKey Expression
+	Value       Expression
+}
+
+type ObjectLiteral struct {
+	Token      Token
+	Properties []*ObjectProperty
+}
+
+func (ol *ObjectLiteral) TokenLiteral() string { return ol.Token.Literal }
+func (ol *ObjectLiteral) expressionNode()      {}
+
+type SuperExpression struct {
+	Token Token
+}
+
+func (se *SuperExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SuperExpression) expressionNode()      {}
+
+// PrivateIdentifier is a #name after a dot.
+type PrivateIdentifier struct {
+	Token Token
+	Name  string
+}
+
+func (pi *PrivateIdentifier) TokenLiteral() string { return pi.Token.Literal }
+func (pi *PrivateIdentifier) expressionNode()      {}
+
+// PrivateInExpression is a brand check of the form #name in obj.
+type PrivateInExpression struct {
+	Token Token
+	Name  string
+	Right Expression
+}
+
+func (pe *PrivateInExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrivateInExpression) expressionNode()      {}
+
+type ClassMemberKind int
+
+const (
+	ClassMethod ClassMemberKind = iota
+	ClassGetter
+	ClassSetter
+	ClassField
+	ClassStaticBlock
+)
+
+type ClassMember struct {
+	Kind   ClassMemberKind
+	Static bool
+	// Key is the member name; private names keep their leading #.
+	// ComputedKey is set instead for members written [key].
+	Key         string
+	ComputedKey Expression
+	Private     bool
+	// Function is the body of methods and accessors, Value the
+	// initializer of fields and Body the block of static blocks.
+	Function *FunctionLiteral
+	Value    Expression
+	Body     *BlockStatement
+	// code is the bytecode of the initializer or the static block, once
+	// it has been compiled.
+	code atomic.Pointer[bytecode]
+}
+
+type ClassLiteral struct {
+	Token      Token
+	Name       string
+	SuperClass Expression
+	Members    []*ClassMember
+	// text is the source code of the class.
+	text string
+}
+
+func (cl *ClassLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *ClassLiteral) expressionNode()      {}
+
+// MemberExpression is a property access. Property is an *Identifier or
+// *PrivateIdentifier naming the property, or the expression computing its
+// key when Computed. Optional marks an access written with ?., which ends
+// the evaluation of the whole chain when Object is null or undefined.
+type MemberExpression struct {
+	Token    Token
+	Object   Expression
+	Property Expression
+	Computed bool
+	Optional bool
+}
+
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) expressionNode()      {}
+
+// ParenthesizedExpression is an optional chain in parentheses, which ends
+// the chain: a ?. inside skips only the rest of Expression, so that
+// (a?.b).c reads c of undefined when a is null.
+type ParenthesizedExpression struct {
+	Token      Token
+	Expression Expression
+}
+
+func (pe *ParenthesizedExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *ParenthesizedExpression) expressionNode()      {}
+
+// YieldExpression is yield, or yield* when Delegate. Argument is nil for a
+// bare yield.
+type YieldExpression struct {
+	Token    Token
+	Argument Expression
+	Delegate bool
+}
+
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) expressionNode()      {}
+
+type AwaitExpression struct {
+	Token    Token
+	Argument Expression
+}
+
+func (ae *AwaitExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AwaitExpression) expressionNode()      {}
+
 type CallExpression struct {
 	Token     Token
 	Function  Expression
 	Arguments []Expression
+	// Optional marks a call written as f?.(), which ends the evaluation of
+	// the whole chain when f is null or undefined.
+	Optional bool
 }
 
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 func (ce *CallExpression) expressionNode()      {}
 
+type NewExpression struct {
+	Token     Token
+	Callee    Expression
+	Arguments []Expression
+}
+
+func (ne *NewExpression) TokenLiteral() string { return ne.Token.Literal }
+func (ne *NewExpression) expressionNode()      {}
+
+type AssignExpression struct {
+	Token  Token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) expressionNode()      {}
+
 type PrefixExpression struct {
 	Token    Token
 	Operator string
@@ -96,6 +319,22 @@ type LetStatement struct {
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) statementNode()       {}
 
+type FunctionDeclaration struct {
+	Token    Token
+	Function *FunctionLiteral
+}
+
+func (fd *FunctionDeclaration) TokenLiteral() string { return fd.Token.Literal }
+func (fd *FunctionDeclaration) statementNode()       {}
+
+type ClassDeclaration struct {
+	Token Token
+	Class *ClassLiteral
+}
+
+func (cd *ClassDeclaration) TokenLiteral() string { return cd.Token.Literal }
+func (cd *ClassDeclaration) statementNode()       {}
+
 type ReturnStatement struct {
 	Token       Token
 	ReturnValue Expression
@@ -136,3 +375,58 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+
+// ModuleSpecifier is one name in the braces of an import or export
+// declaration, Name as Alias, where Alias is Name when no alias is given.
+// Imports bind Alias to the export Name; exports export Name as Alias.
+type ModuleSpecifier struct {
+	Name  string
+	Alias string
+}
+
+// ImportDeclaration is import ... from "source". It binds Default to the
+// default export, Namespace to the namespace object and each specifier to
+// the named export; import "source" has none of them.
+type ImportDeclaration struct {
+	Token      Token
+	Source     string
+	Default    string
+	Namespace  string
+	Specifiers []*ModuleSpecifier
+}
+
+func (id *ImportDeclaration) TokenLiteral() string { return id.Token.Literal }
+func (id *ImportDeclaration) statementNode()       {}
+
+// ExportDeclaration is one of the forms of export: a declaration, export
+// default followed by an expression, a list of specifiers, which re-export
+// from Source when it is set, or export * from Source, which exports the
+// namespace object as Namespace when that is set.
+type ExportDeclaration struct {
+	Token       Token
+	Declaration Statement
+	Default     Expression
+	Specifiers  []*ModuleSpecifier
+	Source      string
+	All         bool
+	Namespace   string
+}
+
+func (ed *ExportDeclaration) TokenLiteral() string { return ed.Token.Literal }
+func (ed *ExportDeclaration) statementNode()       {}
+
+// ImportCall is a dynamic import(source).
+type ImportCall struct {
+	Token  Token
+	Source Expression
+}
+
+func (ic *ImportCall) TokenLiteral() string { return ic.Token.Literal }
+func (ic *ImportCall) expressionNode()      {}
+
+type ImportMeta struct {
+	Token Token
+}
+
+func (im *ImportMeta) TokenLiteral() string { return im.Token.Literal }
+func (im *ImportMeta) expressionNode()      {}
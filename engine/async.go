@@ -0,0 +1,96 @@
+package engine
+
+import "runtime"
+
+// asyncFunction is the state of a call of an async function, whose body
+// runs as a coroutine that suspends at each await.
+type asyncFunction struct {
+	body       *coroutine
+	capability *promiseCapability
+	// exception is what the body threw, if it completed by throwing.
+	exception *JSException
+}
+
+// awaiter identifies one await of an async function. Only the reactions
+// registered on the awaited promise refer to it, so once it has been
+// garbage collected the await can never complete.
+type awaiter struct {
+	async *asyncFunction
+}
+
+// startAsync implements calling an async function: it runs the body up to
+// its first await and returns a promise for its result.
+func (i *Interpreter) startAsync(fn Value, f *Function, this Value, args []Value) Value {
+	i.stopAbandonedCoroutines()
+
+	a := &asyncFunction{capability: i.newPromiseCapability()}
+	env := i.newFunctionEnvironment(fn, f, this, args, Undefined)
+	a.body = i.newCoroutine(func() Value {
+		result, exception := i.tryCatch(func() Value {
+			return i.evalFunctionBody(f, env)
+		})
+		a.exception = exception
+		return result
+	})
+	env.async = a.body
+
+	i.stepAsync(a, resumeNext, Undefined)
+	return a.capability.promise
+}
+
+// stepAsync resumes the body of an async function with the value the
+// awaited promise was fulfilled with or, for resumeThrow, the reason it was
+// rejected with. The body runs until its next await, which is resumed in
+// turn once the promise it awaits settles, or until it completes and
+// settles the async function's promise.
+func (i *Interpreter) stepAsync(a *asyncFunction, mode resumeMode, sent Value) {
+	body := a.body
+	body.mode, body.sent = mode, sent
+	body.resumptions++
+	body.frameBase = len(i.frames)
+	savedEnv := i.env
+	awaited, suspended := body.resume()
+	i.env = savedEnv
+
+	if !suspended {
+		if a.exception != nil {
+			i.applyFunction(a.capability.reject, Undefined, []Value{a.exception.Value})
+		} else {
+			i.applyFunction(a.capability.resolve, Undefined, []Value{body.result})
+		}
+		return
+	}
+
+	w := &awaiter{async: a}
+	onFulfilled := i.newNativeFunction("", 1, func(this Value, args []Value) Value {
+		i.stepAsync(w.async, resumeNext, argument(args, 0))
+		return Undefined
+	})
+	onRejected := i.newNativeFunction("", 1, func(this Value, args []Value) Value {
+		i.stepAsync(w.async, resumeThrow, argument(args, 0))
+		return Undefined
+	})
+	runtime.AddCleanup(w, i.queueAbandoned, abandonedCoroutine{body: body, resumptions: body.resumptions})
+	i.performPromiseThen(awaited, onFulfilled, onRejected, nil)
+}
+
+// currentAsync returns the body of the async function whose code is
+// running.
+func (i *Interpreter) currentAsync() *coroutine {
+	env := i.env.functionEnvironment()
+	if env == nil || env.async == nil {
+		i.throwError("SyntaxError", "await is only valid in async functions and the top level bodies of modules")
+	}
+	return env.async
+}
+
+// await implements await: it suspends the async function body until the
+// promise for val settles, then returns the value it was fulfilled with or
+// throws the reason it was rejected with.
+func (i *Interpreter) await(body *coroutine, val Value) Value {
+	mode, sent := i.suspend(body, i.promiseResolve(i.promiseConstructor, val))
+	if mode == resumeThrow {
+		panic(i.exception(sent))
+	}
+	return sent
+}
@@ -0,0 +1,314 @@
+package engine
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxBigIntBits bounds the size of the BigInts multiplication, shifts and
+// exponentiation may create, so a typo such as 1n << 100000000000n fails
+// instead of exhausting memory.
+const maxBigIntBits = 1 << 30
+
+// exponentiate implements ** for numbers, which differs from math.Pow
+// where the base is 1 or -1 and the exponent is NaN or infinite.
+func exponentiate(base, exponent float64) float64 {
+	if math.IsNaN(exponent) || (math.Abs(base) == 1 && math.IsInf(exponent, 0)) {
+		return math.NaN()
+	}
+	return math.Pow(base, exponent)
+}
+
+// bigIntOperation applies a binary operator of which at least one operand
+// is a BigInt. Arithmetic and bitwise operators require both operands to
+// be BigInts, while comparisons also accept numbers and strings. ok is
+// false for operators that treat BigInts like any other value, such as +
+// with a string operand.
+func (i *Interpreter) bigIntOperation(operator string, left, right Value) (result Value, ok bool) {
+	switch operator {
+	case "<", ">", "<=", ">=":
+		cmp, comparable := compareBigInt(left, right)
+		if !comparable {
+			return Value{Type: TypeBoolean, Data: false}, true
+		}
+		switch operator {
+		case "<":
+			return Value{Type: TypeBoolean, Data: cmp < 0}, true
+		case ">":
+			return Value{Type: TypeBoolean, Data: cmp > 0}, true
+		case "<=":
+			return Value{Type: TypeBoolean, Data: cmp <= 0}, true
+		}
+		return Value{Type: TypeBoolean, Data: cmp >= 0}, true
+	case "+":
+		if left.Type == TypeString || right.Type == TypeString {
+			return Undefined, false
+		}
+	case "-", "*", "/", "%", "**", "&", "|", "^", "<<", ">>", ">>>":
+	default:
+		return Undefined, false
+	}
+
+	if left.Type != TypeBigInt || right.Type != TypeBigInt {
+		i.throwError("TypeError", "Cannot mix BigInt and other types, use explicit conversions")
+	}
+	x, y := left.Data.(*big.Int), right.Data.(*big.Int)
+	z := new(big.Int)
+	switch operator {
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		bits := x.BitLen() + y.BitLen()
+		if bits > maxBigIntBits {
+			i.throwError("RangeError", "Maximum BigInt size exceeded")
+		}
+		i.allocate(bits / 8)
+		return NewBigInt(z.Mul(x, y)), true
+	case "/":
+		if y.Sign() == 0 {
+			i.throwError("RangeError", "Division by zero")
+		}
+		z.Quo(x, y)
+	case "%":
+		if y.Sign() == 0 {
+			i.throwError("RangeError", "Division by zero")
+		}
+		z.Rem(x, y)
+	case "**":
+		if y.Sign() < 0 {
+			i.throwError("RangeError", "Exponent must be non-negative")
+		}
+		if x.CmpAbs(big.NewInt(1)) > 0 {
+			// The result has at least BitLen-1 bits per unit of the
+			// exponent and at most BitLen.
+			if !y.IsInt64() || y.Int64() > maxBigIntBits/int64(x.BitLen()-1) {
+				i.throwError("RangeError", "Maximum BigInt size exceeded")
+			}
+			i.allocate(int(int64(x.BitLen()) * y.Int64() / 8))
+			return NewBigInt(z.Exp(x, y, nil)), true
+		}
+		z.Exp(x, y, nil)
+	case "&":
+		z.And(x, y)
+	case "|":
+		z.Or(x, y)
+	case "^":
+		z.Xor(x, y)
+	case "<<", ">>":
+		if operator == ">>" {
+			y = new(big.Int).Neg(y)
+		}
+		return NewBigInt(i.shiftBigInt(x, y)), true
+	case ">>>":
+		i.throwError("TypeError", "BigInts have no unsigned right shift, use >> instead")
+	}
+	i.allocate(len(z.Bits()) * 8)
+	return NewBigInt(z), true
+}
+
+// shiftBigInt shifts x left by n bits, or right when n is negative,
+// rounding towards negative infinity. It counts the result against the
+// memory limit before creating it.
+func (i *Interpreter) shiftBigInt(x *big.Int, n *big.Int) *big.Int {
+	if n.Sign() < 0 {
+		if !n.IsInt64() || -n.Int64() > int64(x.BitLen()) {
+			if x.Sign() < 0 {
+				return big.NewInt(-1)
+			}
+			return new(big.Int)
+		}
+		i.allocate((x.BitLen() - int(-n.Int64())) / 8)
+		return new(big.Int).Rsh(x, uint(-n.Int64()))
+	}
+	if x.Sign() == 0 {
+		return new(big.Int)
+	}
+	if !n.IsInt64() || n.Int64() > maxBigIntBits-int64(x.BitLen()) {
+		i.throwError("RangeError", "Maximum BigInt size exceeded")
+	}
+	i.allocate(int((int64(x.BitLen()) + n.Int64()) / 8))
+	return new(big.Int).Lsh(x, uint(n.Int64()))
+}
+
+// isLooselyComparableToBigInt reports whether == compares v with a BigInt
+// by its numeric value.
+func isLooselyComparableToBigInt(v Value) bool {
+	switch v.Type {
+	case TypeBigInt, TypeNumber, TypeString, TypeBoolean:
+		return true
+	}
+	return false
+}
+
+// compareBigInt compares two values of which one is a BigInt by their
+// mathematical values, converting strings with StringToBigInt. It is not
+// comparable when either is NaN or a string that is not an integer.
+func compareBigInt(left, right Value) (cmp int, comparable bool) {
+	if left.Type != TypeBigInt {
+		cmp, comparable = compareBigInt(right, left)
+		return -cmp, comparable
+	}
+	x := left.Data.(*big.Int)
+	switch right.Type {
+	case TypeBigInt:
+		return x.Cmp(right.Data.(*big.Int)), true
+	case TypeString:
+		y, ok := stringToBigInt(right.Data.(string))
+		if !ok {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	}
+	f := right.ToNumber()
+	switch {
+	case math.IsNaN(f):
+		return 0, false
+	case math.IsInf(f, 1):
+		return -1, true
+	case math.IsInf(f, -1):
+		return 1, true
+	}
+	return new(big.Float).SetInt(x).Cmp(big.NewFloat(f)), true
+}
+
+// stringToBigInt parses the integer a string holds, which may be written
+// in decimal with a sign or in hexadecimal, octal or binary with a 0x, 0o
+// or 0b prefix. Surrounding whitespace is ignored and an empty string is
+// zero.
+func stringToBigInt(s string) (*big.Int, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return new(big.Int), true
+	}
+	base := 10
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			s = s[2:]
+			if s[0] == '+' || s[0] == '-' {
+				return nil, false
+			}
+		}
+	}
+	if strings.ContainsRune(s, '_') {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, base)
+}
+
+// toBigInt implements ToBigInt, which converts booleans and strings but
+// not numbers, whose conversion is only explicit through BigInt().
+func (i *Interpreter) toBigInt(v Value) *big.Int {
+	v = i.toPrimitive(v, "number")
+	switch v.Type {
+	case TypeBigInt:
+		return v.Data.(*big.Int)
+	case TypeBoolean:
+		if v.ToBoolean() {
+			return big.NewInt(1)
+		}
+		return new(big.Int)
+	case TypeString:
+		x, ok := stringToBigInt(v.Data.(string))
+		if !ok {
+			i.throwError("SyntaxError", "Cannot convert %s to a BigInt", v.Data.(string))
+		}
+		return x
+	}
+	i.throwError("TypeError", "Cannot convert %s to a BigInt", v.ToString())
+	return nil
+}
+
+// numberToBigInt converts an integral number to a BigInt.
+func (i *Interpreter) numberToBigInt(f float64) *big.Int {
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Trunc(f) != f {
+		i.throwError("RangeError", "The number %s cannot be converted to a BigInt because it is not an integer", Value{Type: TypeNumber, Data: f}.ToString())
+	}
+	x, _ := big.NewFloat(f).Int(nil)
+	return x
+}
+
+// toBitCount converts the bits argument of BigInt.asIntN and asUintN,
+// which must be a non-negative safe integer.
+func (i *Interpreter) toBitCount(v Value) uint {
+	f := math.Trunc(v.ToNumber())
+	if math.IsNaN(f) {
+		f = 0
+	}
+	if f < 0 || f > maxBigIntBits {
+		i.throwError("RangeError", "Invalid value: not (convertible to) a safe integer")
+	}
+	return uint(f)
+}
+
+// thisBigInt returns the BigInt a BigInt.prototype method was called on.
+func (i *Interpreter) thisBigInt(this Value, method string) *big.Int {
+	return i.thisPrimitive(this, TypeBigInt, "BigInt.prototype."+method).Data.(*big.Int)
+}
+
+// setupBigInt defines the BigInt function, which converts values to
+// BigInts but is not a constructor.
+func (i *Interpreter) setupBigInt() {
+	bigint := i.newNativeFunction("BigInt", 1, func(this Value, args []Value) Value {
+		prim := i.toPrimitive(argument(args, 0), "number")
+		if prim.Type == TypeNumber {
+			return NewBigInt(i.numberToBigInt(prim.Data.(float64)))
+		}
+		return NewBigInt(i.toBigInt(prim))
+	})
+
+	// asUintN wraps a BigInt to the given number of bits and asIntN
+	// additionally reads the top bit as the sign, like two's complement.
+	i.defineMethod(bigint, "asUintN", 2, func(this Value, args []Value) Value {
+		bits := i.toBitCount(argument(args, 0))
+		x := i.toBigInt(argument(args, 1))
+		modulus := new(big.Int).Lsh(big.NewInt(1), bits)
+		return NewBigInt(new(big.Int).Mod(x, modulus))
+	})
+	i.defineMethod(bigint, "asIntN", 2, func(this Value, args []Value) Value {
+		bits := i.toBitCount(argument(args, 0))
+		x := i.toBigInt(argument(args, 1))
+		if bits == 0 {
+			return NewBigInt(new(big.Int))
+		}
+		modulus := new(big.Int).Lsh(big.NewInt(1), bits)
+		z := new(big.Int).Mod(x, modulus)
+		if z.Bit(int(bits)-1) == 1 {
+			z.Sub(z, modulus)
+		}
+		return NewBigInt(z)
+	})
+
+	i.bigintPrototype = i.newObject()
+	bigint.Object.Properties["prototype"] = i.bigintPrototype
+	i.bigintPrototype.Object.Properties["constructor"] = bigint
+	toString := func(this Value, args []Value) Value {
+		x := i.thisBigInt(this, "toString")
+		radix := 10
+		if r := argument(args, 0); r.Type != TypeUndefined {
+			radix = int(r.ToNumber())
+			if radix < 2 || radix > 36 {
+				i.throwError("RangeError", "toString() radix must be between 2 and 36")
+			}
+		}
+		return Value{Type: TypeString, Data: x.Text(radix)}
+	}
+	i.defineMethod(i.bigintPrototype, "toString", 0, toString)
+	i.defineMethod(i.bigintPrototype, "toLocaleString", 0, toString)
+	i.defineMethod(i.bigintPrototype, "valueOf", 0, func(this Value, args []Value) Value {
+		return NewBigInt(i.thisBigInt(this, "valueOf"))
+	})
+	setSymbolSlot(i.bigintPrototype, symbolToStringTag, Value{Type: TypeString, Data: "BigInt"})
+
+	i.env.Set("BigInt", bigint)
+}
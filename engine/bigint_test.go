@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBigIntSizeLimit(t *testing.T) {
+	for _, src := range []string{
+		`let a = 1n << 1000000000n; a * a`,
+		`4n ** 9223372036854775807n`,
+		`3n ** 99999999999n`,
+		`1n << 9223372036854775807n`,
+	} {
+		_, err := NewInterpreter().Eval(src)
+		if err == nil || !strings.Contains(err.Error(), "RangeError: Maximum BigInt size exceeded") {
+			t.Errorf("%s: err = %v, want a RangeError", src, err)
+		}
+	}
+	for src, want := range map[string]string{
+		`(1n << 100n) * (1n << 100n) == 1n << 200n`: "true",
+		`(-2n) ** 3n`:                 "-8",
+		`1n ** 99999999999999999999n`: "1",
+		`-(2n ** 64n) >> 3n`:          "-2305843009213693952",
+	} {
+		v, err := NewInterpreter().Eval(src)
+		if err != nil || v.ToString() != want {
+			t.Errorf("%s = %v, %v; want %s", src, v.ToString(), err, want)
+		}
+	}
+}
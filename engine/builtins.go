@@ -0,0 +1,216 @@
+package engine
+
+import "math"
+
+// setupBuiltins creates the intrinsic prototypes and the global
+// constructors that expose them.
+func (i *Interpreter) setupBuiltins() {
+	i.objectPrototype = i.newObject()
+	i.objectPrototype.Object.Prototype = Value{Type: TypeNull}
+	i.defineMethod(i.objectPrototype, "toString", 0, i.objectToString)
+	i.defineMethod(i.objectPrototype, "valueOf", 0, func(this Value, args []Value) Value {
+		return i.toObject(this)
+	})
+
+	i.functionPrototype = i.newObject()
+	i.defineMethod(i.functionPrototype, "call", 1, i.functionCall)
+	i.defineMethod(i.functionPrototype, "apply", 2, i.functionApply)
+	i.defineMethod(i.functionPrototype, "bind", 1, i.functionBind)
+	i.defineMethod(i.functionPrototype, "toString", 0, i.functionToString)
+
+	i.setupPrimitivePrototypes()
+	i.setupArray()
+	i.setupErrors()
+	i.setupSymbol()
+	i.setupBigInt()
+	i.setupRegExp()
+	i.setupGeneratorPrototype()
+	i.setupPromise()
+	i.setupProxy()
+	i.setupReflect()
+
+	object := i.newNativeFunction("Object", 1, func(this Value, args []Value) Value {
+		return i.objectConstructor(args)
+	})
+	object.Data.(*NativeFunction).Construct = func(args []Value, newTarget Value) Value {
+		if !sameObject(newTarget, object) {
+			return i.objectFromConstructor(newTarget)
+		}
+		return i.objectConstructor(args)
+	}
+	object.Object.Properties["prototype"] = i.objectPrototype
+	i.objectPrototype.Object.Properties["constructor"] = object
+	i.defineMethod(object, "getPrototypeOf", 1, i.objectGetPrototypeOf)
+	i.defineMethod(object, "setPrototypeOf", 2, i.objectSetPrototypeOf)
+	i.defineMethod(object, "defineProperty", 3, i.objectDefineProperty)
+	i.defineMethod(object, "defineProperties", 2, i.objectDefineProperties)
+	i.defineMethod(object, "getOwnPropertyDescriptor", 2, i.objectGetOwnPropertyDescriptor)
+	i.defineMethod(object, "getOwnPropertyDescriptors", 1, i.objectGetOwnPropertyDescriptors)
+	i.defineMethod(object, "preventExtensions", 1, func(this Value, args []Value) Value {
+		obj := argument(args, 0)
+		if isObject(obj) {
+			i.preventExtensionsOrThrow(obj)
+		}
+		return obj
+	})
+	i.defineMethod(object, "isExtensible", 1, func(this Value, args []Value) Value {
+		obj := argument(args, 0)
+		return Value{Type: TypeBoolean, Data: isObject(obj) && i.isExtensible(obj)}
+	})
+	for _, level := range []struct {
+		set, test string
+		frozen    bool
+	}{{"seal", "isSealed", false}, {"freeze", "isFrozen", true}} {
+		frozen := level.frozen
+		i.defineMethod(object, level.set, 1, func(this Value, args []Value) Value {
+			obj := argument(args, 0)
+			if isObject(obj) {
+				i.setIntegrityLevel(obj, frozen)
+			}
+			return obj
+		})
+		i.defineMethod(object, level.test, 1, func(this Value, args []Value) Value {
+			obj := argument(args, 0)
+			result := !isObject(obj) || i.testIntegrityLevel(obj, frozen)
+			return Value{Type: TypeBoolean, Data: result}
+		})
+	}
+	i.defineMethod(object, "is", 2, func(this Value, args []Value) Value {
+		return Value{Type: TypeBoolean, Data: sameValue(argument(args, 0), argument(args, 1))}
+	})
+	i.env.Set("Object", object)
+
+	i.setupNumberGlobals()
+}
+
+// setupNumberGlobals defines the global NaN and Infinity, which cannot be
+// changed, and the functions isNaN and isFinite, which convert their
+// argument to a number.
+func (i *Interpreter) setupNumberGlobals() {
+	for name, f := range map[string]float64{"NaN": math.NaN(), "Infinity": math.Inf(1)} {
+		i.env.Set(name, Value{Type: TypeNumber, Data: f})
+		setAttributes(i.global, stringKey(name), nonWritable|nonEnumerable|nonConfigurable)
+	}
+	i.defineMethod(i.global, "isNaN", 1, func(this Value, args []Value) Value {
+		return Value{Type: TypeBoolean, Data: math.IsNaN(i.toNumber(argument(args, 0)))}
+	})
+	i.defineMethod(i.global, "isFinite", 1, func(this Value, args []Value) Value {
+		f := i.toNumber(argument(args, 0))
+		return Value{Type: TypeBoolean, Data: !math.IsNaN(f) && !math.IsInf(f, 0)}
+	})
+}
+
+func (i *Interpreter) newNativeFunction(name string, length int, fn func(this Value, args []Value) Value) Value {
+	return i.newFunctionObject(&NativeFunction{Name: name, Length: length, Fn: fn})
+}
+
+// defineMethod defines a built-in method, which like the methods of
+// classes is not enumerable.
+func (i *Interpreter) defineMethod(obj Value, name string, length int, fn func(this Value, args []Value) Value) {
+	obj.Object.Properties[name] = i.newNativeFunction(name, length, fn)
+	setAttributes(obj, stringKey(name), nonEnumerable)
+}
+
+// argument returns the argument at index, or undefined when the call
+// passed fewer arguments.
+func argument(args []Value, index int) Value {
+	if index < len(args) {
+		return args[index]
+	}
+	return Undefined
+}
+
+// objectConstructor implements both Object(value) and new Object(value).
+func (i *Interpreter) objectConstructor(args []Value) Value {
+	if len(args) > 0 && (args[0].Type == TypeObject || args[0].Type == TypeFunction) {
+		return args[0]
+	}
+	return i.newObject()
+}
+
+// objectGetPrototypeOf implements Object.getPrototypeOf.
+func (i *Interpreter) objectGetPrototypeOf(this Value, args []Value) Value {
+	if len(args) == 0 || args[0].Type == TypeUndefined || args[0].Type == TypeNull {
+		i.throwError("TypeError", "Cannot convert undefined or null to object")
+	}
+	return i.prototypeOf(args[0])
+}
+
+// objectSetPrototypeOf implements Object.setPrototypeOf, refusing to
+// create a cycle in the prototype chain.
+func (i *Interpreter) objectSetPrototypeOf(this Value, args []Value) Value {
+	if len(args) < 2 {
+		i.throwError("TypeError", "Object.setPrototypeOf called on null or undefined")
+	}
+	obj, proto := args[0], args[1]
+	if obj.Type == TypeUndefined || obj.Type == TypeNull {
+		i.throwError("TypeError", "Object.setPrototypeOf called on null or undefined")
+	}
+	if proto.Type != TypeObject && proto.Type != TypeFunction && proto.Type != TypeNull {
+		i.throwError("TypeError", "Object prototype may only be an Object or null: %s", proto.ToString())
+	}
+	if !isObject(obj) || i.setPrototypeOf(obj, proto) {
+		return obj
+	}
+	if _, ok := obj.Data.(*Proxy); ok {
+		i.throwError("TypeError", "'setPrototypeOf' on proxy: trap returned falsish")
+	}
+	if !i.isExtensible(obj) {
+		i.throwError("TypeError", "%s is not extensible", i.describeObject(obj))
+	}
+	i.throwError("TypeError", "Cyclic __proto__ value")
+	return obj
+}
+
+// functionCall implements Function.prototype.call.
+func (i *Interpreter) functionCall(this Value, args []Value) Value {
+	thisArg := Undefined
+	if len(args) > 0 {
+		thisArg = args[0]
+		args = args[1:]
+	}
+	return i.applyFunction(this, thisArg, args)
+}
+
+// functionApply implements Function.prototype.apply.
+func (i *Interpreter) functionApply(this Value, args []Value) Value {
+	thisArg := Undefined
+	if len(args) > 0 {
+		thisArg = args[0]
+	}
+	var callArgs []Value
+	if len(args) > 1 && !isNullish(args[1]) {
+		callArgs = i.listFromArrayLike(args[1])
+	}
+	return i.applyFunction(this, thisArg, callArgs)
+}
+
+// functionBind implements Function.prototype.bind.
+func (i *Interpreter) functionBind(this Value, args []Value) Value {
+	if this.Type != TypeFunction {
+		i.throwError("TypeError", "Bind must be called on a function")
+	}
+	bound := &BoundFunction{Target: this, BoundThis: Undefined}
+	if len(args) > 0 {
+		bound.BoundThis = args[0]
+		bound.BoundArgs = append([]Value{}, args[1:]...)
+	}
+	return i.newFunctionObject(bound)
+}
+
+// functionToString implements Function.prototype.toString, which returns
+// the source code of functions defined by scripts and a stand-in for the
+// body of others.
+func (i *Interpreter) functionToString(this Value, args []Value) Value {
+	if this.Type != TypeFunction {
+		i.throwError("TypeError", "Function.prototype.toString requires that 'this' be a Function")
+	}
+	if f, ok := this.Data.(*Function); ok && f.text != "" {
+		return Value{Type: TypeString, Data: f.text}
+	}
+	name := ""
+	if _, bound := this.Data.(*BoundFunction); !bound {
+		name = this.FunctionName()
+	}
+	return Value{Type: TypeString, Data: "function " + name + "() { [native code] }"}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import "testing"
+
+func TestFunctionCallApplyAndBind(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`function g(a, b) { return a + b; } g.apply(null, [1, 2])`, "3"},
+		{`function g(a, b) { return a + b; } g.apply(null, {length: 2, 0: 3, 1: 4})`, "7"},
+		{`function g(a, b) { return a + b; } g.apply(null, {get length() { return 2; }, 0: "a", 1: "b"})`, "ab"},
+		{`function g(a, b) { return a + b; } g.apply(null, new Proxy([1, 2], {}))`, "3"},
+		{`function g(a) { return a; } g.apply(null, {length: {valueOf() { return 1; }}, 0: 9})`, "9"},
+		{`function g() { return 1; } g.apply(null) + g.apply(null, undefined) + g.apply(null, null)`, "3"},
+		{`function g(a) { return a; } g.apply(null, {})`, "undefined"},
+		{`function g(a) { return a; } g.apply(null, {length: -1})`, "undefined"},
+		{`function g(a) { return a; } g.apply(null, {length: 0 / 0})`, "undefined"},
+		{`function g(a) { return a; } g.apply(null, {length: "x"})`, "undefined"},
+		{`function g() {} g.apply(null, 5)`, "Uncaught TypeError: CreateListFromArrayLike called on non-object"},
+		{`function g() {} g.apply(null, {length: 4294967295})`, "Uncaught RangeError: Invalid array length"},
+		{`let bind = function () {}.bind; bind.call(5)`, "Uncaught TypeError: Bind must be called on a function"},
+		{`function f() { return this.v; } f.bind({v: 4})()`, "4"},
+
+		// Sloppy mode functions see primitives as this wrapped in objects.
+		{`function f() { return typeof this; } f.call(5) + f.call("s") + f.call(true)`, "objectobjectobject"},
+		{`function f() { return this + 1; } f.call(5)`, "6"},
+		{`function f() { return this; } Object.prototype.toString.call(f.call("s"))`, "[object String]"},
+		{`function f() { return this; } f.call(undefined) === f.call(null)`, "true"},
+		{`"use strict"; function f() { return typeof this; } f.call(5)`, "number"},
+		{`(5).toString() + "a".valueOf() + true.toString()`, "5atrue"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestArrayConstructor(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`Array(3).length`, "3"},
+		{`new Array(1, 2)`, "1,2"},
+		{`new Array("3")`, "3"},
+		{`Array.isArray([]) + "," + Array.isArray({}) + "," + Array.isArray(new Array(2))`, "true,false,true"},
+		{`Object.getPrototypeOf([]) === Array.prototype`, "true"},
+		{`Array.prototype.constructor === Array`, "true"},
+		{`Object.getPrototypeOf(Array.prototype) === Object.prototype`, "true"},
+		{`class List extends Array {} Object.getPrototypeOf(new List()) === List.prototype`, "true"},
+		{`Array(-1)`, "Uncaught RangeError: Invalid array length"},
+		{`new Array(1.5)`, "Uncaught RangeError: Invalid array length"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
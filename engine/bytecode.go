@@ -0,0 +1,184 @@
+package engine
+
+// opcode is the operation of a bytecode instruction. The comment on each
+// describes its operand and its effect on the operand stack, whose top is
+// on the right.
+type opcode uint8
+
+const (
+	// opConstant pushes constants[arg].
+	opConstant opcode = iota
+	// opUndefined pushes undefined.
+	opUndefined
+	// opPop discards the top of the stack.
+	opPop
+	// opDup pushes the top of the stack again.
+	opDup
+
+	// opGetLocal pushes the local in slot arg.
+	opGetLocal
+	// opSetLocal assigns the top of the stack, which it leaves in place,
+	// to the local in slot arg.
+	opSetLocal
+	// opInitLocal pops the value a declaration binds to the local in slot
+	// arg.
+	opInitLocal
+	// opGetName pushes the binding of names[arg], looked up in the scope
+	// chain.
+	opGetName
+	// opSetName assigns the top of the stack, which it leaves in place, to
+	// the binding of names[arg].
+	opSetName
+	// opDeclareName pops the value a declaration binds to names[arg] in
+	// the current scope.
+	opDeclareName
+	// opThis pushes this.
+	opThis
+
+	// opGetMember replaces an object with its property members[arg].key.
+	opGetMember
+	// opGetIndex replaces an object and a key with the property it names.
+	opGetIndex
+	// opSetMember pops an object and assigns the value under it to its
+	// property members[arg].key, leaving the value.
+	opSetMember
+	// opSetIndex pops an object and a key and assigns the value under
+	// them to the property they name, leaving the value.
+	opSetIndex
+	// opCall replaces this, a function and calls[arg].argc arguments with
+	// the result of calling the function.
+	opCall
+	// opNew replaces a constructor and calls[arg].argc arguments with the
+	// object constructed.
+	opNew
+
+	// opArray replaces arg elements with an array of them.
+	opArray
+	// opObject pushes an object for a literal with arg properties.
+	opObject
+	// opPropertyKey converts the top of the stack to a property key.
+	opPropertyKey
+	// opDefineField pops a value and defines it on the object under it as
+	// the property constants[arg].
+	opDefineField
+	// opDefineComputed pops a key and a value and defines the property on
+	// the object under them.
+	opDefineComputed
+	// opDefineMethod defines the method or accessor methods[arg] on the
+	// object on the stack, popping its key first when it is computed.
+	opDefineMethod
+
+	// opFunction pushes a function created from functions[arg].
+	opFunction
+	// opClass replaces the superclass, when classes[arg] has one, and the
+	// keys of its computed members with the class it defines.
+	opClass
+
+	// opEval pushes the value of expressions[arg], which the tree-walker
+	// evaluates.
+	opEval
+	// opExec runs statements[arg] with the tree-walker.
+	opExec
+
+	// opJump continues at instruction arg.
+	opJump
+	// opJumpIfFalse pops a value and continues at instruction arg if it is
+	// falsy.
+	opJumpIfFalse
+	// opReturn returns the top of the stack.
+	opReturn
+
+	// opTypeof replaces a value with its type's name.
+	opTypeof
+	// opPrefix replaces the operand of the unary operator operators[arg]
+	// with the result.
+	opPrefix
+
+	// The binary operators replace their operands with the result of
+	// infixes[arg].operator. Those below opInfix take a shortcut for the
+	// operands, such as two numbers, that need no conversion.
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opRemainder
+	opLess
+	opGreater
+	opLessEqual
+	opGreaterEqual
+	opStrictEqual
+	opStrictNotEqual
+	opEqual
+	opNotEqual
+	opInfix
+)
+
+// instruction is an opcode in the low 8 bits and an operand in the rest.
+type instruction uint32
+
+// maxOperand bounds the operands, and so the sizes of the tables of a
+// bytecode.
+const maxOperand = 1<<24 - 1
+
+func makeInstruction(op opcode, arg int) instruction {
+	return instruction(uint32(arg)<<8 | uint32(op))
+}
+
+func (in instruction) op() opcode { return opcode(in & 0xff) }
+func (in instruction) arg() int   { return int(in >> 8) }
+
+// callSite is a call or new expression: the number of arguments it
+// passes, the position it is reported at and, for calls, the callee as
+// error messages describe it.
+type callSite struct {
+	argc   int
+	offset int
+	callee string
+}
+
+// infixSite is a binary operator and the position it is reported at.
+type infixSite struct {
+	operator string
+	offset   int
+}
+
+// memberSite is a property access: the key, unless it is computed, and
+// the position it is reported at.
+type memberSite struct {
+	key    Value
+	offset int
+}
+
+// bytecode is the compiled form of a script's top-level code or of a
+// function body. It refers to nothing that belongs to an interpreter, so
+// it may be shared by the interpreters that run a program.
+type bytecode struct {
+	code []instruction
+
+	constants   []Value
+	names       []string
+	operators   []string
+	infixes     []infixSite
+	calls       []callSite
+	members     []memberSite
+	functions   []*FunctionLiteral
+	classes     []*ClassLiteral
+	methods     []*ObjectProperty
+	expressions []Expression
+	statements  []Statement
+
+	// stackSize is the most values the operand stack holds.
+	stackSize int
+
+	// locals names the slots of the function's locals that no nested
+	// function or code the tree-walker evaluates refers to, which are
+	// kept out of the scope's bindings. params holds the slot of each
+	// parameter, or -1 for a parameter bound in the scope.
+	locals []string
+	params []int
+
+	// scopeless is set for a function body that needs no scope of its
+	// own: it keeps every local in a slot and leaves nothing to the
+	// tree-walker, so its calls can share one scope.
+	scopeless bool
+}
@@ -0,0 +1,491 @@
+package engine
+
+type PrivateNameKind int
+
+const (
+	PrivateField PrivateNameKind = iota
+	PrivateMethod
+	PrivateAccessor
+)
+
+// PrivateName identifies a #name declared in a class body. Every
+// evaluation of a class creates new PrivateNames, so two classes declaring
+// the same #name never see each other's elements.
+type PrivateName struct {
+	Description string
+	Kind        PrivateNameKind
+}
+
+// classElement is a field, private method or static block of a class.
+// Instance elements are installed by the constructor on every object it
+// constructs; static ones are installed on the class when it is defined.
+type classElement struct {
+	key     Value
+	private *PrivateName
+	// member declares a field, whose initializer it holds unless the
+	// field has none, or a static block.
+	member *ClassMember
+	// method is the function or accessor of a private method.
+	method Value
+}
+
+// evalClass evaluates a class literal: its superclass and then the keys of
+// its computed members, in the scope enclosing the class, before defining
+// the class.
+func (i *Interpreter) evalClass(class *ClassLiteral) Value {
+	superclass := Undefined
+	if class.SuperClass != nil {
+		superclass = i.evalExpression(class.SuperClass)
+	}
+	var keys []Value
+	for _, member := range class.Members {
+		if member.ComputedKey != nil {
+			keys = append(keys, i.toPropertyKey(i.evalExpression(member.ComputedKey)))
+		}
+	}
+	return i.defineClass(class, superclass, keys)
+}
+
+// defineClass defines the class of a class literal, given its superclass,
+// when it has one, and the keys of its computed members in order.
+func (i *Interpreter) defineClass(class *ClassLiteral, superclass Value, keys []Value) Value {
+	i.allocate(len(class.Members) * propertySize)
+	classEnv := ExtendEnvironment(i.env)
+	classEnv.privateNames = make(map[string]*PrivateName)
+	for _, member := range class.Members {
+		if !member.Private {
+			continue
+		}
+		kind := PrivateField
+		switch member.Kind {
+		case ClassMethod:
+			kind = PrivateMethod
+		case ClassGetter, ClassSetter:
+			kind = PrivateAccessor
+		}
+		if _, ok := classEnv.privateNames[member.Key]; !ok {
+			classEnv.privateNames[member.Key] = &PrivateName{Description: member.Key, Kind: kind}
+		}
+	}
+
+	savedEnv := i.env
+	i.env = classEnv
+	defer func() { i.env = savedEnv }()
+
+	protoParent := i.objectPrototype
+	constructorParent := i.functionPrototype
+	if class.SuperClass != nil {
+		switch {
+		case superclass.Type == TypeNull:
+			protoParent = Value{Type: TypeNull}
+		case !isConstructor(superclass):
+			i.throwError("TypeError", "Class extends value %s is not a constructor or null", superclass.ToString())
+		default:
+			protoParent = i.getProperty(superclass, "prototype")
+			if protoParent.Type != TypeObject && protoParent.Type != TypeFunction && protoParent.Type != TypeNull {
+				i.throwError("TypeError", "Class extends value does not have valid prototype property %s", protoParent.ToString())
+			}
+			constructorParent = superclass
+		}
+	}
+
+	proto := i.newObject()
+	proto.Object.Prototype = protoParent
+
+	f := &Function{
+		Name:       class.Name,
+		Env:        classEnv,
+		Strict:     true,
+		Kind:       ClassConstructor,
+		HomeObject: proto,
+
+		interpreter: i,
+		source:      i.currentSource(),
+		text:        class.text,
+	}
+	if class.SuperClass != nil {
+		f.Kind = DerivedConstructor
+	}
+	for _, member := range class.Members {
+		if member.Kind == ClassMethod && !member.Static && !member.Private && member.Key == "constructor" {
+			f.Parameters = member.Function.Parameters
+			f.Body = member.Function.Body
+			f.literal = member.Function
+		}
+	}
+	if f.Body == nil && f.Kind == ClassConstructor {
+		f.Body = &BlockStatement{}
+	}
+
+	constructor := i.newFunctionObject(f)
+	constructor.Object.Prototype = constructorParent
+	constructor.Object.Properties["prototype"] = proto
+	proto.Object.Properties["constructor"] = constructor
+	if class.Name != "" {
+		classEnv.Set(class.Name, constructor)
+	}
+
+	var statics []*classElement
+	privateAccessors := make(map[*PrivateName]*Accessor)
+	for _, member := range class.Members {
+		home := proto
+		if member.Static {
+			home = constructor
+		}
+		key := stringKey(member.Key)
+		if member.ComputedKey != nil {
+			key, keys = keys[0], keys[1:]
+		}
+
+		switch member.Kind {
+		case ClassStaticBlock:
+			statics = append(statics, &classElement{member: member})
+		case ClassField:
+			element := &classElement{key: key, member: member}
+			if member.Private {
+				element.private = classEnv.privateNames[member.Key]
+			}
+			if member.Static {
+				statics = append(statics, element)
+			} else {
+				f.fields = append(f.fields, element)
+			}
+		default:
+			if member.ComputedKey == nil && member.Key == "constructor" && !member.Static && !member.Private {
+				continue
+			}
+			method := i.newMethod(member, key, home)
+			if !member.Private {
+				i.defineMethodProperty(home, member, key, method)
+				continue
+			}
+
+			name := classEnv.privateNames[member.Key]
+			element := &classElement{key: key, private: name, method: method}
+			if member.Kind != ClassMethod {
+				accessor, ok := privateAccessors[name]
+				if !ok {
+					accessor = &Accessor{}
+					privateAccessors[name] = accessor
+				}
+				if member.Kind == ClassGetter {
+					accessor.Get = method
+				} else {
+					accessor.Set = method
+				}
+				if ok {
+					continue
+				}
+				element.method = Value{Type: TypeAccessor, Data: accessor}
+			}
+			if member.Static {
+				i.addPrivateElement(constructor, name, element.method)
+			} else {
+				f.privateMethods = append(f.privateMethods, element)
+			}
+		}
+	}
+
+	for _, element := range statics {
+		if element.member.Kind == ClassStaticBlock {
+			i.evalClassCode(element.member, constructor, constructor, classEnv)
+			continue
+		}
+		i.defineField(constructor, constructor, classEnv, element)
+	}
+
+	return constructor
+}
+
+// newMethod creates the function object for a class method or accessor
+// defined under key.
+func (i *Interpreter) newMethod(member *ClassMember, key Value, home Value) Value {
+	name := functionNameForKey(key)
+	switch member.Kind {
+	case ClassGetter:
+		name = "get " + name
+	case ClassSetter:
+		name = "set " + name
+	}
+	return i.newMethodFunction(member.Function, name, true, home)
+}
+
+// newMethodFunction creates the function object for a method or accessor
+// of a class or an object literal, which is not a constructor and whose
+// super refers to the prototype of home. Class code is always strict.
+func (i *Interpreter) newMethodFunction(lit *FunctionLiteral, name string, strict bool, home Value) Value {
+	method := i.newFunctionObject(&Function{
+		Name:       name,
+		Parameters: lit.Parameters,
+		Body:       lit.Body,
+		Env:        i.env,
+		Strict:     strict || lit.Strict,
+		Kind:       MethodFunction,
+		Generator:  lit.Generator,
+		Async:      lit.Async,
+		HomeObject: home,
+
+		interpreter: i,
+		source:      i.currentSource(),
+		literal:     lit,
+		text:        lit.text,
+	})
+	if lit.Generator {
+		method.Object.Properties["prototype"] = i.newGeneratorFunctionPrototype()
+	}
+	return method
+}
+
+// defineObjectMethod defines a method or accessor of an object literal on
+// obj under key. Unlike those of classes, they are enumerable.
+func (i *Interpreter) defineObjectMethod(obj Value, prop *ObjectProperty, key Value) {
+	name := functionNameForKey(key)
+	switch prop.Kind {
+	case PropertyGetter:
+		name = "get " + name
+	case PropertySetter:
+		name = "set " + name
+	}
+	method := i.newMethodFunction(prop.Value.(*FunctionLiteral), name, false, obj)
+	if prop.Kind == PropertyMethod {
+		setOwnMember(obj, key, method)
+		return
+	}
+	accessor := &Accessor{}
+	if existing, ok := ownSlot(obj, key); ok && existing.Type == TypeAccessor {
+		accessor = existing.Data.(*Accessor)
+	}
+	if prop.Kind == PropertyGetter {
+		accessor.Get = method
+	} else {
+		accessor.Set = method
+	}
+	setOwnMember(obj, key, Value{Type: TypeAccessor, Data: accessor})
+}
+
+// defineMethodProperty installs a public method or accessor on the class
+// prototype or, for static members, on the class itself. A getter and a
+// setter of the same name share one accessor property.
+func (i *Interpreter) defineMethodProperty(home Value, member *ClassMember, key Value, method Value) {
+	setAttributes(home, key, nonEnumerable)
+	if member.Kind == ClassMethod {
+		setOwnMember(home, key, method)
+		return
+	}
+	accessor := &Accessor{}
+	if existing, ok := ownSlot(home, key); ok && existing.Type == TypeAccessor {
+		accessor = existing.Data.(*Accessor)
+	}
+	if member.Kind == ClassGetter {
+		accessor.Get = method
+	} else {
+		accessor.Set = method
+	}
+	setOwnMember(home, key, Value{Type: TypeAccessor, Data: accessor})
+}
+
+// initializeInstanceElements installs the private methods and fields of
+// the class whose constructor is constructor on a newly constructed obj.
+func (i *Interpreter) initializeInstanceElements(obj Value, constructor Value) {
+	f := constructor.Data.(*Function)
+	for _, element := range f.privateMethods {
+		i.addPrivateElement(obj, element.private, element.method)
+	}
+	for _, element := range f.fields {
+		i.defineField(obj, f.HomeObject, f.Env, element)
+	}
+}
+
+// defineField evaluates a field initializer with obj as this and defines
+// the resulting field on obj.
+func (i *Interpreter) defineField(obj Value, home Value, classEnv *Environment, element *classElement) {
+	val := Undefined
+	if element.member.Value != nil {
+		val = i.evalClassCode(element.member, obj, home, classEnv)
+		nameFunction(val, functionNameForKey(element.key))
+	}
+
+	if element.private != nil {
+		i.addPrivateElement(obj, element.private, val)
+		return
+	}
+	i.definePropertyOrThrow(obj, element.key, &propertyDescriptor{
+		value: val, writable: true, enumerable: true, configurable: true,
+		hasValue: true, hasWritable: true, hasEnumerable: true, hasConfigurable: true,
+	})
+}
+
+// evalClassCode evaluates a field initializer, returning its value, or
+// runs a static block, in a scope of its own nested in the class scope
+// with this bound to obj.
+func (i *Interpreter) evalClassCode(member *ClassMember, obj Value, home Value, classEnv *Environment) Value {
+	env := ExtendEnvironment(classEnv)
+	env.hasThis = true
+	env.strict = true
+	env.this = obj
+	env.homeObject = home
+	savedEnv := i.env
+	i.env = env
+	val := Undefined
+	switch code := i.memberCode(member); {
+	case code != nil:
+		env.bindSlots(code)
+		val = i.run(code, env.slots)
+	case member.Kind == ClassStaticBlock:
+		i.evalBlockStatement(member.Body)
+	default:
+		val = i.evalExpression(member.Value)
+	}
+	i.env = savedEnv
+	return val
+}
+
+// constructDerived runs the constructor of a derived class. Its this is
+// bound by the super() call, which must happen before the constructor
+// finishes unless it returns an object of its own.
+func (i *Interpreter) constructDerived(constructor Value, f *Function, args []Value, newTarget Value) Value {
+	env := i.newFunctionEnvironment(constructor, f, Undefined, args, newTarget)
+	env.thisUninitialized = true
+
+	// A derived class without a constructor passes its arguments on.
+	if f.Body == nil {
+		return i.superCall(env, args)
+	}
+
+	result := i.evalFunctionBody(f, env)
+	if result.Type == TypeObject || result.Type == TypeFunction {
+		return result
+	}
+	if result.Type != TypeUndefined {
+		i.throwError("TypeError", "Derived constructors may only return object or undefined")
+	}
+	if env.thisUninitialized {
+		i.throwError("ReferenceError", "Must call super constructor in derived class before accessing 'this' or returning from derived constructor")
+	}
+	return env.this
+}
+
+// superCall implements super(...args) in the constructor whose scope is
+// env: it constructs the parent class and binds the result as this.
+func (i *Interpreter) superCall(env *Environment, args []Value) Value {
+	f, ok := env.callee.Data.(*Function)
+	if !ok || f.Kind != DerivedConstructor {
+		i.throwError("SyntaxError", "'super' keyword unexpected here")
+	}
+
+	parent := i.prototypeOf(env.callee)
+	if !isConstructor(parent) {
+		i.throwError("TypeError", "Super constructor %s of anonymous class is not a constructor", parent.ToString())
+	}
+	result := i.construct(parent, args, env.newTarget)
+
+	if !env.thisUninitialized {
+		i.throwError("ReferenceError", "Super constructor may only be called once")
+	}
+	env.this = result
+	env.thisUninitialized = false
+	i.initializeInstanceElements(result, env.callee)
+	return result
+}
+
+// superBase returns the object super property lookups start at: the
+// prototype of the current method's home object.
+func (i *Interpreter) superBase() Value {
+	env := i.env.thisEnvironment()
+	if env == nil || env.homeObject.Type == TypeUndefined {
+		i.throwError("SyntaxError", "'super' keyword unexpected here")
+	}
+	return i.prototypeOf(env.homeObject)
+}
+
+// resolveThis returns the current this binding.
+func (i *Interpreter) resolveThis() Value {
+	env := i.env.thisEnvironment()
+	if env == nil {
+		return Undefined
+	}
+	if env.thisUninitialized {
+		i.throwError("ReferenceError", "Must call super constructor in derived class before accessing 'this' or returning from derived constructor")
+	}
+	return env.this
+}
+
+// lookupPrivateName resolves a #name against the enclosing class bodies.
+func (i *Interpreter) lookupPrivateName(name string) *PrivateName {
+	for env := i.env; env != nil; env = env.outer {
+		if pn, ok := env.privateNames[name]; ok {
+			return pn
+		}
+	}
+	i.throwError("SyntaxError", "Private field '%s' must be declared in an enclosing class", name)
+	return nil
+}
+
+// privateElements returns the private elements of obj, if any.
+func (i *Interpreter) privateElements(obj Value) map[*PrivateName]Value {
+	if obj.Object == nil {
+		return nil
+	}
+	return obj.Object.private
+}
+
+func (i *Interpreter) addPrivateElement(obj Value, name *PrivateName, val Value) {
+	if _, ok := i.privateElements(obj)[name]; ok {
+		i.throwError("TypeError", "Cannot initialize %s twice on the same object", name.Description)
+	}
+	if obj.Object.private == nil {
+		obj.Object.private = make(map[*PrivateName]Value)
+	}
+	obj.Object.private[name] = val
+}
+
+func (i *Interpreter) privateGet(obj Value, name *PrivateName) Value {
+	val, ok := i.privateElement(obj, name, "read")
+	if !ok {
+		return Undefined
+	}
+	if name.Kind == PrivateAccessor {
+		accessor := val.Data.(*Accessor)
+		if accessor.Get.Type != TypeFunction {
+			i.throwError("TypeError", "'%s' was defined without a getter", name.Description)
+		}
+		return i.callGetter(accessor, obj)
+	}
+	return val
+}
+
+func (i *Interpreter) privateSet(obj Value, name *PrivateName, val Value) {
+	current, ok := i.privateElement(obj, name, "write")
+	if !ok {
+		return
+	}
+	switch name.Kind {
+	case PrivateMethod:
+		i.throwError("TypeError", "Private method '%s' is not writable", name.Description)
+	case PrivateAccessor:
+		accessor := current.Data.(*Accessor)
+		if accessor.Set.Type != TypeFunction {
+			i.throwError("TypeError", "'%s' was defined without a setter", name.Description)
+		}
+		i.applyFunction(accessor.Set, obj, []Value{val})
+	default:
+		obj.Object.private[name] = val
+	}
+}
+
+// privateElement looks up a private element of obj, throwing a TypeError
+// when obj was not constructed by a class declaring the name.
+func (i *Interpreter) privateElement(obj Value, name *PrivateName, access string) (Value, bool) {
+	if val, ok := i.privateElements(obj)[name]; ok {
+		return val, true
+	}
+	i.throwError("TypeError", "Cannot %s private member %s from an object whose class did not declare it", access, name.Description)
+	return Undefined, false
+}
+
+func (i *Interpreter) callGetter(accessor *Accessor, receiver Value) Value {
+	if accessor.Get.Type != TypeFunction {
+		return Undefined
+	}
+	return i.applyFunction(accessor.Get, receiver, nil)
+}
@@ -0,0 +1,779 @@
+package engine
+
+import "sync/atomic"
+
+// uncompilable is cached for code whose tables outgrow the operands of its
+// instructions, which the tree-walker evaluates instead.
+var uncompilable = &bytecode{}
+
+// compiler translates the statements of a script or a function body into
+// bytecode. Whatever it does not translate, such as optional chains and
+// yield, it leaves to the tree-walker with opEval and opExec.
+type compiler struct {
+	b *bytecode
+
+	// slots maps the locals kept in slots to their indexes. It is nil
+	// for a script, whose bindings all belong to the global scope.
+	slots map[string]int
+	// boxed holds the locals that must be kept in the scope's bindings
+	// instead, because nested functions and classes or code the
+	// tree-walker evaluates refer to them, and referenced collects the
+	// names such code refers to.
+	boxed      map[string]bool
+	referenced map[string]bool
+
+	// depth is the number of values on the operand stack.
+	depth int
+
+	// returningIf is set once the statement being compiled is found to
+	// contain an if expression, used as a value, whose blocks return.
+	// Its value is the return itself, which only the tree-walker's
+	// statements know to act on, so the statement is left to it.
+	returningIf bool
+
+	// failed is set when a table outgrows the operands.
+	failed bool
+}
+
+func newCompiler() *compiler {
+	return &compiler{b: &bytecode{}, referenced: make(map[string]bool)}
+}
+
+// compileProgram compiles the top-level code of a script, which returns
+// the value of its last statement.
+func compileProgram(program *Program) *bytecode {
+	c := newCompiler()
+	c.statements(program.Statements, true)
+	c.emit(opReturn, 0, -1)
+	return c.finish()
+}
+
+// compileFunction compiles the body of a function. Its locals live in
+// slots unless nested functions or code left to the tree-walker refer to
+// them; since which those are is only known once the body has been
+// compiled, it is compiled again whenever there are any.
+func compileFunction(params []*Identifier, body *BlockStatement) *bytecode {
+	boxed := make(map[string]bool)
+	for {
+		c := newCompiler()
+		c.slots = make(map[string]int)
+		c.boxed = boxed
+		for _, param := range params {
+			slot := -1
+			if !boxed[param.Value] {
+				slot = c.slot(param.Value)
+			}
+			c.b.params = append(c.b.params, slot)
+		}
+		c.statements(body.Statements, false)
+		c.emit(opUndefined, 0, 1)
+		c.emit(opReturn, 0, -1)
+		if c.boxesReferenced() {
+			c.b.scopeless = len(boxed) == 0 && c.usesNoScope()
+			return c.finish()
+		}
+		boxed = c.referenced
+	}
+}
+
+// boxesReferenced reports whether every name that nested functions or
+// code left to the tree-walker refer to is kept in the scope's bindings.
+func (c *compiler) boxesReferenced() bool {
+	for name := range c.referenced {
+		if !c.boxed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// usesNoScope reports whether the code reaches its scope only to look up
+// names of enclosing scopes.
+func (c *compiler) usesNoScope() bool {
+	for _, in := range c.b.code {
+		switch in.op() {
+		case opDeclareName, opThis, opFunction, opClass, opDefineMethod, opEval, opExec:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) finish() *bytecode {
+	if c.failed {
+		return uncompilable
+	}
+	return c.b
+}
+
+// compiled returns the bytecode of the program, compiling it the first
+// time. It is nil for uncompilable code.
+func (p *Program) compiled() *bytecode {
+	b := p.code.Load()
+	if b == nil {
+		b = storeCode(&p.code, compileProgram(p))
+	}
+	if b == uncompilable {
+		return nil
+	}
+	return b
+}
+
+// compiled returns the bytecode of the function's body, compiling it the
+// first time. It is nil for uncompilable code.
+func (fl *FunctionLiteral) compiled() *bytecode {
+	b := fl.code.Load()
+	if b == nil {
+		b = storeCode(&fl.code, compileFunction(fl.Parameters, fl.Body))
+	}
+	if b == uncompilable {
+		return nil
+	}
+	return b
+}
+
+// compiled returns the bytecode of a field initializer, compiled as the
+// body of a function returning its value, or of a static block, compiling
+// it the first time. It is nil for uncompilable code.
+func (m *ClassMember) compiled() *bytecode {
+	b := m.code.Load()
+	if b == nil {
+		body := m.Body
+		if m.Kind == ClassField {
+			body = &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: m.Value}}}
+		}
+		b = storeCode(&m.code, compileFunction(nil, body))
+	}
+	if b == uncompilable {
+		return nil
+	}
+	return b
+}
+
+// storeCode caches bytecode unless another goroutine has cached the same
+// code's first, and returns the bytecode cached.
+func storeCode(cache *atomic.Pointer[bytecode], b *bytecode) *bytecode {
+	if !cache.CompareAndSwap(nil, b) {
+		return cache.Load()
+	}
+	return b
+}
+
+// emit appends an instruction that changes the depth of the operand stack
+// by delta and returns its index.
+func (c *compiler) emit(op opcode, arg int, delta int) int {
+	if arg > maxOperand {
+		c.failed = true
+		arg = 0
+	}
+	c.b.code = append(c.b.code, makeInstruction(op, arg))
+	c.depth += delta
+	if c.depth > c.b.stackSize {
+		c.b.stackSize = c.depth
+	}
+	return len(c.b.code) - 1
+}
+
+// patch makes the jump at index continue at the next instruction emitted.
+func (c *compiler) patch(jump int) {
+	target := len(c.b.code)
+	if target > maxOperand {
+		c.failed = true
+		target = 0
+	}
+	c.b.code[jump] = makeInstruction(c.b.code[jump].op(), target)
+}
+
+func (c *compiler) constant(v Value) {
+	c.emit(opConstant, len(c.b.constants), 1)
+	c.b.constants = append(c.b.constants, v)
+}
+
+func (c *compiler) name(name string) int {
+	c.b.names = append(c.b.names, name)
+	return len(c.b.names) - 1
+}
+
+// slot returns the slot of a local, allocating one the first time.
+func (c *compiler) slot(name string) int {
+	slot, ok := c.slots[name]
+	if !ok {
+		slot = len(c.b.locals)
+		c.slots[name] = slot
+		c.b.locals = append(c.b.locals, name)
+	}
+	return slot
+}
+
+func (c *compiler) statements(stmts []Statement, keep bool) {
+	if len(stmts) == 0 && keep {
+		c.emit(opUndefined, 0, 1)
+	}
+	for idx, stmt := range stmts {
+		c.statement(stmt, keep && idx == len(stmts)-1)
+	}
+}
+
+// statement compiles a statement, leaving its value on the stack when
+// keep is set.
+func (c *compiler) statement(stmt Statement, keep bool) {
+	saved := c.returningIf
+	c.returningIf = false
+	start, depth := len(c.b.code), c.depth
+
+	c.compileStatement(stmt, keep)
+
+	if c.returningIf {
+		c.b.code, c.depth = c.b.code[:start], depth
+		c.exec(stmt, keep)
+	}
+	c.returningIf = saved
+}
+
+func (c *compiler) compileStatement(stmt Statement, keep bool) {
+	switch s := stmt.(type) {
+	case *LetStatement:
+		c.expression(s.Value)
+		c.declare(s.Name.Value)
+	case *ReturnStatement:
+		c.expression(s.ReturnValue)
+		c.emit(opReturn, 0, -1)
+		if keep {
+			c.emit(opUndefined, 0, 1)
+		}
+		return
+	case *FunctionDeclaration:
+		c.function(s.Function)
+		c.declare(s.Function.Name)
+	case *ClassDeclaration:
+		c.class(s.Class)
+		c.declare(s.Class.Name)
+	case *ExpressionStatement:
+		if e, ok := s.Expression.(*IfExpression); ok {
+			c.ifExpression(e, keep)
+			return
+		}
+		c.expression(s.Expression)
+		if !keep {
+			c.emit(opPop, 0, -1)
+		}
+		return
+	case *BlockStatement:
+		c.statements(s.Statements, keep)
+		return
+	case *ImportDeclaration, *ExportDeclaration:
+		c.exec(stmt, keep)
+		return
+	}
+	if keep {
+		c.emit(opUndefined, 0, 1)
+	}
+}
+
+// exec leaves a statement to the tree-walker.
+func (c *compiler) exec(stmt Statement, keep bool) {
+	collectNames(stmt, c.referenced)
+	c.emit(opExec, len(c.b.statements), 1)
+	c.b.statements = append(c.b.statements, stmt)
+	if !keep {
+		c.emit(opPop, 0, -1)
+	}
+}
+
+// declare binds the value on the stack to name in the current scope.
+func (c *compiler) declare(name string) {
+	if c.slots != nil && !c.boxed[name] {
+		c.emit(opInitLocal, c.slot(name), -1)
+		return
+	}
+	c.emit(opDeclareName, c.name(name), -1)
+}
+
+// ifExpression compiles an if, leaving the value of the block that ran on
+// the stack when keep is set.
+func (c *compiler) ifExpression(e *IfExpression, keep bool) {
+	c.expression(e.Condition)
+	skip := c.emit(opJumpIfFalse, 0, -1)
+	depth := c.depth
+	c.block(e.Consequence, keep)
+	end := c.emit(opJump, 0, 0)
+	c.patch(skip)
+	c.depth = depth
+	c.block(e.Alternative, keep)
+	c.patch(end)
+}
+
+func (c *compiler) block(block *BlockStatement, keep bool) {
+	if block == nil {
+		if keep {
+			c.emit(opUndefined, 0, 1)
+		}
+		return
+	}
+	c.statements(block.Statements, keep)
+}
+
+func (c *compiler) expression(exp Expression) {
+	switch e := exp.(type) {
+	case nil:
+		c.emit(opUndefined, 0, 1)
+	case *NumberLiteral:
+		c.constant(Value{Type: TypeNumber, Data: e.Value})
+	case *BigIntLiteral:
+		c.constant(NewBigInt(e.Value))
+	case *StringLiteral:
+		c.constant(Value{Type: TypeString, Data: e.Value})
+	case *BooleanLiteral:
+		c.constant(Value{Type: TypeBoolean, Data: e.Value})
+	case *NullLiteral:
+		c.constant(Value{Type: TypeNull})
+	case *Identifier:
+		if slot, ok := c.slots[e.Value]; ok {
+			c.emit(opGetLocal, slot, 1)
+		} else {
+			c.emit(opGetName, c.name(e.Value), 1)
+		}
+	case *ThisExpression:
+		c.emit(opThis, 0, 1)
+	case *PrefixExpression:
+		switch e.Operator {
+		case "delete":
+			c.fallback(e)
+		case "typeof":
+			c.expression(e.Right)
+			c.emit(opTypeof, 0, 0)
+		default:
+			c.expression(e.Right)
+			c.emit(opPrefix, len(c.b.operators), 0)
+			c.b.operators = append(c.b.operators, e.Operator)
+		}
+	case *InfixExpression:
+		c.expression(e.Left)
+		c.expression(e.Right)
+		c.emit(infixOpcode(e.Operator), len(c.b.infixes), -1)
+		c.b.infixes = append(c.b.infixes, infixSite{operator: e.Operator, offset: e.Token.start})
+	case *IfExpression:
+		if containsReturn(e.Consequence) || containsReturn(e.Alternative) {
+			c.returningIf = true
+			c.fallback(e)
+			return
+		}
+		c.ifExpression(e, true)
+	case *AssignExpression:
+		c.assignment(e)
+	case *ArrayLiteral:
+		for _, el := range e.Elements {
+			c.expression(el)
+		}
+		c.emit(opArray, len(e.Elements), 1-len(e.Elements))
+	case *ObjectLiteral:
+		c.emit(opObject, len(e.Properties), 1)
+		for _, prop := range e.Properties {
+			if prop.Kind != PropertyValue {
+				c.method(prop)
+				continue
+			}
+			if prop.ComputedKey != nil {
+				c.expression(prop.ComputedKey)
+				c.emit(opPropertyKey, 0, 0)
+				c.expression(prop.Value)
+				c.emit(opDefineComputed, 0, -2)
+				continue
+			}
+			c.expression(prop.Value)
+			c.emit(opDefineField, len(c.b.constants), -1)
+			c.b.constants = append(c.b.constants, stringKey(prop.Key))
+		}
+	case *FunctionLiteral:
+		c.function(e)
+	case *ClassLiteral:
+		c.class(e)
+	case *NewExpression:
+		c.expression(e.Callee)
+		for _, arg := range e.Arguments {
+			c.expression(arg)
+		}
+		c.emit(opNew, c.callSite(len(e.Arguments), e.Token, ""), -len(e.Arguments))
+	case *MemberExpression:
+		if !isPlainChain(e) {
+			c.fallback(e)
+			return
+		}
+		c.expression(e.Object)
+		c.getMember(e)
+	case *CallExpression:
+		if !isPlainChain(e) {
+			c.fallback(e)
+			return
+		}
+		if callee, ok := e.Function.(*MemberExpression); ok {
+			// The object is both this and where the function is found.
+			c.expression(callee.Object)
+			c.emit(opDup, 0, 1)
+			c.getMember(callee)
+		} else {
+			c.emit(opUndefined, 0, 1)
+			c.expression(e.Function)
+		}
+		for _, arg := range e.Arguments {
+			c.expression(arg)
+		}
+		site := c.callSite(len(e.Arguments), callPosition(e), describeExpression(e.Function))
+		c.emit(opCall, site, -len(e.Arguments)-1)
+	default:
+		c.fallback(exp)
+	}
+}
+
+// fallback leaves an expression to the tree-walker.
+func (c *compiler) fallback(exp Expression) {
+	if returnsThrough(exp) {
+		c.returningIf = true
+	}
+	collectNames(exp, c.referenced)
+	c.emit(opEval, len(c.b.expressions), 1)
+	c.b.expressions = append(c.b.expressions, exp)
+}
+
+// function pushes a function created from a function literal. The function
+// keeps the scope it is created in, so the locals it refers to are kept in
+// the scope's bindings.
+func (c *compiler) function(e *FunctionLiteral) {
+	collectNames(e, c.referenced)
+	c.emit(opFunction, len(c.b.functions), 1)
+	c.b.functions = append(c.b.functions, e)
+}
+
+// method defines a method or accessor of an object literal on the object
+// on the stack.
+func (c *compiler) method(prop *ObjectProperty) {
+	collectNames(prop.Value, c.referenced)
+	delta := 0
+	if prop.ComputedKey != nil {
+		c.expression(prop.ComputedKey)
+		c.emit(opPropertyKey, 0, 0)
+		delta = -1
+	}
+	c.emit(opDefineMethod, len(c.b.methods), delta)
+	c.b.methods = append(c.b.methods, prop)
+}
+
+// class pushes the class a class literal defines, evaluating its
+// superclass and then the keys of its computed members first.
+func (c *compiler) class(e *ClassLiteral) {
+	collectNames(e, c.referenced)
+	operands := 0
+	if e.SuperClass != nil {
+		c.expression(e.SuperClass)
+		operands++
+	}
+	for _, member := range e.Members {
+		if member.ComputedKey != nil {
+			c.expression(member.ComputedKey)
+			c.emit(opPropertyKey, 0, 0)
+			operands++
+		}
+	}
+	c.emit(opClass, len(c.b.classes), 1-operands)
+	c.b.classes = append(c.b.classes, e)
+}
+
+// getMember replaces the object on the stack with the property e reads.
+func (c *compiler) getMember(e *MemberExpression) {
+	if e.Computed {
+		c.expression(e.Property)
+		c.emit(opGetIndex, c.memberSite(e), -1)
+		return
+	}
+	c.emit(opGetMember, c.memberSite(e), 0)
+}
+
+func (c *compiler) assignment(e *AssignExpression) {
+	switch target := e.Target.(type) {
+	case *Identifier:
+		c.expression(e.Value)
+		if slot, ok := c.slots[target.Value]; ok {
+			c.emit(opSetLocal, slot, 0)
+		} else {
+			c.emit(opSetName, c.name(target.Value), 0)
+		}
+	case *MemberExpression:
+		if _, ok := target.Object.(*SuperExpression); ok {
+			c.fallback(e)
+			return
+		}
+		if _, ok := target.Property.(*PrivateIdentifier); ok {
+			c.fallback(e)
+			return
+		}
+		c.expression(e.Value)
+		c.expression(target.Object)
+		if target.Computed {
+			c.expression(target.Property)
+			c.emit(opSetIndex, c.memberSite(target), -2)
+			return
+		}
+		c.emit(opSetMember, c.memberSite(target), -1)
+	default:
+		c.expression(e.Value)
+	}
+}
+
+func (c *compiler) memberSite(e *MemberExpression) int {
+	site := memberSite{key: stringKey(""), offset: memberPosition(e).start}
+	if name, ok := e.Property.(*Identifier); ok && !e.Computed {
+		site.key = stringKey(name.Value)
+	}
+	c.b.members = append(c.b.members, site)
+	return len(c.b.members) - 1
+}
+
+func (c *compiler) callSite(argc int, position Token, callee string) int {
+	c.b.calls = append(c.b.calls, callSite{argc: argc, offset: position.start, callee: callee})
+	return len(c.b.calls) - 1
+}
+
+// infixOpcode returns the instruction for a binary operator.
+func infixOpcode(operator string) opcode {
+	switch operator {
+	case "+":
+		return opAdd
+	case "-":
+		return opSubtract
+	case "*":
+		return opMultiply
+	case "/":
+		return opDivide
+	case "%":
+		return opRemainder
+	case "<":
+		return opLess
+	case ">":
+		return opGreater
+	case "<=":
+		return opLessEqual
+	case ">=":
+		return opGreaterEqual
+	case "===":
+		return opStrictEqual
+	case "!==":
+		return opStrictNotEqual
+	case "==":
+		return opEqual
+	case "!=":
+		return opNotEqual
+	}
+	return opInfix
+}
+
+// isPlainChain reports whether a member or call expression can be compiled
+// link by link: none of its links is optional, which would need the rest
+// of the chain skipped, or a parenthesized optional chain, or reaches
+// super or a private name.
+func isPlainChain(exp Expression) bool {
+	switch e := exp.(type) {
+	case *MemberExpression:
+		if e.Optional {
+			return false
+		}
+		if _, ok := e.Object.(*SuperExpression); ok {
+			return false
+		}
+		if _, ok := e.Property.(*PrivateIdentifier); ok {
+			return false
+		}
+		return isPlainChain(e.Object)
+	case *CallExpression:
+		if e.Optional {
+			return false
+		}
+		if _, ok := e.Function.(*SuperExpression); ok {
+			return false
+		}
+		return isPlainChain(e.Function)
+	case *ParenthesizedExpression:
+		return false
+	}
+	return true
+}
+
+// containsReturn reports whether a block has a return statement that
+// would return from the function containing it, outside if expressions
+// used as values.
+func containsReturn(block *BlockStatement) bool {
+	if block == nil {
+		return false
+	}
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ReturnStatement:
+			return true
+		case *BlockStatement:
+			if containsReturn(s) {
+				return true
+			}
+		case *ExpressionStatement:
+			if e, ok := s.Expression.(*IfExpression); ok && (containsReturn(e.Consequence) || containsReturn(e.Alternative)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returnsThrough reports whether the value of an expression may be the
+// return of an if expression in it, outside nested functions and classes.
+func returnsThrough(exp Expression) bool {
+	found := false
+	inspect(exp, func(node Node) bool {
+		switch n := node.(type) {
+		case *FunctionLiteral, *ClassLiteral:
+			return false
+		case *IfExpression:
+			if containsReturn(n.Consequence) || containsReturn(n.Alternative) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// collectNames adds every name node refers to or declares to names.
+func collectNames(node Node, names map[string]bool) {
+	inspect(node, func(node Node) bool {
+		switch n := node.(type) {
+		case *Identifier:
+			names[n.Value] = true
+		case *LetStatement:
+			names[n.Name.Value] = true
+		case *FunctionLiteral:
+			names[n.Name] = true
+			for _, param := range n.Parameters {
+				names[param.Value] = true
+			}
+		case *ClassLiteral:
+			names[n.Name] = true
+		case *ImportDeclaration:
+			names[n.Default] = true
+			names[n.Namespace] = true
+			for _, spec := range n.Specifiers {
+				names[spec.Alias] = true
+			}
+		case *ExportDeclaration:
+			for _, spec := range n.Specifiers {
+				names[spec.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+// inspect calls visit for node and, while visit returns true, for each of
+// the nodes in it, depth first.
+func inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+	each := func(exps []Expression) {
+		for _, exp := range exps {
+			inspectExpression(exp, visit)
+		}
+	}
+	switch n := node.(type) {
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			inspect(stmt, visit)
+		}
+	case *LetStatement:
+		inspectExpression(n.Value, visit)
+	case *ReturnStatement:
+		inspectExpression(n.ReturnValue, visit)
+	case *ExpressionStatement:
+		inspectExpression(n.Expression, visit)
+	case *FunctionDeclaration:
+		inspectExpression(n.Function, visit)
+	case *ClassDeclaration:
+		inspectExpression(n.Class, visit)
+	case *ExportDeclaration:
+		if n.Declaration != nil {
+			inspect(n.Declaration, visit)
+		}
+		inspectExpression(n.Default, visit)
+	case *FunctionLiteral:
+		inspectBlock(n.Body, visit)
+	case *ClassLiteral:
+		inspectExpression(n.SuperClass, visit)
+		for _, member := range n.Members {
+			inspectExpression(member.ComputedKey, visit)
+			inspectExpression(member.Function, visit)
+			inspectExpression(member.Value, visit)
+			inspectBlock(member.Body, visit)
+		}
+	case *IfExpression:
+		inspectExpression(n.Condition, visit)
+		inspectBlock(n.Consequence, visit)
+		inspectBlock(n.Alternative, visit)
+	case *PrefixExpression:
+		inspectExpression(n.Right, visit)
+	case *InfixExpression:
+		inspectExpression(n.Left, visit)
+		inspectExpression(n.Right, visit)
+	case *AssignExpression:
+		inspectExpression(n.Target, visit)
+		inspectExpression(n.Value, visit)
+	case *MemberExpression:
+		inspectExpression(n.Object, visit)
+		if n.Computed {
+			inspectExpression(n.Property, visit)
+		}
+	case *CallExpression:
+		inspectExpression(n.Function, visit)
+		each(n.Arguments)
+	case *NewExpression:
+		inspectExpression(n.Callee, visit)
+		each(n.Arguments)
+	case *ArrayLiteral:
+		each(n.Elements)
+	case *ObjectLiteral:
+		for _, prop := range n.Properties {
+			inspectExpression(prop.ComputedKey, visit)
+			inspectExpression(prop.Value, visit)
+		}
+	case *YieldExpression:
+		inspectExpression(n.Argument, visit)
+	case *AwaitExpression:
+		inspectExpression(n.Argument, visit)
+	case *ParenthesizedExpression:
+		inspectExpression(n.Expression, visit)
+	case *ImportCall:
+		inspectExpression(n.Source, visit)
+	case *PrivateInExpression:
+		inspectExpression(n.Right, visit)
+	}
+}
+
+// inspectExpression is inspect for an expression, which may be missing.
+func inspectExpression(exp Expression, visit func(Node) bool) {
+	if exp == nil {
+		return
+	}
+	switch e := exp.(type) {
+	case *FunctionLiteral:
+		if e == nil {
+			return
+		}
+	case *ClassLiteral:
+		if e == nil {
+			return
+		}
+	}
+	inspect(exp, visit)
+}
+
+// inspectBlock is inspect for a block, which may be missing.
+func inspectBlock(block *BlockStatement, visit func(Node) bool) {
+	if block != nil {
+		inspect(block, visit)
+	}
+}
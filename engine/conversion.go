@@ -0,0 +1,333 @@
+package engine
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// toPrimitive implements ToPrimitive, converting an object to a primitive
+// by calling its Symbol.toPrimitive method with the hint "default",
+// "number" or "string", or else its valueOf and toString methods, in
+// the order the hint prefers. Primitives are returned unchanged.
+func (i *Interpreter) toPrimitive(v Value, hint string) Value {
+	if !isObject(v) {
+		return v
+	}
+	exotic := i.getMember(v, symbolKey(symbolToPrimitive))
+	if !isNullish(exotic) {
+		if exotic.Type != TypeFunction {
+			i.throwError("TypeError", "%s is not a function", exotic.ToString())
+		}
+		result := i.applyFunction(exotic, v, []Value{{Type: TypeString, Data: hint}})
+		if isObject(result) {
+			i.throwError("TypeError", "Cannot convert object to primitive value")
+		}
+		return result
+	}
+
+	methods := []string{"valueOf", "toString"}
+	if hint == "string" {
+		methods = []string{"toString", "valueOf"}
+	}
+	for _, name := range methods {
+		if method := i.getProperty(v, name); method.Type == TypeFunction {
+			if result := i.applyFunction(method, v, nil); !isObject(result) {
+				return result
+			}
+		}
+	}
+	i.throwError("TypeError", "Cannot convert object to primitive value")
+	return Undefined
+}
+
+// toNumber implements ToNumber, which converts objects through their
+// primitive value and rejects symbols.
+func (i *Interpreter) toNumber(v Value) float64 {
+	v = i.toPrimitive(v, "number")
+	switch v.Type {
+	case TypeSymbol:
+		i.throwError("TypeError", "Cannot convert a Symbol value to a number")
+	case TypeBigInt:
+		i.throwError("TypeError", "Cannot convert a BigInt value to a number")
+	}
+	return v.ToNumber()
+}
+
+// toNumeric implements ToNumeric, which is ToNumber except that BigInts
+// stay BigInts. The result is a number or a BigInt value.
+func (i *Interpreter) toNumeric(v Value) Value {
+	if v = i.toPrimitive(v, "number"); v.Type == TypeBigInt {
+		return v
+	}
+	return Value{Type: TypeNumber, Data: i.toNumber(v)}
+}
+
+// toString implements ToString, which converts objects through their
+// primitive value and rejects symbols.
+func (i *Interpreter) toString(v Value) string {
+	v = i.toPrimitive(v, "string")
+	if v.Type == TypeSymbol {
+		i.throwError("TypeError", "Cannot convert a Symbol value to a string")
+	}
+	return v.ToString()
+}
+
+// primitiveObject is the kind of an object wrapping a primitive, which
+// ToObject creates for code that needs an object where it was given a
+// primitive, such as the this of a sloppy mode function.
+type primitiveObject struct {
+	value Value
+}
+
+// toObject implements ToObject: objects are returned unchanged and other
+// values other than undefined and null are wrapped in a new object that
+// inherits from the prototype of their type.
+func (i *Interpreter) toObject(v Value) Value {
+	if isNullish(v) {
+		i.throwError("TypeError", "Cannot convert undefined or null to object")
+	}
+	if isObject(v) {
+		return v
+	}
+	obj := i.newObject()
+	obj.Data = &primitiveObject{value: v}
+	obj.Object.Prototype = i.prototypeOf(v)
+	return obj
+}
+
+// thisPrimitive returns the primitive of type typ a method of the
+// prototype of typ was called on, unwrapping an object that wraps one.
+func (i *Interpreter) thisPrimitive(this Value, typ ValueType, method string) Value {
+	if wrapper, ok := this.Data.(*primitiveObject); ok && isObject(this) {
+		this = wrapper.value
+	}
+	if this.Type != typ {
+		i.throwError("TypeError", "%s requires that 'this' be a %s", method, primitiveTypeNames[typ])
+	}
+	return this
+}
+
+// primitiveTypeNames are the names of the constructors of primitive types,
+// which error messages refer to them by.
+var primitiveTypeNames = map[ValueType]string{
+	TypeNumber:  "Number",
+	TypeString:  "String",
+	TypeBoolean: "Boolean",
+	TypeSymbol:  "Symbol",
+	TypeBigInt:  "BigInt",
+}
+
+// setupPrimitivePrototypes defines the prototypes numbers, strings and
+// booleans inherit from, and the objects wrapping them. They have only
+// valueOf and toString, which the conversions of wrappers call.
+func (i *Interpreter) setupPrimitivePrototypes() {
+	i.primitivePrototypes = make(map[ValueType]Value)
+	for _, typ := range []ValueType{TypeNumber, TypeString, TypeBoolean} {
+		typ := typ
+		name := primitiveTypeNames[typ]
+		proto := i.newObject()
+		i.defineMethod(proto, "valueOf", 0, func(this Value, args []Value) Value {
+			return i.thisPrimitive(this, typ, name+".prototype.valueOf")
+		})
+		i.defineMethod(proto, "toString", 0, func(this Value, args []Value) Value {
+			return Value{Type: TypeString, Data: i.thisPrimitive(this, typ, name+".prototype.toString").ToString()}
+		})
+		i.primitivePrototypes[typ] = proto
+	}
+}
+
+// toPropertyKey converts the value of a computed key to a property key.
+func (i *Interpreter) toPropertyKey(v Value) Value {
+	v = i.toPrimitive(v, "string")
+	if v.Type == TypeSymbol || v.Type == TypeString {
+		return v
+	}
+	return stringKey(v.ToString())
+}
+
+// isSpace reports whether ch is white space or a line terminator, which
+// \s matches in regular expressions and StringToNumber ignores around
+// numbers.
+func isSpace(ch rune) bool {
+	switch ch {
+	case '\t', '\v', '\f', ' ', '\u00a0', '\ufeff':
+		return true
+	}
+	return isLineTerminator(ch) || unicode.Is(unicode.Zs, ch)
+}
+
+// stringToNumber implements StringToNumber. The string may hold a decimal
+// number with a sign, fraction and exponent, Infinity, or an unsigned
+// hexadecimal, octal or binary integer; surrounding white space is
+// ignored, an empty string is zero and anything else is NaN.
+func stringToNumber(s string) float64 {
+	s = strings.TrimFunc(s, isSpace)
+	if s == "" {
+		return 0
+	}
+	if len(s) > 2 && s[0] == '0' {
+		base := 0
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 0 {
+			if s[2] == '+' || s[2] == '-' {
+				return math.NaN()
+			}
+			x, ok := new(big.Int).SetString(s[2:], base)
+			if !ok {
+				return math.NaN()
+			}
+			f, _ := new(big.Float).SetInt(x).Float64()
+			return f
+		}
+	}
+
+	unsigned := strings.TrimLeft(s[:1], "+-") + s[1:]
+	if unsigned == "Infinity" {
+		if s[0] == '-' {
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	}
+	if !isDecimalLiteral(unsigned) {
+		return math.NaN()
+	}
+	// Out of range literals parse as infinity or zero, as they should.
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// isDecimalLiteral reports whether s is a StrUnsignedDecimalLiteral:
+// digits with an optional fraction, or a fraction alone, followed by an
+// optional exponent.
+func isDecimalLiteral(s string) bool {
+	digits := func() int {
+		n := 0
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		s = s[n:]
+		return n
+	}
+	mantissa := digits()
+	if s != "" && s[0] == '.' {
+		s = s[1:]
+		mantissa += digits()
+	}
+	if mantissa == 0 {
+		return false
+	}
+	if s != "" && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s != "" && (s[0] == '+' || s[0] == '-') {
+			s = s[1:]
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return s == ""
+}
+
+// numberToString implements Number::toString for radix 10: the shortest
+// digits that read back as the same number, written out in full for
+// magnitudes from 1e-7 up to 1e21 and in exponential notation otherwise.
+func numberToString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case f == 0:
+		return "0"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f < 0:
+		return "-" + numberToString(-f)
+	case f < 1<<53 && f == math.Trunc(f):
+		// Every digit of an integer this small is needed to round trip.
+		return strconv.FormatInt(int64(f), 10)
+	}
+
+	// FormatFloat finds the shortest round-tripping digits, as d.ddde±x.
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	k := len(digits)
+	n, _ := strconv.Atoi(exponent)
+	n++ // The decimal point follows the first n digits.
+
+	switch {
+	case k <= n && n <= 21:
+		return digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return "0." + strings.Repeat("0", -n) + digits
+	}
+	sign := "+"
+	if n-1 < 0 {
+		sign = "-"
+	}
+	e := strconv.Itoa(int(math.Abs(float64(n - 1))))
+	if k == 1 {
+		return digits + "e" + sign + e
+	}
+	return digits[:1] + "." + digits[1:] + "e" + sign + e
+}
+
+// compareStrings orders strings by their UTF-16 code units, as the
+// relational operators do.
+func compareStrings(a, b string) int {
+	x, y := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for idx := 0; idx < len(x) && idx < len(y); idx++ {
+		if x[idx] != y[idx] {
+			if x[idx] < y[idx] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(x) - len(y)
+}
+
+// isLessThan implements IsLessThan for primitives other than BigInts:
+// strings compare by code units and anything else as numbers. ok is
+// false when either operand is NaN, which makes every comparison false.
+func isLessThan(x, y Value) (less bool, ok bool) {
+	if x.Type == TypeString && y.Type == TypeString {
+		return compareStrings(x.Data.(string), y.Data.(string)) < 0, true
+	}
+	nx, ny := x.ToNumber(), y.ToNumber()
+	if math.IsNaN(nx) || math.IsNaN(ny) {
+		return false, false
+	}
+	return nx < ny, true
+}
+
+// compare applies a relational operator to two primitives.
+func compare(operator string, left, right Value) Value {
+	var result bool
+	switch operator {
+	case "<":
+		result, _ = isLessThan(left, right)
+	case ">":
+		result, _ = isLessThan(right, left)
+	case "<=":
+		greater, ok := isLessThan(right, left)
+		result = ok && !greater
+	case ">=":
+		less, ok := isLessThan(left, right)
+		result = ok && !less
+	}
+	return Value{Type: TypeBoolean, Data: result}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import "testing"
+
+func TestArraysAndFunctionsToPrimitive(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"" + [1, 2]`, "1,2"},
+		{`"" + []`, ""},
+		{`"" + [1, [2, 3], null, undefined, "s"]`, "1,2,3,,,s"},
+		{`let a = [1]; a[2] = a; "" + a`, "1,,"},
+		{`[1, 2] + 1`, "1,21"},
+		{`[5] * 2`, "10"},
+		{`[1, 2].join(" - ") + "|" + [1, 2].join()`, "1 - 2|1,2"},
+		{`let a = [1, 2]; a.join = function () { return "joined"; }; "" + a`, "joined"},
+		{`[].join.call({length: 2, 0: "a", 1: "b"}, "+")`, "a+b"},
+		{`[].toString.call({})`, "[object Object]"},
+		{`Object.getPrototypeOf(Object.getPrototypeOf([])) === Object.prototype`, "true"},
+
+		{`"" + function f(a) { return a; }`, "function f(a) { return a; }"},
+		{`"" + ((x, y) => x + y)`, "(x, y) => x + y"},
+		{`"" + (async x => x)`, "async x => x"},
+		{`async function af() {} "" + af`, "async function af() {}"},
+		{`function* g() { yield 1; } "" + g`, "function* g() { yield 1; }"},
+		{`"" + {m(a) { return a; }}.m`, "m(a) { return a; }"},
+		{`"" + Object.getOwnPropertyDescriptor({get v() { return 1; }}, "v").get`, "get v() { return 1; }"},
+		{`class A { static s() {} } "" + A + "|" + A.s`, "class A { static s() {} }|s() {}"},
+		{`"" + Object`, "function Object() { [native code] }"},
+		{`"" + function () {}.bind(null)`, "function () { [native code] }"},
+		{`Object.toString.call({})`, "Uncaught TypeError: Function.prototype.toString requires that 'this' be a Function"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLooseEquality(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"1" == 1`, "true"},
+		{`1 != "1"`, "false"},
+		{`null == undefined`, "true"},
+		{`null == 0`, "false"},
+		{`undefined == false`, "false"},
+		{`[] == false`, "true"},
+		{`[1] == 1`, "true"},
+		{`[1, 2] == "1,2"`, "true"},
+		{`"" == 0`, "true"},
+		{`"x" == NaN`, "false"},
+		{`true == "1"`, "true"},
+		{`({}) == "[object Object]"`, "true"},
+		{`let o = {}; o == o`, "true"},
+		{`({}) == ({})`, "false"},
+		{`let o = {valueOf() { return 2; }}; o == 2`, "true"},
+		{`({}) == null`, "false"},
+		{`1n == "1"`, "true"},
+		{`1n == 1`, "true"},
+		{`1n == true`, "true"},
+		{`1n == "x"`, "false"},
+		{`let s = Symbol(); s == "s"`, "false"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+
+	// Literals are folded as == compares them when the script runs.
+	for _, tt := range tests[:5] {
+		i := NewInterpreter()
+		i.SetOptimizations(Optimizations{FoldConstants: true})
+		if v, err := i.Eval(tt.src); err != nil || v.ToString() != tt.want {
+			t.Errorf("%s (folded) = %s, %v, want %s", tt.src, v.ToString(), err, tt.want)
+		}
+	}
+}
+
+func TestValueToString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`[1, 2]`, "1,2"},
+		{`[1, [2, [3]], null, undefined, "s"]`, "1,2,3,,,s"},
+		{`let a = [1]; a[1] = a; a`, "1,"},
+		{`new TypeError("bad")`, "TypeError: bad"},
+		{`new Error("")`, "Error"},
+		{`class MyErr extends Error {} new MyErr("m")`, "Error: m"},
+		{`Object.prototype.toString.call(new Error(""))`, "[object Error]"},
+		{`Object.prototype.toString.call(new RangeError("r"))`, "[object Error]"},
+		{`Object.prototype.toString.call({name: "Error", message: ""})`, "[object Object]"},
+	}
+	for _, tt := range tests {
+		v, err := NewInterpreter().Eval(tt.src)
+		if err != nil || v.ToString() != tt.want {
+			t.Errorf("%s = %q, %v, want %q", tt.src, v.ToString(), err, tt.want)
+		}
+	}
+}
+
+func TestIntegerFastPaths(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"" + 1234567`, "1234567"},
+		{`"" + -42`, "-42"},
+		{`"" + 9007199254740991`, "9007199254740991"},
+		{`"" + 2 ** 60`, "1152921504606847000"},
+		{`"" + 10 ** 21`, "1e+21"},
+		{`[7 % 3, -7 % 3, 7 % -3, -7 % -3, 5.5 % 2, 5 % 0]`, "1,-1,1,-1,1.5,NaN"},
+		{`[1 / (-4 % 2), 1 / (4 % -2), 1 / (-0 % 5)]`, "-Infinity,Infinity,-Infinity"},
+		{`2 ** 53 % 3 + "," + 2 % 2 ** 54`, "2,2"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			if err != nil || v.ToString() != tt.want {
+				t.Errorf("%s (tree walking %t) = %q, %v, want %q", tt.src, treeWalking, v.ToString(), err, tt.want)
+			}
+		}
+	}
+}
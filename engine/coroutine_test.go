@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCloseStopsSuspendedGenerators(t *testing.T) {
+	i := NewInterpreter()
+	if _, err := i.Eval(`function* g() { yield 1; yield 2; } let it = g(); it.next(); let fresh = g();`); err != nil {
+		t.Fatal(err)
+	}
+	if len(i.coroutines) != 2 {
+		t.Fatalf("live coroutines = %d, want 2", len(i.coroutines))
+	}
+	i.Close()
+	if len(i.coroutines) != 0 {
+		t.Fatalf("live coroutines after Close = %d, want 0", len(i.coroutines))
+	}
+	v, err := i.Eval(`it.next().done`)
+	if err != nil || !v.ToBoolean() {
+		t.Fatalf("stopped generator: next().done = %v, %v; want true", v.ToString(), err)
+	}
+}
+
+func TestSuspendedGeneratorsCountAgainstMemory(t *testing.T) {
+	i := NewInterpreter()
+	defer i.Close()
+	i.SetLimits(Limits{MaxMemory: 1 << 20})
+	_, err := i.Eval(`
+		function* g() { yield 1; }
+		let keep = [];
+		function mk(n) { if (n == 0) { return 0; } let it = g(); it.next(); keep[n] = it; return mk(n - 1); }
+		mk(5000);`)
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Reason != ErrMemoryLimit {
+		t.Fatalf("err = %v, want memory limit exceeded", err)
+	}
+	if n := len(i.coroutines); n > 200 {
+		t.Fatalf("%d coroutines live under a 1MB limit", n)
+	}
+}
+
+func TestCloseStopsSuspendedAsyncFunctions(t *testing.T) {
+	i := NewInterpreter()
+	_, err := i.Eval(`
+		let settled = false;
+		async function a() { await new Promise(() => {}); settled = true; }
+		let p = a();`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.coroutines) != 1 {
+		t.Fatalf("live coroutines = %d, want 1", len(i.coroutines))
+	}
+	i.Close()
+	if len(i.coroutines) != 0 {
+		t.Fatalf("live coroutines after Close = %d, want 0", len(i.coroutines))
+	}
+	v, err := i.Eval(`settled`)
+	if err != nil || v.ToBoolean() {
+		t.Fatalf("settled = %v, %v; want false", v.ToString(), err)
+	}
+}
@@ -0,0 +1,319 @@
+package engine
+
+import "math"
+
+// propertyAttributes holds the attributes of a property that differ from
+// those of a property created by assignment, which is writable,
+// enumerable and configurable, so the zero value is the common case.
+// nonWritable only applies to data properties.
+type propertyAttributes uint8
+
+const (
+	nonWritable propertyAttributes = 1 << iota
+	nonEnumerable
+	nonConfigurable
+)
+
+// propertyKey identifies a property in the attributes of an object, as
+// property keys that are values cannot be map keys.
+type propertyKey struct {
+	name   string
+	symbol *Symbol
+}
+
+func keyOf(key Value) propertyKey {
+	if key.Type == TypeSymbol {
+		return propertyKey{symbol: key.Data.(*Symbol)}
+	}
+	return propertyKey{name: key.Data.(string)}
+}
+
+// attributesOf returns the attributes of the own property key of obj. The
+// name and length functions expose are read-only and hidden.
+func attributesOf(obj Value, key Value) propertyAttributes {
+	if obj.Object == nil {
+		return 0
+	}
+	if attrs, ok := obj.Object.attributes[keyOf(key)]; ok {
+		return attrs
+	}
+	if obj.Type == TypeFunction && key.Type == TypeString {
+		if _, own := obj.Object.Properties[key.Data.(string)]; !own && (key.Data == "name" || key.Data == "length") {
+			return nonWritable | nonEnumerable
+		}
+	}
+	return 0
+}
+
+// setAttributes records the attributes of the own property key of obj.
+// Objects without internal slots only have default attributes.
+func setAttributes(obj Value, key Value, attrs propertyAttributes) {
+	if obj.Object == nil {
+		return
+	}
+	if attrs == 0 {
+		delete(obj.Object.attributes, keyOf(key))
+		return
+	}
+	if obj.Object.attributes == nil {
+		obj.Object.attributes = make(map[propertyKey]propertyAttributes)
+	}
+	obj.Object.attributes[keyOf(key)] = attrs
+}
+
+// isStrict reports whether the code being evaluated is strict mode code,
+// which throws a TypeError where sloppy code silently fails to write or
+// delete a property.
+func (i *Interpreter) isStrict() bool {
+	for env := i.env; env != nil && env.outer != nil; env = env.outer {
+		if env.hasThis || env.arrow || env.module != nil {
+			return env.strict
+		}
+	}
+	return i.strictScript
+}
+
+// propertyDescriptor is a property descriptor, whose fields may each be
+// absent: a descriptor is an accessor descriptor when it has get or set,
+// a data descriptor when it has value or writable, and generic otherwise.
+type propertyDescriptor struct {
+	value    Value
+	get, set Value
+
+	writable, enumerable, configurable bool
+
+	hasValue, hasGet, hasSet                    bool
+	hasWritable, hasEnumerable, hasConfigurable bool
+}
+
+func (d *propertyDescriptor) isAccessor() bool {
+	return d.hasGet || d.hasSet
+}
+
+func (d *propertyDescriptor) isData() bool {
+	return d.hasValue || d.hasWritable
+}
+
+// toPropertyDescriptor implements ToPropertyDescriptor, reading the
+// attributes an object passed to Object.defineProperty describes.
+func (i *Interpreter) toPropertyDescriptor(obj Value) *propertyDescriptor {
+	if obj.Type != TypeObject && obj.Type != TypeFunction {
+		i.throwError("TypeError", "Property description must be an object: %s", obj.ToString())
+	}
+	desc := &propertyDescriptor{}
+	field := func(name string, present *bool) Value {
+		if *present = i.hasProperty(obj, name); *present {
+			return i.getProperty(obj, name)
+		}
+		return Undefined
+	}
+	desc.enumerable = field("enumerable", &desc.hasEnumerable).ToBoolean()
+	desc.configurable = field("configurable", &desc.hasConfigurable).ToBoolean()
+	desc.value = field("value", &desc.hasValue)
+	desc.writable = field("writable", &desc.hasWritable).ToBoolean()
+	desc.get = field("get", &desc.hasGet)
+	if desc.hasGet && desc.get.Type != TypeFunction && desc.get.Type != TypeUndefined {
+		i.throwError("TypeError", "Getter must be a function: %s", desc.get.ToString())
+	}
+	desc.set = field("set", &desc.hasSet)
+	if desc.hasSet && desc.set.Type != TypeFunction && desc.set.Type != TypeUndefined {
+		i.throwError("TypeError", "Setter must be a function: %s", desc.set.ToString())
+	}
+	if desc.isAccessor() && desc.isData() {
+		i.throwError("TypeError", "Invalid property descriptor. Cannot both specify accessors and a value or writable attribute")
+	}
+	return desc
+}
+
+// fromPropertyDescriptor implements FromPropertyDescriptor, describing a
+// property as Object.getOwnPropertyDescriptor returns it.
+func fromPropertyDescriptor(desc *propertyDescriptor) Value {
+	obj := NewObject()
+	if desc.hasValue {
+		obj.Object.Properties["value"] = desc.value
+	}
+	if desc.hasWritable {
+		obj.Object.Properties["writable"] = Value{Type: TypeBoolean, Data: desc.writable}
+	}
+	if desc.hasGet {
+		obj.Object.Properties["get"] = desc.get
+	}
+	if desc.hasSet {
+		obj.Object.Properties["set"] = desc.set
+	}
+	if desc.hasEnumerable {
+		obj.Object.Properties["enumerable"] = Value{Type: TypeBoolean, Data: desc.enumerable}
+	}
+	if desc.hasConfigurable {
+		obj.Object.Properties["configurable"] = Value{Type: TypeBoolean, Data: desc.configurable}
+	}
+	return obj
+}
+
+// validatePropertyDescriptor is the validation half of
+// ValidateAndApplyPropertyDescriptor: it reports whether a property
+// described by current, if it exists, may be changed as desc describes.
+// A new property needs an extensible object, and a non-configurable one
+// can only have its value written while writable or be made read-only.
+func validatePropertyDescriptor(extensible bool, desc *propertyDescriptor, current *propertyDescriptor, exists bool) bool {
+	if !exists {
+		return extensible
+	}
+	if current.configurable {
+		return true
+	}
+	switch {
+	case desc.hasConfigurable && desc.configurable:
+		return false
+	case desc.hasEnumerable && desc.enumerable != current.enumerable:
+		return false
+	case (desc.isAccessor() || desc.isData()) && desc.isAccessor() != current.isAccessor():
+		return false
+	case current.isAccessor():
+		return !(desc.hasGet && !sameValue(desc.get, current.get) || desc.hasSet && !sameValue(desc.set, current.set))
+	case !current.writable:
+		return !(desc.hasWritable && desc.writable || desc.hasValue && !sameValue(desc.value, current.value))
+	}
+	return true
+}
+
+// definePropertyOrThrow is defineOwnProperty throwing a TypeError when the
+// definition is not allowed.
+func (i *Interpreter) definePropertyOrThrow(obj Value, key Value, desc *propertyDescriptor) {
+	if i.defineOwnProperty(obj, key, desc) {
+		return
+	}
+	if _, ok := obj.Data.(*Proxy); ok {
+		i.throwError("TypeError", "'defineProperty' on proxy: trap returned falsish for property '%s'", key.ToString())
+	}
+	if _, exists := i.getOwnMember(obj, key); !exists {
+		i.throwError("TypeError", "Cannot define property %s, object is not extensible", key.ToString())
+	}
+	i.throwError("TypeError", "Cannot redefine property: %s", key.ToString())
+}
+
+// sameValue implements SameValue, which unlike === tells +0 from -0 and
+// considers NaN the same as itself.
+func sameValue(a, b Value) bool {
+	if a.Type == TypeNumber && b.Type == TypeNumber {
+		x, y := a.Data.(float64), b.Data.(float64)
+		if math.IsNaN(x) && math.IsNaN(y) {
+			return true
+		}
+		return x == y && math.Signbit(x) == math.Signbit(y)
+	}
+	return a.Equals(b)
+}
+
+// preventExtensionsOrThrow is preventExtensions throwing a TypeError when
+// the object refuses.
+func (i *Interpreter) preventExtensionsOrThrow(obj Value) {
+	if i.preventExtensions(obj) {
+		return
+	}
+	if _, ok := obj.Data.(*Proxy); ok {
+		i.throwError("TypeError", "'preventExtensions' on proxy: trap returned falsish")
+	}
+	i.throwError("TypeError", "Cannot prevent extensions of %s", i.describeObject(obj))
+}
+
+// setIntegrityLevel implements Object.seal and, when frozen is set,
+// Object.freeze: it prevents extensions and makes every own property
+// non-configurable and, for freeze, every data property read-only.
+func (i *Interpreter) setIntegrityLevel(obj Value, frozen bool) {
+	i.preventExtensionsOrThrow(obj)
+	for _, key := range i.ownKeys(obj) {
+		desc := &propertyDescriptor{hasConfigurable: true}
+		if frozen {
+			if current, ok := i.getOwnPropertyDescriptor(obj, key); ok && !current.isAccessor() {
+				desc.hasWritable = true
+			}
+		}
+		i.definePropertyOrThrow(obj, key, desc)
+	}
+}
+
+// testIntegrityLevel implements Object.isSealed and Object.isFrozen.
+func (i *Interpreter) testIntegrityLevel(obj Value, frozen bool) bool {
+	if i.isExtensible(obj) {
+		return false
+	}
+	for _, key := range i.ownKeys(obj) {
+		current, ok := i.getOwnPropertyDescriptor(obj, key)
+		if !ok {
+			continue
+		}
+		if current.configurable || frozen && current.isData() && current.writable {
+			return false
+		}
+	}
+	return true
+}
+
+// toObjectArgument returns the object argument of the Object functions
+// that reject primitives.
+func (i *Interpreter) toObjectArgument(v Value, function string) Value {
+	if v.Type != TypeObject && v.Type != TypeFunction {
+		i.throwError("TypeError", "Object.%s called on non-object", function)
+	}
+	return v
+}
+
+// objectDefineProperty implements Object.defineProperty.
+func (i *Interpreter) objectDefineProperty(this Value, args []Value) Value {
+	obj := i.toObjectArgument(argument(args, 0), "defineProperty")
+	key := i.toPropertyKey(argument(args, 1))
+	i.definePropertyOrThrow(obj, key, i.toPropertyDescriptor(argument(args, 2)))
+	return obj
+}
+
+// objectDefineProperties implements Object.defineProperties, which reads
+// all descriptors before defining any of the properties.
+func (i *Interpreter) objectDefineProperties(this Value, args []Value) Value {
+	obj := i.toObjectArgument(argument(args, 0), "defineProperties")
+	props := argument(args, 1)
+	if isNullish(props) {
+		i.throwError("TypeError", "Cannot convert undefined or null to object")
+	}
+	var keys []Value
+	var descriptors []*propertyDescriptor
+	for _, key := range i.ownKeys(props) {
+		if desc, ok := i.getOwnPropertyDescriptor(props, key); ok && desc.enumerable {
+			keys = append(keys, key)
+			descriptors = append(descriptors, i.toPropertyDescriptor(i.getMember(props, key)))
+		}
+	}
+	for idx, key := range keys {
+		i.definePropertyOrThrow(obj, key, descriptors[idx])
+	}
+	return obj
+}
+
+// objectGetOwnPropertyDescriptor implements
+// Object.getOwnPropertyDescriptor.
+func (i *Interpreter) objectGetOwnPropertyDescriptor(this Value, args []Value) Value {
+	obj := argument(args, 0)
+	if isNullish(obj) {
+		i.throwError("TypeError", "Cannot convert undefined or null to object")
+	}
+	if desc, ok := i.getOwnPropertyDescriptor(obj, i.toPropertyKey(argument(args, 1))); ok {
+		return fromPropertyDescriptor(desc)
+	}
+	return Undefined
+}
+
+// objectGetOwnPropertyDescriptors implements
+// Object.getOwnPropertyDescriptors.
+func (i *Interpreter) objectGetOwnPropertyDescriptors(this Value, args []Value) Value {
+	obj := argument(args, 0)
+	if isNullish(obj) {
+		i.throwError("TypeError", "Cannot convert undefined or null to object")
+	}
+	result := i.newObject()
+	for _, key := range i.ownKeys(obj) {
+		if desc, ok := i.getOwnPropertyDescriptor(obj, key); ok {
+			setOwnMember(result, key, fromPropertyDescriptor(desc))
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package engine
+
+import "testing"
+
+func TestArrayLength(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let a = [1, 2, 3]; a.length = 1; a.length + "," + a[1] + "," + a`, "1,undefined,1"},
+		{`let a = [1, 2, 3]; a.length = 1; a[5] = 6; a.length + "," + a[2]`, "6,undefined"},
+		{`let a = [1, 2, 3]; Object.defineProperty(a, "length", {value: 1}); a.length + "," + a[2] + "," + (1 in a)`, "1,undefined,false"},
+		{`let a = [1, 2]; a.length = 4; a.length + "," + a`, "4,1,2,,"},
+		{`let a = [1, 2]; Object.defineProperty(a, "length", {writable: false}); a[2] = 3; a.length + "," + a[2]`, "2,undefined"},
+		{`"use strict"; let a = [1, 2]; Object.defineProperty(a, "length", {writable: false}); a[2] = 3`, "Uncaught TypeError: Cannot add property 2, object is not extensible"},
+		{`let a = [1, 2]; Object.defineProperty(a, "length", {writable: false}); Reflect.defineProperty(a, "5", {value: 1}) + "," + a.length`, "false,2"},
+		{`let a = [1, 2]; Object.defineProperty(a, "length", {writable: false}); a[0] = 5; a[0]`, "5"},
+		{`let a = [1, 2]; Object.defineProperty(a, "length", {writable: false}); a.length = 0; a.length`, "2"},
+		{`let a = [1, 2, 3]; Object.defineProperty(a, "1", {value: 2, configurable: false}); a.length = 0; a.length + "," + a`, "2,1,2"},
+		{`let a = [1, 2, 3]; Object.defineProperty(a, "length", {value: 1, writable: false}); a.length = 3; a.length + "," + a`, "1,1"},
+		{`let a = [1]; a.length = "2"; a.length`, "2"},
+		{`let a = []; a.length = -1`, "Uncaught RangeError: Invalid array length"},
+		{`let a = []; a.length = 1.5`, "Uncaught RangeError: Invalid array length"},
+		{`let a = []; Object.defineProperty(a, "length", {value: 4294967296})`, "Uncaught RangeError: Invalid array length"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
@@ -1,12 +1,67 @@
 package engine
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
 
 type Environment struct {
-	store map[string]Value
-	outer *Environment
+	// bindings holds the scope's bindings while there are at most
+	// fewBindings of them, and store once there are more. Function scopes
+	// mostly hold a few, which a list finds as quickly as a map does and
+	// costs far less to create.
+	bindings []binding
+	store    map[string]Value
+	outer    *Environment
+
+	// Function scopes, and scopes that evaluate class field initializers,
+	// bind this along with what super and new.target need.
+	hasThis bool
+	this    Value
+	// thisUninitialized is set in derived class constructors until super()
+	// has bound this.
+	thisUninitialized bool
+	callee            Value
+	newTarget         Value
+	homeObject        Value
+
+	// arrow is set in the scope of an arrow function's body, which has no
+	// this of its own but does have its own await.
+	arrow bool
+	// strict is set in function, class and module scopes whose code is
+	// strict mode code.
+	strict bool
+	// generator and async are set in the scope of the body of a generator
+	// or async function respectively.
+	generator *coroutine
+	async     *coroutine
+
+	// privateNames holds the #names declared by a class body.
+	privateNames map[string]*PrivateName
+
+	// module is set in the scope of a module's body, where imports holds
+	// the bindings it imports from other modules.
+	module  *moduleRecord
+	imports map[string]importBinding
+
+	// code is set in the scope of a function body run as bytecode, and
+	// slots holds the locals the bytecode keeps out of its bindings.
+	code  *bytecode
+	slots []Value
 }
 
+// binding is a name bound in a scope and its value.
+type binding struct {
+	name  string
+	value Value
+}
+
+// fewBindings is the most bindings a scope keeps in a list.
+const fewBindings = 8
+
 func NewEnvironment() *Environment {
 	return &Environment{
 		store: make(map[string]Value),
@@ -15,33 +70,239 @@ func NewEnvironment() *Environment {
 }
 
 func (e *Environment) Get(name string) (Value, bool) {
-	val, ok := e.store[name]
-	if !ok && e.outer != nil {
-		return e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		if val, ok := env.own(name); ok {
+			return val, true
+		}
+		if binding, imported := env.imports[name]; imported {
+			return binding.get(), true
+		}
 	}
-	return val, ok
+	return Value{}, false
 }
 
 func (e *Environment) Set(name string, val Value) {
+	if e.store != nil {
+		e.store[name] = val
+		return
+	}
+	for idx := range e.bindings {
+		if e.bindings[idx].name == name {
+			e.bindings[idx].value = val
+			return
+		}
+	}
+	if len(e.bindings) < fewBindings {
+		e.bindings = append(e.bindings, binding{name: name, value: val})
+		return
+	}
+	e.store = make(map[string]Value, len(e.bindings)+1)
+	for _, b := range e.bindings {
+		e.store[b.name] = b.value
+	}
+	e.bindings = nil
 	e.store[name] = val
 }
 
+// own returns the binding of name in the scope itself, not those it is
+// nested in.
+func (e *Environment) own(name string) (Value, bool) {
+	for idx := range e.bindings {
+		if e.bindings[idx].name == name {
+			return e.bindings[idx].value, true
+		}
+	}
+	val, ok := e.store[name]
+	return val, ok
+}
+
+// Assign updates the binding of name in the nearest scope that declares it
+// and reports whether such a scope was found.
+func (e *Environment) Assign(name string, val Value) bool {
+	if env := e.resolve(name); env != nil {
+		env.Set(name, val)
+		return true
+	}
+	return false
+}
+
+// resolve returns the scope that binds name, or nil when it is not
+// declared.
+func (e *Environment) resolve(name string) *Environment {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.own(name); ok {
+			return env
+		}
+	}
+	return nil
+}
+
+// isImport reports whether name resolves to a binding imported from
+// another module, which cannot be assigned to.
+func (e *Environment) isImport(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.own(name); ok {
+			return false
+		}
+		if _, ok := env.imports[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bindSlots makes the scope run code, with slots for its locals. The
+// slots are followed by room for the operand stack, so that one
+// allocation serves both.
+func (e *Environment) bindSlots(code *bytecode) {
+	e.code = code
+	e.slots = make([]Value, len(code.locals), len(code.locals)+code.stackSize)
+	for idx := range e.slots {
+		e.slots[idx] = unbound
+	}
+}
+
+// ExtendEnvironment creates a scope nested in outer. Its map of bindings is
+// only made once it holds more than a few, since most function scopes are small.
 func ExtendEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{outer: outer}
+}
+
+// thisEnvironment returns the nearest enclosing scope that binds this,
+// which is a function, field initializer or the global scope.
+func (e *Environment) thisEnvironment() *Environment {
+	for env := e; env != nil; env = env.outer {
+		if env.hasThis {
+			return env
+		}
+	}
+	return nil
+}
+
+// functionEnvironment returns the scope of the innermost function body,
+// arrow functions included, or of the field initializer being evaluated.
+func (e *Environment) functionEnvironment() *Environment {
+	for env := e; env != nil; env = env.outer {
+		if env.hasThis || env.arrow {
+			return env
+		}
+	}
+	return nil
 }
 
 type Interpreter struct {
-	env       *Environment
-	debugMode bool
+	env                *Environment
+	global             Value
+	objectPrototype    Value
+	functionPrototype  Value
+	arrayPrototype     Value
+	iteratorPrototype  Value
+	generatorPrototype Value
+	promisePrototype   Value
+	promiseConstructor Value
+	symbolPrototype    Value
+	bigintPrototype    Value
+	regexpPrototype    Value
+	debugMode          bool
+
+	// primitivePrototypes are the prototypes of numbers, strings and
+	// booleans by type.
+	primitivePrototypes map[ValueType]Value
+
+	// errorPrototypes are the prototypes of Error and its subclasses by
+	// name, which the errors the engine throws inherit from.
+	errorPrototypes map[string]Value
+
+	// treeWalking is set when scripts are evaluated by walking their
+	// syntax trees rather than compiled to bytecode.
+	treeWalking bool
+	// optimizations are the passes made over the programs parsed.
+	optimizations Optimizations
+	// slots holds the locals and operand stacks of the scopeless
+	// functions being called, innermost last. spareSlots holds the
+	// chunks of slots calls that have returned set aside, for the calls
+	// after them to reuse.
+	slots      []Value
+	spareSlots [][]Value
+	// activations holds the calls of scopeless functions that run makes
+	// in place, set aside for the next run to reuse.
+	activations []activation
+
+	// joining holds the arrays Array.prototype.join is joining, innermost
+	// last.
+	joining []*Object
+
+	// console is the object console refers to unless the host defines
+	// a global of that name.
+	console Value
+
+	// regexpStepLimit bounds the backtracking of a single regular
+	// expression match.
+	regexpStepLimit int
+
+	// frames are the script, module and function bodies being evaluated,
+	// innermost last, which errors record as their stack.
+	frames []frame
+
+	// nesting counts the proxy internal methods and prototype chain walks
+	// in progress, which count against MaxCallDepth along with frames so
+	// that long proxy or prototype chains cannot overflow the Go stack.
+	nesting int
+
+	// strictScript is set while a script with a "use strict" directive
+	// runs its top-level code.
+	strictScript bool
+
+	// symbolRegistry holds the symbols created by Symbol.for by key.
+	symbolRegistry map[string]*Symbol
+
+	// jobQueue is the host's queue for promise jobs. Without one, jobs
+	// wait in jobs until the script has finished.
+	jobQueue JobQueue
+	jobs     []func()
+
+	// modules caches the modules loaded by moduleLoader by their
+	// resolved names.
+	moduleLoader ModuleLoader
+	modules      map[string]*moduleRecord
+
+	// limits bounds what scripts may use, and allocated counts the bytes
+	// they have allocated against limits.MaxMemory.
+	limits    Limits
+	allocated int64
+
+	// interrupt is the pending Interrupt, which other goroutines set.
+	interrupt atomic.Pointer[InterruptedError]
+
+	// abandoned collects the bodies of unreachable suspended generators
+	// and async functions, which are stopped on the interpreter's
+	// goroutine.
+	abandonedMu sync.Mutex
+	abandoned   []abandonedCoroutine
+	// coroutines holds the bodies of generators and async functions that
+	// have not finished, which Close stops.
+	coroutines map[*coroutine]struct{}
 }
 
 func NewInterpreter() *Interpreter {
-	return &Interpreter{
-		env:       NewEnvironment(),
-		debugMode: false,
+	i := &Interpreter{
+		env:             NewEnvironment(),
+		debugMode:       false,
+		regexpStepLimit: defaultRegExpStepLimit,
 	}
+
+	// The global object shares its property map with the global scope, so
+	// globals are visible through this and globalThis and vice versa.
+	i.global = Value{Type: TypeObject, Data: "global", Object: &Object{Properties: i.env.store}}
+	i.env.this = i.global
+	i.env.hasThis = true
+	i.env.Set("globalThis", i.global)
+	i.console = newConsole()
+	i.SetLimits(Limits{})
+
+	i.setupBuiltins()
+
+	return i
 }
 
 func (i *Interpreter) EnableDebug() {
@@ -52,6 +313,42 @@ func (i *Interpreter) DisableDebug() {
 	i.debugMode = false
 }
 
+// SetTreeWalking sets whether scripts are evaluated by walking their
+// syntax trees, which is slower than running the bytecode they are
+// otherwise compiled to but serves as the reference for it. Debug mode
+// always walks the trees, so that it can report each node it evaluates.
+// Functions already called keep running the way they started.
+func (i *Interpreter) SetTreeWalking(enabled bool) {
+	i.treeWalking = enabled
+}
+
+// programCode returns the bytecode to run a program with, or nil when it
+// is to be walked.
+func (i *Interpreter) programCode(program *Program) *bytecode {
+	if i.treeWalking || i.debugMode {
+		return nil
+	}
+	return program.compiled()
+}
+
+// functionCode returns the bytecode to run the body of f with, or nil
+// when it is to be walked.
+func (i *Interpreter) functionCode(f *Function) *bytecode {
+	if i.treeWalking || i.debugMode || f.literal == nil {
+		return nil
+	}
+	return f.literal.compiled()
+}
+
+// memberCode returns the bytecode to run a field initializer or static
+// block with, or nil when it is to be walked.
+func (i *Interpreter) memberCode(member *ClassMember) *bytecode {
+	if i.treeWalking || i.debugMode {
+		return nil
+	}
+	return member.compiled()
+}
+
 func (i *Interpreter) SetGlobal(name string, value interface{}) error {
 	var v Value
 	switch val := value.(type) {
@@ -63,6 +360,8 @@ func (i *Interpreter) SetGlobal(name string, value interface{}) error {
 		v = Value{Type: TypeString, Data: val}
 	case bool:
 		v = Value{Type: TypeBoolean, Data: val}
+	case func(...Value) Value:
+		v = NewFunction(val)
 	default:
 		v = Undefined
 	}
@@ -70,37 +369,149 @@ func (i *Interpreter) SetGlobal(name string, value interface{}) error {
 	return nil
 }
 
-func (i *Interpreter) Eval(code string) (Value, error) {
+// Eval evaluates a script and returns the value of its last statement. A
+// script that does not parse is not run, and its *SyntaxError returned.
+func (i *Interpreter) Eval(code string) (result Value, err error) {
+	return i.EvalScript("", code)
+}
+
+// EvalScript is Eval for a script called name, such as the file it was
+// read from, which the stack traces of errors refer to it by.
+func (i *Interpreter) EvalScript(name string, code string) (result Value, err error) {
 	if i.debugMode {
 		fmt.Println("🔍 Debug: Starting evaluation of code")
+		fmt.Println("🔍 Debug: Starting parsing")
 	}
 
-	lexer := NewLexer(code)
-	if i.debugMode {
-		fmt.Println("🔍 Debug: Starting lexical analysis")
+	program, err := Parse(name, code)
+	if err != nil {
+		return Undefined, err
 	}
-
-	parser := NewParser(lexer)
+	i.optimize(program)
 	if i.debugMode {
-		fmt.Println("🔍 Debug: Starting parsing")
+		fmt.Println("🔍 Debug: Parsing complete, beginning program evaluation")
 	}
+	return i.RunProgram(program)
+}
 
-	program := parser.ParseProgram()
-	if i.debugMode {
-		fmt.Println("🔍 Debug: Parsing complete, beginning program evaluation")
+// EvalWrappedScript is EvalScript for a script the host wraps, such as in
+// a function expression: it evaluates prefix + code + suffix, but stack
+// traces and syntax errors give positions within code, as in the file it
+// was read from. prefix must not contain a line break.
+func (i *Interpreter) EvalWrappedScript(name string, prefix string, code string, suffix string) (Value, error) {
+	l := newSourceLexer(name, prefix+code+suffix)
+	l.source.wrapper = len(prefix)
+	program, err := parseSource(l)
+	if err != nil {
+		return Undefined, err
 	}
+	i.optimize(program)
+	return i.RunProgram(program)
+}
 
-	result := i.evalProgram(program)
+// RunProgram runs a program returned by Parse, as Eval runs a script.
+func (i *Interpreter) RunProgram(program *Program) (result Value, err error) {
+	i.stopAbandonedCoroutines()
+
+	// Code evaluated by a host function called from a script runs in the
+	// global scope, not the scope of the call.
+	savedEnv := i.env
+	i.env = i.globalEnvironment()
+	defer func() {
+		i.env = savedEnv
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *JSException:
+				if i.debugMode {
+					fmt.Printf("🔍 Debug: Uncaught exception: %v\n", r)
+				}
+				result, err = Undefined, r
+			case *InterruptedError:
+				result, err = Undefined, r
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	result = i.evalProgram(program)
 	if i.debugMode {
 		fmt.Printf("🔍 Debug: Program evaluation complete, final result: %v\n", result.ToString())
 	}
+	i.runJobs()
+
+	return result, nil
+}
+
+// Call calls fn on behalf of the host with the given this value and
+// arguments. An exception thrown by fn is returned as a *JSException, and
+// an Interrupt that stops it as an *InterruptedError.
+func (i *Interpreter) Call(fn Value, this Value, args ...Value) (result Value, err error) {
+	if fn.Type != TypeFunction {
+		return Undefined, i.exception(i.NewError("TypeError", describeCallee(fn)+" is not a function"))
+	}
+	return i.hostCall(func() Value {
+		return i.applyFunction(fn, this, args)
+	})
+}
+
+// GetProperty reads the property name of obj on behalf of the host, as
+// obj[name] in a script would: through its prototype chain, getters and
+// proxy traps. The exception a getter or trap throws is returned as a
+// *JSException, and an Interrupt that stops it as an *InterruptedError.
+func (i *Interpreter) GetProperty(obj Value, name string) (Value, error) {
+	return i.hostCall(func() Value {
+		return i.getProperty(obj, name)
+	})
+}
 
+// SetProperty writes the property name of obj on behalf of the host, as
+// obj[name] = val in strict mode code would: calling setters and proxy
+// traps, and throwing a TypeError when the write is refused, such as for
+// a frozen object. Setting a property of a primitive does nothing.
+func (i *Interpreter) SetProperty(obj Value, name string, val Value) error {
+	_, err := i.hostCall(func() Value {
+		key := stringKey(name)
+		if isObject(obj) && !i.methodsOf(obj).set(obj, key, val, obj) {
+			i.throwSetFailure(obj, key)
+		}
+		return Undefined
+	})
+	return err
+}
+
+// hostCall runs fn on behalf of the host, returning the exception or
+// interrupt that stops it as an error.
+func (i *Interpreter) hostCall(fn func() Value) (result Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			interrupted, ok := r.(*InterruptedError)
+			if !ok {
+				panic(r)
+			}
+			result, err = Undefined, interrupted
+		}
+	}()
+	result, exception := i.tryCatch(fn)
+	if exception != nil {
+		return Undefined, exception
+	}
 	return result, nil
 }
 
 func (i *Interpreter) evalProgram(program *Program) Value {
 	var result Value = Undefined
 
+	savedStrict := i.strictScript
+	i.strictScript = program.Strict
+	defer func() { i.strictScript = savedStrict }()
+	i.pushFrame("", program.source)
+	defer i.popFrame()
+
+	if code := i.programCode(program); code != nil {
+		return i.run(code, nil)
+	}
+
 	for _, statement := range program.Statements {
 		if i.debugMode {
 			fmt.Printf("🔍 Debug: Evaluating statement: %T\n", statement)
@@ -128,6 +539,7 @@ func (i *Interpreter) evalStatement(stmt Statement) Value {
 	switch s := stmt.(type) {
 	case *LetStatement:
 		val := i.evalExpression(s.Value)
+		nameFunction(val, s.Name.Value)
 		if i.debugMode {
 			fmt.Printf("🔍 Debug: Let statement - binding '%s' to value: %v\n", s.Name.Value, val.ToString())
 		}
@@ -142,6 +554,26 @@ func (i *Interpreter) evalStatement(stmt Statement) Value {
 			Type: TypeReturn,
 			Data: &ReturnValue{Value: val},
 		}
+	case *FunctionDeclaration:
+		fn := i.evalExpression(s.Function)
+		if i.debugMode {
+			fmt.Printf("🔍 Debug: Function declaration - binding '%s'\n", s.Function.Name)
+		}
+		i.env.Set(s.Function.Name, fn)
+		return Undefined
+	case *ImportDeclaration:
+		i.throwError("SyntaxError", "Cannot use import statement outside a module")
+		return Undefined
+	case *ExportDeclaration:
+		i.throwError("SyntaxError", "Unexpected token 'export'")
+		return Undefined
+	case *ClassDeclaration:
+		class := i.evalClass(s.Class)
+		if i.debugMode {
+			fmt.Printf("🔍 Debug: Class declaration - binding '%s'\n", s.Class.Name)
+		}
+		i.env.Set(s.Class.Name, class)
+		return Undefined
 	case *ExpressionStatement:
 		if i.debugMode {
 			fmt.Println("🔍 Debug: Evaluating expression statement")
@@ -179,44 +611,34 @@ func (i *Interpreter) evalExpression(exp Expression) Value {
 	switch e := exp.(type) {
 	case *NumberLiteral:
 		return Value{Type: TypeNumber, Data: e.Value}
+	case *BigIntLiteral:
+		return NewBigInt(e.Value)
 	case *StringLiteral:
 		return Value{Type: TypeString, Data: e.Value}
+	case *RegExpLiteral:
+		return i.newRegExp(e.Pattern, e.Flags, i.regexpPrototype)
 	case *BooleanLiteral:
 		return Value{Type: TypeBoolean, Data: e.Value}
+	case *NullLiteral:
+		return Value{Type: TypeNull}
 	case *Identifier:
-		if val, ok := i.env.Get(e.Value); ok {
-			return val
-		}
-		if e.Value == "console" {
-			return Value{
-				Type: TypeObject,
-				Data: "console",
-				Properties: map[string]Value{
-					"log": {
-						Type: TypeFunction,
-						Data: func(args ...Value) Value {
-							for _, arg := range args {
-								fmt.Print(arg.ToString(), " ")
-							}
-							fmt.Println()
-							return Undefined
-						},
-					},
-				},
-			}
-		}
-		return Undefined
+		val, _ := i.lookupIdentifier(e.Value)
+		return val
 	case *PrefixExpression:
-		right := i.evalExpression(e.Right)
 		switch e.Operator {
-		case "!":
-			return Value{Type: TypeBoolean, Data: !right.ToBoolean()}
-		case "-":
-			if right.Type == TypeNumber {
-				return Value{Type: TypeNumber, Data: -right.Data.(float64)}
+		case "typeof":
+			// typeof is the one place an undeclared identifier may be used
+			// without error.
+			if ident, ok := e.Right.(*Identifier); ok {
+				val, _ := i.lookupIdentifier(ident.Value)
+				return Value{Type: TypeString, Data: val.TypeOf()}
 			}
+			return Value{Type: TypeString, Data: i.evalExpression(e.Right).TypeOf()}
+		case "delete":
+			return Value{Type: TypeBoolean, Data: i.evalDelete(e.Right)}
 		}
-		return Undefined
+
+		return i.prefixOperation(e.Operator, i.evalExpression(e.Right))
 	case *IfExpression:
 		condition := i.evalExpression(e.Condition)
 		if condition.ToBoolean() {
@@ -225,122 +647,773 @@ func (i *Interpreter) evalExpression(exp Expression) Value {
 			return i.evalBlockStatement(e.Alternative)
 		}
 		return Undefined
-	case *InfixExpression:
-		if e.Operator == "." {
-			left := i.evalExpression(e.Left)
-			if right, ok := e.Right.(*Identifier); ok {
-				if left.Properties != nil {
-					if prop, ok := left.Properties[right.Value]; ok {
-						return prop
-					}
-				}
-				if left.Type == TypeObject && left.Data == "console" && right.Value == "log" {
-					return Value{
-						Type: TypeFunction,
-						Data: func(args ...Value) Value {
-							for _, arg := range args {
-								fmt.Print(arg.ToString(), " ")
-							}
-							fmt.Println()
-							return Undefined
-						},
-					}
-				}
+
+	case *ThisExpression:
+		return i.resolveThis()
+	case *ClassLiteral:
+		return i.evalClass(e)
+	case *PrivateInExpression:
+		name := i.lookupPrivateName(e.Name)
+		obj := i.evalExpression(e.Right)
+		if obj.Type != TypeObject && obj.Type != TypeFunction {
+			i.throwError("TypeError", "Cannot use 'in' operator to search for '%s' in %s", e.Name, obj.ToString())
+		}
+		_, ok := i.privateElements(obj)[name]
+		return Value{Type: TypeBoolean, Data: ok}
+	case *ArrayLiteral:
+		elements := make([]Value, len(e.Elements))
+		for idx, el := range e.Elements {
+			elements[idx] = i.evalExpression(el)
+		}
+		i.checkArrayLength(int64(len(elements)))
+		return i.newArray(elements)
+	case *NewExpression:
+		callee := i.evalExpression(e.Callee)
+		args := make([]Value, len(e.Arguments))
+		for idx, arg := range e.Arguments {
+			args[idx] = i.evalExpression(arg)
+		}
+		i.setPosition(e.Token)
+		return i.construct(callee, args, callee)
+	case *AssignExpression:
+		val := i.evalExpression(e.Value)
+		switch target := e.Target.(type) {
+		case *Identifier:
+			i.assignIdentifier(target.Value, val)
+		case *MemberExpression:
+			i.assignMember(target, val)
+		}
+		return val
+	case *ObjectLiteral:
+		obj := i.newObject()
+		i.allocate(len(e.Properties) * propertySize)
+		for _, prop := range e.Properties {
+			key := stringKey(prop.Key)
+			if prop.ComputedKey != nil {
+				key = i.toPropertyKey(i.evalExpression(prop.ComputedKey))
 			}
-			return Undefined
+			if prop.Kind != PropertyValue {
+				i.defineObjectMethod(obj, prop, key)
+				continue
+			}
+			val := i.evalExpression(prop.Value)
+			nameFunction(val, functionNameForKey(key))
+			setOwnMember(obj, key, val)
 		}
-
+		return obj
+	case *MemberExpression:
+		val, _, _ := i.evalChain(e)
+		return val
+	case *InfixExpression:
 		left := i.evalExpression(e.Left)
 		right := i.evalExpression(e.Right)
+		i.setPosition(e.Token)
+		return i.infixOperation(e.Operator, left, right)
+	case *FunctionLiteral:
+		return i.evalFunctionLiteral(e)
+	case *YieldExpression:
+		generator := i.currentGenerator()
+		val := Undefined
+		if e.Argument != nil {
+			val = i.evalExpression(e.Argument)
+		}
+		if e.Delegate {
+			return i.yieldDelegate(generator, val)
+		}
+		return i.generatorYield(generator, val)
+	case *ImportCall:
+		specifier := i.evalExpression(e.Source).ToString()
+		return i.dynamicImport(specifier, i.currentModuleName())
+	case *ImportMeta:
+		return i.importMeta()
+	case *AwaitExpression:
+		body := i.currentAsync()
+		return i.await(body, i.evalExpression(e.Argument))
+	case *CallExpression:
+		val, _, _ := i.evalChain(e)
+		return val
+	case *ParenthesizedExpression:
+		val, _, _ := i.evalChain(e.Expression)
+		return val
+	default:
+		return Undefined
+	}
+}
 
-		switch e.Operator {
-		case "+":
-			return left.Add(right)
-		case "-":
-			return left.Subtract(right)
-		case "*":
-			return left.Multiply(right)
-		case "/":
-			return left.Divide(right)
-		case ">":
-			if left.Type == TypeNumber && right.Type == TypeNumber {
-				return Value{Type: TypeBoolean, Data: left.Data.(float64) > right.Data.(float64)}
+// evalFunctionLiteral creates a function from a function literal, which
+// keeps the current scope as the scope its body runs nested in.
+func (i *Interpreter) evalFunctionLiteral(e *FunctionLiteral) Value {
+	f := &Function{
+		Name:       e.Name,
+		Parameters: e.Parameters,
+		Body:       e.Body,
+		Env:        i.env,
+		Strict:     e.Strict,
+		Generator:  e.Generator,
+		Async:      e.Async,
+
+		interpreter: i,
+		source:      i.currentSource(),
+		literal:     e,
+		text:        e.text,
+	}
+	if e.Arrow {
+		f.Kind = ArrowFunction
+	}
+	fn := i.newFunctionObject(f)
+	if e.Generator {
+		fn.Object.Properties["prototype"] = i.newGeneratorFunctionPrototype()
+		return fn
+	}
+	if e.Arrow || e.Async {
+		return fn
+	}
+	proto := i.newObject()
+	proto.Object.Properties["constructor"] = fn
+	fn.Object.Properties["prototype"] = proto
+	return fn
+}
+
+// prefixOperation applies a unary operator other than typeof and delete,
+// which need their operand unevaluated, to its operand's value.
+func (i *Interpreter) prefixOperation(operator string, right Value) Value {
+	switch operator {
+	case "!":
+		return Value{Type: TypeBoolean, Data: !right.ToBoolean()}
+	case "+":
+		return Value{Type: TypeNumber, Data: i.toNumber(right)}
+	case "-":
+		if right = i.toNumeric(right); right.Type == TypeBigInt {
+			return NewBigInt(new(big.Int).Neg(right.Data.(*big.Int)))
+		}
+		return Value{Type: TypeNumber, Data: -right.Data.(float64)}
+	case "~":
+		if right = i.toNumeric(right); right.Type == TypeBigInt {
+			return NewBigInt(new(big.Int).Not(right.Data.(*big.Int)))
+		}
+		return Value{Type: TypeNumber, Data: float64(^toInt32(right))}
+	case "void":
+		return Undefined
+	}
+	return Undefined
+}
+
+// infixOperation applies a binary operator to the values of its operands.
+func (i *Interpreter) infixOperation(operator string, left, right Value) Value {
+	// Numbers, and strings joined with +, need no conversion first.
+	if left.Type == TypeNumber && right.Type == TypeNumber {
+		if op := infixOpcode(operator); op != opInfix {
+			return numberOperation(op, left.Data.(float64), right.Data.(float64))
+		}
+	}
+	if operator == "+" && isStringOrNumber(left) && isStringOrNumber(right) {
+		s := left.ToString() + right.ToString()
+		i.allocateString(s)
+		return Value{Type: TypeString, Data: s}
+	}
+
+	switch operator {
+	case "+", "-", "*", "/", "%", "**", "&", "|", "^", "<<", ">>", ">>>", ">", "<", ">=", "<=":
+		hint := "number"
+		if operator == "+" {
+			hint = "default"
+		}
+		left, right = i.toPrimitive(left, hint), i.toPrimitive(right, hint)
+		if left.Type == TypeSymbol || right.Type == TypeSymbol {
+			if operator == "+" {
+				i.throwError("TypeError", "Cannot convert a Symbol value to a string")
 			}
-			return Value{Type: TypeBoolean, Data: false}
-		case "<":
-			if left.Type == TypeNumber && right.Type == TypeNumber {
-				return Value{Type: TypeBoolean, Data: left.Data.(float64) < right.Data.(float64)}
+			i.throwError("TypeError", "Cannot convert a Symbol value to a number")
+		}
+	case "==", "!=":
+		// An object compared with a primitive other than undefined and
+		// null is compared as the primitive it converts to.
+		if isObject(left) != isObject(right) && !isNullish(left) && !isNullish(right) {
+			if isObject(left) {
+				left = i.toPrimitive(left, "default")
+			} else {
+				right = i.toPrimitive(right, "default")
 			}
-			return Value{Type: TypeBoolean, Data: false}
-		case ">=":
-			if left.Type == TypeNumber && right.Type == TypeNumber {
-				return Value{Type: TypeBoolean, Data: left.Data.(float64) >= right.Data.(float64)}
+		}
+	}
+
+	if left.Type == TypeBigInt || right.Type == TypeBigInt {
+		if result, ok := i.bigIntOperation(operator, left, right); ok {
+			return result
+		}
+	}
+
+	if result, ok := primitiveOperation(operator, left, right); ok {
+		if result.Type == TypeString {
+			i.allocateString(result.Data.(string))
+		}
+		return result
+	}
+
+	switch operator {
+	case "instanceof":
+		return Value{Type: TypeBoolean, Data: i.instanceOf(left, right)}
+	case "in":
+		if right.Type != TypeObject && right.Type != TypeFunction {
+			i.throwError("TypeError", "Cannot use 'in' operator to search for '%s' in %s", left.ToString(), right.ToString())
+		}
+		return Value{Type: TypeBoolean, Data: i.hasMember(right, i.toPropertyKey(left))}
+	}
+	return Undefined
+}
+
+func isStringOrNumber(v Value) bool {
+	return v.Type == TypeString || v.Type == TypeNumber
+}
+
+// primitiveOperation applies a binary operator other than instanceof and
+// in to operands that need no conversion first: primitives other than
+// symbols and BigInts, for == and != operands other than an object and a
+// primitive, and for === and !== any values. It reports whether operator
+// is one of them.
+func primitiveOperation(operator string, left, right Value) (Value, bool) {
+	switch operator {
+	case "+":
+		return left.Add(right), true
+	case "-":
+		return left.Subtract(right), true
+	case "*":
+		return left.Multiply(right), true
+	case "/":
+		return left.Divide(right), true
+	case "%":
+		return Value{Type: TypeNumber, Data: math.Mod(left.ToNumber(), right.ToNumber())}, true
+	case "**":
+		return Value{Type: TypeNumber, Data: exponentiate(left.ToNumber(), right.ToNumber())}, true
+	case "&":
+		return Value{Type: TypeNumber, Data: float64(toInt32(left) & toInt32(right))}, true
+	case "|":
+		return Value{Type: TypeNumber, Data: float64(toInt32(left) | toInt32(right))}, true
+	case "^":
+		return Value{Type: TypeNumber, Data: float64(toInt32(left) ^ toInt32(right))}, true
+	case "<<":
+		return Value{Type: TypeNumber, Data: float64(toInt32(left) << (toUint32(right) & 31))}, true
+	case ">>":
+		return Value{Type: TypeNumber, Data: float64(toInt32(left) >> (toUint32(right) & 31))}, true
+	case ">>>":
+		return Value{Type: TypeNumber, Data: float64(toUint32(left) >> (toUint32(right) & 31))}, true
+	case ">", "<", ">=", "<=":
+		return compare(operator, left, right), true
+	case "==":
+		return Value{Type: TypeBoolean, Data: looselyEqual(left, right)}, true
+	case "!=":
+		return Value{Type: TypeBoolean, Data: !looselyEqual(left, right)}, true
+	case "===":
+		return Value{Type: TypeBoolean, Data: left.Equals(right)}, true
+	case "!==":
+		return Value{Type: TypeBoolean, Data: !left.Equals(right)}, true
+	}
+	return Undefined, false
+}
+
+// assignIdentifier performs an assignment whose target is the binding
+// name.
+func (i *Interpreter) assignIdentifier(name string, val Value) {
+	nameFunction(val, name)
+	if i.env.isImport(name) {
+		i.throwError("TypeError", "Assignment to constant variable.")
+	}
+	// Global bindings are properties of the global object, some of which,
+	// such as NaN, are read-only.
+	if env := i.env.resolve(name); env != nil && env.outer != nil {
+		env.Set(name, val)
+	} else {
+		i.setMember(i.global, stringKey(name), val)
+	}
+}
+
+// lookupIdentifier resolves a name against the scope chain and reports
+// whether it is declared.
+func (i *Interpreter) lookupIdentifier(name string) (Value, bool) {
+	if val, ok := i.env.Get(name); ok {
+		return val, true
+	}
+	if name == "console" {
+		return i.console, true
+	}
+	return Undefined, false
+}
+
+// newConsole creates the console object scripts see when the host does
+// not define one.
+func newConsole() Value {
+	console := NewObject()
+	console.Object.Properties["log"] = NewFunction(func(args ...Value) Value {
+		for _, arg := range args {
+			fmt.Print(arg.ToString(), " ")
+		}
+		fmt.Println()
+		return Undefined
+	})
+	return console
+}
+
+// evalDelete implements the delete operator. Deleting a member removes the
+// object's own property; bindings cannot be deleted, and deleting any
+// other expression just evaluates it.
+func (i *Interpreter) evalDelete(exp Expression) bool {
+	switch e := exp.(type) {
+	case *MemberExpression:
+		if _, ok := e.Object.(*SuperExpression); ok {
+			i.throwError("ReferenceError", "Unsupported reference to 'super'")
+		}
+		obj, _, short := i.evalChain(e.Object)
+		if short || (e.Optional && isNullish(obj)) {
+			return true
+		}
+		key := i.memberKey(e)
+		if isNullish(obj) {
+			i.throwError("TypeError", "Cannot convert undefined or null to object")
+		}
+		if !i.deleteMember(obj, key) {
+			if _, ok := obj.Data.(*Proxy); ok && i.isStrict() {
+				i.throwError("TypeError", "'deleteProperty' on proxy: trap returned falsish for property '%s'", key.ToString())
 			}
-			return Value{Type: TypeBoolean, Data: false}
-		case "<=":
-			if left.Type == TypeNumber && right.Type == TypeNumber {
-				return Value{Type: TypeBoolean, Data: left.Data.(float64) <= right.Data.(float64)}
+			if i.isStrict() {
+				i.throwError("TypeError", "Cannot delete property '%s' of %s", key.ToString(), i.describeObject(obj))
 			}
-			return Value{Type: TypeBoolean, Data: false}
-		case "==":
-			return Value{Type: TypeBoolean, Data: left.Equals(right)}
-		case "!=":
-			return Value{Type: TypeBoolean, Data: !left.Equals(right)}
+			return false
 		}
-		return Undefined
-	case *FunctionLiteral:
-		params := e.Parameters
-		body := e.Body
-		return Value{
-			Type: TypeFunction,
-			Data: &Function{
-				Parameters: params,
-				Body:       body,
-				Env:        i.env,
-			},
+		return true
+	case *Identifier:
+		return false
+	}
+	i.evalExpression(exp)
+	return true
+}
+
+// evalChain evaluates a member or call expression, which may be part of
+// an optional chain. Along with the value it returns the this value a call
+// of it would receive, and it reports whether a ?. in the chain found a
+// null or undefined value, in which case the rest of the chain is skipped
+// and the value is undefined.
+func (i *Interpreter) evalChain(exp Expression) (val Value, this Value, shortCircuited bool) {
+	switch e := exp.(type) {
+	case *MemberExpression:
+		if _, ok := e.Object.(*SuperExpression); ok {
+			this := i.resolveThis()
+			return i.lookupMember(i.superBase(), i.memberKey(e), this), this, false
+		}
+
+		obj, _, short := i.evalChain(e.Object)
+		if short || (e.Optional && isNullish(obj)) {
+			return Undefined, Undefined, true
 		}
+		if private, ok := e.Property.(*PrivateIdentifier); ok {
+			return i.privateGet(obj, i.lookupPrivateName(private.Name)), obj, false
+		}
+		key := i.memberKey(e)
+		i.setPosition(memberPosition(e))
+		if isNullish(obj) {
+			i.throwError("TypeError", "Cannot read properties of %s (reading '%s')", obj.ToString(), key.ToString())
+		}
+		return i.getMember(obj, key), obj, false
 	case *CallExpression:
-		fn := i.evalExpression(e.Function)
-		args := make([]Value, len(e.Arguments))
-		for idx, arg := range e.Arguments {
-			args[idx] = i.evalExpression(arg)
+		if _, ok := e.Function.(*SuperExpression); ok {
+			return i.superCall(i.env.thisEnvironment(), i.evalArguments(e.Arguments)), Undefined, false
 		}
-		return i.applyFunction(fn, args)
-	default:
-		return Undefined
+
+		// A call through a member expression passes the object as this; any
+		// other call leaves this undefined.
+		fn, this, short := i.evalChain(e.Function)
+		if short || (e.Optional && isNullish(fn)) {
+			return Undefined, Undefined, true
+		}
+		args := i.evalArguments(e.Arguments)
+		i.setPosition(callPosition(e))
+		if fn.Type != TypeFunction {
+			i.throwError("TypeError", "%s is not a function", describeExpression(e.Function))
+		}
+		return i.applyFunction(fn, this, args), Undefined, false
+	case *ParenthesizedExpression:
+		// The chain inside ends here, but a call of it still receives the
+		// object as this.
+		val, this, _ := i.evalChain(e.Expression)
+		return val, this, false
+	}
+	return i.evalExpression(exp), Undefined, false
+}
+
+func (i *Interpreter) evalArguments(exps []Expression) []Value {
+	args := make([]Value, len(exps))
+	for idx, arg := range exps {
+		args[idx] = i.evalExpression(arg)
+	}
+	return args
+}
+
+// memberKey returns the property key a non-private member expression
+// accesses, evaluating the key expression of computed members.
+func (i *Interpreter) memberKey(e *MemberExpression) Value {
+	if e.Computed {
+		return i.toPropertyKey(i.evalExpression(e.Property))
+	}
+	if name, ok := e.Property.(*Identifier); ok {
+		return stringKey(name.Value)
 	}
+	return stringKey("")
 }
 
-func (i *Interpreter) applyFunction(fn Value, args []Value) Value {
+// assignMember performs an assignment whose target is a member
+// expression.
+func (i *Interpreter) assignMember(e *MemberExpression, val Value) {
+	var obj Value
+	if _, ok := e.Object.(*SuperExpression); ok {
+		obj = i.resolveThis()
+	} else {
+		obj = i.evalExpression(e.Object)
+	}
+	if private, ok := e.Property.(*PrivateIdentifier); ok {
+		i.privateSet(obj, i.lookupPrivateName(private.Name), val)
+		return
+	}
+	key := i.memberKey(e)
+	i.setPosition(memberPosition(e))
+	if isNullish(obj) {
+		i.throwError("TypeError", "Cannot set properties of %s (setting '%s')", obj.ToString(), key.ToString())
+	}
+	i.setMember(obj, key, val)
+}
+
+// memberPosition returns the token a member expression is reported at:
+// the property name, or the [ of a computed member.
+func memberPosition(e *MemberExpression) Token {
+	if name, ok := e.Property.(*Identifier); ok && !e.Computed {
+		return name.Token
+	}
+	return e.Token
+}
+
+// callPosition returns the token a call is reported at: the name of the
+// function called, or else the ( of the arguments.
+func callPosition(e *CallExpression) Token {
+	switch callee := e.Function.(type) {
+	case *Identifier:
+		return callee.Token
+	case *MemberExpression:
+		return memberPosition(callee)
+	}
+	return e.Token
+}
+
+// isNullish reports whether v is null or undefined.
+func isNullish(v Value) bool {
+	return v.Type == TypeUndefined || v.Type == TypeNull
+}
+
+// describeExpression renders the callee of a failed call for error
+// messages, such as obj.method.
+func describeExpression(exp Expression) string {
+	switch e := exp.(type) {
+	case *Identifier:
+		return e.Value
+	case *ThisExpression:
+		return "this"
+	case *MemberExpression:
+		switch property := e.Property.(type) {
+		case *Identifier:
+			if !e.Computed {
+				return describeExpression(e.Object) + "." + property.Value
+			}
+		case *PrivateIdentifier:
+			return describeExpression(e.Object) + "." + property.Name
+		}
+		return describeExpression(e.Object) + "[...]"
+	case *CallExpression:
+		return describeExpression(e.Function) + "(...)"
+	case *ParenthesizedExpression:
+		return "(" + describeExpression(e.Expression) + ")"
+	}
+	return "expression"
+}
+
+// getOwnProperty reads a property of the value itself, ignoring its
+// prototype chain. Functions expose name and length as own properties.
+func (i *Interpreter) getOwnProperty(obj Value, name string) (Value, bool) {
+	if prop, ok := ownSlot(obj, stringKey(name)); ok {
+		return prop, true
+	}
+	if obj.Type == TypeFunction {
+		switch name {
+		case "name":
+			return Value{Type: TypeString, Data: obj.FunctionName()}, true
+		case "length":
+			return Value{Type: TypeNumber, Data: float64(obj.FunctionLength())}, true
+		}
+	}
+	return Undefined, false
+}
+
+// instanceOf implements the instanceof operator. A constructor may decide
+// what its instances are with a Symbol.hasInstance method; otherwise obj
+// is an instance when the constructor's prototype object appears in its
+// prototype chain.
+func (i *Interpreter) instanceOf(obj Value, constructor Value) bool {
+	if constructor.Type != TypeObject && constructor.Type != TypeFunction {
+		i.throwError("TypeError", "Right-hand side of 'instanceof' is not an object")
+	}
+	if hasInstance := i.getMember(constructor, symbolKey(symbolHasInstance)); !isNullish(hasInstance) {
+		if hasInstance.Type != TypeFunction {
+			i.throwError("TypeError", "%s is not a function", hasInstance.ToString())
+		}
+		return i.applyFunction(hasInstance, constructor, []Value{obj}).ToBoolean()
+	}
+	if constructor.Type != TypeFunction {
+		i.throwError("TypeError", "Right-hand side of 'instanceof' is not callable")
+	}
+	return i.ordinaryHasInstance(constructor, obj)
+}
+
+// ordinaryHasInstance reports whether the prototype object of constructor
+// appears in the prototype chain of obj, which is what instanceof checks
+// unless the constructor overrides Symbol.hasInstance.
+func (i *Interpreter) ordinaryHasInstance(constructor Value, obj Value) bool {
+	if constructor.Type != TypeFunction {
+		return false
+	}
+	if bound, ok := constructor.Data.(*BoundFunction); ok {
+		return i.instanceOf(obj, bound.Target)
+	}
+	if obj.Type != TypeObject && obj.Type != TypeFunction {
+		return false
+	}
+
+	proto := i.getProperty(constructor, "prototype")
+	if proto.Type != TypeObject {
+		i.throwError("TypeError", "Function has non-object prototype '%s' in instanceof check", proto.ToString())
+	}
+	for o := i.prototypeOf(obj); o.Type != TypeNull; o = i.prototypeOf(o) {
+		if sameObject(o, proto) {
+			return true
+		}
+	}
+	return false
+}
+
+// construct implements the new operator. newTarget is the constructor new
+// was applied to, which differs from constructor while super() runs the
+// constructors of base classes.
+func (i *Interpreter) construct(constructor Value, args []Value, newTarget Value) Value {
+	switch f := constructor.Data.(type) {
+	case *Function:
+		if !isConstructor(constructor) {
+			break
+		}
+		if f.Kind == DerivedConstructor {
+			return i.constructDerived(constructor, f, args, newTarget)
+		}
+		obj := i.objectFromConstructor(newTarget)
+		if f.Kind == ClassConstructor {
+			i.initializeInstanceElements(obj, constructor)
+		}
+		result := i.callFunction(constructor, f, obj, args, newTarget)
+		if result.Type == TypeObject || result.Type == TypeFunction {
+			return result
+		}
+		return obj
+	case *BoundFunction:
+		boundArgs := append(append([]Value{}, f.BoundArgs...), args...)
+		if sameObject(newTarget, constructor) {
+			newTarget = f.Target
+		}
+		return i.construct(f.Target, boundArgs, newTarget)
+	case *NativeFunction:
+		if f.Construct != nil {
+			return f.Construct(args, newTarget)
+		}
+	case *Proxy:
+		if f.constructor {
+			return i.proxyConstruct(f, args, newTarget)
+		}
+	}
+	i.throwError("TypeError", "%s is not a constructor", describeCallee(constructor))
+	return Undefined
+}
+
+// isConstructor reports whether new can be applied to v.
+func isConstructor(v Value) bool {
+	switch f := v.Data.(type) {
+	case *Function:
+		return f.Kind != MethodFunction && f.Kind != ArrowFunction && !f.Generator && !f.Async
+	case *BoundFunction:
+		return isConstructor(f.Target)
+	case *NativeFunction:
+		return f.Construct != nil
+	case *Proxy:
+		return f.constructor
+	}
+	return false
+}
+
+// objectFromConstructor allocates the this object for new, inheriting from
+// newTarget.prototype, or from Object.prototype when that is not an object.
+func (i *Interpreter) objectFromConstructor(newTarget Value) Value {
+	obj := i.newObject()
+	if proto := i.getProperty(newTarget, "prototype"); proto.Type == TypeObject || proto.Type == TypeFunction {
+		obj.Object.Prototype = proto
+	}
+	return obj
+}
+
+// describeObject names an object in error messages about its properties
+// by its constructor, as in #<Point>.
+func (i *Interpreter) describeObject(obj Value) string {
+	if obj.Type == TypeFunction {
+		return "function '" + describeCallee(obj) + "'"
+	}
+	name := "Object"
+	if constructor := i.getProperty(obj, "constructor"); constructor.Type == TypeFunction && constructor.FunctionName() != "" {
+		name = constructor.FunctionName()
+	}
+	return "#<" + name + ">"
+}
+
+// describeCallee names a value in error messages about calls.
+func describeCallee(v Value) string {
+	if v.Type == TypeFunction && v.FunctionName() != "" {
+		return v.FunctionName()
+	}
+	return v.ToString()
+}
+
+// nameFunction gives an anonymous function literal the name of the binding
+// or property it is assigned to.
+func nameFunction(val Value, name string) {
+	if fn, ok := val.Data.(*Function); ok && fn.Name == "" {
+		fn.Name = name
+	}
+}
+
+func (i *Interpreter) applyFunction(fn Value, this Value, args []Value) Value {
 	if fn.Type != TypeFunction {
 		return Undefined
 	}
 
 	switch f := fn.Data.(type) {
 	case func(...Value) Value:
+		defer i.recordHostStack()
 		return f(args...)
+	case *NativeFunction:
+		defer i.recordHostStack()
+		return f.Fn(this, args)
+	case *BoundFunction:
+		boundArgs := append(append([]Value{}, f.BoundArgs...), args...)
+		return i.applyFunction(f.Target, f.BoundThis, boundArgs)
 	case *Function:
-		extendedEnv := ExtendEnvironment(f.Env)
-		for idx, param := range f.Parameters {
-			if idx < len(args) {
-				extendedEnv.Set(param.Value, args[idx])
-			}
+		if f.Kind == ClassConstructor || f.Kind == DerivedConstructor {
+			i.throwError("TypeError", "Class constructor %s cannot be invoked without 'new'", f.Name)
 		}
-		savedEnv := i.env
-		i.env = extendedEnv
-		evaluated := i.evalStatement(f.Body)
-		i.env = savedEnv
-		if evaluated.Type == TypeReturn {
-			if returnValue, ok := evaluated.Data.(*ReturnValue); ok {
-				return returnValue.Value
-			}
+		if f.Generator {
+			return i.startGenerator(fn, f, this, args)
 		}
-		return evaluated
+		if f.Async {
+			return i.startAsync(fn, f, this, args)
+		}
+		return i.callFunction(fn, f, this, args, Undefined)
+	case *Proxy:
+		return i.proxyCall(f, this, args)
 	default:
 		return Undefined
 	}
 }
 
+// recordHostStack gives an exception thrown by a host function, which
+// has no interpreter to take the stack from, the stack of its call. It
+// must be deferred.
+func (i *Interpreter) recordHostStack() {
+	if r := recover(); r != nil {
+		if e, ok := r.(*JSException); ok && e.Stack == nil {
+			e.Stack = i.captureStack()
+		}
+		panic(r)
+	}
+}
+
+func (i *Interpreter) callFunction(fn Value, f *Function, this Value, args []Value, newTarget Value) Value {
+	if code := i.functionCode(f); code != nil && code.scopeless {
+		return i.callScopeless(f, code, this, args, newTarget)
+	}
+	return i.evalFunctionBody(f, i.newFunctionEnvironment(fn, f, this, args, newTarget))
+}
+
+// newFunctionEnvironment creates the scope for a call of fn, binding its
+// parameters and this.
+func (i *Interpreter) newFunctionEnvironment(fn Value, f *Function, this Value, args []Value, newTarget Value) *Environment {
+	extendedEnv := ExtendEnvironment(f.Env)
+	extendedEnv.strict = f.Strict
+	if f.Kind == ArrowFunction {
+		// Arrow functions see this, super and new.target of the scope they
+		// were defined in.
+		extendedEnv.arrow = true
+	} else {
+		extendedEnv.this = i.thisForCall(f, this)
+		extendedEnv.hasThis = true
+		extendedEnv.callee = fn
+		extendedEnv.newTarget = newTarget
+		extendedEnv.homeObject = f.HomeObject
+	}
+	code := i.functionCode(f)
+	if code != nil {
+		extendedEnv.bindSlots(code)
+	} else if len(f.Parameters) <= fewBindings {
+		extendedEnv.bindings = make([]binding, 0, len(f.Parameters))
+	}
+	for idx, param := range f.Parameters {
+		val := Undefined
+		if idx < len(args) {
+			val = args[idx]
+		}
+		if code != nil && code.params[idx] >= 0 {
+			extendedEnv.slots[code.params[idx]] = val
+		} else {
+			extendedEnv.Set(param.Value, val)
+		}
+	}
+	return extendedEnv
+}
+
+func (i *Interpreter) evalFunctionBody(f *Function, env *Environment) Value {
+	if f.Body == nil {
+		return Undefined
+	}
+	i.checkInterrupt()
+	savedEnv := i.env
+	i.pushCallFrame(f, env.this, env.newTarget)
+	i.env = env
+	defer func() {
+		i.env = savedEnv
+		i.popFrame()
+	}()
+	if env.code != nil {
+		return i.run(env.code, env.slots)
+	}
+	evaluated := i.evalStatement(f.Body)
+	if evaluated.Type == TypeReturn {
+		if returnValue, ok := evaluated.Data.(*ReturnValue); ok {
+			return returnValue.Value
+		}
+	}
+	return Undefined
+}
+
+// thisForCall computes the this binding for a call to f: strict functions
+// see this exactly as passed, sloppy ones see the global object in place of
+// undefined or null and an object wrapping any other primitive.
+func (i *Interpreter) thisForCall(f *Function, this Value) Value {
+	if f.Strict {
+		return this
+	}
+	if isNullish(this) {
+		return i.global
+	}
+	return i.toObject(this)
+}
+
 type ReturnValue struct {
 	Value Value
 }
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stackTraceLimit is the number of frames an error records, innermost
+// first.
+const stackTraceLimit = 10
+
+// JSException is a JavaScript exception. While the interpreter runs it
+// propagates as a panic, and Eval returns it as an error once it escapes
+// the script.
+type JSException struct {
+	Value Value
+	// Stack is the stack recorded by the error object that was thrown or,
+	// when another value was thrown, the stack where it was thrown.
+	Stack []StackFrame
+}
+
+func (e *JSException) Error() string {
+	if e.Value.Type == TypeObject && e.Value.Object != nil {
+		name, hasName := errorField(e.Value, "name")
+		message, hasMessage := errorField(e.Value, "message")
+		if hasName && hasMessage {
+			return "Uncaught " + name.ToString() + ": " + message.ToString()
+		}
+	}
+	return "Uncaught " + e.Value.ToString()
+}
+
+// errorField reads the data property name of an error object or of the
+// prototypes it was given, such as the name of a TypeError, without an
+// interpreter.
+func errorField(err Value, name string) (Value, bool) {
+	for o := err; o.Object != nil; o = o.Object.Prototype {
+		if prop, ok := o.Object.Properties[name]; ok && prop.Type != TypeAccessor {
+			return prop, true
+		}
+	}
+	return Undefined, false
+}
+
+// StackFrame is a script or function whose code was running when an error
+// was created, and the line and column, counting from 1, that it had
+// reached. Function is empty for the top-level code of a script or module
+// and for anonymous functions, and Script is the name the code was
+// evaluated under.
+type StackFrame struct {
+	Function string
+	Script   string
+	Line     int
+	Column   int
+}
+
+// String formats the frame as a line of a stack trace does, without the
+// leading "at".
+func (f StackFrame) String() string {
+	script := f.Script
+	if script == "" {
+		script = "<anonymous>"
+	}
+	location := fmt.Sprintf("%s:%d:%d", script, f.Line, f.Column)
+	if f.Function == "" {
+		return location
+	}
+	return f.Function + " (" + location + ")"
+}
+
+// frame is a script, module or function body being evaluated. offset is
+// the position in its source of the code it is running, and receiver is
+// the this value a method was called with, which names the frame.
+type frame struct {
+	function string
+	receiver Value
+	source   *source
+	offset   int
+}
+
+// pushFrame enters the body of a function named function, or of a script
+// when function is empty, whose code is in src. Every pushFrame is paired
+// with a deferred popFrame.
+func (i *Interpreter) pushFrame(function string, src *source) {
+	i.checkCallDepth()
+	i.frames = append(i.frames, frame{function: function, source: src})
+}
+
+// pushCallFrame enters the body of f called with this, or constructing
+// an object when newTarget is defined.
+func (i *Interpreter) pushCallFrame(f *Function, this Value, newTarget Value) {
+	i.pushFrame(f.Name, f.source)
+	switch {
+	case f.Name == "":
+	case newTarget.Type != TypeUndefined:
+		i.frames[len(i.frames)-1].function = "new " + f.Name
+	case f.Kind != ArrowFunction:
+		i.frames[len(i.frames)-1].receiver = this
+	}
+}
+
+func (i *Interpreter) popFrame() {
+	i.frames = i.frames[:len(i.frames)-1]
+}
+
+// checkCallDepth throws a RangeError when calls and nested internal
+// methods have reached MaxCallDepth.
+func (i *Interpreter) checkCallDepth() {
+	if len(i.frames)+i.nesting >= i.limits.MaxCallDepth {
+		i.throwError("RangeError", "Maximum call stack size exceeded")
+	}
+}
+
+// pushNesting enters an internal method of a proxy or a step along a
+// prototype chain, which may recurse without calling a function. Every
+// pushNesting is paired with a deferred popNesting.
+func (i *Interpreter) pushNesting() {
+	i.checkCallDepth()
+	i.nesting++
+}
+
+func (i *Interpreter) popNesting() {
+	i.nesting--
+}
+
+// setPosition records that the innermost frame has reached tok.
+func (i *Interpreter) setPosition(tok Token) {
+	i.setOffset(tok.start)
+}
+
+// setOffset records that the innermost frame has reached offset in its
+// source.
+func (i *Interpreter) setOffset(offset int) {
+	if n := len(i.frames); n > 0 {
+		i.frames[n-1].offset = offset
+	}
+}
+
+// currentSource returns the source of the code that is running.
+func (i *Interpreter) currentSource() *source {
+	if n := len(i.frames); n > 0 {
+		return i.frames[n-1].source
+	}
+	return nil
+}
+
+// captureStack returns the frames that are running, innermost first.
+func (i *Interpreter) captureStack() []StackFrame {
+	var stack []StackFrame
+	for idx := len(i.frames) - 1; idx >= 0 && len(stack) < stackTraceLimit; idx-- {
+		f := i.frames[idx]
+		sf := StackFrame{Function: f.function}
+		if name := i.receiverName(f.receiver); name != "" {
+			sf.Function = name + "." + f.function
+		}
+		if f.source != nil {
+			sf.Script = f.source.name
+			sf.Line, sf.Column = f.source.position(f.offset)
+		}
+		stack = append(stack, sf)
+	}
+	return stack
+}
+
+// receiverName returns the name a method called on receiver is shown
+// under: the name of a class or constructor function for its static
+// methods, and otherwise the name of the constructor its prototypes
+// hold. It reads only data properties, so that capturing a stack runs no
+// code, and returns "" for functions called without an object.
+func (i *Interpreter) receiverName(receiver Value) string {
+	if receiver.Object == nil || receiver.Object == i.global.Object {
+		return ""
+	}
+	if receiver.Type == TypeFunction {
+		if name := receiver.FunctionName(); name != "" {
+			return name
+		}
+		return "Function"
+	}
+	for o := receiver; o.Object != nil; o = o.Object.Prototype {
+		if _, ok := o.Data.(*Proxy); ok {
+			break
+		}
+		if c, ok := o.Object.Properties["constructor"]; ok && c.Type == TypeFunction {
+			if name := c.FunctionName(); name != "" {
+				return name
+			}
+			break
+		}
+	}
+	return "Object"
+}
+
+// errorData is the internal state of an error object: the stack recorded
+// when it was created.
+type errorData struct {
+	stack []StackFrame
+}
+
+// newError creates an error object such as a TypeError, which records
+// stack as its stack property.
+func newError(name string, message string, stack []StackFrame) Value {
+	err := NewObject()
+	err.Object.Properties["name"] = Value{Type: TypeString, Data: name}
+	err.Object.Properties["message"] = Value{Type: TypeString, Data: message}
+	return setStack(err, name, message, stack)
+}
+
+// NewError creates an error object such as a TypeError, which inherits
+// from the prototype of the constructor of that name and records the
+// stack of the code that is running. Host functions throw it by
+// panicking with a *JSException.
+func (i *Interpreter) NewError(name string, message string) Value {
+	err := newError(name, message, i.captureStack())
+	err.Object.interpreter = i
+	if proto, ok := i.errorPrototypes[name]; ok {
+		err.Object.Prototype = proto
+	}
+	return err
+}
+
+// setStack records stack on an error object as its internal state and as
+// its stack property, which begins with its name and message, and
+// returns the error with that state.
+func setStack(err Value, name string, message string, stack []StackFrame) Value {
+	err.Data = &errorData{stack: stack}
+	var trace strings.Builder
+	trace.WriteString(name)
+	if message != "" {
+		trace.WriteString(": " + message)
+	}
+	for _, f := range stack {
+		trace.WriteString("\n    at " + f.String())
+	}
+	err.Object.Properties["stack"] = Value{Type: TypeString, Data: trace.String()}
+	setAttributes(err, stringKey("stack"), nonEnumerable)
+	return err
+}
+
+// errorNames are the constructors of the errors the engine throws, Error
+// first since the others inherit from it.
+var errorNames = []string{"Error", "TypeError", "RangeError", "ReferenceError", "SyntaxError", "EvalError", "URIError"}
+
+// setupErrors defines Error and its subclasses. Called as functions they
+// construct errors too.
+func (i *Interpreter) setupErrors() {
+	i.errorPrototypes = make(map[string]Value)
+	var base Value
+	for _, name := range errorNames {
+		proto := i.newObject()
+		proto.Object.Properties["name"] = Value{Type: TypeString, Data: name}
+		proto.Object.Properties["message"] = Value{Type: TypeString, Data: ""}
+		setAttributes(proto, stringKey("name"), nonEnumerable)
+		setAttributes(proto, stringKey("message"), nonEnumerable)
+
+		constructor := i.newNativeFunction(name, 1, nil)
+		native := constructor.Data.(*NativeFunction)
+		native.Construct = func(args []Value, newTarget Value) Value {
+			return i.constructError(proto, args, newTarget)
+		}
+		native.Fn = func(this Value, args []Value) Value {
+			return native.Construct(args, constructor)
+		}
+		constructor.Object.Properties["prototype"] = proto
+		proto.Object.Properties["constructor"] = constructor
+		setAttributes(proto, stringKey("constructor"), nonEnumerable)
+
+		if name == "Error" {
+			base = constructor
+			i.defineMethod(proto, "toString", 0, i.errorToString)
+		} else {
+			proto.Object.Prototype = i.errorPrototypes["Error"]
+			constructor.Object.Prototype = base
+		}
+		i.errorPrototypes[name] = proto
+		i.env.Set(name, constructor)
+	}
+}
+
+// constructError implements the error constructors: the error records
+// the stack where it was created, a message when one is given and the
+// cause option.
+func (i *Interpreter) constructError(proto Value, args []Value, newTarget Value) Value {
+	err := i.newObject()
+	err.Object.Prototype = proto
+	if p := i.getProperty(newTarget, "prototype"); isObject(p) {
+		err.Object.Prototype = p
+	}
+	if message := argument(args, 0); message.Type != TypeUndefined {
+		err.Object.Properties["message"] = Value{Type: TypeString, Data: i.toString(message)}
+		setAttributes(err, stringKey("message"), nonEnumerable)
+	}
+	if options := argument(args, 1); isObject(options) && i.hasProperty(options, "cause") {
+		err.Object.Properties["cause"] = i.getProperty(options, "cause")
+		setAttributes(err, stringKey("cause"), nonEnumerable)
+	}
+	name := i.getProperty(err, "name")
+	return setStack(err, i.toString(name), i.toString(i.getProperty(err, "message")), i.captureStack())
+}
+
+// errorToString implements Error.prototype.toString.
+func (i *Interpreter) errorToString(this Value, args []Value) Value {
+	if !isObject(this) {
+		i.throwError("TypeError", "Error.prototype.toString requires that 'this' be an Object")
+	}
+	name, message := "Error", ""
+	if v := i.getProperty(this, "name"); v.Type != TypeUndefined {
+		name = i.toString(v)
+	}
+	if v := i.getProperty(this, "message"); v.Type != TypeUndefined {
+		message = i.toString(v)
+	}
+	switch {
+	case name == "":
+		return Value{Type: TypeString, Data: message}
+	case message == "":
+		return Value{Type: TypeString, Data: name}
+	}
+	return Value{Type: TypeString, Data: name + ": " + message}
+}
+
+// ErrorStack returns the stack an error object created by the engine
+// recorded, or nil for any other value.
+func ErrorStack(v Value) []StackFrame {
+	if data, ok := v.Data.(*errorData); ok && v.Type == TypeObject {
+		return data.stack
+	}
+	return nil
+}
+
+// exception wraps a thrown value in a JSException, with the stack of the
+// error object or else the current stack.
+func (i *Interpreter) exception(v Value) *JSException {
+	if data, ok := v.Data.(*errorData); ok && v.Type == TypeObject {
+		return &JSException{Value: v, Stack: data.stack}
+	}
+	return &JSException{Value: v, Stack: i.captureStack()}
+}
+
+// throwError throws a new error object of the given name, unwinding to the
+// nearest Eval.
+func (i *Interpreter) throwError(name string, format string, args ...interface{}) {
+	panic(i.exception(i.NewError(name, fmt.Sprintf(format, args...))))
+}
+
+// tryCatch runs fn and returns the exception it throws, if any, instead of
+// letting it unwind further.
+func (i *Interpreter) tryCatch(fn func() Value) (result Value, exception *JSException) {
+	savedEnv := i.env
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*JSException)
+			if !ok {
+				panic(r)
+			}
+			i.env = savedEnv
+			result, exception = Undefined, e
+		}
+	}()
+	return fn(), nil
+}
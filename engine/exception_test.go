@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorConstructors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`new Error("boom").stack`, "Error: boom\n    at <anonymous>:1:1"},
+		{`function f() { return new TypeError("in f"); } f().stack`, "TypeError: in f\n    at f (<anonymous>:1:23)\n    at <anonymous>:1:48"},
+		{`Error("called").message`, "called"},
+		{`new Error().message`, ""},
+		{`new RangeError("r").toString()`, "RangeError: r"},
+		{`new TypeError("t") instanceof Error`, "true"},
+		{`new Error("m", {cause: 5}).cause`, "5"},
+		{`Object.getPrototypeOf(SyntaxError) === Error`, "true"},
+		{`class MyErr extends Error { constructor(m) { super(m); this.name = "MyErr"; } } new MyErr("z").toString()`, "MyErr: z"},
+		{`class K { m() { return new Error("x").stack; } } new K().m()`, "Error: x\n    at K.m (<anonymous>:1:24)\n    at <anonymous>:1:58"},
+		{`class K { static s() { return new Error("x").stack; } } K.s()`, "Error: x\n    at K.s (<anonymous>:1:31)\n    at <anonymous>:1:59"},
+		{`let o = { m() { return new Error("x").stack; } }; o.m()`, "Error: x\n    at Object.m (<anonymous>:1:24)\n    at <anonymous>:1:53"},
+	}
+	for _, tt := range tests {
+		v, err := NewInterpreter().Eval(tt.src)
+		if err != nil || v.ToString() != tt.want {
+			t.Errorf("%s = %q, %v, want %q", tt.src, v.ToString(), err, tt.want)
+		}
+	}
+
+	// A job that throws rejects its promise with the error, which keeps
+	// the stack of the job.
+	i := NewInterpreter()
+	promise, err := i.Eval(`Promise.resolve(1).then(function () { return (1)(); })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, reason, _ := PromiseResult(promise)
+	if state != PromiseRejected || !isObject(reason) || reason.Object.Properties["stack"].ToString() != "TypeError: expression is not a function\n    at <anonymous>:1:49" {
+		t.Errorf("promise = %v %v, want rejected with a TypeError and its stack", state, reason.Object)
+	}
+	if stack := ErrorStack(reason); len(stack) != 1 || stack[0].String() != "<anonymous>:1:49" {
+		t.Errorf("ErrorStack(reason) = %v, want the frame of the job", stack)
+	}
+
+	// Errors the engine throws inherit from the constructors.
+	i = NewInterpreter()
+	_, err = i.Eval(`let o = {}; o.x.y`)
+	var exception *JSException
+	if !errors.As(err, &exception) {
+		t.Fatalf("err = %v, want a JSException", err)
+	}
+	i.SetGlobal("thrown", exception.Value)
+	if v, _ := i.Eval(`thrown instanceof TypeError`); !v.ToBoolean() {
+		t.Error("a TypeError the engine threw is not an instance of TypeError")
+	}
+}
+
+func TestEvalWrappedScriptPositions(t *testing.T) {
+	i := NewInterpreter()
+	_, err := i.EvalWrappedScript("mod.js", "(function () { ", "let o = {}; o.x.y;", "\n})()")
+	var exception *JSException
+	if !errors.As(err, &exception) || len(exception.Stack) == 0 {
+		t.Fatalf("err = %v, want a JSException with a stack", err)
+	}
+	if got := exception.Stack[0].String(); got != "mod.js:1:17" {
+		t.Errorf("innermost frame = %s, want mod.js:1:17", got)
+	}
+
+	_, err = i.EvalWrappedScript("bad.js", "(function () { ", "let x = ;", "\n})")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Line != 1 || syntaxErr.Column != 9 {
+		t.Errorf("err = %v, want a SyntaxError at 1:9", err)
+	}
+}
@@ -0,0 +1,398 @@
+package engine
+
+import (
+	"iter"
+	"runtime"
+	"strconv"
+)
+
+type generatorState int
+
+const (
+	generatorSuspendedStart generatorState = iota
+	generatorSuspendedYield
+	generatorExecuting
+	generatorCompleted
+)
+
+// resumeMode says how a suspended generator continues: as if its yield
+// evaluated to a value, returned one, or threw one.
+type resumeMode int
+
+const (
+	resumeNext resumeMode = iota
+	resumeReturn
+	resumeThrow
+)
+
+// Generator is the internal state of a generator object.
+type Generator struct {
+	state generatorState
+	body  *coroutine
+}
+
+// coroutine runs a function body that can suspend in the middle of its
+// evaluation: generator bodies suspend at yield and async function bodies
+// at await. resume switches to the body, which runs until it suspends or
+// finishes, and yield switches back to the caller of resume. A coroutine is
+// kept apart from the generator object or promise it serves so that the
+// suspended body does not keep them reachable.
+type coroutine struct {
+	resume func() (Value, bool)
+	stop   func()
+	yield  func(Value) bool
+
+	// mode and sent pass the argument of next, return or throw, or the
+	// outcome of an awaited promise, to the suspended body.
+	mode resumeMode
+	sent Value
+	// result is the body's return value once it completes.
+	result Value
+	// resumptions counts the calls of resume.
+	resumptions int
+	// frameBase is the number of frames below the body's when it was
+	// last resumed.
+	frameBase int
+}
+
+// generatorReturn unwinds a generator body resumed by return.
+type generatorReturn struct {
+	value Value
+}
+
+// coroutineStopped unwinds the body of a coroutine that became
+// unreachable while suspended.
+type coroutineStopped struct{}
+
+// abandonedCoroutine is a coroutine queued to be stopped. Unless
+// resumptions is negative, it is only stopped if it has not been resumed
+// since it was queued.
+type abandonedCoroutine struct {
+	body        *coroutine
+	resumptions int
+}
+
+// newCoroutine returns a coroutine that evaluates run once it is first
+// resumed. Its goroutine counts against the memory limit, and it is live
+// until it finishes or is stopped.
+func (i *Interpreter) newCoroutine(run func() Value) *coroutine {
+	i.allocate(coroutineSize)
+	body := &coroutine{}
+	body.resume, body.stop = iter.Pull(func(yield func(Value) bool) {
+		body.yield = yield
+		defer func() {
+			delete(i.coroutines, body)
+			if r := recover(); r != nil {
+				switch r := r.(type) {
+				case *generatorReturn:
+					body.result = r.value
+				case coroutineStopped:
+				default:
+					panic(r)
+				}
+			}
+		}()
+		body.result = run()
+	})
+	if i.coroutines == nil {
+		i.coroutines = make(map[*coroutine]struct{})
+	}
+	i.coroutines[body] = struct{}{}
+	return body
+}
+
+// stopCoroutine unwinds the body of a suspended coroutine, or keeps one
+// that has not started from ever running, and releases its goroutine.
+func (i *Interpreter) stopCoroutine(body *coroutine) {
+	savedEnv := i.env
+	body.stop()
+	i.env = savedEnv
+	delete(i.coroutines, body)
+}
+
+// Close stops the bodies of the generators and async functions that are
+// suspended, releasing the goroutines they hold. They never resume: a
+// stopped generator is done and the promise of a stopped async function
+// stays pending. The interpreter may still run scripts after Close, which
+// should be called once it is no longer needed.
+func (i *Interpreter) Close() {
+	i.abandonedMu.Lock()
+	i.abandoned = nil
+	i.abandonedMu.Unlock()
+	// Unwinding a body may start others.
+	for len(i.coroutines) > 0 {
+		for body := range i.coroutines {
+			i.stopCoroutine(body)
+		}
+	}
+}
+
+// queueAbandoned queues a coroutine to be stopped. It is called by the
+// cleanups of the handles that keep coroutines alive, such as generator
+// objects.
+func (i *Interpreter) queueAbandoned(a abandonedCoroutine) {
+	i.abandonedMu.Lock()
+	i.abandoned = append(i.abandoned, a)
+	i.abandonedMu.Unlock()
+}
+
+// startGenerator implements calling a generator function: it binds the
+// arguments and returns a generator object without running the body.
+func (i *Interpreter) startGenerator(fn Value, f *Function, this Value, args []Value) Value {
+	i.stopAbandonedCoroutines()
+
+	env := i.newFunctionEnvironment(fn, f, this, args, Undefined)
+	body := i.newCoroutine(func() Value {
+		return i.evalFunctionBody(f, env)
+	})
+	env.generator = body
+
+	g := &Generator{state: generatorSuspendedStart, body: body}
+	runtime.AddCleanup(g, i.queueAbandoned, abandonedCoroutine{body: body, resumptions: -1})
+
+	obj := i.newObject()
+	obj.Data = g
+	obj.Object.Prototype = i.generatorPrototype
+	if proto := i.getProperty(fn, "prototype"); proto.Type == TypeObject {
+		obj.Object.Prototype = proto
+	}
+	return obj
+}
+
+// stopAbandonedCoroutines unwinds the bodies of generators and async
+// functions that became unreachable while suspended, ending their
+// coroutines. Cleanups run on their own goroutine, so the bodies are only
+// queued there and stopped here, where touching the interpreter is safe.
+func (i *Interpreter) stopAbandonedCoroutines() {
+	i.abandonedMu.Lock()
+	abandoned := i.abandoned
+	i.abandoned = nil
+	i.abandonedMu.Unlock()
+
+	for _, a := range abandoned {
+		if a.resumptions < 0 || a.resumptions == a.body.resumptions {
+			i.stopCoroutine(a.body)
+		}
+	}
+}
+
+// resumeGenerator implements the next, return and throw methods of
+// generator objects.
+func (i *Interpreter) resumeGenerator(this Value, mode resumeMode, sent Value) Value {
+	g, ok := this.Data.(*Generator)
+	if !ok || this.Type != TypeObject {
+		i.throwError("TypeError", "next method called on incompatible receiver %s", this.ToString())
+	}
+
+	switch g.state {
+	case generatorExecuting:
+		i.throwError("TypeError", "Generator is already running")
+	case generatorSuspendedStart:
+		if mode != resumeNext {
+			g.state = generatorCompleted
+		}
+	}
+	if g.state == generatorCompleted {
+		switch mode {
+		case resumeReturn:
+			return i.iteratorResult(sent, true)
+		case resumeThrow:
+			panic(i.exception(sent))
+		}
+		return i.iteratorResult(Undefined, true)
+	}
+
+	body := g.body
+	body.mode, body.sent = mode, sent
+	g.state = generatorExecuting
+	savedEnv := i.env
+	defer func() {
+		i.env = savedEnv
+		if g.state == generatorExecuting {
+			g.state = generatorCompleted
+		}
+	}()
+
+	body.resumptions++
+	body.frameBase = len(i.frames)
+	if val, ok := body.resume(); ok {
+		g.state = generatorSuspendedYield
+		return i.iteratorResult(val, false)
+	}
+	g.state = generatorCompleted
+	return i.iteratorResult(body.result, true)
+}
+
+// currentGenerator returns the body of the generator function whose code
+// is running.
+func (i *Interpreter) currentGenerator() *coroutine {
+	env := i.env.functionEnvironment()
+	if env == nil || env.generator == nil {
+		i.throwError("SyntaxError", "yield is only valid in generator functions")
+	}
+	return env.generator
+}
+
+// suspend yields val from a coroutine body and returns how and with what
+// value it was resumed.
+func (i *Interpreter) suspend(body *coroutine, val Value) (resumeMode, Value) {
+	env := i.env
+	// The body's frames leave the stack while it is suspended and return
+	// on top of the frames of whatever resumes it.
+	frames := append([]frame(nil), i.frames[body.frameBase:]...)
+	i.frames = i.frames[:body.frameBase]
+	ok := body.yield(val)
+	i.frames = append(i.frames, frames...)
+	if !ok {
+		panic(coroutineStopped{})
+	}
+	i.env = env
+	return body.mode, body.sent
+}
+
+// generatorYield implements yield.
+func (i *Interpreter) generatorYield(body *coroutine, val Value) Value {
+	mode, sent := i.suspend(body, val)
+	switch mode {
+	case resumeReturn:
+		panic(&generatorReturn{value: sent})
+	case resumeThrow:
+		panic(i.exception(sent))
+	}
+	return sent
+}
+
+// yieldDelegate implements yield*, forwarding next, return and throw to
+// the iterator of iterable until it is done. Its done value becomes the
+// value of the yield* expression.
+func (i *Interpreter) yieldDelegate(body *coroutine, iterable Value) Value {
+	iterator := i.getIterator(iterable)
+	mode, received := resumeNext, Undefined
+	for {
+		var result Value
+		switch mode {
+		case resumeNext:
+			result = i.applyFunction(i.getProperty(iterator, "next"), iterator, []Value{received})
+		case resumeThrow:
+			throw := i.getProperty(iterator, "throw")
+			if throw.Type != TypeFunction {
+				i.closeIterator(iterator)
+				i.throwError("TypeError", "The iterator does not provide a 'throw' method")
+			}
+			result = i.applyFunction(throw, iterator, []Value{received})
+		case resumeReturn:
+			ret := i.getProperty(iterator, "return")
+			if ret.Type != TypeFunction {
+				panic(&generatorReturn{value: received})
+			}
+			result = i.applyFunction(ret, iterator, []Value{received})
+		}
+
+		if result.Type != TypeObject {
+			i.throwError("TypeError", "Iterator result %s is not an object", result.ToString())
+		}
+		if i.getProperty(result, "done").ToBoolean() {
+			value := i.getProperty(result, "value")
+			if mode == resumeReturn {
+				panic(&generatorReturn{value: value})
+			}
+			return value
+		}
+		mode, received = i.suspend(body, i.getProperty(result, "value"))
+	}
+}
+
+// getIterator returns the iterator that iterable's Symbol.iterator method
+// creates. Arrays, which have no such method, iterate over their
+// elements.
+func (i *Interpreter) getIterator(iterable Value) Value {
+	method := i.getMember(iterable, symbolKey(symbolIterator))
+	if method.Type == TypeFunction {
+		iterator := i.applyFunction(method, iterable, nil)
+		if iterator.Type != TypeObject && iterator.Type != TypeFunction {
+			i.throwError("TypeError", "Result of the Symbol.iterator method is not an object")
+		}
+		return iterator
+	}
+	if iterable.Type == TypeObject && iterable.Data == "Array" {
+		return i.newArrayIterator(iterable)
+	}
+	i.throwError("TypeError", "%s is not iterable", iterable.ToString())
+	return Undefined
+}
+
+// iteratorStep advances iterator and returns the value it produced, or
+// reports that it is done.
+func (i *Interpreter) iteratorStep(iterator Value) (Value, bool) {
+	result := i.applyFunction(i.getProperty(iterator, "next"), iterator, nil)
+	if result.Type != TypeObject {
+		i.throwError("TypeError", "Iterator result %s is not an object", result.ToString())
+	}
+	if i.getProperty(result, "done").ToBoolean() {
+		return Undefined, true
+	}
+	return i.getProperty(result, "value"), false
+}
+
+// closeIterator calls the return method of an iterator that is abandoned
+// before it is done, if it has one.
+func (i *Interpreter) closeIterator(iterator Value) {
+	if ret := i.getProperty(iterator, "return"); ret.Type == TypeFunction {
+		i.applyFunction(ret, iterator, nil)
+	}
+}
+
+// newArrayIterator returns an iterator over the elements of arr, reading
+// its length afresh on every step like the built-in array iterator.
+func (i *Interpreter) newArrayIterator(arr Value) Value {
+	iterator := i.newObject()
+	iterator.Object.Prototype = i.iteratorPrototype
+	index := 0
+	i.defineMethod(iterator, "next", 0, func(this Value, args []Value) Value {
+		if arr.Type == TypeUndefined || index >= int(i.getProperty(arr, "length").ToNumber()) {
+			arr = Undefined
+			return i.iteratorResult(Undefined, true)
+		}
+		val := i.getProperty(arr, strconv.Itoa(index))
+		index++
+		return i.iteratorResult(val, false)
+	})
+	return iterator
+}
+
+// iteratorResult creates an iterator result object.
+func (i *Interpreter) iteratorResult(val Value, done bool) Value {
+	result := i.newObject()
+	result.Object.Properties["value"] = val
+	result.Object.Properties["done"] = Value{Type: TypeBoolean, Data: done}
+	return result
+}
+
+// newGeneratorFunctionPrototype creates the prototype property of a
+// generator function, which the generator objects it returns inherit from.
+func (i *Interpreter) newGeneratorFunctionPrototype() Value {
+	proto := i.newObject()
+	proto.Object.Prototype = i.generatorPrototype
+	return proto
+}
+
+func (i *Interpreter) setupGeneratorPrototype() {
+	// Iterators, generators included, are iterable themselves.
+	i.iteratorPrototype = i.newObject()
+	i.defineSymbolMethod(i.iteratorPrototype, symbolIterator, "[Symbol.iterator]", 0, func(this Value, args []Value) Value {
+		return this
+	})
+
+	i.generatorPrototype = i.newObject()
+	i.generatorPrototype.Object.Prototype = i.iteratorPrototype
+	setSymbolSlot(i.generatorPrototype, symbolToStringTag, Value{Type: TypeString, Data: "Generator"})
+	i.defineMethod(i.generatorPrototype, "next", 1, func(this Value, args []Value) Value {
+		return i.resumeGenerator(this, resumeNext, argument(args, 0))
+	})
+	i.defineMethod(i.generatorPrototype, "return", 1, func(this Value, args []Value) Value {
+		return i.resumeGenerator(this, resumeReturn, argument(args, 0))
+	})
+	i.defineMethod(i.generatorPrototype, "throw", 1, func(this Value, args []Value) Value {
+		return i.resumeGenerator(this, resumeThrow, argument(args, 0))
+	})
+}
@@ -0,0 +1,79 @@
+package engine
+
+import "context"
+
+// InterruptedError is the error Eval and Call return when Interrupt, or
+// the end of the context passed to EvalContext, stops a script. Scripts
+// cannot catch it. Reason is what was passed to Interrupt, or the cause
+// of the context's end, and Stack the stack where the script stopped.
+type InterruptedError struct {
+	Reason error
+	Stack  []StackFrame
+}
+
+func (e *InterruptedError) Error() string {
+	if e.Reason == nil {
+		return "script interrupted"
+	}
+	return "script interrupted: " + e.Reason.Error()
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Reason
+}
+
+// Interrupt stops the script that is running, the next time it calls a
+// function, with an *InterruptedError for reason. If no script is running
+// the next one is stopped instead, unless ClearInterrupt is called first.
+// Unlike the interpreter's other methods, Interrupt may be called from
+// any goroutine.
+func (i *Interpreter) Interrupt(reason error) {
+	i.interrupt.Store(&InterruptedError{Reason: reason})
+}
+
+// ClearInterrupt withdraws an Interrupt that has not stopped a script yet.
+func (i *Interpreter) ClearInterrupt() {
+	i.interrupt.Store(nil)
+}
+
+// checkInterrupt stops the script if Interrupt has been called. It is
+// called on entry to every function body and between jobs; loops call it
+// on each iteration, and regular expression matches as they backtrack.
+func (i *Interpreter) checkInterrupt() {
+	if i.interrupt.Load() == nil {
+		return
+	}
+	if e := i.interrupt.Swap(nil); e != nil {
+		e.Stack = i.captureStack()
+		panic(e)
+	}
+}
+
+// EvalContext is Eval for a script that is stopped, as by Interrupt, once
+// ctx is done.
+func (i *Interpreter) EvalContext(ctx context.Context, code string) (Value, error) {
+	if ctx.Err() != nil {
+		return Undefined, &InterruptedError{Reason: context.Cause(ctx)}
+	}
+	defer i.interruptWhenDone(ctx)()
+	return i.Eval(code)
+}
+
+// interruptWhenDone interrupts the interpreter once ctx is done, until the
+// function it returns is called. That function also withdraws the
+// interrupt if no script has been stopped by it.
+func (i *Interpreter) interruptWhenDone(ctx context.Context) (stop func()) {
+	e := &InterruptedError{}
+	interrupted := make(chan struct{})
+	stopAfter := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		e.Reason = context.Cause(ctx)
+		i.interrupt.Store(e)
+	})
+	return func() {
+		if !stopAfter() {
+			<-interrupted
+			i.interrupt.CompareAndSwap(e, nil)
+		}
+	}
+}
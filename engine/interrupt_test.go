@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowScript recurses for far longer than any test waits.
+const slowScript = `function fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); } fib(40)`
+
+func TestInterrupt(t *testing.T) {
+	reason := errors.New("stop")
+	for _, treeWalking := range []bool{false, true} {
+		i := NewInterpreter()
+		i.SetTreeWalking(treeWalking)
+		time.AfterFunc(20*time.Millisecond, func() { i.Interrupt(reason) })
+		_, err := i.Eval(slowScript)
+		var interrupted *InterruptedError
+		if !errors.As(err, &interrupted) || !errors.Is(err, reason) {
+			t.Fatalf("tree walking %t: err = %v, want interrupted by %v", treeWalking, err, reason)
+		}
+		if len(interrupted.Stack) == 0 || interrupted.Stack[0].Function != "fib" {
+			t.Errorf("tree walking %t: stack = %v, want it to start in fib", treeWalking, interrupted.Stack)
+		}
+
+		// An interrupt stops one script only.
+		if v, err := i.Eval(`fib(10)`); err != nil || v.ToString() != "55" {
+			t.Errorf("tree walking %t: after the interrupt = %s, %v, want 55", treeWalking, v.ToString(), err)
+		}
+	}
+}
+
+func TestInterruptBeforeScript(t *testing.T) {
+	i := NewInterpreter()
+	i.Interrupt(nil)
+	if _, err := i.Eval(`function f() { return 1; } f()`); err == nil || err.Error() != "script interrupted" {
+		t.Errorf("err = %v, want the pending interrupt to stop the script", err)
+	}
+
+	i.Interrupt(nil)
+	i.ClearInterrupt()
+	if v, err := i.Eval(`f()`); err != nil || v.ToString() != "1" {
+		t.Errorf("after ClearInterrupt = %s, %v, want 1", v.ToString(), err)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	i := NewInterpreter()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := i.EvalContext(ctx, slowScript); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the deadline to stop the script", err)
+	}
+	if _, err := i.EvalContext(ctx, `1`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("with a done context: err = %v, want it not to run", err)
+	}
+
+	// A context that ends after the script does not stop the next one.
+	ctx, cancel = context.WithCancel(context.Background())
+	if v, err := i.EvalContext(ctx, `2`); err != nil || v.ToString() != "2" {
+		t.Fatalf("EvalContext = %s, %v, want 2", v.ToString(), err)
+	}
+	cancel()
+	if v, err := i.Eval(`3`); err != nil || v.ToString() != "3" {
+		t.Errorf("after the context ended = %s, %v, want 3", v.ToString(), err)
+	}
+}
+
+func TestInterruptStopsJobs(t *testing.T) {
+	i := NewInterpreter()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := i.EvalContext(ctx, `function fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); }
+		Promise.resolve(40).then(fib)`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline to stop the job", err)
+	}
+}
@@ -1,5 +1,10 @@
 package engine
 
+import (
+	"sort"
+	"unicode/utf16"
+)
+
 type TokenType string
 
 const (
@@ -7,16 +12,29 @@ const (
 	EOF       TokenType = "EOF"
 	IDENT     TokenType = "IDENT"
 	NUMBER    TokenType = "NUMBER"
+	BIGINT    TokenType = "BIGINT"
 	STRING    TokenType = "STRING"
+	REGEXP    TokenType = "REGEXP"
+	PRIVATE   TokenType = "PRIVATE"
 	ASSIGN    TokenType = "="
 	PLUS      TokenType = "+"
 	MINUS     TokenType = "-"
 	BANG      TokenType = "!"
 	ASTERISK  TokenType = "*"
 	SLASH     TokenType = "/"
+	PERCENT   TokenType = "%"
+	EXPONENT  TokenType = "**"
+	AMPERSAND TokenType = "&"
+	PIPE      TokenType = "|"
+	CARET     TokenType = "^"
+	TILDE     TokenType = "~"
 	SEMICOLON TokenType = ";"
 	DOT       TokenType = "."
 	COMMA     TokenType = ","
+	COLON     TokenType = ":"
+
+	OPTIONAL_CHAIN TokenType = "?."
+	ARROW          TokenType = "=>"
 
 	FUNCTION TokenType = "FUNCTION"
 	LET      TokenType = "LET"
@@ -25,29 +43,69 @@ const (
 	IF       TokenType = "IF"
 	ELSE     TokenType = "ELSE"
 	RETURN   TokenType = "RETURN"
+	THIS     TokenType = "THIS"
+	NEW      TokenType = "NEW"
+	CLASS    TokenType = "CLASS"
+	EXTENDS  TokenType = "EXTENDS"
+	SUPER    TokenType = "SUPER"
+	IN       TokenType = "IN"
+	NULL     TokenType = "NULL"
+	TYPEOF   TokenType = "TYPEOF"
+	VOID     TokenType = "VOID"
+	DELETE   TokenType = "DELETE"
+	YIELD    TokenType = "YIELD"
+	AWAIT    TokenType = "AWAIT"
+	IMPORT   TokenType = "IMPORT"
+	EXPORT   TokenType = "EXPORT"
+
+	INSTANCEOF TokenType = "INSTANCEOF"
+
+	GT  TokenType = ">"
+	LT  TokenType = "<"
+	GTE TokenType = ">="
+	LTE TokenType = "<="
 
-	GT     TokenType = ">"
-	LT     TokenType = "<"
-	GTE    TokenType = ">="
-	LTE    TokenType = "<="
-	EQ     TokenType = "=="
-	NOT_EQ TokenType = "!="
+	SHIFT_LEFT           TokenType = "<<"
+	SHIFT_RIGHT          TokenType = ">>"
+	UNSIGNED_SHIFT_RIGHT TokenType = ">>>"
+	EQ                   TokenType = "=="
+	NOT_EQ               TokenType = "!="
+
+	STRICT_EQ     TokenType = "==="
+	STRICT_NOT_EQ TokenType = "!=="
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	// start is the offset of the token in the input.
+	start int
 }
 
 var keywords = map[string]TokenType{
-	"fn":       FUNCTION,
-	"let":      LET,
-	"true":     TRUE,
-	"false":    FALSE,
-	"if":       IF,
-	"else":     ELSE,
-	"return":   RETURN,
-	"function": FUNCTION,
+	"fn":         FUNCTION,
+	"let":        LET,
+	"true":       TRUE,
+	"false":      FALSE,
+	"if":         IF,
+	"else":       ELSE,
+	"return":     RETURN,
+	"function":   FUNCTION,
+	"this":       THIS,
+	"new":        NEW,
+	"class":      CLASS,
+	"extends":    EXTENDS,
+	"super":      SUPER,
+	"in":         IN,
+	"null":       NULL,
+	"typeof":     TYPEOF,
+	"void":       VOID,
+	"delete":     DELETE,
+	"yield":      YIELD,
+	"await":      AWAIT,
+	"import":     IMPORT,
+	"export":     EXPORT,
+	"instanceof": INSTANCEOF,
 }
 
 func lookupIdent(ident string) TokenType {
@@ -62,14 +120,62 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	source       *source
+	// prev is the type of the last token, which tells whether a . followed
+	// by a digit accesses a member, as in a.b.5, or starts a number.
+	prev TokenType
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	return newSourceLexer("", input)
+}
+
+// newSourceLexer returns a lexer for the code of the script or module
+// called name.
+func newSourceLexer(name string, input string) *Lexer {
+	l := &Lexer{input: input, source: newSource(name, input)}
 	l.readChar()
 	return l
 }
 
+// source is the code of a script or module and the name, such as a file
+// name, that stack traces refer to it by. It is not modified once
+// created, so programs parsed from it may be run on many goroutines.
+type source struct {
+	name string
+	code string
+	// lineStarts holds the offset of each line.
+	lineStarts []int
+	// wrapper is the length of the code a host put before the script on
+	// its first line, which columns do not count.
+	wrapper int
+}
+
+func newSource(name string, code string) *source {
+	s := &source{name: name, code: code, lineStarts: []int{0}}
+	for idx := 0; idx < len(code); idx++ {
+		if code[idx] == '\n' {
+			s.lineStarts = append(s.lineStarts, idx+1)
+		}
+	}
+	return s
+}
+
+// position returns the line and column of the byte at offset, counting
+// from 1. Columns count UTF-16 code units, like the rest of JavaScript.
+func (s *source) position(offset int) (line int, column int) {
+	line = sort.SearchInts(s.lineStarts, offset+1)
+	start := s.lineStarts[line-1]
+	if line == 1 {
+		start = min(s.wrapper, offset)
+	}
+	column = 1
+	for _, r := range s.code[start:min(offset, len(s.code))] {
+		column += utf16.RuneLen(r)
+	}
+	return line, column
+}
+
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
@@ -87,17 +193,49 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
-func (l *Lexer) NextToken() Token {
-	var tok Token
+// peekCharAt returns the character offset positions after the current one.
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.position+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.position+offset]
+}
 
+func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
+	start := l.position
+	tok := l.scanToken()
+	tok.start = start
+	l.prev = tok.Type
+	return tok
+}
+
+// endsOperand reports whether the last token can end an operand, so that
+// a . after it accesses a member.
+func (l *Lexer) endsOperand() bool {
+	switch l.prev {
+	case IDENT, NUMBER, BIGINT, STRING, ")", "]":
+		return true
+	}
+	return false
+}
+
+func (l *Lexer) scanToken() Token {
+	var tok Token
 
 	switch l.ch {
 	case '=':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '=' && l.peekCharAt(2) == '=' {
+			l.readChar()
+			l.readChar()
+			tok = Token{Type: STRICT_EQ, Literal: "==="}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: ARROW, Literal: "=>"}
 		} else {
 			tok = Token{Type: ASSIGN, Literal: string(l.ch)}
 		}
@@ -106,7 +244,11 @@ func (l *Lexer) NextToken() Token {
 	case '-':
 		tok = Token{Type: MINUS, Literal: string(l.ch)}
 	case '!':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '=' && l.peekCharAt(2) == '=' {
+			l.readChar()
+			l.readChar()
+			tok = Token{Type: STRICT_NOT_EQ, Literal: "!=="}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: NOT_EQ, Literal: string(ch) + string(l.ch)}
@@ -114,17 +256,55 @@ func (l *Lexer) NextToken() Token {
 			tok = Token{Type: BANG, Literal: string(l.ch)}
 		}
 	case '*':
-		tok = Token{Type: ASTERISK, Literal: string(l.ch)}
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = Token{Type: EXPONENT, Literal: "**"}
+		} else {
+			tok = Token{Type: ASTERISK, Literal: string(l.ch)}
+		}
 	case '/':
 		tok = Token{Type: SLASH, Literal: string(l.ch)}
+	case '%':
+		tok = Token{Type: PERCENT, Literal: string(l.ch)}
+	case '&':
+		tok = Token{Type: AMPERSAND, Literal: string(l.ch)}
+	case '|':
+		tok = Token{Type: PIPE, Literal: string(l.ch)}
+	case '^':
+		tok = Token{Type: CARET, Literal: string(l.ch)}
+	case '~':
+		tok = Token{Type: TILDE, Literal: string(l.ch)}
 	case ';':
 		tok = Token{Type: SEMICOLON, Literal: string(l.ch)}
 	case '.':
+		if isDigit(l.peekChar()) && !l.endsOperand() {
+			tok.Literal = l.readNumber()
+			tok.Type = NUMBER
+			return tok
+		}
 		tok = Token{Type: DOT, Literal: string(l.ch)}
 	case ',':
 		tok = Token{Type: COMMA, Literal: string(l.ch)}
+	case ':':
+		tok = Token{Type: COLON, Literal: string(l.ch)}
+	case '?':
+		// ?. followed by a digit is a conditional followed by a number
+		// such as a?.5:b, not an optional chain.
+		if l.peekChar() == '.' && !isDigit(l.peekCharAt(2)) {
+			l.readChar()
+			tok = Token{Type: OPTIONAL_CHAIN, Literal: "?."}
+		} else {
+			tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
+		}
 	case '>':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '>' && l.peekCharAt(2) == '>' {
+			l.readChar()
+			l.readChar()
+			tok = Token{Type: UNSIGNED_SHIFT_RIGHT, Literal: ">>>"}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: SHIFT_RIGHT, Literal: ">>"}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: GTE, Literal: string(ch) + string(l.ch)}
@@ -132,7 +312,10 @@ func (l *Lexer) NextToken() Token {
 			tok = Token{Type: GT, Literal: string(l.ch)}
 		}
 	case '<':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = Token{Type: SHIFT_LEFT, Literal: "<<"}
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: LTE, Literal: string(ch) + string(l.ch)}
@@ -147,6 +330,18 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: "{", Literal: string(l.ch)}
 	case '}':
 		tok = Token{Type: "}", Literal: string(l.ch)}
+	case '[':
+		tok = Token{Type: "[", Literal: string(l.ch)}
+	case ']':
+		tok = Token{Type: "]", Literal: string(l.ch)}
+	case '#':
+		if isLetter(l.peekChar()) {
+			l.readChar()
+			tok.Literal = "#" + l.readIdentifier()
+			tok.Type = PRIVATE
+			return tok
+		}
+		tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
 	case '"':
 		tok.Type = STRING
 		tok.Literal = l.readString()
@@ -160,6 +355,12 @@ func (l *Lexer) NextToken() Token {
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = NUMBER
+			// A trailing n makes the literal a BigInt, which the parser
+			// rejects unless it is an integer.
+			if l.ch == 'n' {
+				l.readChar()
+				tok.Type = BIGINT
+			}
 			return tok
 		} else {
 			tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
@@ -170,6 +371,41 @@ func (l *Lexer) NextToken() Token {
 	return tok
 }
 
+// readRegExp rescans the input from start, where the lexer found a / that
+// the parser knows begins a regular expression literal rather than a
+// division. The token's literal is the whole /pattern/flags. It reports
+// false when the literal is unterminated.
+func (l *Lexer) readRegExp(start int) (Token, bool) {
+	l.readPosition = start + 1
+	l.readChar()
+
+	inClass := false
+	for {
+		switch l.ch {
+		case 0, '\n', '\r':
+			return Token{}, false
+		case '\\':
+			l.readChar()
+			if l.ch == 0 || l.ch == '\n' || l.ch == '\r' {
+				return Token{}, false
+			}
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				l.readChar()
+				for isLetter(l.ch) {
+					l.readChar()
+				}
+				return Token{Type: REGEXP, Literal: l.input[start:l.position], start: start}, true
+			}
+		}
+		l.readChar()
+	}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -184,11 +420,19 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// readNumber reads a decimal literal, whose integer part may be omitted
+// as in .5 and whose fraction may be.
 func (l *Lexer) readNumber() string {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[position:l.position]
 }
 
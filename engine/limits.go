@@ -0,0 +1,105 @@
+package engine
+
+import "errors"
+
+// ErrMemoryLimit is the Reason of the InterruptedError that stops a script
+// allocating more than Limits.MaxMemory.
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// The default limits. Calls nest about as deeply as in V8, well short of
+// exhausting the Go stack, and strings and arrays are as long as V8 and
+// the specification allow.
+const (
+	defaultMaxCallDepth    = 10000
+	defaultMaxStringLength = 1<<29 - 24
+	defaultMaxArrayLength  = 1<<32 - 1
+)
+
+// Rough sizes, in bytes, of what scripts allocate, which the memory limit
+// counts.
+const (
+	objectSize   = 128
+	propertySize = 64
+	// coroutineSize is the least stack the goroutine of a generator or
+	// async function body holds while it is suspended.
+	coroutineSize = 8192
+)
+
+// maxListLength bounds the lists of arguments and property keys built from
+// array-likes. They are held in memory whole, so the default array length
+// limit would let a length alone exhaust the host's memory.
+const maxListLength = 1 << 20
+
+// Limits bounds the resources scripts may use, so that untrusted code
+// cannot exhaust the host's. A zero field keeps its default.
+type Limits struct {
+	// MaxCallDepth bounds how deeply calls may nest. A call beyond it
+	// throws a RangeError.
+	MaxCallDepth int
+
+	// MaxMemory bounds the bytes, roughly estimated, of the objects,
+	// properties, strings, BigInts and suspended generator and async
+	// function bodies scripts allocate in total, including ones since
+	// discarded. A script that exceeds it is stopped with an
+	// *InterruptedError whose Reason is ErrMemoryLimit. By default memory
+	// is not limited.
+	//
+	// The count is not reset when a script ends: it covers every script,
+	// module, job and callback the interpreter runs after SetLimits, since
+	// what earlier scripts left in globals is still held. A host that
+	// wants a budget for each script calls SetLimits before running it.
+	MaxMemory int64
+
+	// MaxStringLength bounds the length in bytes of the strings scripts
+	// build. Building a longer one throws a RangeError.
+	MaxStringLength int
+
+	// MaxArrayLength bounds the length of arrays, however it is set, and
+	// of the lists of arguments created from array-likes. Exceeding it
+	// throws a RangeError.
+	MaxArrayLength int64
+}
+
+// SetLimits sets the limits scripts run under and starts counting their
+// memory afresh.
+func (i *Interpreter) SetLimits(limits Limits) {
+	if limits.MaxCallDepth <= 0 {
+		limits.MaxCallDepth = defaultMaxCallDepth
+	}
+	if limits.MaxStringLength <= 0 {
+		limits.MaxStringLength = defaultMaxStringLength
+	}
+	if limits.MaxArrayLength <= 0 {
+		limits.MaxArrayLength = defaultMaxArrayLength
+	}
+	i.limits = limits
+	i.allocated = 0
+}
+
+// allocate counts size bytes against the memory limit.
+func (i *Interpreter) allocate(size int) {
+	if i.limits.MaxMemory <= 0 {
+		return
+	}
+	i.allocated += int64(size)
+	if i.allocated > i.limits.MaxMemory {
+		panic(&InterruptedError{Reason: ErrMemoryLimit, Stack: i.captureStack()})
+	}
+}
+
+// allocateString checks a string a script built against the string length
+// and memory limits.
+func (i *Interpreter) allocateString(s string) {
+	if len(s) > i.limits.MaxStringLength {
+		i.throwError("RangeError", "Invalid string length")
+	}
+	i.allocate(len(s))
+}
+
+// checkArrayLength throws a RangeError for an array length beyond the
+// limit.
+func (i *Interpreter) checkArrayLength(length int64) {
+	if length > i.limits.MaxArrayLength {
+		i.throwError("RangeError", "Invalid array length")
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuiltinAllocationsCountAgainstMemory(t *testing.T) {
+	for _, body := range []string{
+		`g().next()`,
+		`h.bind(null)`,
+		`new RegExp("abc")`,
+		`Symbol("s")`,
+		`Promise.resolve(1)`,
+		`new Proxy({}, {})`,
+	} {
+		i := NewInterpreter()
+		i.SetLimits(Limits{MaxMemory: 100000})
+		_, err := i.Eval(`function* g() { yield 1; } function h() {}
+			function loop(n) { if (n == 0) { return 0; } ` + body + `; return loop(n - 1); }
+			loop(5000)`)
+		var interrupted *InterruptedError
+		if !errors.As(err, &interrupted) || interrupted.Reason != ErrMemoryLimit {
+			t.Errorf("%s: err = %v, want memory limit exceeded", body, err)
+		}
+		i.Close()
+	}
+}
+
+func TestLongChainsCountAgainstCallDepth(t *testing.T) {
+	for _, link := range []string{`new Proxy(p, {})`, `Object.setPrototypeOf({}, p)`} {
+		for _, access := range []string{`p.x`, `"x" in p`, `p.x = 1`} {
+			i := NewInterpreter()
+			i.SetLimits(Limits{MaxCallDepth: 1000})
+			_, err := i.Eval(`function build(p, n) { if (n == 0) { return p; } return build(` + link + `, n - 1); }
+				function outer(p, k) { if (k == 0) { return p; } return outer(build(p, 100), k - 1); }
+				var p = outer({}, 20);
+				` + access)
+			var exception *JSException
+			if !errors.As(err, &exception) || exception.Value.Object.Properties["name"].ToString() != "RangeError" {
+				t.Errorf("%s with %s: err = %v, want RangeError", access, link, err)
+			}
+		}
+	}
+}
+
+func TestArrayLengthLimit(t *testing.T) {
+	for _, src := range []string{
+		`new Array(1001)`,
+		`let a = []; a.length = 1001`,
+		`let a = []; a.length = 4294967295`,
+		`let a = []; Object.defineProperty(a, "length", {value: 2000})`,
+		`let a = []; a[1000] = 1`,
+	} {
+		for _, treeWalking := range []bool{false, true} {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			i.SetLimits(Limits{MaxArrayLength: 1000})
+			_, err := i.Eval(src)
+			if err == nil || err.Error() != "Uncaught RangeError: Invalid array length" {
+				t.Errorf("%s (tree walking %t): err = %v, want RangeError", src, treeWalking, err)
+			}
+			if v, err := i.Eval(`let b = []; b.length = 1000; b.length`); err != nil || v.ToString() != "1000" {
+				t.Errorf("length at the limit = %s, %v, want 1000", v.ToString(), err)
+			}
+		}
+	}
+
+	// Without a limit arrays are as long as the specification allows.
+	if v, err := NewInterpreter().Eval(`new Array(4294967295).length`); err != nil || v.ToString() != "4294967295" {
+		t.Errorf("new Array(4294967295).length = %s, %v", v.ToString(), err)
+	}
+}
+
+func TestMemoryIsCountedAcrossScripts(t *testing.T) {
+	i := NewInterpreter()
+	i.SetLimits(Limits{MaxMemory: 100000})
+	script := `var kept = []; function fill(n) { if (n == 0) { return 0; } kept[n] = {}; return fill(n - 1); } fill(300)`
+	var err error
+	for n := 0; n < 10 && err == nil; n++ {
+		_, err = i.Eval(script)
+	}
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Reason != ErrMemoryLimit {
+		t.Fatalf("err = %v, want memory limit exceeded", err)
+	}
+
+	// SetLimits starts counting afresh.
+	i.SetLimits(Limits{MaxMemory: 100000})
+	if _, err := i.Eval(script); err != nil {
+		t.Errorf("after SetLimits: err = %v", err)
+	}
+}
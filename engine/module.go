@@ -0,0 +1,592 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// namespaceBinding stands for a module's namespace object where an import
+// or export would otherwise name a binding, as in import * as ns.
+const namespaceBinding = "*namespace*"
+
+// defaultBinding is the local binding of an anonymous export default.
+const defaultBinding = "*default*"
+
+// moduleRecord is a module loaded through the interpreter's ModuleLoader.
+type moduleRecord struct {
+	name    string
+	program *Program
+	env     *Environment
+
+	// dependencies maps the specifiers of the module's import and export
+	// declarations to the modules they resolve to, which requested lists
+	// in order.
+	dependencies map[string]*moduleRecord
+	requested    []*moduleRecord
+
+	// imports maps local names to what they import. localExports maps
+	// export names to local bindings and indirectExports to what they
+	// re-export; starExports lists the specifiers of export * from.
+	imports         map[string]moduleImport
+	localExports    map[string]string
+	indirectExports map[string]moduleImport
+	starExports     []string
+
+	linked bool
+	// evaluation is the promise for the result of evaluating the module,
+	// set once evaluation starts. evaluating is set while the modules it
+	// depends on are being started, so that cycles do not wait on it.
+	evaluation Value
+	evaluating bool
+
+	namespace Value
+	meta      Value
+}
+
+// moduleImport names the export, or namespaceBinding, of the module a
+// specifier refers to.
+type moduleImport struct {
+	specifier string
+	name      string
+}
+
+// importBinding is an imported binding, which always reads the current
+// value of the exporting module's binding.
+type importBinding struct {
+	env  *Environment
+	name string
+}
+
+func (b importBinding) get() Value {
+	if val, ok := b.env.own(b.name); ok {
+		return val
+	}
+	return Undefined
+}
+
+// resolvedExport is the binding an export name resolves to, following
+// re-exports.
+type resolvedExport struct {
+	module *moduleRecord
+	name   string
+}
+
+type exportKey struct {
+	module *moduleRecord
+	name   string
+}
+
+// globalEnvironment returns the global scope, which module scopes extend.
+func (i *Interpreter) globalEnvironment() *Environment {
+	env := i.env
+	for env.outer != nil {
+		env = env.outer
+	}
+	return env
+}
+
+func (i *Interpreter) SetModuleLoader(loader ModuleLoader) {
+	i.moduleLoader = loader
+}
+
+// ImportModule loads the module specifier refers to and the modules it
+// imports through the interpreter's ModuleLoader, links them and starts
+// evaluating them. It returns a promise for the module's namespace object,
+// which settles once evaluation, which top-level await can suspend, has
+// finished. Errors loading or linking the modules are returned instead.
+// Without a host job queue, promise jobs run before ImportModule returns.
+func (i *Interpreter) ImportModule(specifier string) (promise Value, err error) {
+	i.stopAbandonedCoroutines()
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *JSException:
+				promise, err = Undefined, r
+			case *InterruptedError:
+				promise, err = Undefined, r
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	m, err := i.resolveAndLoadModule(specifier, "")
+	if err != nil {
+		return Undefined, err
+	}
+	i.linkModule(m)
+	promise = i.evaluateModule(m)
+	i.runJobs()
+	return promise, nil
+}
+
+// dynamicImport implements import(specifier) in the module named
+// referrer, or in a script when referrer is empty. Any error is reported
+// by rejecting the returned promise.
+func (i *Interpreter) dynamicImport(specifier string, referrer string) Value {
+	capability := i.newPromiseCapability()
+
+	evaluation, exception := i.tryCatch(func() Value {
+		m, err := i.resolveAndLoadModule(specifier, referrer)
+		if err != nil {
+			var exception *JSException
+			if errors.As(err, &exception) {
+				panic(exception)
+			}
+			i.throwError("Error", "%s", err.Error())
+		}
+		i.linkModule(m)
+		return i.evaluateModule(m)
+	})
+	if exception != nil {
+		i.applyFunction(capability.reject, Undefined, []Value{exception.Value})
+	} else {
+		i.applyFunction(capability.resolve, Undefined, []Value{evaluation})
+	}
+	return capability.promise
+}
+
+// currentModule returns the module whose code is running, or nil in
+// scripts.
+func (i *Interpreter) currentModule() *moduleRecord {
+	for env := i.env; env != nil; env = env.outer {
+		if env.module != nil {
+			return env.module
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) currentModuleName() string {
+	if m := i.currentModule(); m != nil {
+		return m.name
+	}
+	return ""
+}
+
+// importMeta implements import.meta, whose url property is the module's
+// resolved name.
+func (i *Interpreter) importMeta() Value {
+	m := i.currentModule()
+	if m == nil {
+		i.throwError("SyntaxError", "Cannot use 'import.meta' outside a module")
+	}
+	if m.meta.Type == TypeUndefined {
+		m.meta = i.newObject()
+		m.meta.Object.Prototype = Value{Type: TypeNull}
+		m.meta.Object.Properties["url"] = Value{Type: TypeString, Data: m.name}
+	}
+	return m.meta
+}
+
+func (i *Interpreter) resolveAndLoadModule(specifier string, referrer string) (*moduleRecord, error) {
+	if i.moduleLoader == nil {
+		return nil, fmt.Errorf("cannot import '%s': no module loader", specifier)
+	}
+	name, err := i.moduleLoader.Resolve(specifier, referrer)
+	if err != nil {
+		return nil, err
+	}
+	return i.loadModule(name)
+}
+
+// loadModule loads, parses and caches the module with the resolved name
+// and, recursively, the modules it imports.
+func (i *Interpreter) loadModule(name string) (*moduleRecord, error) {
+	if m, ok := i.modules[name]; ok {
+		return m, nil
+	}
+
+	src, err := i.moduleLoader.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if i.debugMode {
+		fmt.Printf("🔍 Debug: Loading module %s\n", name)
+	}
+
+	// Module code is always strict, and may await at its top level.
+	parser := NewParser(newSourceLexer(name, src))
+	parser.strict = true
+	parser.function.async = true
+	program := parser.ParseProgram()
+	if len(parser.errors) > 0 {
+		return nil, parser.errors[0]
+	}
+	program.Strict = true
+	i.optimize(program)
+
+	env := ExtendEnvironment(i.globalEnvironment())
+	env.hasThis = true
+	env.strict = true
+	env.this = Undefined
+	env.imports = make(map[string]importBinding)
+	m := &moduleRecord{
+		name:            name,
+		program:         program,
+		env:             env,
+		dependencies:    make(map[string]*moduleRecord),
+		imports:         make(map[string]moduleImport),
+		localExports:    make(map[string]string),
+		indirectExports: make(map[string]moduleImport),
+	}
+	env.module = m
+	m.collectEntries()
+
+	if i.modules == nil {
+		i.modules = make(map[string]*moduleRecord)
+	}
+	i.modules[name] = m
+
+	for _, stmt := range program.Statements {
+		var specifier string
+		switch s := stmt.(type) {
+		case *ImportDeclaration:
+			specifier = s.Source
+		case *ExportDeclaration:
+			specifier = s.Source
+		}
+		if specifier == "" {
+			continue
+		}
+		if _, ok := m.dependencies[specifier]; ok {
+			continue
+		}
+		depName, err := i.moduleLoader.Resolve(specifier, name)
+		if err != nil {
+			return nil, err
+		}
+		dep, err := i.loadModule(depName)
+		if err != nil {
+			return nil, err
+		}
+		m.dependencies[specifier] = dep
+		m.requested = append(m.requested, dep)
+	}
+	return m, nil
+}
+
+// collectEntries records what the module's import and export declarations
+// import and export.
+func (m *moduleRecord) collectEntries() {
+	for _, stmt := range m.program.Statements {
+		switch s := stmt.(type) {
+		case *ImportDeclaration:
+			if s.Default != "" {
+				m.imports[s.Default] = moduleImport{specifier: s.Source, name: "default"}
+			}
+			if s.Namespace != "" {
+				m.imports[s.Namespace] = moduleImport{specifier: s.Source, name: namespaceBinding}
+			}
+			for _, spec := range s.Specifiers {
+				m.imports[spec.Alias] = moduleImport{specifier: s.Source, name: spec.Name}
+			}
+		case *ExportDeclaration:
+			switch {
+			case s.Declaration != nil:
+				name := declaredName(s.Declaration)
+				m.localExports[name] = name
+			case s.Default != nil:
+				m.localExports["default"] = defaultExportBinding(s.Default)
+			case s.All && s.Namespace != "":
+				m.indirectExports[s.Namespace] = moduleImport{specifier: s.Source, name: namespaceBinding}
+			case s.All:
+				m.starExports = append(m.starExports, s.Source)
+			case s.Source != "":
+				for _, spec := range s.Specifiers {
+					m.indirectExports[spec.Alias] = moduleImport{specifier: s.Source, name: spec.Name}
+				}
+			default:
+				for _, spec := range s.Specifiers {
+					m.localExports[spec.Alias] = spec.Name
+				}
+			}
+		}
+	}
+}
+
+// declaredName returns the name of the binding a let, function or class
+// declaration creates.
+func declaredName(stmt Statement) string {
+	switch s := stmt.(type) {
+	case *LetStatement:
+		return s.Name.Value
+	case *FunctionDeclaration:
+		return s.Function.Name
+	case *ClassDeclaration:
+		return s.Class.Name
+	}
+	return ""
+}
+
+// defaultExportBinding returns the local binding export default creates:
+// the name of a named function or class, or else defaultBinding.
+func defaultExportBinding(exp Expression) string {
+	switch e := exp.(type) {
+	case *FunctionLiteral:
+		if e.Name != "" && !e.Arrow {
+			return e.Name
+		}
+	case *ClassLiteral:
+		if e.Name != "" {
+			return e.Name
+		}
+	}
+	return defaultBinding
+}
+
+// hoistedFunction returns the function literal of a top-level statement
+// that declares a function, which is created when the module is linked so
+// that modules in a cycle can call it before the module is evaluated.
+func hoistedFunction(stmt Statement) *FunctionLiteral {
+	switch s := stmt.(type) {
+	case *FunctionDeclaration:
+		return s.Function
+	case *ExportDeclaration:
+		if decl, ok := s.Declaration.(*FunctionDeclaration); ok {
+			return decl.Function
+		}
+		if lit, ok := s.Default.(*FunctionLiteral); ok && !lit.Arrow {
+			return lit
+		}
+	}
+	return nil
+}
+
+// linkModule binds the imports of m and the modules it depends on to the
+// bindings they refer to and creates their function declarations.
+func (i *Interpreter) linkModule(m *moduleRecord) {
+	if m.linked {
+		return
+	}
+	m.linked = true
+	for _, dep := range m.requested {
+		i.linkModule(dep)
+	}
+
+	for local, imp := range m.imports {
+		resolved := i.resolveImport(m, imp, make(map[exportKey]bool))
+		if resolved.name == namespaceBinding {
+			m.env.Set(local, i.moduleNamespace(resolved.module))
+			continue
+		}
+		m.env.imports[local] = importBinding{env: resolved.module.env, name: resolved.name}
+	}
+
+	savedEnv := i.env
+	i.env = m.env
+	defer func() { i.env = savedEnv }()
+	i.pushFrame("", m.program.source)
+	defer i.popFrame()
+	for _, stmt := range m.program.Statements {
+		lit := hoistedFunction(stmt)
+		if lit == nil {
+			continue
+		}
+		fn := i.evalExpression(lit)
+		nameFunction(fn, "default")
+		binding := lit.Name
+		if binding == "" {
+			binding = defaultBinding
+		}
+		m.env.Set(binding, fn)
+	}
+}
+
+// resolveImport resolves what imp imports from a dependency of m, throwing
+// a SyntaxError when the dependency has no such export.
+func (i *Interpreter) resolveImport(m *moduleRecord, imp moduleImport, visited map[exportKey]bool) resolvedExport {
+	dep := m.dependencies[imp.specifier]
+	if imp.name == namespaceBinding {
+		return resolvedExport{module: dep, name: namespaceBinding}
+	}
+	resolved, ambiguous := i.resolveExport(dep, imp.name, visited)
+	if ambiguous {
+		i.throwError("SyntaxError", "The requested module '%s' contains conflicting star exports for name '%s'", imp.specifier, imp.name)
+	}
+	if resolved == nil {
+		i.throwError("SyntaxError", "The requested module '%s' does not provide an export named '%s'", imp.specifier, imp.name)
+	}
+	return *resolved
+}
+
+// resolveExport finds the binding the export name of m refers to. It
+// returns nil when there is no such export, and reports whether the name
+// is exported by more than one export * with different bindings.
+func (i *Interpreter) resolveExport(m *moduleRecord, name string, visited map[exportKey]bool) (*resolvedExport, bool) {
+	key := exportKey{module: m, name: name}
+	if visited[key] {
+		return nil, false
+	}
+	visited[key] = true
+
+	if local, ok := m.localExports[name]; ok {
+		if imp, ok := m.imports[local]; ok {
+			resolved := i.resolveImport(m, imp, visited)
+			return &resolved, false
+		}
+		return &resolvedExport{module: m, name: local}, false
+	}
+	if imp, ok := m.indirectExports[name]; ok {
+		resolved := i.resolveImport(m, imp, visited)
+		return &resolved, false
+	}
+	if name == "default" {
+		return nil, false
+	}
+
+	var star *resolvedExport
+	for _, specifier := range m.starExports {
+		resolved, ambiguous := i.resolveExport(m.dependencies[specifier], name, visited)
+		if ambiguous {
+			return nil, true
+		}
+		if resolved == nil {
+			continue
+		}
+		if star != nil && *star != *resolved {
+			return nil, true
+		}
+		star = resolved
+	}
+	return star, false
+}
+
+// exportedNames returns the names m exports, including those of its
+// export * declarations other than default.
+func (m *moduleRecord) exportedNames(visited map[*moduleRecord]bool) []string {
+	if visited[m] {
+		return nil
+	}
+	visited[m] = true
+
+	var names []string
+	for name := range m.localExports {
+		names = append(names, name)
+	}
+	for name := range m.indirectExports {
+		names = append(names, name)
+	}
+	for _, specifier := range m.starExports {
+		for _, name := range m.dependencies[specifier].exportedNames(visited) {
+			if name != "default" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// moduleNamespace returns the namespace object of m, whose properties are
+// getters that read m's exports, so they stay live.
+func (i *Interpreter) moduleNamespace(m *moduleRecord) Value {
+	if m.namespace.Type != TypeUndefined {
+		return m.namespace
+	}
+
+	ns := i.newObject()
+	ns.Data = "Module"
+	ns.Object.Prototype = Value{Type: TypeNull}
+	setSymbolSlot(ns, symbolToStringTag, Value{Type: TypeString, Data: "Module"})
+	m.namespace = ns
+
+	names := m.exportedNames(make(map[*moduleRecord]bool))
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := ns.Object.Properties[name]; ok {
+			continue
+		}
+		resolved, _ := i.resolveExport(m, name, make(map[exportKey]bool))
+		if resolved == nil {
+			continue
+		}
+		getter := i.newNativeFunction(name, 0, func(this Value, args []Value) Value {
+			if resolved.name == namespaceBinding {
+				return i.moduleNamespace(resolved.module)
+			}
+			return importBinding{env: resolved.module.env, name: resolved.name}.get()
+		})
+		ns.Object.Properties[name] = Value{Type: TypeAccessor, Data: &Accessor{Get: getter, Set: Undefined}}
+	}
+	return ns
+}
+
+// evaluateModule starts evaluating m after the modules it depends on and
+// returns the promise for its namespace object. A module's body runs like
+// an async function, so it can use await at the top level; modules that
+// depend on it wait for it to finish, except where they form a cycle.
+func (i *Interpreter) evaluateModule(m *moduleRecord) Value {
+	if m.evaluation.Type != TypeUndefined {
+		return m.evaluation
+	}
+
+	a := &asyncFunction{capability: i.newPromiseCapability()}
+	m.evaluation = a.capability.promise
+	m.evaluating = true
+	defer func() { m.evaluating = false }()
+
+	var waitFor []Value
+	for _, dep := range m.requested {
+		evaluation := i.evaluateModule(dep)
+		if !dep.evaluating {
+			waitFor = append(waitFor, evaluation)
+		}
+	}
+
+	a.body = i.newCoroutine(func() Value {
+		result, exception := i.tryCatch(func() Value {
+			for _, evaluation := range waitFor {
+				switch p := evaluation.Data.(*Promise); p.state {
+				case PromisePending:
+					i.await(a.body, evaluation)
+				case PromiseRejected:
+					panic(i.exception(p.result))
+				}
+			}
+			i.evalModuleBody(m)
+			return i.moduleNamespace(m)
+		})
+		a.exception = exception
+		return result
+	})
+	m.env.async = a.body
+
+	i.stepAsync(a, resumeNext, Undefined)
+	return m.evaluation
+}
+
+// evalModuleBody runs the statements of a module in its scope. Imports
+// and function declarations have already been handled by linkModule.
+func (i *Interpreter) evalModuleBody(m *moduleRecord) {
+	savedEnv := i.env
+	i.env = m.env
+	defer func() { i.env = savedEnv }()
+	i.pushFrame("", m.program.source)
+	defer i.popFrame()
+
+	if i.debugMode {
+		fmt.Printf("🔍 Debug: Evaluating module %s\n", m.name)
+	}
+
+	for _, stmt := range m.program.Statements {
+		if hoistedFunction(stmt) != nil {
+			continue
+		}
+		switch s := stmt.(type) {
+		case *ImportDeclaration:
+		case *ExportDeclaration:
+			switch {
+			case s.Declaration != nil:
+				i.evalStatement(s.Declaration)
+			case s.Default != nil:
+				val := i.evalExpression(s.Default)
+				nameFunction(val, "default")
+				m.env.Set(m.localExports["default"], val)
+			}
+		default:
+			i.evalStatement(stmt)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ModuleLoader finds the source of the modules imported by import
+// declarations, import() and Interpreter.ImportModule.
+type ModuleLoader interface {
+	// Resolve returns the name of the module specifier refers to when it
+	// is imported by the module named referrer, or by a script or the host
+	// when referrer is empty. Modules with the same name are loaded once.
+	Resolve(specifier string, referrer string) (string, error)
+	// Load returns the source of the module with the resolved name.
+	Load(name string) (string, error)
+}
+
+// FSModuleLoader loads modules from the files of FS. Specifiers starting
+// with ./ or ../ are relative to the importing module's file and others to
+// the root of FS.
+type FSModuleLoader struct {
+	FS fs.FS
+}
+
+func NewFSModuleLoader(fsys fs.FS) *FSModuleLoader {
+	return &FSModuleLoader{FS: fsys}
+}
+
+func (l *FSModuleLoader) Resolve(specifier string, referrer string) (string, error) {
+	name := specifier
+	if strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		name = path.Join(path.Dir(referrer), specifier)
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "resolve", Path: specifier, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+func (l *FSModuleLoader) Load(name string) (string, error) {
+	src, err := fs.ReadFile(l.FS, name)
+	if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// importMain imports main.js from files and returns the value of its
+// export result, or the error importing it gave.
+func importMain(t *testing.T, files map[string]string) string {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, src := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	i := NewInterpreter()
+	i.SetModuleLoader(NewFSModuleLoader(fsys))
+	promise, err := i.ImportModule("main.js")
+	if err != nil {
+		return err.Error()
+	}
+	state, result, _ := PromiseResult(promise)
+	switch state {
+	case PromiseRejected:
+		if isObject(result) {
+			return "rejected: " + result.Object.Properties["name"].ToString() + ": " + result.Object.Properties["message"].ToString()
+		}
+		return "rejected: " + result.ToString()
+	case PromisePending:
+		return "pending"
+	}
+	exported, err := i.GetProperty(result, "result")
+	if err != nil {
+		return err.Error()
+	}
+	return exported.ToString()
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"declarations", map[string]string{
+			"main.js": `import { a, f, C, af } from "./lib.js"; export let result = a + f() + new C().v + typeof af;`,
+			"lib.js":  `export let a = 1; export function f() { return 2; } export class C { constructor() { this.v = 3; } } export async function af() {}`,
+		}, "6function"},
+		{"default and aliases", map[string]string{
+			"main.js": `import def, { x as y } from "./lib.js"; export let result = def + y;`,
+			"lib.js":  `let x = "x"; export { x }; export default "d";`,
+		}, "dx"},
+		{"namespace", map[string]string{
+			"main.js": `import * as lib from "./lib.js"; export let result = lib.a + lib.b;`,
+			"lib.js":  `export let a = 1; export let b = 2;`,
+		}, "3"},
+		{"re-exports", map[string]string{
+			"main.js": `import { a, b, ns } from "./mid.js"; export let result = a + b + ns.c;`,
+			"mid.js":  `export * from "./a.js"; export { b } from "./b.js"; export * as ns from "./c.js";`,
+			"a.js":    `export let a = "a";`,
+			"b.js":    `export let b = "b";`,
+			"c.js":    `export let c = "c";`,
+		}, "abc"},
+		{"live bindings", map[string]string{
+			"main.js": `import { n, inc } from "./lib.js"; inc(); inc(); export let result = n;`,
+			"lib.js":  `export let n = 0; export function inc() { n = n + 1; }`,
+		}, "2"},
+		{"cycles", map[string]string{
+			"main.js": `import { b } from "./b.js"; export function a() { return "a"; } export let result = b();`,
+			"b.js":    `import { a } from "./main.js"; export function b() { return a() + "b"; }`,
+		}, "ab"},
+		{"top-level await", map[string]string{
+			"main.js": `import { v } from "./lib.js"; export let result = v + await Promise.resolve(1);`,
+			"lib.js":  `export let v = await Promise.resolve(41);`,
+		}, "42"},
+		{"dynamic import", map[string]string{
+			"main.js": `let lib = await import("./lib.js"); export let result = lib.default;`,
+			"lib.js":  `export default "dynamic";`,
+		}, "dynamic"},
+		{"modules are strict", map[string]string{
+			"main.js": `let o = Object.freeze({}); o.x = 1; export let result = 1;`,
+		}, "TypeError"},
+		{"missing export", map[string]string{
+			"main.js": `import { nope } from "./lib.js"; export let result = 1;`,
+			"lib.js":  `export let a = 1;`,
+		}, "SyntaxError: The requested module './lib.js' does not provide an export named 'nope'"},
+		{"missing module", map[string]string{
+			"main.js": `import { a } from "./nope.js"; export let result = a;`,
+		}, "nope.js"},
+		{"export const", map[string]string{
+			"main.js": `export const x = 1;`,
+		}, "main.js:1:8: SyntaxError: Unexpected identifier 'const'"},
+		{"export var", map[string]string{
+			"main.js": `export var x;`,
+		}, "main.js:1:8: SyntaxError: Unexpected identifier 'var'"},
+		{"duplicate export", map[string]string{
+			"main.js": `export let a = 1; let b = 2; export { b as a };`,
+		}, "main.js:1:30: SyntaxError: Duplicate export of 'a'"},
+		{"duplicate default", map[string]string{
+			"main.js": `export default 1; export default 2;`,
+		}, "SyntaxError: Duplicate export of 'default'"},
+		{"anonymous function", map[string]string{
+			"main.js": `export function () {}`,
+		}, "SyntaxError: Function statements require a function name"},
+		{"malformed import", map[string]string{
+			"main.js": `import { a } "./lib.js";`,
+		}, "SyntaxError: Unexpected string"},
+	}
+	for _, tt := range tests {
+		if got := importMain(t, tt.files); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package engine
+
+import (
+	"sort"
+	"strconv"
+)
+
+// objectMethods are the essential internal methods of objects. Every
+// operation the interpreter performs on an object goes through them, so
+// that proxies can intercept it; ordinary objects implement them with
+// the default behaviour of the specification.
+type objectMethods interface {
+	getPrototypeOf(obj Value) Value
+	setPrototypeOf(obj Value, proto Value) bool
+	isExtensible(obj Value) bool
+	preventExtensions(obj Value) bool
+	getOwnProperty(obj Value, key Value) (*propertyDescriptor, bool)
+	defineOwnProperty(obj Value, key Value, desc *propertyDescriptor) bool
+	hasProperty(obj Value, key Value) bool
+	get(obj Value, key Value, receiver Value) Value
+	set(obj Value, key Value, val Value, receiver Value) bool
+	delete(obj Value, key Value) bool
+	ownPropertyKeys(obj Value) []Value
+}
+
+// methodsOf returns the internal methods of an object.
+func (i *Interpreter) methodsOf(obj Value) objectMethods {
+	if proxy, ok := obj.Data.(*Proxy); ok {
+		return &proxyObject{i: i, proxy: proxy}
+	}
+	return ordinaryObject{i: i}
+}
+
+func isObject(v Value) bool {
+	return v.Type == TypeObject || v.Type == TypeFunction
+}
+
+// prototypeOf returns the [[Prototype]] of a value, or null when it has
+// none. Symbols and BigInts report the prototype their methods come from.
+func (i *Interpreter) prototypeOf(v Value) Value {
+	switch v.Type {
+	case TypeObject, TypeFunction:
+		return i.methodsOf(v).getPrototypeOf(v)
+	case TypeSymbol:
+		return i.symbolPrototype
+	case TypeBigInt:
+		return i.bigintPrototype
+	case TypeNumber, TypeString, TypeBoolean:
+		return i.primitivePrototypes[v.Type]
+	}
+	return Value{Type: TypeNull}
+}
+
+// setPrototypeOf changes the [[Prototype]] of an object and reports
+// whether it could.
+func (i *Interpreter) setPrototypeOf(obj Value, proto Value) bool {
+	return i.methodsOf(obj).setPrototypeOf(obj, proto)
+}
+
+// isExtensible reports whether properties may be added to obj.
+func (i *Interpreter) isExtensible(obj Value) bool {
+	return i.methodsOf(obj).isExtensible(obj)
+}
+
+// preventExtensions stops properties from being added to obj and reports
+// whether it succeeded.
+func (i *Interpreter) preventExtensions(obj Value) bool {
+	return i.methodsOf(obj).preventExtensions(obj)
+}
+
+// getOwnPropertyDescriptor returns the complete descriptor of the own
+// property key of obj.
+func (i *Interpreter) getOwnPropertyDescriptor(obj Value, key Value) (*propertyDescriptor, bool) {
+	return i.methodsOf(obj).getOwnProperty(obj, key)
+}
+
+// defineOwnProperty defines or changes the own property key of obj as desc
+// describes, reporting false when the change is not allowed.
+func (i *Interpreter) defineOwnProperty(obj Value, key Value, desc *propertyDescriptor) bool {
+	return i.methodsOf(obj).defineOwnProperty(obj, key, desc)
+}
+
+// ownKeys returns the own property keys of obj.
+func (i *Interpreter) ownKeys(obj Value) []Value {
+	return i.methodsOf(obj).ownPropertyKeys(obj)
+}
+
+// hasProperty reports whether obj or an object on its prototype chain has
+// the named property.
+func (i *Interpreter) hasProperty(obj Value, name string) bool {
+	return i.hasMember(obj, stringKey(name))
+}
+
+// hasMember is hasProperty for a property key, which is a string or a
+// symbol.
+func (i *Interpreter) hasMember(obj Value, key Value) bool {
+	if !isObject(obj) {
+		return false
+	}
+	return i.methodsOf(obj).hasProperty(obj, key)
+}
+
+// getProperty reads the named property of a value, searching its
+// prototype chain when the value has no such own property.
+func (i *Interpreter) getProperty(obj Value, name string) Value {
+	return i.lookupMember(obj, stringKey(name), obj)
+}
+
+// getMember is getProperty for a property key, which is a string or a
+// symbol.
+func (i *Interpreter) getMember(obj Value, key Value) Value {
+	return i.lookupMember(obj, key, obj)
+}
+
+// lookupMember reads a property starting at obj, calling getters with
+// receiver as this. It differs from getMember only for super lookups.
+func (i *Interpreter) lookupMember(obj Value, key Value, receiver Value) Value {
+	switch obj.Type {
+	case TypeNumber, TypeString, TypeBoolean, TypeSymbol, TypeBigInt:
+		obj = i.prototypeOf(obj)
+	}
+	if !isObject(obj) {
+		return Undefined
+	}
+	return i.methodsOf(obj).get(obj, key, receiver)
+}
+
+// setProperty writes a property of an object, calling the setter when the
+// property is an accessor on the object or its prototype chain. Data
+// properties are written to the object itself, keeping the length of
+// arrays in step with their indexed properties. Writes to primitives are
+// ignored.
+func (i *Interpreter) setProperty(obj Value, name string, val Value) {
+	i.setMember(obj, stringKey(name), val)
+}
+
+// setMember is setProperty for a property key, which is a string or a
+// symbol. A write that is not allowed throws a TypeError in strict mode
+// code and is ignored otherwise.
+func (i *Interpreter) setMember(obj Value, key Value, val Value) {
+	if obj.Object == nil {
+		return
+	}
+	if !i.methodsOf(obj).set(obj, key, val, obj) && i.isStrict() {
+		i.throwSetFailure(obj, key)
+	}
+}
+
+// throwSetFailure explains why writing the property key of obj failed.
+func (i *Interpreter) throwSetFailure(obj Value, key Value) {
+	for o := obj; isObject(o); o = i.prototypeOf(o) {
+		if _, ok := o.Data.(*Proxy); ok {
+			i.throwError("TypeError", "'set' on proxy: trap returned falsish for property '%s'", key.ToString())
+		}
+		prop, ok := i.getOwnMember(o, key)
+		if !ok {
+			continue
+		}
+		if prop.Type == TypeAccessor {
+			i.throwError("TypeError", "Cannot set property %s of %s which has only a getter", key.ToString(), i.describeObject(obj))
+		}
+		if attributesOf(o, key)&nonWritable != 0 {
+			i.throwError("TypeError", "Cannot assign to read only property '%s' of object '%s'", key.ToString(), i.describeObject(obj))
+		}
+		break
+	}
+	i.throwError("TypeError", "Cannot add property %s, object is not extensible", key.ToString())
+}
+
+// deleteMember removes the own property key of obj, unless it is
+// non-configurable, and reports whether obj no longer has the property.
+func (i *Interpreter) deleteMember(obj Value, key Value) bool {
+	return i.methodsOf(obj).delete(obj, key)
+}
+
+// ordinaryObject implements the internal methods of ordinary objects,
+// whose properties live in Properties and the object's internal slots.
+type ordinaryObject struct {
+	i *Interpreter
+}
+
+func (o ordinaryObject) getPrototypeOf(obj Value) Value {
+	if obj.Object != nil && obj.Object.Prototype.Type != TypeUndefined {
+		return obj.Object.Prototype
+	}
+	switch {
+	case obj.Type == TypeObject && obj.Data == "Array":
+		return o.i.arrayPrototype
+	case obj.Type == TypeObject:
+		return o.i.objectPrototype
+	case obj.Type == TypeFunction:
+		return o.i.functionPrototype
+	}
+	return Value{Type: TypeNull}
+}
+
+// setPrototypeOf refuses to change the prototype of a non-extensible
+// object or to create a cycle in the prototype chain. The check for
+// cycles stops at proxies, whose prototypes are not fixed.
+func (o ordinaryObject) setPrototypeOf(obj Value, proto Value) bool {
+	if sameValue(o.getPrototypeOf(obj), proto) {
+		return true
+	}
+	if obj.Object == nil || obj.Object.nonExtensible {
+		return false
+	}
+	for p := proto; p.Type != TypeNull; p = o.i.prototypeOf(p) {
+		if sameObject(p, obj) {
+			return false
+		}
+		if _, ok := p.Data.(*Proxy); ok {
+			break
+		}
+	}
+	obj.Object.Prototype = proto
+	return true
+}
+
+func (o ordinaryObject) isExtensible(obj Value) bool {
+	return obj.Object == nil || !obj.Object.nonExtensible
+}
+
+// preventExtensions fails for objects without internal slots, which have
+// nowhere to record it.
+func (o ordinaryObject) preventExtensions(obj Value) bool {
+	if obj.Object == nil {
+		return false
+	}
+	obj.Object.nonExtensible = true
+	return true
+}
+
+func (o ordinaryObject) getOwnProperty(obj Value, key Value) (*propertyDescriptor, bool) {
+	prop, ok := o.i.getOwnMember(obj, key)
+	if !ok {
+		return nil, false
+	}
+	attrs := attributesOf(obj, key)
+	desc := &propertyDescriptor{
+		enumerable:      attrs&nonEnumerable == 0,
+		configurable:    attrs&nonConfigurable == 0,
+		hasEnumerable:   true,
+		hasConfigurable: true,
+	}
+	if prop.Type == TypeAccessor {
+		accessor := prop.Data.(*Accessor)
+		desc.get, desc.set = accessor.Get, accessor.Set
+		desc.hasGet, desc.hasSet = true, true
+	} else {
+		desc.value, desc.writable = prop, attrs&nonWritable == 0
+		desc.hasValue, desc.hasWritable = true, true
+	}
+	return desc, true
+}
+
+// defineOwnProperty implements ValidateAndApplyPropertyDescriptor and,
+// for arrays, the [[DefineOwnProperty]] of array exotic objects: an index
+// defined past the end grows the length unless it is read-only, and
+// defining the length sets it as ArraySetLength does.
+func (o ordinaryObject) defineOwnProperty(obj Value, key Value, desc *propertyDescriptor) bool {
+	if obj.Type != TypeObject || obj.Data != "Array" || obj.Object == nil {
+		return o.ordinaryDefineOwnProperty(obj, key, desc)
+	}
+	if key.Type == TypeString && key.Data == "length" {
+		return o.arraySetLength(obj, desc)
+	}
+	idx, ok := arrayIndex(key)
+	if !ok {
+		return o.ordinaryDefineOwnProperty(obj, key, desc)
+	}
+	length := obj.Object.Properties["length"].ToNumber()
+	if float64(idx) >= length && attributesOf(obj, stringKey("length"))&nonWritable != 0 {
+		return false
+	}
+	if !o.ordinaryDefineOwnProperty(obj, key, desc) {
+		return false
+	}
+	if float64(idx) >= length {
+		obj.Object.Properties["length"] = Value{Type: TypeNumber, Data: float64(idx + 1)}
+	}
+	return true
+}
+
+// arraySetLength implements ArraySetLength: shrinking an array deletes
+// its elements from the last, stopping at one that cannot be deleted, and
+// an array whose length is read-only keeps its length.
+func (o ordinaryObject) arraySetLength(arr Value, desc *propertyDescriptor) bool {
+	lengthKey := stringKey("length")
+	if !desc.hasValue {
+		return o.ordinaryDefineOwnProperty(arr, lengthKey, desc)
+	}
+	number := o.i.toNumber(desc.value)
+	newLen := toUint32(Value{Type: TypeNumber, Data: number})
+	if float64(newLen) != number {
+		o.i.throwError("RangeError", "Invalid array length")
+	}
+	o.i.checkArrayLength(int64(newLen))
+	newDesc := *desc
+	newDesc.value = Value{Type: TypeNumber, Data: float64(newLen)}
+	oldLen := int64(toUint32(arr.Object.Properties["length"]))
+	if int64(newLen) >= oldLen {
+		return o.ordinaryDefineOwnProperty(arr, lengthKey, &newDesc)
+	}
+	if attributesOf(arr, lengthKey)&nonWritable != 0 {
+		return false
+	}
+	// The length stays writable until the elements are deleted, in case
+	// one of them cannot be.
+	newWritable := !desc.hasWritable || desc.writable
+	newDesc.writable, newDesc.hasWritable = true, true
+	if !o.ordinaryDefineOwnProperty(arr, lengthKey, &newDesc) {
+		return false
+	}
+
+	var indexes []int64
+	for name := range arr.Object.Properties {
+		if idx, ok := arrayIndex(stringKey(name)); ok && idx >= int64(newLen) {
+			indexes = append(indexes, idx)
+		}
+	}
+	sort.Slice(indexes, func(a, b int) bool { return indexes[a] > indexes[b] })
+	for _, idx := range indexes {
+		if !o.delete(arr, stringKey(strconv.FormatInt(idx, 10))) {
+			arr.Object.Properties["length"] = Value{Type: TypeNumber, Data: float64(idx + 1)}
+			if !newWritable {
+				setAttributes(arr, lengthKey, attributesOf(arr, lengthKey)|nonWritable)
+			}
+			return false
+		}
+	}
+	if !newWritable {
+		setAttributes(arr, lengthKey, attributesOf(arr, lengthKey)|nonWritable)
+	}
+	return true
+}
+
+// ordinaryDefineOwnProperty implements ValidateAndApplyPropertyDescriptor.
+func (o ordinaryObject) ordinaryDefineOwnProperty(obj Value, key Value, desc *propertyDescriptor) bool {
+	current, exists := o.getOwnProperty(obj, key)
+	if !validatePropertyDescriptor(o.isExtensible(obj), desc, current, exists) {
+		return false
+	}
+	if !exists {
+		if idx, ok := arrayIndex(key); ok && obj.Data == "Array" {
+			o.i.checkArrayLength(idx + 1)
+		}
+		o.i.allocate(propertySize)
+		current = &propertyDescriptor{value: Undefined, get: Undefined, set: Undefined}
+		if desc.isAccessor() {
+			current.hasGet, current.hasSet = true, true
+		} else {
+			current.hasValue, current.hasWritable = true, true
+		}
+	}
+
+	// Changing a data property into an accessor or back keeps only its
+	// enumerable and configurable attributes.
+	accessor := current.isAccessor()
+	if desc.isAccessor() && !accessor {
+		current = &propertyDescriptor{get: Undefined, set: Undefined, enumerable: current.enumerable, configurable: current.configurable}
+	} else if desc.isData() && accessor {
+		current = &propertyDescriptor{value: Undefined, enumerable: current.enumerable, configurable: current.configurable}
+	}
+	if desc.isAccessor() || desc.isData() {
+		accessor = desc.isAccessor()
+	}
+	if desc.hasValue {
+		current.value = desc.value
+	}
+	if desc.hasWritable {
+		current.writable = desc.writable
+	}
+	if desc.hasGet {
+		current.get = desc.get
+	}
+	if desc.hasSet {
+		current.set = desc.set
+	}
+	if desc.hasEnumerable {
+		current.enumerable = desc.enumerable
+	}
+	if desc.hasConfigurable {
+		current.configurable = desc.configurable
+	}
+
+	var attrs propertyAttributes
+	if !current.enumerable {
+		attrs |= nonEnumerable
+	}
+	if !current.configurable {
+		attrs |= nonConfigurable
+	}
+	if accessor {
+		setOwnMember(obj, key, Value{Type: TypeAccessor, Data: &Accessor{Get: current.get, Set: current.set}})
+	} else {
+		if !current.writable {
+			attrs |= nonWritable
+		}
+		setOwnMember(obj, key, current.value)
+	}
+	setAttributes(obj, key, attrs)
+	return true
+}
+
+// isArrayLength reports whether key is the length of the array obj.
+func isArrayLength(obj Value, key Value) bool {
+	return obj.Type == TypeObject && obj.Data == "Array" && key.Type == TypeString && key.Data == "length"
+}
+
+// arrayIndex returns the array index key is, if it is one: the canonical
+// form of an integer below 2^32 - 1.
+func arrayIndex(key Value) (int64, bool) {
+	if key.Type != TypeString {
+		return 0, false
+	}
+	idx, err := strconv.ParseInt(key.Data.(string), 10, 64)
+	if err != nil || idx < 0 || idx >= 1<<32-1 || strconv.FormatInt(idx, 10) != key.Data.(string) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func (o ordinaryObject) hasProperty(obj Value, key Value) bool {
+	if _, ok := o.i.getOwnMember(obj, key); ok {
+		return true
+	}
+	o.i.pushNesting()
+	defer o.i.popNesting()
+	return o.i.hasMember(o.getPrototypeOf(obj), key)
+}
+
+func (o ordinaryObject) get(obj Value, key Value, receiver Value) Value {
+	if prop, ok := o.i.getOwnMember(obj, key); ok {
+		if prop.Type == TypeAccessor {
+			return o.i.callGetter(prop.Data.(*Accessor), receiver)
+		}
+		return prop
+	}
+	o.i.pushNesting()
+	defer o.i.popNesting()
+	return o.i.lookupMember(o.getPrototypeOf(obj), key, receiver)
+}
+
+// set implements OrdinarySet: an inherited setter is called, an inherited
+// read-only property prevents the write, and otherwise the property is
+// written to the receiver.
+func (o ordinaryObject) set(obj Value, key Value, val Value, receiver Value) bool {
+	prop, ok := o.i.getOwnMember(obj, key)
+	if !ok {
+		if parent := o.getPrototypeOf(obj); isObject(parent) {
+			o.i.pushNesting()
+			defer o.i.popNesting()
+			return o.i.methodsOf(parent).set(parent, key, val, receiver)
+		}
+	}
+	if ok && prop.Type == TypeAccessor {
+		setter := prop.Data.(*Accessor).Set
+		if setter.Type != TypeFunction {
+			return false
+		}
+		o.i.applyFunction(setter, receiver, []Value{val})
+		return true
+	}
+	if ok && attributesOf(obj, key)&nonWritable != 0 {
+		return false
+	}
+	if !isObject(receiver) {
+		return false
+	}
+
+	// Writing an existing property of the receiver only changes its value,
+	// except for the length of an array.
+	if ok && sameObject(obj, receiver) && !isArrayLength(obj, key) {
+		setOwnMember(obj, key, val)
+		return true
+	}
+	if existing, exists := o.i.getOwnPropertyDescriptor(receiver, key); exists {
+		if existing.isAccessor() || !existing.writable {
+			return false
+		}
+		return o.i.defineOwnProperty(receiver, key, &propertyDescriptor{value: val, hasValue: true})
+	}
+	return o.i.defineOwnProperty(receiver, key, &propertyDescriptor{
+		value: val, writable: true, enumerable: true, configurable: true,
+		hasValue: true, hasWritable: true, hasEnumerable: true, hasConfigurable: true,
+	})
+}
+
+func (o ordinaryObject) delete(obj Value, key Value) bool {
+	if _, ok := o.i.getOwnMember(obj, key); ok && attributesOf(obj, key)&nonConfigurable != 0 {
+		return false
+	}
+	if obj.Object == nil {
+		return true
+	}
+	setAttributes(obj, key, 0)
+	if key.Type != TypeSymbol {
+		delete(obj.Object.Properties, key.Data.(string))
+		return true
+	}
+	delete(obj.Object.symbols, key.Data.(*Symbol))
+	return true
+}
+
+// ownPropertyKeys returns array indexes in ascending order, then other
+// names in sorted order, then symbols. The order of names is not their
+// order of creation, which objects do not record.
+func (o ordinaryObject) ownPropertyKeys(obj Value) []Value {
+	if obj.Object == nil {
+		return nil
+	}
+	var indexes []int
+	var names []string
+	if obj.Type == TypeFunction {
+		for _, name := range []string{"length", "name"} {
+			if _, own := obj.Object.Properties[name]; !own {
+				names = append(names, name)
+			}
+		}
+	}
+	for name := range obj.Object.Properties {
+		if idx, err := strconv.Atoi(name); err == nil && idx >= 0 && strconv.Itoa(idx) == name {
+			indexes = append(indexes, idx)
+		} else {
+			names = append(names, name)
+		}
+	}
+	sort.Ints(indexes)
+	sort.Strings(names)
+
+	keys := make([]Value, 0, len(indexes)+len(names))
+	for _, idx := range indexes {
+		keys = append(keys, stringKey(strconv.Itoa(idx)))
+	}
+	for _, name := range names {
+		keys = append(keys, stringKey(name))
+	}
+	var symbols []*Symbol
+	for sym := range obj.Object.symbols {
+		symbols = append(symbols, sym)
+	}
+	sort.Slice(symbols, func(a, b int) bool {
+		return symbols[a].descriptiveString() < symbols[b].descriptiveString()
+	})
+	for _, sym := range symbols {
+		keys = append(keys, symbolKey(sym))
+	}
+	return keys
+}
@@ -0,0 +1,439 @@
+package engine
+
+// Optimizations selects the passes Optimize makes over a program. Each
+// rewrites the program into one that behaves the same but does less work
+// when it runs.
+type Optimizations struct {
+	// FoldConstants replaces operators applied to literals, such as
+	// 60 * 60 or "a" + "b", with literals of their results. Strings longer
+	// than maxFoldedStringLength, or than the interpreter's
+	// Limits.MaxStringLength, are left for the script to build, so that
+	// the limits apply to them.
+	FoldConstants bool
+
+	// EliminateDeadCode removes the statements of a block that follow a
+	// return, or an if whose branches both return, since they never run.
+	EliminateDeadCode bool
+
+	// SimplifyConditions replaces an if whose condition is a literal with
+	// the block it runs.
+	SimplifyConditions bool
+
+	// InlineLiterals replaces the uses of a function's locals that are
+	// bound to a literal and never assigned with the literal, which lets
+	// the other passes work on them. Global bindings, which are properties
+	// of the global object, are left alone.
+	InlineLiterals bool
+}
+
+// maxFoldedStringLength bounds the strings FoldConstants builds, which no
+// limit counts. Folding cannot build many of them, each being the result
+// of an operator written in the program.
+const maxFoldedStringLength = 256
+
+// Optimize rewrites program in place with the passes opts selects. It must
+// be called before the program first runs.
+func Optimize(program *Program, opts Optimizations) {
+	optimize(program, opts, maxFoldedStringLength)
+}
+
+// optimize is Optimize folding strings no longer than maxString.
+func optimize(program *Program, opts Optimizations, maxString int) {
+	o := &optimizer{opts: opts, maxString: maxString, inlined: make(map[*Identifier]Expression)}
+	program.Statements = o.statements(program.Statements, nil)
+}
+
+// optimize is Optimize with the passes and within the limits set for the
+// interpreter.
+func (i *Interpreter) optimize(program *Program) {
+	optimize(program, i.optimizations, min(maxFoldedStringLength, i.limits.MaxStringLength))
+}
+
+// SetOptimizations sets the passes Optimize makes over the scripts and
+// modules the interpreter parses. None are made by default.
+func (i *Interpreter) SetOptimizations(opts Optimizations) {
+	i.optimizations = opts
+}
+
+// optimizer applies the selected passes in a single walk of the tree,
+// which rewrites the expressions in a node before the node itself.
+type optimizer struct {
+	opts Optimizations
+
+	// maxString is the length of the longest string FoldConstants may
+	// build.
+	maxString int
+
+	// inlined maps the uses of locals that InlineLiterals replaces to the
+	// literals replacing them.
+	inlined map[*Identifier]Expression
+}
+
+// statements optimizes a list of statements, which is the body of fn when
+// fn is not nil, and returns what is left of it.
+func (o *optimizer) statements(stmts []Statement, fn *FunctionLiteral) []Statement {
+	for idx, stmt := range stmts {
+		stmts[idx] = o.statement(stmt)
+		if let, ok := stmts[idx].(*LetStatement); ok && fn != nil && o.opts.InlineLiterals {
+			o.inline(fn, let, stmts[idx+1:])
+		}
+		if o.opts.EliminateDeadCode && alwaysReturns(stmts[idx]) {
+			return stmts[:idx+1]
+		}
+	}
+	return stmts
+}
+
+func (o *optimizer) statement(stmt Statement) Statement {
+	switch s := stmt.(type) {
+	case *LetStatement:
+		s.Value = o.expression(s.Value)
+	case *ReturnStatement:
+		s.ReturnValue = o.expression(s.ReturnValue)
+	case *ExpressionStatement:
+		s.Expression = o.expression(s.Expression)
+		if e, ok := s.Expression.(*IfExpression); ok && o.opts.SimplifyConditions {
+			if condition, ok := literalValue(e.Condition); ok {
+				if condition.ToBoolean() {
+					return e.Consequence
+				}
+				if e.Alternative != nil {
+					return e.Alternative
+				}
+				return &BlockStatement{Token: e.Token}
+			}
+		}
+	case *BlockStatement:
+		o.block(s)
+	case *FunctionDeclaration:
+		o.function(s.Function)
+	case *ClassDeclaration:
+		o.class(s.Class)
+	case *ExportDeclaration:
+		if s.Declaration != nil {
+			s.Declaration = o.statement(s.Declaration)
+		}
+		s.Default = o.expression(s.Default)
+	}
+	return stmt
+}
+
+func (o *optimizer) block(block *BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements, nil)
+	}
+}
+
+func (o *optimizer) function(fn *FunctionLiteral) {
+	if fn != nil && fn.Body != nil {
+		fn.Body.Statements = o.statements(fn.Body.Statements, fn)
+	}
+}
+
+func (o *optimizer) class(class *ClassLiteral) {
+	if class == nil {
+		return
+	}
+	class.SuperClass = o.expression(class.SuperClass)
+	for _, member := range class.Members {
+		member.ComputedKey = o.expression(member.ComputedKey)
+		o.function(member.Function)
+		member.Value = o.expression(member.Value)
+		o.block(member.Body)
+	}
+}
+
+// expression optimizes an expression, which may be missing, and returns
+// what replaces it.
+func (o *optimizer) expression(exp Expression) Expression {
+	each := func(exps []Expression) {
+		for idx, exp := range exps {
+			exps[idx] = o.expression(exp)
+		}
+	}
+	switch e := exp.(type) {
+	case *Identifier:
+		if lit, ok := o.inlined[e]; ok {
+			val, _ := literalValue(lit)
+			return literal(val, e.Token)
+		}
+	case *FunctionLiteral:
+		o.function(e)
+	case *ClassLiteral:
+		o.class(e)
+	case *IfExpression:
+		e.Condition = o.expression(e.Condition)
+		o.block(e.Consequence)
+		o.block(e.Alternative)
+		if o.opts.SimplifyConditions {
+			return simplifyIf(e)
+		}
+	case *PrefixExpression:
+		e.Right = o.expression(e.Right)
+		if o.opts.FoldConstants {
+			return foldPrefix(e)
+		}
+	case *InfixExpression:
+		e.Left = o.expression(e.Left)
+		e.Right = o.expression(e.Right)
+		if o.opts.FoldConstants {
+			return o.foldInfix(e)
+		}
+	case *AssignExpression:
+		e.Target = o.expression(e.Target)
+		e.Value = o.expression(e.Value)
+	case *MemberExpression:
+		e.Object = o.expression(e.Object)
+		if e.Computed {
+			e.Property = o.expression(e.Property)
+		}
+	case *CallExpression:
+		e.Function = o.expression(e.Function)
+		each(e.Arguments)
+	case *NewExpression:
+		e.Callee = o.expression(e.Callee)
+		each(e.Arguments)
+	case *ArrayLiteral:
+		each(e.Elements)
+	case *ObjectLiteral:
+		for _, prop := range e.Properties {
+			prop.ComputedKey = o.expression(prop.ComputedKey)
+			prop.Value = o.expression(prop.Value)
+		}
+	case *YieldExpression:
+		e.Argument = o.expression(e.Argument)
+	case *AwaitExpression:
+		e.Argument = o.expression(e.Argument)
+	case *ParenthesizedExpression:
+		e.Expression = o.expression(e.Expression)
+	case *ImportCall:
+		e.Source = o.expression(e.Source)
+	case *PrivateInExpression:
+		e.Right = o.expression(e.Right)
+	}
+	return exp
+}
+
+// simplifyIf replaces an if used as a value whose condition is a literal
+// with the expression the block it runs consists of, when it consists of
+// one.
+func simplifyIf(e *IfExpression) Expression {
+	condition, ok := literalValue(e.Condition)
+	if !ok {
+		return e
+	}
+	block := e.Alternative
+	if condition.ToBoolean() {
+		block = e.Consequence
+	}
+	if block == nil || len(block.Statements) != 1 {
+		return e
+	}
+	if stmt, ok := block.Statements[0].(*ExpressionStatement); ok {
+		return stmt.Expression
+	}
+	return e
+}
+
+func foldPrefix(e *PrefixExpression) Expression {
+	right, ok := literalValue(e.Right)
+	if !ok {
+		return e
+	}
+	switch e.Operator {
+	case "!":
+		return literal(Value{Type: TypeBoolean, Data: !right.ToBoolean()}, e.Token)
+	case "+":
+		return literal(Value{Type: TypeNumber, Data: right.ToNumber()}, e.Token)
+	case "-":
+		return literal(Value{Type: TypeNumber, Data: -right.ToNumber()}, e.Token)
+	case "~":
+		return literal(Value{Type: TypeNumber, Data: float64(^toInt32(right))}, e.Token)
+	case "typeof":
+		return literal(Value{Type: TypeString, Data: right.TypeOf()}, e.Token)
+	}
+	return e
+}
+
+// foldInfix replaces an operator applied to literals with a literal of its
+// result, unless the result is a string too long to build here.
+func (o *optimizer) foldInfix(e *InfixExpression) Expression {
+	left, ok := literalValue(e.Left)
+	if !ok {
+		return e
+	}
+	right, ok := literalValue(e.Right)
+	if !ok {
+		return e
+	}
+	if e.Operator == "+" && (left.Type == TypeString || right.Type == TypeString) &&
+		len(left.ToString())+len(right.ToString()) > o.maxString {
+		return e
+	}
+	if result, ok := primitiveOperation(e.Operator, left, right); ok {
+		return literal(result, e.Token)
+	}
+	return e
+}
+
+// literalValue returns the value of a literal of a primitive.
+func literalValue(exp Expression) (Value, bool) {
+	switch e := exp.(type) {
+	case *NumberLiteral:
+		return Value{Type: TypeNumber, Data: e.Value}, true
+	case *StringLiteral:
+		return Value{Type: TypeString, Data: e.Value}, true
+	case *BooleanLiteral:
+		return Value{Type: TypeBoolean, Data: e.Value}, true
+	case *NullLiteral:
+		return Value{Type: TypeNull}, true
+	}
+	return Undefined, false
+}
+
+// literal returns a literal, written at tok, of a value literalValue may
+// return.
+func literal(val Value, at Token) Expression {
+	switch val.Type {
+	case TypeNumber:
+		return &NumberLiteral{Token: Token{Type: NUMBER, Literal: val.ToString(), start: at.start}, Value: val.Data.(float64)}
+	case TypeString:
+		return &StringLiteral{Token: Token{Type: STRING, Literal: val.Data.(string), start: at.start}, Value: val.Data.(string)}
+	case TypeBoolean:
+		if val.Data.(bool) {
+			return &BooleanLiteral{Token: Token{Type: TRUE, Literal: "true", start: at.start}, Value: true}
+		}
+		return &BooleanLiteral{Token: Token{Type: FALSE, Literal: "false", start: at.start}, Value: false}
+	}
+	return &NullLiteral{Token: Token{Type: NULL, Literal: "null", start: at.start}}
+}
+
+// alwaysReturns reports whether a statement returns from the function it
+// is in whenever it runs to completion.
+func alwaysReturns(stmt Statement) bool {
+	switch s := stmt.(type) {
+	case *ReturnStatement:
+		return true
+	case *BlockStatement:
+		for _, stmt := range s.Statements {
+			if alwaysReturns(stmt) {
+				return true
+			}
+		}
+	case *ExpressionStatement:
+		if e, ok := s.Expression.(*IfExpression); ok && e.Alternative != nil {
+			return alwaysReturns(e.Consequence) && alwaysReturns(e.Alternative)
+		}
+	}
+	return false
+}
+
+// inline arranges for the uses of the local let declares in fn to be
+// replaced with its value in the statements that follow the declaration,
+// which run after it, if its value is a literal and the local keeps it.
+func (o *optimizer) inline(fn *FunctionLiteral, let *LetStatement, following []Statement) {
+	name := let.Name.Value
+	if _, ok := literalValue(let.Value); !ok || !keepsValue(fn, name) {
+		return
+	}
+	// Calls and property accesses describe their callees by name in error
+	// messages, and delete tells bindings from values, so those uses stay.
+	kept := make(map[*Identifier]bool)
+	keep := func(exp Expression) {
+		if ident, ok := exp.(*Identifier); ok {
+			kept[ident] = true
+		}
+	}
+	for _, stmt := range following {
+		inspect(stmt, func(node Node) bool {
+			switch n := node.(type) {
+			case *FunctionLiteral:
+				return !bindsName(n, name)
+			case *ClassLiteral:
+				return n.Name != name
+			case *CallExpression:
+				keep(n.Function)
+			case *NewExpression:
+				keep(n.Callee)
+			case *MemberExpression:
+				keep(n.Object)
+			case *AssignExpression:
+				keep(n.Target)
+			case *PrefixExpression:
+				if n.Operator == "delete" {
+					keep(n.Right)
+				}
+			case *Identifier:
+				if n.Value == name && !kept[n] {
+					o.inlined[n] = let.Value
+				}
+			}
+			return true
+		})
+	}
+}
+
+// keepsValue reports whether name is a local of fn declared once and never
+// assigned, so that it keeps the value its declaration binds.
+func keepsValue(fn *FunctionLiteral, name string) bool {
+	for _, param := range fn.Parameters {
+		if param.Value == name {
+			return false
+		}
+	}
+	if declarations(fn.Body, name) != 1 {
+		return false
+	}
+	assigned := false
+	inspect(fn.Body, func(node Node) bool {
+		if e, ok := node.(*AssignExpression); ok {
+			if target, ok := e.Target.(*Identifier); ok && target.Value == name {
+				assigned = true
+			}
+		}
+		return !assigned
+	})
+	return !assigned
+}
+
+// bindsName reports whether fn has a binding of its own called name, which
+// hides any of an enclosing scope.
+func bindsName(fn *FunctionLiteral, name string) bool {
+	if fn.Name == name {
+		return true
+	}
+	for _, param := range fn.Parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+	return fn.Body != nil && declarations(fn.Body, name) > 0
+}
+
+// declarations counts the declarations of name in the scope of the
+// function whose body is body, which does not include nested functions.
+func declarations(body *BlockStatement, name string) int {
+	count := 0
+	inspect(body, func(node Node) bool {
+		switch n := node.(type) {
+		case *LetStatement:
+			if n.Name.Value == name {
+				count++
+			}
+		case *FunctionDeclaration:
+			if n.Function.Name == name {
+				count++
+			}
+			return false
+		case *ClassDeclaration:
+			if n.Class.Name == name {
+				count++
+			}
+			return false
+		case *FunctionLiteral, *ClassLiteral:
+			return false
+		}
+		return true
+	})
+	return count
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var allOptimizations = Optimizations{FoldConstants: true, EliminateDeadCode: true, SimplifyConditions: true, InlineLiterals: true}
+
+func TestOptimizationsKeepBehaviour(t *testing.T) {
+	scripts := []string{
+		`60 * 60 * 24`,
+		`"a" + "b" + 1 + 2`,
+		`1 + 2 + "a"`,
+		`!0 + typeof null + -"3" + ~5`,
+		`1 / 0 + (0 / 0 == 0 / 0) + ("b" < "a")`,
+		`function f() { return 1; return 2; } f()`,
+		`function f(x) { if (x) { return 1; } else { return 2; } return 3; } f(0)`,
+		`if (true) { "then"; } else { "else"; }`,
+		`let v = if (0) { 1; } else { 2; }; v`,
+		`function f() { let a = "x"; let b = a + a; return b + b; } f()`,
+		`function f() { let a = 2; a = 3; return a * a; } f()`,
+		`function f() { let a = 1; function g() { let a = 5; return a; } return a + g(); } f()`,
+		`function f() { let a = 1; return () => a + 1; } f()()`,
+		`function f() { let g = 1; return g(); } f()`,
+		`function f() { let o = null; return o.x; } f()`,
+		`let x = 1; function f() { return x + 1; } x = 5; f()`,
+	}
+	for _, src := range scripts {
+		plain, plainErr := NewInterpreter().Eval(src)
+		i := NewInterpreter()
+		i.SetOptimizations(allOptimizations)
+		optimized, optimizedErr := i.Eval(src)
+		want, got := plain.ToString(), optimized.ToString()
+		if plainErr != nil {
+			want = plainErr.Error()
+		}
+		if optimizedErr != nil {
+			got = optimizedErr.Error()
+		}
+		if got != want {
+			t.Errorf("%s = %s optimized, want %s", src, got, want)
+		}
+	}
+}
+
+func TestOptimizePasses(t *testing.T) {
+	// body returns the statements of the function the program declares
+	// first.
+	body := func(program *Program) []Statement {
+		return program.Statements[0].(*FunctionDeclaration).Function.Body.Statements
+	}
+	value := func(stmt Statement) Expression {
+		switch s := stmt.(type) {
+		case *ExpressionStatement:
+			return s.Expression
+		case *ReturnStatement:
+			return s.ReturnValue
+		}
+		return nil
+	}
+
+	program := optimized(t, Optimizations{FoldConstants: true}, `60 * 60 * 24`)
+	if lit, ok := value(program.Statements[0]).(*NumberLiteral); !ok || lit.Value != 86400 {
+		t.Errorf("60 * 60 * 24 folded to %#v, want 86400", value(program.Statements[0]))
+	}
+	program = optimized(t, Optimizations{FoldConstants: true}, `"a" + "b" + 1`)
+	if lit, ok := value(program.Statements[0]).(*StringLiteral); !ok || lit.Value != "ab1" {
+		t.Errorf(`"a" + "b" + 1 folded to %#v, want "ab1"`, value(program.Statements[0]))
+	}
+	program = optimized(t, Optimizations{}, `60 * 60`)
+	if _, ok := value(program.Statements[0]).(*InfixExpression); !ok {
+		t.Errorf("60 * 60 without FoldConstants = %#v, want it unchanged", value(program.Statements[0]))
+	}
+	program = optimized(t, Optimizations{SimplifyConditions: true}, `let v = if (1) { 2; } else { 3; };`)
+	if lit, ok := program.Statements[0].(*LetStatement).Value.(*NumberLiteral); !ok || lit.Value != 2 {
+		t.Errorf("if (1) { 2; } else { 3; } simplified to %#v, want 2", program.Statements[0].(*LetStatement).Value)
+	}
+	program = optimized(t, Optimizations{EliminateDeadCode: true}, `function f(x) { if (x) { return 1; } else { return 2; } x; return 3; }`)
+	if stmts := body(program); len(stmts) != 1 {
+		t.Errorf("dead code left %d statements, want 1", len(stmts))
+	}
+	program = optimized(t, Optimizations{InlineLiterals: true, FoldConstants: true}, `function f() { let a = 2; return a * 3; }`)
+	if lit, ok := value(body(program)[1]).(*NumberLiteral); !ok || lit.Value != 6 {
+		t.Errorf("inlined a * 3 = %#v, want 6", value(body(program)[1]))
+	}
+	program = optimized(t, Optimizations{InlineLiterals: true}, `function f() { let a = 2; a = 3; return a; }`)
+	if _, ok := value(body(program)[2]).(*Identifier); !ok {
+		t.Errorf("assigned local inlined as %#v, want it kept", value(body(program)[2]))
+	}
+}
+
+// optimized parses src and optimizes it with opts.
+func optimized(t *testing.T, opts Optimizations, src string) *Program {
+	t.Helper()
+	program, err := Parse("", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Optimize(program, opts)
+	return program
+}
+
+func TestFoldingKeepsStringLimits(t *testing.T) {
+	var b strings.Builder
+	// The locals are called a, aa, aaa and so on, each twice as long as
+	// the one before.
+	name := func(n int) string { return strings.Repeat("a", n+1) }
+	b.WriteString(`function f() { let a = "0123456789012345678901234567890123456789";`)
+	for n := 1; n <= 25; n++ {
+		fmt.Fprintf(&b, " let %s = %s + %s;", name(n), name(n-1), name(n-1))
+	}
+	fmt.Fprintf(&b, " return %s; } f()", name(25))
+
+	i := NewInterpreter()
+	i.SetOptimizations(allOptimizations)
+	i.SetLimits(Limits{MaxStringLength: 1000, MaxMemory: 1 << 20})
+	start := time.Now()
+	_, err := i.Eval(b.String())
+	if err == nil || !strings.Contains(err.Error(), "RangeError: Invalid string length") {
+		t.Errorf("doubling a string 25 times = %v, want a RangeError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("doubling a string 25 times took %s", elapsed)
+	}
+
+	// Folding respects a string limit lower than its own.
+	i = NewInterpreter()
+	i.SetOptimizations(allOptimizations)
+	i.SetLimits(Limits{MaxStringLength: 5})
+	if _, err := i.Eval(`"abc" + "def"`); err == nil || !strings.Contains(err.Error(), "RangeError: Invalid string length") {
+		t.Errorf(`"abc" + "def" under a limit of 5 = %v, want a RangeError`, err)
+	}
+}
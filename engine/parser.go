@@ -1,36 +1,165 @@
 package engine
 
-import "strconv"
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 type Parser struct {
 	l         *Lexer
 	curToken  Token
 	peekToken Token
+	strict    bool
+
+	prefixParseFns map[TokenType]prefixParseFn
+	infixParseFns  map[TokenType]infixParseFn
+
+	// errors lists the syntax errors found, in the order of their
+	// positions.
+	errors []*SyntaxError
+
+	// arrowAhead caches isArrowAhead by the offset of the parenthesis, so
+	// that nested parentheses are each scanned once.
+	arrowAhead map[int]bool
+
+	// function is what the code being parsed may use of the function
+	// around it.
+	function functionContext
+
+	// exported holds the names a module exports, each of which it may
+	// export once.
+	exported map[string]bool
+
+	// classes are the bodies of the classes being parsed, innermost last,
+	// which private names are resolved against.
+	classes []*classScope
+}
+
+// classScope is a class body being parsed: the private names it declares
+// and the references to private names in it, which may come before their
+// declarations and are resolved once the body ends.
+type classScope struct {
+	declared   map[string]privateDeclaration
+	references []Token
+}
+
+// privateDeclaration is how a class declares a private name. Only a
+// getter and a setter that are both static or both not may share a name.
+type privateDeclaration struct {
+	kind   ClassMemberKind
+	static bool
+	paired bool
+}
+
+// functionContext is what code may use of the function around it: yield
+// in generators, await in async functions and at the top level of
+// modules, super properties in methods and super calls in the
+// constructors of derived classes. Arrow functions take super from the
+// code around them.
+type functionContext struct {
+	generator     bool
+	async         bool
+	superProperty bool
+	superCall     bool
+}
+
+// enterFunction makes ctx the context of the code parsed until the
+// returned function restores the one around it.
+func (p *Parser) enterFunction(ctx functionContext) func() {
+	outer := p.function
+	p.function = ctx
+	return func() { p.function = outer }
 }
 
 func NewParser(l *Lexer) *Parser {
-	p := &Parser{l: l}
+	p := &Parser{l: l, arrowAhead: make(map[int]bool)}
+	// The parse functions are bound to the parser that registered them,
+	// so every parser registers its own.
+	p.init()
 	p.nextToken()
 	p.nextToken()
 	return p
 }
 
+// SyntaxError is an error in the syntax of a script or module, at the
+// line and column, counting from 1, of the script called Script.
+type SyntaxError struct {
+	Message string
+	Script  string
+	Line    int
+	Column  int
+}
+
+func (e *SyntaxError) Error() string {
+	script := e.Script
+	if script == "" {
+		script = "<anonymous>"
+	}
+	return fmt.Sprintf("%s:%d:%d: SyntaxError: %s", script, e.Line, e.Column, e.Message)
+}
+
+// Parse parses the script src, called name in stack traces, and returns
+// its first syntax error if it has any. Parse may be called from any
+// goroutine, and the program it returns may be run any number of times,
+// by any interpreter, with RunProgram.
+func Parse(name string, src string) (*Program, error) {
+	return parseSource(newSourceLexer(name, src))
+}
+
+// parseSource parses the script a lexer reads.
+func parseSource(l *Lexer) (*Program, error) {
+	parser := NewParser(l)
+	program := parser.ParseProgram()
+	if len(parser.errors) > 0 {
+		return nil, parser.errors[0]
+	}
+	return program, nil
+}
+
 func (p *Parser) ParseProgram() *Program {
 	program := &Program{
 		Statements: []Statement{},
 	}
 
+	directives := true
 	for p.curToken.Type != EOF {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+			directives = p.checkDirective(stmt, directives)
 		}
 		p.nextToken()
 	}
+	program.Strict = p.strict
+	program.source = p.l.source
 
 	return program
 }
 
+// checkDirective switches the parser into strict mode when stmt is a
+// "use strict" directive and reports whether the directive prologue
+// continues past stmt.
+func (p *Parser) checkDirective(stmt Statement, directives bool) bool {
+	if !directives {
+		return false
+	}
+	es, ok := stmt.(*ExpressionStatement)
+	if !ok {
+		return false
+	}
+	lit, ok := es.Expression.(*StringLiteral)
+	if !ok {
+		return false
+	}
+	if lit.Value == "use strict" {
+		p.strict = true
+	}
+	return true
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
@@ -42,6 +171,33 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseLetStatement()
 	case RETURN:
 		return p.parseReturnStatement()
+	case FUNCTION:
+		if p.peekTokenIs(IDENT) || p.peekTokenIs(ASTERISK) {
+			return p.parseFunctionDeclaration()
+		}
+		return p.parseExpressionStatement()
+	case CLASS:
+		if p.peekTokenIs(IDENT) {
+			return p.parseClassDeclaration()
+		}
+		return p.parseExpressionStatement()
+	case "{":
+		return p.parseBlockStatement()
+	case IMPORT:
+		if p.peekTokenIs("(") || p.peekTokenIs(DOT) {
+			return p.parseExpressionStatement()
+		}
+		return p.parseImportDeclaration()
+	case EXPORT:
+		return p.parseExportDeclaration()
+	case IDENT:
+		if p.curToken.Literal == "async" && p.peekTokenIs(FUNCTION) {
+			if stmt := p.parseAsyncFunctionDeclaration(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -71,6 +227,245 @@ func (p *Parser) parseLetStatement() *LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseFunctionDeclaration() *FunctionDeclaration {
+	stmt := &FunctionDeclaration{Token: p.curToken}
+
+	lit := p.parseFunction(false)
+	if lit == nil {
+		return nil
+	}
+	stmt.Function = lit
+
+	return stmt
+}
+
+func (p *Parser) parseAsyncFunctionDeclaration() *FunctionDeclaration {
+	start := p.curToken.start
+	p.nextToken()
+	stmt := &FunctionDeclaration{Token: p.curToken}
+
+	lit := p.parseFunction(true)
+	if lit == nil || lit.Generator {
+		return nil
+	}
+	lit.text = p.sourceText(start)
+	stmt.Function = lit
+
+	return stmt
+}
+
+func (p *Parser) parseImportDeclaration() Statement {
+	decl := &ImportDeclaration{Token: p.curToken}
+
+	if p.peekTokenIs(STRING) {
+		p.nextToken()
+		decl.Source = p.curToken.Literal
+		if p.peekTokenIs(SEMICOLON) {
+			p.nextToken()
+		}
+		return decl
+	}
+
+	p.nextToken()
+	if p.curTokenIs(IDENT) {
+		decl.Default = p.curToken.Literal
+		if p.peekTokenIs(COMMA) {
+			p.nextToken()
+			p.nextToken()
+		}
+	}
+	switch {
+	case p.curTokenIs(ASTERISK):
+		if !p.expectContextualKeyword("as") || !p.expectPeek(IDENT) {
+			return nil
+		}
+		decl.Namespace = p.curToken.Literal
+	case p.curTokenIs("{"):
+		decl.Specifiers = p.parseModuleSpecifiers()
+		if decl.Specifiers == nil {
+			return nil
+		}
+	case decl.Default == "":
+		p.unexpected(p.curToken)
+		return nil
+	}
+
+	if !p.expectContextualKeyword("from") || !p.expectPeek(STRING) {
+		return nil
+	}
+	decl.Source = p.curToken.Literal
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+	return decl
+}
+
+func (p *Parser) parseExportDeclaration() Statement {
+	decl := &ExportDeclaration{Token: p.curToken}
+	p.nextToken()
+
+	switch {
+	case p.curTokenIs(ASTERISK):
+		decl.All = true
+		if p.peekTokenIs(IDENT) && p.peekToken.Literal == "as" {
+			p.nextToken()
+			if !p.expectPeek(IDENT) {
+				return nil
+			}
+			decl.Namespace = p.curToken.Literal
+		}
+		if !p.expectContextualKeyword("from") || !p.expectPeek(STRING) {
+			return nil
+		}
+		decl.Source = p.curToken.Literal
+	case p.curTokenIs("{"):
+		decl.Specifiers = p.parseModuleSpecifiers()
+		if decl.Specifiers == nil {
+			return nil
+		}
+		if p.peekTokenIs(IDENT) && p.peekToken.Literal == "from" {
+			p.nextToken()
+			if !p.expectPeek(STRING) {
+				return nil
+			}
+			decl.Source = p.curToken.Literal
+		}
+	case p.curTokenIs(IDENT) && p.curToken.Literal == "default":
+		p.nextToken()
+		decl.Default = p.parseExpression(LOWEST)
+		if decl.Default == nil {
+			return nil
+		}
+	case p.curTokenIs(LET):
+		stmt := p.parseLetStatement()
+		if stmt == nil {
+			return nil
+		}
+		decl.Declaration = stmt
+		return p.exportNames(decl, stmt.Name.Value)
+	case p.curTokenIs(FUNCTION):
+		stmt := p.parseFunctionDeclaration()
+		if stmt == nil {
+			return nil
+		}
+		if stmt.Function.Name == "" {
+			p.errorAt(stmt.Token, "Function statements require a function name")
+			return nil
+		}
+		decl.Declaration = stmt
+		return p.exportNames(decl, stmt.Function.Name)
+	case p.curTokenIs(IDENT) && p.curToken.Literal == "async" && p.peekTokenIs(FUNCTION):
+		stmt := p.parseAsyncFunctionDeclaration()
+		if stmt == nil {
+			return nil
+		}
+		decl.Declaration = stmt
+		return p.exportNames(decl, stmt.Function.Name)
+	case p.curTokenIs(CLASS):
+		stmt := p.parseClassDeclaration()
+		if stmt == nil {
+			return nil
+		}
+		if stmt.Class.Name == "" {
+			p.errorAt(stmt.Token, "Class statements require a class name")
+			return nil
+		}
+		decl.Declaration = stmt
+		return p.exportNames(decl, stmt.Class.Name)
+	default:
+		// Only let, function and class declarations are supported, so
+		// const and var are reported rather than exporting nothing.
+		p.unexpected(p.curToken)
+		return nil
+	}
+
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+	switch {
+	case decl.Default != nil:
+		return p.exportNames(decl, "default")
+	case decl.Namespace != "":
+		return p.exportNames(decl, decl.Namespace)
+	}
+	names := make([]string, len(decl.Specifiers))
+	for idx, specifier := range decl.Specifiers {
+		names[idx] = specifier.Alias
+	}
+	return p.exportNames(decl, names...)
+}
+
+// exportNames records the names decl exports, reporting any the module
+// already exports, and returns decl.
+func (p *Parser) exportNames(decl *ExportDeclaration, names ...string) Statement {
+	if p.exported == nil {
+		p.exported = make(map[string]bool)
+	}
+	for _, name := range names {
+		if p.exported[name] {
+			p.errorAt(decl.Token, "Duplicate export of '%s'", name)
+		}
+		p.exported[name] = true
+	}
+	return decl
+}
+
+// parseModuleSpecifiers parses the braced list of an import or export
+// declaration. It returns nil for a malformed list and an empty, non-nil
+// list for {}.
+func (p *Parser) parseModuleSpecifiers() []*ModuleSpecifier {
+	specifiers := []*ModuleSpecifier{}
+
+	for !p.peekTokenIs("}") {
+		p.nextToken()
+		if !p.isPropertyName() {
+			p.unexpected(p.curToken)
+			return nil
+		}
+		specifier := &ModuleSpecifier{Name: p.curToken.Literal, Alias: p.curToken.Literal}
+		if p.peekTokenIs(IDENT) && p.peekToken.Literal == "as" {
+			p.nextToken()
+			p.nextToken()
+			if !p.isPropertyName() {
+				p.unexpected(p.curToken)
+				return nil
+			}
+			specifier.Alias = p.curToken.Literal
+		}
+		specifiers = append(specifiers, specifier)
+
+		if !p.peekTokenIs("}") && !p.expectPeek(COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return specifiers
+}
+
+// expectContextualKeyword advances past the peek token if it is the given
+// contextual keyword, such as from or as, and otherwise reports it.
+func (p *Parser) expectContextualKeyword(keyword string) bool {
+	if p.peekTokenIs(IDENT) && p.peekToken.Literal == keyword {
+		p.nextToken()
+		return true
+	}
+	p.unexpected(p.peekToken)
+	return false
+}
+
+func (p *Parser) parseClassDeclaration() *ClassDeclaration {
+	stmt := &ClassDeclaration{Token: p.curToken}
+
+	class, ok := p.parseClassLiteral().(*ClassLiteral)
+	if !ok {
+		return nil
+	}
+	stmt.Class = class
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ReturnStatement {
 	stmt := &ReturnStatement{Token: p.curToken}
 
@@ -102,9 +497,43 @@ func (p *Parser) expectPeek(t TokenType) bool {
 		p.nextToken()
 		return true
 	}
+	p.unexpected(p.peekToken)
 	return false
 }
 
+// unexpected records a syntax error for a token the grammar does not
+// allow where it appears.
+func (p *Parser) unexpected(tok Token) {
+	switch tok.Type {
+	case EOF:
+		p.errorAt(tok, "Unexpected end of input")
+	case STRING:
+		p.errorAt(tok, "Unexpected string")
+	case NUMBER, BIGINT:
+		p.errorAt(tok, "Unexpected number")
+	case IDENT:
+		p.errorAt(tok, "Unexpected identifier '%s'", tok.Literal)
+	default:
+		p.errorAt(tok, "Unexpected token '%s'", tok.Literal)
+	}
+}
+
+// errorAt records a syntax error at tok.
+func (p *Parser) errorAt(tok Token, format string, args ...interface{}) {
+	err := &SyntaxError{Message: fmt.Sprintf(format, args...)}
+	if src := p.l.source; src != nil {
+		err.Script = src.name
+		err.Line, err.Column = src.position(tok.start)
+	}
+	// An error found once a class body ends may precede errors found in
+	// the body.
+	at := len(p.errors)
+	for at > 0 && (p.errors[at-1].Line > err.Line || p.errors[at-1].Line == err.Line && p.errors[at-1].Column > err.Column) {
+		at--
+	}
+	p.errors = slices.Insert(p.errors, at, err)
+}
+
 func (p *Parser) peekTokenIs(t TokenType) bool {
 	return p.peekToken.Type == t
 }
@@ -116,28 +545,49 @@ func (p *Parser) curTokenIs(t TokenType) bool {
 const (
 	_ int = iota
 	LOWEST
+	ASSIGNMENT  // =
+	BITWISE_OR  // |
+	BITWISE_XOR // ^
+	BITWISE_AND // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
+	EXPONENTIAL // **
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
 	PROPERTY    // obj.prop
 )
 
 var precedences = map[TokenType]int{
-	EQ:       EQUALS,
-	NOT_EQ:   EQUALS,
-	LT:       LESSGREATER,
-	GT:       LESSGREATER,
-	LTE:      LESSGREATER,
-	GTE:      LESSGREATER,
-	PLUS:     SUM,
-	MINUS:    SUM,
-	SLASH:    PRODUCT,
-	ASTERISK: PRODUCT,
-	"(":      CALL,
-	DOT:      PROPERTY,
+	ASSIGN:               ASSIGNMENT,
+	EQ:                   EQUALS,
+	NOT_EQ:               EQUALS,
+	STRICT_EQ:            EQUALS,
+	STRICT_NOT_EQ:        EQUALS,
+	LT:                   LESSGREATER,
+	GT:                   LESSGREATER,
+	LTE:                  LESSGREATER,
+	GTE:                  LESSGREATER,
+	INSTANCEOF:           LESSGREATER,
+	IN:                   LESSGREATER,
+	PIPE:                 BITWISE_OR,
+	CARET:                BITWISE_XOR,
+	AMPERSAND:            BITWISE_AND,
+	SHIFT_LEFT:           SHIFT,
+	SHIFT_RIGHT:          SHIFT,
+	UNSIGNED_SHIFT_RIGHT: SHIFT,
+	PLUS:                 SUM,
+	MINUS:                SUM,
+	SLASH:                PRODUCT,
+	ASTERISK:             PRODUCT,
+	PERCENT:              PRODUCT,
+	EXPONENT:             EXPONENTIAL,
+	"(":                  CALL,
+	DOT:                  PROPERTY,
+	"[":                  PROPERTY,
+	OPTIONAL_CHAIN:       PROPERTY,
 }
 
 type (
@@ -145,64 +595,93 @@ type (
 	infixParseFn  func(Expression) Expression
 )
 
-var prefixParseFns map[TokenType]prefixParseFn
-var infixParseFns map[TokenType]infixParseFn
-
 func (p *Parser) registerPrefix(tokenType TokenType, fn prefixParseFn) {
-	if prefixParseFns == nil {
-		prefixParseFns = make(map[TokenType]prefixParseFn)
-	}
-	prefixParseFns[tokenType] = fn
+	p.prefixParseFns[tokenType] = fn
 }
 
 func (p *Parser) registerInfix(tokenType TokenType, fn infixParseFn) {
-	if infixParseFns == nil {
-		infixParseFns = make(map[TokenType]infixParseFn)
-	}
-	infixParseFns[tokenType] = fn
+	p.infixParseFns[tokenType] = fn
 }
 
 func (p *Parser) init() {
+	p.prefixParseFns = make(map[TokenType]prefixParseFn)
+	p.infixParseFns = make(map[TokenType]infixParseFn)
+
 	// Register prefix parsers
 	p.registerPrefix(IDENT, p.parseIdentifier)
 	p.registerPrefix(NUMBER, p.parseNumberLiteral)
+	p.registerPrefix(BIGINT, p.parseBigIntLiteral)
 	p.registerPrefix(STRING, p.parseStringLiteral)
+	p.registerPrefix(SLASH, p.parseRegExpLiteral)
 	p.registerPrefix(MINUS, p.parsePrefixExpression)
+	p.registerPrefix(PLUS, p.parsePrefixExpression)
 	p.registerPrefix(BANG, p.parsePrefixExpression)
+	p.registerPrefix(TILDE, p.parsePrefixExpression)
+	p.registerPrefix(TYPEOF, p.parsePrefixExpression)
+	p.registerPrefix(VOID, p.parsePrefixExpression)
+	p.registerPrefix(DELETE, p.parsePrefixExpression)
+	p.registerPrefix(NULL, p.parseNullLiteral)
+	p.registerPrefix(YIELD, p.parseYieldExpression)
+	p.registerPrefix(AWAIT, p.parseAwaitExpression)
+	p.registerPrefix(IMPORT, p.parseImportExpression)
 	p.registerPrefix(TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(IF, p.parseIfExpression)
+	p.registerPrefix("(", p.parseGroupedExpression)
+	p.registerPrefix(THIS, p.parseThisExpression)
+	p.registerPrefix("[", p.parseArrayLiteral)
+	p.registerPrefix("{", p.parseObjectLiteral)
+	p.registerPrefix(NEW, p.parseNewExpression)
+	p.registerPrefix(CLASS, p.parseClassLiteral)
+	p.registerPrefix(SUPER, p.parseSuperExpression)
+	p.registerPrefix(PRIVATE, p.parsePrivateInExpression)
 
 	// Register infix parsers
 	p.registerInfix(PLUS, p.parseInfixExpression)
 	p.registerInfix(MINUS, p.parseInfixExpression)
 	p.registerInfix(SLASH, p.parseInfixExpression)
 	p.registerInfix(ASTERISK, p.parseInfixExpression)
+	p.registerInfix(PERCENT, p.parseInfixExpression)
+	p.registerInfix(EXPONENT, p.parseInfixExpression)
+	p.registerInfix(AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(PIPE, p.parseInfixExpression)
+	p.registerInfix(CARET, p.parseInfixExpression)
+	p.registerInfix(SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(UNSIGNED_SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(GT, p.parseInfixExpression)
 	p.registerInfix(LT, p.parseInfixExpression)
 	p.registerInfix(GTE, p.parseInfixExpression)
 	p.registerInfix(LTE, p.parseInfixExpression)
 	p.registerInfix(EQ, p.parseInfixExpression)
 	p.registerInfix(NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(STRICT_EQ, p.parseInfixExpression)
+	p.registerInfix(STRICT_NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(INSTANCEOF, p.parseInfixExpression)
+	p.registerInfix(IN, p.parseInfixExpression)
+	p.registerInfix(ASSIGN, p.parseAssignExpression)
 	p.registerInfix("(", p.parseCallExpression)
 	p.registerInfix(DOT, p.parseDotExpression)
+	p.registerInfix("[", p.parseIndexExpression)
+	p.registerInfix(OPTIONAL_CHAIN, p.parseOptionalChain)
 }
 
 func (p *Parser) parseExpression(precedence int) Expression {
-	if prefixParseFns == nil {
-		p.init()
-	}
-
-	prefix := prefixParseFns[p.curToken.Type]
+	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
+		p.unexpected(p.curToken)
 		return nil
 	}
 
+	start := p.curToken.start
 	leftExp := prefix()
+	if lit, ok := leftExp.(*FunctionLiteral); ok && lit.Arrow && lit.text == "" {
+		lit.text = p.sourceText(start)
+	}
 
 	for !p.peekTokenIs(SEMICOLON) && precedence < p.peekPrecedence() {
-		infix := infixParseFns[p.peekToken.Type]
+		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
 		}
@@ -215,9 +694,127 @@ func (p *Parser) parseExpression(precedence int) Expression {
 }
 
 func (p *Parser) parseIdentifier() Expression {
+	if p.peekTokenIs(ARROW) {
+		param := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return p.parseArrowFunction([]*Identifier{param}, false)
+	}
+	if p.curToken.Literal == "async" {
+		switch {
+		case p.peekTokenIs(FUNCTION):
+			start := p.curToken.start
+			p.nextToken()
+			lit := p.parseFunction(true)
+			if lit == nil || lit.Generator {
+				return nil
+			}
+			lit.text = p.sourceText(start)
+			return lit
+		case p.peekTokenIs(IDENT) && p.isArrowAfterPeek():
+			p.nextToken()
+			param := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			return p.parseArrowFunction([]*Identifier{param}, true)
+		case p.peekTokenIs("(") && p.isArrowAhead(0):
+			p.nextToken()
+			return p.parseArrowFunction(p.parseFunctionParameters(), true)
+		}
+	}
 	return &Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseGroupedExpression parses a parenthesized expression, or the arrow
+// function whose parameter list the parenthesis opens. Only optional
+// chains keep their parentheses, which end the chain.
+func (p *Parser) parseGroupedExpression() Expression {
+	if p.isArrowAhead(1) {
+		return p.parseArrowFunction(p.parseFunctionParameters(), false)
+	}
+
+	token := p.curToken
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(")") {
+		return nil
+	}
+	if isOptionalChain(exp) {
+		return &ParenthesizedExpression{Token: token, Expression: exp}
+	}
+	return exp
+}
+
+// isArrowAhead reports whether the parenthesis that is the current token,
+// when depth is 1, or the peek token, when depth is 0, is closed and then
+// followed by =>. It scans a copy of the lexer, so no tokens are consumed,
+// and records the answer for every parenthesis it passes the end of.
+func (p *Parser) isArrowAhead(depth int) bool {
+	open, tok := p.curToken, p.peekToken
+	if depth == 0 {
+		open = p.peekToken
+	}
+	if arrow, ok := p.arrowAhead[open.start]; ok {
+		return arrow
+	}
+
+	saved := *p.l
+	defer func() { *p.l = saved }()
+
+	if depth == 0 {
+		tok = p.l.NextToken()
+	}
+	opens := []int{open.start}
+	for tok.Type != EOF {
+		switch tok.Type {
+		case "(":
+			opens = append(opens, tok.start)
+		case ")":
+			next := p.l.NextToken()
+			p.arrowAhead[opens[len(opens)-1]] = next.Type == ARROW
+			if opens = opens[:len(opens)-1]; len(opens) == 0 {
+				return next.Type == ARROW
+			}
+			tok = next
+			continue
+		}
+		tok = p.l.NextToken()
+	}
+	return false
+}
+
+// isArrowAfterPeek reports whether the token after the peek token is =>.
+func (p *Parser) isArrowAfterPeek() bool {
+	saved := *p.l
+	defer func() { *p.l = saved }()
+
+	return p.l.NextToken().Type == ARROW
+}
+
+// parseArrowFunction parses the => and body of an arrow function whose
+// parameters have been parsed. A concise body becomes a block returning
+// its expression.
+func (p *Parser) parseArrowFunction(params []*Identifier, async bool) Expression {
+	lit := &FunctionLiteral{Token: p.curToken, Parameters: params, Async: async, Arrow: true}
+
+	if !p.expectPeek(ARROW) {
+		return nil
+	}
+	defer p.enterFunction(functionContext{
+		async:         async,
+		superProperty: p.function.superProperty,
+		superCall:     p.function.superCall,
+	})()
+
+	if p.peekTokenIs("{") {
+		p.nextToken()
+		lit.Body, lit.Strict = p.parseFunctionBody()
+		return lit
+	}
+
+	p.nextToken()
+	ret := &ReturnStatement{Token: p.curToken, ReturnValue: p.parseExpression(LOWEST)}
+	lit.Body = &BlockStatement{Token: ret.Token, Statements: []Statement{ret}}
+	lit.Strict = p.strict
+	return lit
+}
+
 func (p *Parser) parseNumberLiteral() Expression {
 	lit := &NumberLiteral{Token: p.curToken}
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
@@ -228,6 +825,30 @@ func (p *Parser) parseNumberLiteral() Expression {
 	return lit
 }
 
+func (p *Parser) parseBigIntLiteral() Expression {
+	value, ok := new(big.Int).SetString(p.curToken.Literal, 10)
+	if !ok {
+		p.errorAt(p.curToken, "Invalid or unexpected token")
+		return nil
+	}
+	return &BigIntLiteral{Token: p.curToken, Value: value}
+}
+
+// parseRegExpLiteral parses a regular expression literal. The lexer cannot
+// tell one from a division, so it produces a / token, which the parser
+// has it rescan when the / appears where an operand is expected.
+func (p *Parser) parseRegExpLiteral() Expression {
+	tok, ok := p.l.readRegExp(p.curToken.start)
+	if !ok {
+		return nil
+	}
+	p.curToken = tok
+	p.peekToken = p.l.NextToken()
+
+	end := strings.LastIndexByte(tok.Literal, '/')
+	return &RegExpLiteral{Token: tok, Pattern: tok.Literal[1:end], Flags: tok.Literal[end+1:]}
+}
+
 func (p *Parser) parseStringLiteral() Expression {
 	return &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -236,6 +857,185 @@ func (p *Parser) parseBooleanLiteral() Expression {
 	return &BooleanLiteral{Token: p.curToken, Value: p.curToken.Type == TRUE}
 }
 
+func (p *Parser) parseYieldExpression() Expression {
+	expression := &YieldExpression{Token: p.curToken}
+	if !p.function.generator {
+		p.errorAt(p.curToken, "yield is only valid in generator functions")
+	}
+
+	if p.peekTokenIs(ASTERISK) {
+		p.nextToken()
+		expression.Delegate = true
+	}
+
+	switch p.peekToken.Type {
+	case ")", "]", "}", COMMA, SEMICOLON, COLON, EOF:
+		if !expression.Delegate {
+			return expression
+		}
+	}
+
+	p.nextToken()
+	expression.Argument = p.parseExpression(LOWEST)
+	return expression
+}
+
+func (p *Parser) parseAwaitExpression() Expression {
+	expression := &AwaitExpression{Token: p.curToken}
+	if !p.function.async {
+		p.errorAt(p.curToken, "await is only valid in async functions and the top level bodies of modules")
+	}
+	p.nextToken()
+	expression.Argument = p.parseExpression(PREFIX)
+	return expression
+}
+
+// parseImportExpression parses import(source) and import.meta.
+func (p *Parser) parseImportExpression() Expression {
+	token := p.curToken
+
+	if p.peekTokenIs(DOT) {
+		p.nextToken()
+		if !p.expectPeek(IDENT) || p.curToken.Literal != "meta" {
+			return nil
+		}
+		return &ImportMeta{Token: token}
+	}
+
+	if !p.expectPeek("(") {
+		return nil
+	}
+	p.nextToken()
+	call := &ImportCall{Token: token, Source: p.parseExpression(LOWEST)}
+	if !p.expectPeek(")") {
+		return nil
+	}
+	return call
+}
+
+func (p *Parser) parseNullLiteral() Expression {
+	return &NullLiteral{Token: p.curToken}
+}
+
+func (p *Parser) parseThisExpression() Expression {
+	return &ThisExpression{Token: p.curToken}
+}
+
+func (p *Parser) parseArrayLiteral() Expression {
+	array := &ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList("]")
+	return array
+}
+
+func (p *Parser) parseObjectLiteral() Expression {
+	obj := &ObjectLiteral{Token: p.curToken}
+
+	for !p.peekTokenIs("}") {
+		p.nextToken()
+		prop := p.parseObjectProperty()
+		if prop == nil {
+			return nil
+		}
+		obj.Properties = append(obj.Properties, prop)
+
+		if !p.peekTokenIs("}") && !p.expectPeek(COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek("}") {
+		return nil
+	}
+
+	return obj
+}
+
+// parseObjectProperty parses a property of an object literal: key: value,
+// or a method or accessor written as in a class.
+func (p *Parser) parseObjectProperty() *ObjectProperty {
+	prop := &ObjectProperty{}
+	start := p.curToken.start
+
+	async := false
+	if p.isContextualKeyword("async") {
+		async = true
+		p.nextToken()
+	}
+	generator := false
+	if p.curTokenIs(ASTERISK) {
+		p.checkAsyncGenerator(async)
+		generator = true
+		p.nextToken()
+	} else if !async && p.isContextualKeyword("get") {
+		prop.Kind = PropertyGetter
+		p.nextToken()
+	} else if !async && p.isContextualKeyword("set") {
+		prop.Kind = PropertySetter
+		p.nextToken()
+	}
+
+	if p.curTokenIs("[") {
+		if prop.ComputedKey = p.parseComputedKey(); prop.ComputedKey == nil {
+			return nil
+		}
+	} else if p.isPropertyName() {
+		prop.Key = p.curToken.Literal
+	} else {
+		p.unexpected(p.curToken)
+		return nil
+	}
+
+	if prop.Kind == PropertyValue && !async && !generator && !p.peekTokenIs("(") {
+		if !p.expectPeek(COLON) {
+			return nil
+		}
+		p.nextToken()
+		prop.Value = p.parseExpression(LOWEST)
+		return prop
+	}
+
+	if async && generator {
+		return nil
+	}
+	if prop.Kind == PropertyValue {
+		prop.Kind = PropertyMethod
+	}
+	lit := &FunctionLiteral{Token: p.curToken, Name: prop.Key, Generator: generator, Async: async}
+	defer p.enterFunction(functionContext{generator: generator, async: async, superProperty: true})()
+	if !p.expectPeek("(") {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek("{") {
+		return nil
+	}
+	lit.Body, lit.Strict = p.parseFunctionBody()
+	lit.text = p.sourceText(start)
+	prop.Value = lit
+	return prop
+}
+
+// parseComputedKey parses the [key] of a computed property or class
+// member, leaving the closing bracket as the current token.
+func (p *Parser) parseComputedKey() Expression {
+	p.nextToken()
+	key := p.parseExpression(LOWEST)
+	if key == nil || !p.expectPeek("]") {
+		return nil
+	}
+	return key
+}
+
+// isPropertyName reports whether the current token can name a property in
+// an object literal. Keywords are allowed there just like identifiers.
+func (p *Parser) isPropertyName() bool {
+	switch p.curToken.Type {
+	case IDENT, STRING, NUMBER:
+		return true
+	}
+	return lookupIdent(p.curToken.Literal) != IDENT
+}
+
 func (p *Parser) parsePrefixExpression() Expression {
 	expression := &PrefixExpression{
 		Token:    p.curToken,
@@ -253,28 +1053,384 @@ func (p *Parser) parseInfixExpression(left Expression) Expression {
 		Left:     left,
 	}
 	precedence := p.curPrecedence()
+	// Exponentiation is right-associative: a ** b ** c is a ** (b ** c).
+	if p.curTokenIs(EXPONENT) {
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 	return expression
 }
 
+// parseAssignExpression parses an assignment to left, which must be a
+// variable or a property outside an optional chain.
+func (p *Parser) parseAssignExpression(left Expression) Expression {
+	valid := false
+	switch target := left.(type) {
+	case *Identifier:
+		valid = true
+	case *MemberExpression:
+		valid = !isOptionalChain(target)
+	}
+	if !valid {
+		p.errorAt(p.curToken, "Invalid left-hand side in assignment")
+		return nil
+	}
+
+	expression := &AssignExpression{Token: p.curToken, Target: left}
+	p.nextToken()
+	// Assignment is right-associative: a = b = c assigns c to b first.
+	expression.Value = p.parseExpression(ASSIGNMENT - 1)
+	return expression
+}
+
+// parseSuperExpression parses super, which may only be called in the
+// constructors of derived classes and have its properties read in
+// methods.
+func (p *Parser) parseSuperExpression() Expression {
+	allowed := p.function.superProperty && (p.peekTokenIs(DOT) || p.peekTokenIs("["))
+	if p.peekTokenIs("(") {
+		allowed = p.function.superCall
+	}
+	if !allowed {
+		p.errorAt(p.curToken, "'super' keyword unexpected here")
+	}
+	return &SuperExpression{Token: p.curToken}
+}
+
+func (p *Parser) parsePrivateInExpression() Expression {
+	expression := &PrivateInExpression{Token: p.curToken, Name: p.curToken.Literal}
+	p.referencePrivateName(p.curToken)
+	if !p.expectPeek(IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(LESSGREATER)
+	return expression
+}
+
+func (p *Parser) parseClassLiteral() Expression {
+	class := &ClassLiteral{Token: p.curToken}
+
+	if p.peekTokenIs(IDENT) {
+		p.nextToken()
+		class.Name = p.curToken.Literal
+	}
+
+	// All parts of a class, including its heritage, are strict mode code.
+	outerStrict := p.strict
+	p.strict = true
+	defer func() { p.strict = outerStrict }()
+
+	if p.peekTokenIs(EXTENDS) {
+		p.nextToken()
+		p.nextToken()
+		class.SuperClass = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek("{") {
+		return nil
+	}
+
+	// The heritage is outside the class body, whose private names it
+	// cannot use.
+	p.classes = append(p.classes, &classScope{declared: make(map[string]privateDeclaration)})
+	defer func() { p.classes = p.classes[:len(p.classes)-1] }()
+	for !p.peekTokenIs("}") {
+		p.nextToken()
+		if p.curTokenIs(SEMICOLON) {
+			continue
+		}
+		member := p.parseClassMember(class.SuperClass != nil)
+		if member == nil {
+			return nil
+		}
+		class.Members = append(class.Members, member)
+	}
+	p.nextToken()
+	p.resolvePrivateNames()
+	class.text = p.sourceText(class.Token.start)
+
+	return class
+}
+
+// parseClassMember parses a member of a class, which extends another when
+// derived.
+func (p *Parser) parseClassMember(derived bool) *ClassMember {
+	member := &ClassMember{Kind: ClassMethod}
+
+	if p.isContextualKeyword("static") {
+		member.Static = true
+		p.nextToken()
+		if p.curTokenIs("{") {
+			member.Kind = ClassStaticBlock
+			defer p.enterFunction(functionContext{superProperty: true})()
+			member.Body = p.parseBlockStatement()
+			return member
+		}
+	}
+
+	start := p.curToken.start
+	async := false
+	if p.isContextualKeyword("async") {
+		async = true
+		p.nextToken()
+	}
+
+	generator := false
+	if p.curTokenIs(ASTERISK) {
+		p.checkAsyncGenerator(async)
+		generator = true
+		p.nextToken()
+	} else if !async && p.isContextualKeyword("get") {
+		member.Kind = ClassGetter
+		p.nextToken()
+	} else if !async && p.isContextualKeyword("set") {
+		member.Kind = ClassSetter
+		p.nextToken()
+	}
+
+	key := p.curToken
+	switch {
+	case p.curTokenIs(PRIVATE):
+		member.Private = true
+		member.Key = p.curToken.Literal
+	case p.curTokenIs("["):
+		if member.ComputedKey = p.parseComputedKey(); member.ComputedKey == nil {
+			return nil
+		}
+	case p.isPropertyName():
+		member.Key = p.curToken.Literal
+	default:
+		return nil
+	}
+
+	if p.peekTokenIs("(") {
+		if async && generator {
+			return nil
+		}
+		lit := &FunctionLiteral{Token: p.curToken, Name: member.Key, Generator: generator, Async: async}
+		constructor := member.Kind == ClassMethod && !member.Static && member.Key == "constructor" && member.ComputedKey == nil
+		defer p.enterFunction(functionContext{
+			generator:     generator,
+			async:         async,
+			superProperty: true,
+			superCall:     derived && constructor,
+		})()
+		p.nextToken()
+		lit.Parameters = p.parseFunctionParameters()
+		if !p.expectPeek("{") {
+			return nil
+		}
+		lit.Body, lit.Strict = p.parseFunctionBody()
+		lit.text = p.sourceText(start)
+		member.Function = lit
+		if member.Private {
+			p.declarePrivateName(key, member.Kind, member.Static)
+		}
+		return member
+	}
+
+	if member.Kind != ClassMethod || generator || async {
+		return nil
+	}
+	member.Kind = ClassField
+	if member.Private {
+		p.declarePrivateName(key, member.Kind, member.Static)
+	}
+	if p.peekTokenIs(ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		defer p.enterFunction(functionContext{superProperty: true})()
+		member.Value = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+
+	return member
+}
+
+// declarePrivateName declares the private name tok in the class body
+// being parsed.
+func (p *Parser) declarePrivateName(tok Token, kind ClassMemberKind, static bool) {
+	if tok.Literal == "#constructor" {
+		p.errorAt(tok, "Classes may not have a private field named '#constructor'")
+		return
+	}
+	scope := p.classes[len(p.classes)-1]
+	prev, exists := scope.declared[tok.Literal]
+	if exists {
+		accessors := (kind == ClassGetter || kind == ClassSetter) && (prev.kind == ClassGetter || prev.kind == ClassSetter)
+		if !accessors || kind == prev.kind || static != prev.static || prev.paired {
+			p.errorAt(tok, "Identifier '%s' has already been declared", tok.Literal)
+			return
+		}
+	}
+	scope.declared[tok.Literal] = privateDeclaration{kind: kind, static: static, paired: exists}
+}
+
+// referencePrivateName records a use of the private name tok, which an
+// enclosing class body must declare.
+func (p *Parser) referencePrivateName(tok Token) {
+	if len(p.classes) == 0 {
+		p.errorAt(tok, "Private field '%s' must be declared in an enclosing class", tok.Literal)
+		return
+	}
+	scope := p.classes[len(p.classes)-1]
+	scope.references = append(scope.references, tok)
+}
+
+// resolvePrivateNames resolves the private names used in the class body
+// that has just ended, leaving those it does not declare to the class
+// around it.
+func (p *Parser) resolvePrivateNames() {
+	scope := p.classes[len(p.classes)-1]
+	for _, tok := range scope.references {
+		if _, ok := scope.declared[tok.Literal]; ok {
+			continue
+		}
+		if n := len(p.classes); n > 1 {
+			outer := p.classes[n-2]
+			outer.references = append(outer.references, tok)
+		} else {
+			p.errorAt(tok, "Private field '%s' must be declared in an enclosing class", tok.Literal)
+		}
+	}
+}
+
+// isContextualKeyword reports whether the current token is the given
+// contextual keyword, such as static or get, rather than a member that
+// happens to have that name.
+func (p *Parser) isContextualKeyword(keyword string) bool {
+	if !p.curTokenIs(IDENT) || p.curToken.Literal != keyword {
+		return false
+	}
+	switch p.peekToken.Type {
+	case "(", ASSIGN, SEMICOLON, "}", COLON, COMMA:
+		return false
+	}
+	return true
+}
+
+func (p *Parser) parseNewExpression() Expression {
+	expression := &NewExpression{Token: p.curToken}
+	p.nextToken()
+	// Stop before the argument list so it binds to new rather than
+	// becoming a call of the constructor.
+	expression.Callee = p.parseExpression(CALL)
+	if p.peekTokenIs("(") {
+		p.nextToken()
+		expression.Arguments = p.parseExpressionList(")")
+	}
+	return expression
+}
+
 func (p *Parser) parseDotExpression(left Expression) Expression {
-	if !p.expectPeek(IDENT) {
+	expression := &MemberExpression{Token: p.curToken, Object: left}
+	p.nextToken()
+	if !p.parseMemberName(expression) {
 		return nil
 	}
-	right := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return expression
+}
 
-	expression := &InfixExpression{
-		Token:    Token{Type: DOT, Literal: "."},
-		Operator: ".",
-		Left:     left,
-		Right:    right,
+// parseMemberName parses the property name after a dot, which may be any
+// identifier name, keywords included, or a private name.
+func (p *Parser) parseMemberName(expression *MemberExpression) bool {
+	switch {
+	case p.curTokenIs(PRIVATE):
+		expression.Property = &PrivateIdentifier{Token: p.curToken, Name: p.curToken.Literal}
+		p.referencePrivateName(p.curToken)
+	case p.curTokenIs(IDENT) || lookupIdent(p.curToken.Literal) != IDENT:
+		expression.Property = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	default:
+		p.unexpected(p.curToken)
+		return false
+	}
+	return true
+}
+
+func (p *Parser) parseIndexExpression(left Expression) Expression {
+	expression := &MemberExpression{Token: p.curToken, Object: left, Computed: true}
+	p.nextToken()
+	expression.Property = p.parseExpression(LOWEST)
+	if !p.expectPeek("]") {
+		return nil
 	}
 	return expression
 }
 
+// parseOptionalChain parses the access following ?., which is a property
+// name, a computed member or an argument list.
+func (p *Parser) parseOptionalChain(left Expression) Expression {
+	token := p.curToken
+	p.nextToken()
+
+	switch {
+	case p.curTokenIs("("):
+		call := &CallExpression{Token: token, Function: left, Optional: true}
+		call.Arguments = p.parseExpressionList(")")
+		return call
+	case p.curTokenIs("["):
+		expression := p.parseIndexExpression(left)
+		if member, ok := expression.(*MemberExpression); ok {
+			member.Token = token
+			member.Optional = true
+		}
+		return expression
+	}
+
+	expression := &MemberExpression{Token: token, Object: left, Optional: true}
+	if !p.parseMemberName(expression) {
+		return nil
+	}
+	return expression
+}
+
+// isOptionalChain reports whether a member or call expression contains a
+// ?. anywhere in its chain.
+func isOptionalChain(exp Expression) bool {
+	switch e := exp.(type) {
+	case *MemberExpression:
+		return e.Optional || isOptionalChain(e.Object)
+	case *CallExpression:
+		return e.Optional || isOptionalChain(e.Function)
+	}
+	return false
+}
+
 func (p *Parser) parseFunctionLiteral() Expression {
-	lit := &FunctionLiteral{Token: p.curToken}
+	if lit := p.parseFunction(false); lit != nil {
+		return lit
+	}
+	return nil
+}
+
+// checkAsyncGenerator reports the * of a generator that is async, which
+// the engine does not support.
+func (p *Parser) checkAsyncGenerator(async bool) {
+	if async {
+		p.errorAt(p.curToken, "Async generators are not supported")
+	}
+}
+
+// parseFunction parses a function expression or declaration from the
+// function keyword, after async for an async function.
+func (p *Parser) parseFunction(async bool) *FunctionLiteral {
+	lit := &FunctionLiteral{Token: p.curToken, Async: async}
+
+	if p.peekTokenIs(ASTERISK) {
+		p.nextToken()
+		p.checkAsyncGenerator(async)
+		lit.Generator = true
+	}
+	defer p.enterFunction(functionContext{generator: lit.Generator, async: async})()
+
+	if p.peekTokenIs(IDENT) {
+		p.nextToken()
+		lit.Name = p.curToken.Literal
+	}
 
 	if !p.expectPeek("(") {
 		return nil
@@ -286,11 +1442,46 @@ func (p *Parser) parseFunctionLiteral() Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body, lit.Strict = p.parseFunctionBody()
+	lit.text = p.sourceText(lit.Token.start)
 
 	return lit
 }
 
+// sourceText returns the code from offset start to the end of the current
+// token, the last of a function or class, for Function.prototype.toString.
+func (p *Parser) sourceText(start int) string {
+	if p.curTokenIs("}") {
+		return p.l.input[start : p.curToken.start+1]
+	}
+	return strings.TrimRight(p.l.input[start:p.peekToken.start], " \t\r\n")
+}
+
+// parseFunctionBody parses a function body, honouring a "use strict"
+// directive at its start. Strictness is inherited from the enclosing code
+// and restored once the body has been parsed.
+func (p *Parser) parseFunctionBody() (*BlockStatement, bool) {
+	outerStrict := p.strict
+	defer func() { p.strict = outerStrict }()
+
+	block := &BlockStatement{Token: p.curToken}
+	block.Statements = []Statement{}
+
+	p.nextToken()
+
+	directives := true
+	for !p.curTokenIs("}") && !p.curTokenIs(EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+			directives = p.checkDirective(stmt, directives)
+		}
+		p.nextToken()
+	}
+
+	return block, p.strict
+}
+
 func (p *Parser) parseFunctionParameters() []*Identifier {
 	var identifiers []*Identifier
 
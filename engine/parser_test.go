@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		message string
+	}{
+		{`o.`, "Unexpected end of input"},
+		{`o?.`, "Unexpected end of input"},
+		{`o.5`, "Unexpected number"},
+		{`o.+1`, "Unexpected token '+'"},
+		{`1.5n`, "Invalid or unexpected token"},
+		{`function f() { yield 1; } 2`, "yield is only valid in generator functions"},
+		{`function* g() { let a = () => yield 1; }`, "yield is only valid in generator functions"},
+		{`if (false) { await 3; }`, "await is only valid in async functions and the top level bodies of modules"},
+		{`async function f() { return () => await 1; }`, "await is only valid in async functions and the top level bodies of modules"},
+		{`function f() { return super.x; }`, "'super' keyword unexpected here"},
+		{`class A { constructor() { super(); } }`, "'super' keyword unexpected here"},
+		{`class A extends Object { m() { super(); } }`, "'super' keyword unexpected here"},
+		{`({ m() { return super; } })`, "'super' keyword unexpected here"},
+		{`1 = 2; 3`, "Invalid left-hand side in assignment"},
+		{`function f() {} f() = 2`, "Invalid left-hand side in assignment"},
+		{`let a = 1; a + 1 = 2`, "Invalid left-hand side in assignment"},
+		{`let o = {}; o?.a = 1`, "Invalid left-hand side in assignment"},
+		{`let o = {}; o?.a.b = 1`, "Invalid left-hand side in assignment"},
+		{`let o = {}; (o?.a) = 1`, "Invalid left-hand side in assignment"},
+		{`class A { m() { return this.#nope; } }`, "Private field '#nope' must be declared in an enclosing class"},
+		{`function f(o) { return o.#x; }`, "Private field '#x' must be declared in an enclosing class"},
+		{`class A { m(o) { return #x in o; } }`, "Private field '#x' must be declared in an enclosing class"},
+		{`class A { m(o) { return o?.#x; } }`, "Private field '#x' must be declared in an enclosing class"},
+		{`class A { #x; m() { class B { n() { return this.#y; } } } }`, "Private field '#y' must be declared in an enclosing class"},
+		{`class A { #x; static m(o) { return class extends o.#x {}; } } class B extends A.#x {}`, "Private field '#x' must be declared in an enclosing class"},
+		{`class A { m() { return this.#a + this.#b; } #a; }`, "Private field '#b' must be declared in an enclosing class"},
+		{`class A { #a; #a; }`, "Identifier '#a' has already been declared"},
+		{`class A { #a; #a() {} }`, "Identifier '#a' has already been declared"},
+		{`class A { get #a() {} get #a() {} }`, "Identifier '#a' has already been declared"},
+		{`class A { get #a() {} static set #a(v) {} }`, "Identifier '#a' has already been declared"},
+		{`class A { get #a() {} set #a(v) {} #a; }`, "Identifier '#a' has already been declared"},
+		{`async function* g() {}`, "Async generators are not supported"},
+		{`let f = async function* () {};`, "Async generators are not supported"},
+		{`export async function* g() {}`, "Async generators are not supported"},
+		{`class A { async *m() {} }`, "Async generators are not supported"},
+		{`({ async *m() {} })`, "Async generators are not supported"},
+		{`class A { #constructor; }`, "Classes may not have a private field named '#constructor'"},
+		{`class A { m() { return this.#x; } x = ; }`, "Private field '#x' must be declared in an enclosing class"},
+	}
+	for _, tt := range tests {
+		_, err := Parse("", tt.src)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Message != tt.message {
+			t.Errorf("Parse(%q) = %v, want SyntaxError %q", tt.src, err, tt.message)
+		}
+	}
+}
+
+func TestYieldAwaitAndSuperInTheirFunctions(t *testing.T) {
+	sources := []string{
+		`function* g() { yield 1; }`,
+		`let o = { *g() { yield 1; }, async m() { await 1; } }`,
+		`async function f() { await 1; let g = async () => await 2; }`,
+		`({ m() { return () => super.x; } })`,
+		`class A extends Object { constructor() { let f = () => super(); f(); } static { super.x; } y = super.y; }`,
+		`class A { m() { return this.#a; } #a = 1; }`,
+		`class A { #x; m() { return class B { n(o) { return o.#x + this.#y; } #y; }; } static has(o) { return #x in o; } }`,
+		`class A { get #a() { return 1; } set #a(v) {} static get #b() { return 2; } static set #b(v) {} }`,
+		`class A { #a; } class B { #a; }`,
+	}
+	for _, src := range sources {
+		if _, err := Parse("", src); err != nil {
+			t.Errorf("Parse(%q) = %v, want no error", src, err)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{`0.5`, 0.5},
+		{`.25 + 1.5`, 1.75},
+		{`let x = 0.5; x`, 0.5},
+		{`[1, 2.5][1]`, 2.5},
+	}
+	for _, tt := range tests {
+		v, err := NewInterpreter().Eval(tt.src)
+		if err != nil || v.Type != TypeNumber || v.Data.(float64) != tt.want {
+			t.Errorf("%s = %v, %v, want %v", tt.src, v.ToString(), err, tt.want)
+		}
+	}
+}
+
+func TestParenthesesEndOptionalChains(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let n = null; (n?.b).c`, "Uncaught TypeError: Cannot read properties of undefined (reading 'c')"},
+		{`let n = null; (n?.b)()`, "Uncaught TypeError: (n.b) is not a function"},
+		{`let n = null; n?.b.c`, "undefined"},
+		{`let o = {b: {c: 3}}; (o?.b).c`, "3"},
+		{`let o = {v: 7, f: function () { return this.v; }}; (o?.f)()`, "7"},
+		{`let o = {a: {}}; (o?.a).b = 1; o.a.b`, "1"},
+		{`let o = {}; (o?.a).b = 1`, "Uncaught TypeError: Cannot set properties of undefined (setting 'b')"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestNestedParenthesesParseInLinearTime(t *testing.T) {
+	// Scanning ahead for => from every parenthesis took seconds at this
+	// depth when each scan covered the parentheses nested inside it.
+	src := strings.Repeat("(", 20000) + "1" + strings.Repeat(")", 20000)
+	start := time.Now()
+	if _, err := Parse("", src); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("parsing took %v", elapsed)
+	}
+
+	for src, want := range map[string]string{
+		`((a, b) => a + b)(1, 2)`:         "3",
+		`(((a) => ((b) => a + b))(1))(5)`: "6",
+		`((a) => a)((2))`:                 "2",
+	} {
+		v, err := NewInterpreter().Eval(src)
+		if err != nil || v.ToString() != want {
+			t.Errorf("%s = %s, %v, want %s", src, v.ToString(), err, want)
+		}
+	}
+}
+
+func TestObjectLiteralMethods(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let o = { m(a) { return a + 1; } }; o.m(1)`, "2"},
+		{`let o = { *g() { yield 1; yield 2; } }; let it = o.g(); it.next(); it.next().value`, "2"},
+		{`let o = { v: 2, get x() { return this.v * 10; }, set x(n) { this.v = n; } }; o.x = 7; o.x`, "70"},
+		{`let o = { get: 1, set: 2, async: 3 }; o.get + o.set + o.async`, "6"},
+		{`let o = { ["a" + "b"]() { return 3; } }; o.ab()`, "3"},
+		{`let p = { hi() { return "p"; } }; let o = { hi() { return super.hi() + "o"; } }; Object.setPrototypeOf(o, p); o.hi()`, "po"},
+		{`let o = { m() {} }; new o.m()`, "Uncaught TypeError: m is not a constructor"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+
+	promise, err := NewInterpreter().Eval(`let o = { async m() { return 5; } }; o.m()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, result, _ := PromiseResult(promise); state != PromiseFulfilled || result.ToString() != "5" {
+		t.Errorf("async method = %v %s, want a promise fulfilled with 5", state, result.ToString())
+	}
+}
+
+// TestConcurrentParseAndRun parses scripts on many goroutines at once and
+// runs one shared program from each, as hosts may. Run it with -race.
+func TestConcurrentParseAndRun(t *testing.T) {
+	shared, err := Parse("shared.js", `function fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); }
+		class Point { #x; constructor(x) { this.#x = x; } get x() { return this.#x; } }
+		let f = (a) => a * 2;
+		fib(12) + new Point(f(3)).x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const goroutines = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for n := 0; n < goroutines; n++ {
+		wg.Add(1)
+		go func(treeWalking bool) {
+			defer wg.Done()
+			program, err := Parse("own.js", `let o = {a: [1, 2], m() { return this.a.length; }}; o.m() + (1 + 2) * 3`)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := Parse("bad.js", `let = ;`); err == nil {
+				errs <- errors.New("Parse(let = ;) succeeded")
+				return
+			}
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			for _, run := range []struct {
+				program *Program
+				want    string
+			}{{program, "11"}, {shared, "150"}, {shared, "150"}} {
+				v, err := i.RunProgram(run.program)
+				if err != nil || v.ToString() != run.want {
+					errs <- fmt.Errorf("RunProgram = %s, %v, want %s", v.ToString(), err, run.want)
+					return
+				}
+			}
+		}(n%2 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
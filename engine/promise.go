@@ -0,0 +1,555 @@
+package engine
+
+type PromiseState int
+
+const (
+	PromisePending PromiseState = iota
+	PromiseFulfilled
+	PromiseRejected
+)
+
+// Promise is the internal state of a promise object.
+type Promise struct {
+	state PromiseState
+	// result is the value the promise was fulfilled with or the reason it
+	// was rejected with.
+	result           Value
+	fulfillReactions []*promiseReaction
+	rejectReactions  []*promiseReaction
+}
+
+// promiseReaction is a handler registered on a promise by then. When the
+// promise settles, the handler runs as a job and its outcome settles the
+// promise of capability, which is nil for reactions registered internally,
+// such as by await.
+type promiseReaction struct {
+	capability *promiseCapability
+	// handler is undefined when then was not passed a function, in which
+	// case the outcome is passed on unchanged.
+	handler Value
+	rejects bool
+}
+
+// promiseCapability is a promise together with the functions that resolve
+// and reject it.
+type promiseCapability struct {
+	promise Value
+	resolve Value
+	reject  Value
+}
+
+// newPromise creates a pending promise.
+func (i *Interpreter) newPromise() Value {
+	promise := i.newObject()
+	promise.Data = &Promise{}
+	promise.Object.Prototype = i.promisePrototype
+	return promise
+}
+
+// newPromiseCapability creates a pending promise and the functions that
+// settle it.
+func (i *Interpreter) newPromiseCapability() *promiseCapability {
+	promise := i.newPromise()
+	resolve, reject := i.createResolvingFunctions(promise)
+	return &promiseCapability{promise: promise, resolve: resolve, reject: reject}
+}
+
+// newPromiseCapabilityFrom creates a promise by calling new on c, which
+// may be a subclass of Promise or any constructor that calls its argument
+// with resolve and reject functions the way Promise calls its executor.
+func (i *Interpreter) newPromiseCapabilityFrom(c Value) *promiseCapability {
+	if sameObject(c, i.promiseConstructor) {
+		return i.newPromiseCapability()
+	}
+	if !isConstructor(c) {
+		i.throwError("TypeError", "%s is not a constructor", describeCallee(c))
+	}
+
+	capability := &promiseCapability{}
+	executor := i.newNativeFunction("", 2, func(this Value, args []Value) Value {
+		if capability.resolve.Type != TypeUndefined || capability.reject.Type != TypeUndefined {
+			i.throwError("TypeError", "Promise executor has already been invoked with non-undefined arguments")
+		}
+		capability.resolve, capability.reject = argument(args, 0), argument(args, 1)
+		return Undefined
+	})
+	capability.promise = i.construct(c, []Value{executor}, c)
+	if capability.resolve.Type != TypeFunction || capability.reject.Type != TypeFunction {
+		i.throwError("TypeError", "Promise resolve or reject function is not callable")
+	}
+	return capability
+}
+
+// NewPromise creates a pending promise for host code to settle by calling
+// resolve or reject. Both must be called on the goroutine running the
+// interpreter, and only the first call has an effect.
+func (i *Interpreter) NewPromise() (promise Value, resolve func(Value), reject func(Value)) {
+	capability := i.newPromiseCapability()
+	resolve = func(val Value) {
+		i.applyFunction(capability.resolve, Undefined, []Value{val})
+	}
+	reject = func(reason Value) {
+		i.applyFunction(capability.reject, Undefined, []Value{reason})
+	}
+	return capability.promise, resolve, reject
+}
+
+// createResolvingFunctions returns the resolve and reject functions of a
+// promise. Only the first call of either has an effect.
+func (i *Interpreter) createResolvingFunctions(promise Value) (Value, Value) {
+	alreadyResolved := false
+	resolve := i.newNativeFunction("", 1, func(this Value, args []Value) Value {
+		if !alreadyResolved {
+			alreadyResolved = true
+			i.resolvePromise(promise, argument(args, 0))
+		}
+		return Undefined
+	})
+	reject := i.newNativeFunction("", 1, func(this Value, args []Value) Value {
+		if !alreadyResolved {
+			alreadyResolved = true
+			i.rejectPromise(promise, argument(args, 0))
+		}
+		return Undefined
+	})
+	return resolve, reject
+}
+
+// resolvePromise resolves promise with resolution: thenables are followed
+// by calling their then method in a job, anything else fulfills the
+// promise.
+func (i *Interpreter) resolvePromise(promise Value, resolution Value) {
+	if sameObject(promise, resolution) {
+		i.rejectPromise(promise, i.NewError("TypeError", "Chaining cycle detected for promise"))
+		return
+	}
+	if resolution.Type != TypeObject && resolution.Type != TypeFunction {
+		i.fulfillPromise(promise, resolution)
+		return
+	}
+
+	then, exception := i.tryCatch(func() Value {
+		return i.getProperty(resolution, "then")
+	})
+	if exception != nil {
+		i.rejectPromise(promise, exception.Value)
+		return
+	}
+	if then.Type != TypeFunction {
+		i.fulfillPromise(promise, resolution)
+		return
+	}
+
+	i.enqueueJob(func() {
+		resolve, reject := i.createResolvingFunctions(promise)
+		_, exception := i.tryCatch(func() Value {
+			return i.applyFunction(then, resolution, []Value{resolve, reject})
+		})
+		if exception != nil {
+			i.applyFunction(reject, Undefined, []Value{exception.Value})
+		}
+	})
+}
+
+func (i *Interpreter) fulfillPromise(promise Value, value Value) {
+	p := promise.Data.(*Promise)
+	reactions := p.fulfillReactions
+	p.state, p.result = PromiseFulfilled, value
+	p.fulfillReactions, p.rejectReactions = nil, nil
+	i.triggerPromiseReactions(reactions, value)
+}
+
+func (i *Interpreter) rejectPromise(promise Value, reason Value) {
+	p := promise.Data.(*Promise)
+	reactions := p.rejectReactions
+	p.state, p.result = PromiseRejected, reason
+	p.fulfillReactions, p.rejectReactions = nil, nil
+	i.triggerPromiseReactions(reactions, reason)
+}
+
+func (i *Interpreter) triggerPromiseReactions(reactions []*promiseReaction, argument Value) {
+	for _, reaction := range reactions {
+		i.enqueuePromiseReactionJob(reaction, argument)
+	}
+}
+
+// enqueuePromiseReactionJob schedules the handler of reaction to run with
+// the value or reason of the promise it was registered on.
+func (i *Interpreter) enqueuePromiseReactionJob(reaction *promiseReaction, argument Value) {
+	i.enqueueJob(func() {
+		var result Value
+		var exception *JSException
+		switch {
+		case reaction.handler.Type == TypeFunction:
+			result, exception = i.tryCatch(func() Value {
+				return i.applyFunction(reaction.handler, Undefined, []Value{argument})
+			})
+		case reaction.rejects:
+			exception = &JSException{Value: argument, Stack: ErrorStack(argument)}
+		default:
+			result = argument
+		}
+
+		if reaction.capability == nil {
+			return
+		}
+		if exception != nil {
+			i.applyFunction(reaction.capability.reject, Undefined, []Value{exception.Value})
+			return
+		}
+		i.applyFunction(reaction.capability.resolve, Undefined, []Value{result})
+	})
+}
+
+// performPromiseThen registers onFulfilled and onRejected on promise,
+// settling the promise of capability with their outcome.
+func (i *Interpreter) performPromiseThen(promise Value, onFulfilled Value, onRejected Value, capability *promiseCapability) {
+	if onFulfilled.Type != TypeFunction {
+		onFulfilled = Undefined
+	}
+	if onRejected.Type != TypeFunction {
+		onRejected = Undefined
+	}
+	fulfillReaction := &promiseReaction{capability: capability, handler: onFulfilled}
+	rejectReaction := &promiseReaction{capability: capability, handler: onRejected, rejects: true}
+
+	p := promise.Data.(*Promise)
+	switch p.state {
+	case PromisePending:
+		p.fulfillReactions = append(p.fulfillReactions, fulfillReaction)
+		p.rejectReactions = append(p.rejectReactions, rejectReaction)
+	case PromiseFulfilled:
+		i.enqueuePromiseReactionJob(fulfillReaction, p.result)
+	case PromiseRejected:
+		i.enqueuePromiseReactionJob(rejectReaction, p.result)
+	}
+}
+
+// PromiseResult returns the state of a promise and, once it has settled,
+// the value it was fulfilled with or the reason it was rejected with. ok is
+// false when v is not a promise.
+func PromiseResult(v Value) (state PromiseState, result Value, ok bool) {
+	if !isPromise(v) {
+		return PromisePending, Undefined, false
+	}
+	p := v.Data.(*Promise)
+	if p.state == PromisePending {
+		return PromisePending, Undefined, true
+	}
+	return p.state, p.result, true
+}
+
+// isPromise reports whether v is a promise object.
+func isPromise(v Value) bool {
+	_, ok := v.Data.(*Promise)
+	return ok && v.Type == TypeObject
+}
+
+// promiseResolve implements Promise.resolve for the constructor c: it
+// returns val if it is a promise created by c, or else a new promise
+// resolved with val.
+func (i *Interpreter) promiseResolve(c Value, val Value) Value {
+	if isPromise(val) && sameObject(i.getProperty(val, "constructor"), c) {
+		return val
+	}
+	capability := i.newPromiseCapabilityFrom(c)
+	i.applyFunction(capability.resolve, Undefined, []Value{val})
+	return capability.promise
+}
+
+// speciesConstructor returns the constructor that derived promises of
+// promise are created with, which is its constructor property, or
+// defaultConstructor when it has none.
+func (i *Interpreter) speciesConstructor(promise Value, defaultConstructor Value) Value {
+	c := i.getProperty(promise, "constructor")
+	if c.Type == TypeUndefined {
+		return defaultConstructor
+	}
+	if c.Type != TypeObject && c.Type != TypeFunction {
+		i.throwError("TypeError", "The .constructor property is not an object")
+	}
+	return c
+}
+
+// invoke calls the named method of obj.
+func (i *Interpreter) invoke(obj Value, name string, args ...Value) Value {
+	method := i.getProperty(obj, name)
+	if method.Type != TypeFunction {
+		i.throwError("TypeError", "%s is not a function", name)
+	}
+	return i.applyFunction(method, obj, args)
+}
+
+// JobQueue schedules the promise jobs of an interpreter. Hosts that run an
+// event loop supply one with SetJobQueue and run the queued jobs after
+// each script and each task; otherwise Eval runs them after the script.
+type JobQueue interface {
+	EnqueueJob(job func())
+}
+
+func (i *Interpreter) SetJobQueue(queue JobQueue) {
+	i.jobQueue = queue
+}
+
+// enqueueJob schedules a promise job to run once the running script or
+// task has finished.
+func (i *Interpreter) enqueueJob(job func()) {
+	if i.jobQueue != nil {
+		i.jobQueue.EnqueueJob(job)
+		return
+	}
+	i.jobs = append(i.jobs, job)
+}
+
+// runJobs runs the jobs queued when there is no host job queue, including
+// the ones they schedule in turn, until none remain.
+func (i *Interpreter) runJobs() {
+	for len(i.jobs) > 0 {
+		i.checkInterrupt()
+		job := i.jobs[0]
+		i.jobs[0] = nil
+		i.jobs = i.jobs[1:]
+		job()
+	}
+}
+
+func (i *Interpreter) setupPromise() {
+	i.promisePrototype = i.newObject()
+	i.defineMethod(i.promisePrototype, "then", 2, i.promiseThen)
+	i.defineMethod(i.promisePrototype, "catch", 1, func(this Value, args []Value) Value {
+		return i.invoke(this, "then", Undefined, argument(args, 0))
+	})
+	i.defineMethod(i.promisePrototype, "finally", 1, i.promiseFinally)
+	setSymbolSlot(i.promisePrototype, symbolToStringTag, Value{Type: TypeString, Data: "Promise"})
+
+	promise := i.newNativeFunction("Promise", 1, func(this Value, args []Value) Value {
+		i.throwError("TypeError", "Promise constructor cannot be invoked without 'new'")
+		return Undefined
+	})
+	promise.Data.(*NativeFunction).Construct = i.promiseConstructorNew
+	promise.Object.Properties["prototype"] = i.promisePrototype
+	i.promisePrototype.Object.Properties["constructor"] = promise
+	i.promiseConstructor = promise
+
+	i.defineMethod(promise, "resolve", 1, func(this Value, args []Value) Value {
+		if this.Type != TypeObject && this.Type != TypeFunction {
+			i.throwError("TypeError", "PromiseResolve called on non-object")
+		}
+		return i.promiseResolve(this, argument(args, 0))
+	})
+	i.defineMethod(promise, "reject", 1, func(this Value, args []Value) Value {
+		capability := i.newPromiseCapabilityFrom(this)
+		i.applyFunction(capability.reject, Undefined, []Value{argument(args, 0)})
+		return capability.promise
+	})
+	i.defineMethod(promise, "withResolvers", 0, func(this Value, args []Value) Value {
+		capability := i.newPromiseCapabilityFrom(this)
+		result := i.newObject()
+		result.Object.Properties["promise"] = capability.promise
+		result.Object.Properties["resolve"] = capability.resolve
+		result.Object.Properties["reject"] = capability.reject
+		return result
+	})
+	i.defineMethod(promise, "all", 1, i.promiseAll)
+	i.defineMethod(promise, "allSettled", 1, i.promiseAllSettled)
+	i.defineMethod(promise, "any", 1, i.promiseAny)
+	i.defineMethod(promise, "race", 1, i.promiseRace)
+	i.env.Set("Promise", promise)
+}
+
+// promiseConstructorNew implements new Promise(executor).
+func (i *Interpreter) promiseConstructorNew(args []Value, newTarget Value) Value {
+	executor := argument(args, 0)
+	if executor.Type != TypeFunction {
+		i.throwError("TypeError", "Promise resolver %s is not a function", executor.ToString())
+	}
+
+	promise := i.objectFromConstructor(newTarget)
+	if promise.Object.Prototype.Type == TypeUndefined {
+		promise.Object.Prototype = i.promisePrototype
+	}
+	promise.Data = &Promise{}
+
+	resolve, reject := i.createResolvingFunctions(promise)
+	_, exception := i.tryCatch(func() Value {
+		return i.applyFunction(executor, Undefined, []Value{resolve, reject})
+	})
+	if exception != nil {
+		i.applyFunction(reject, Undefined, []Value{exception.Value})
+	}
+	return promise
+}
+
+func (i *Interpreter) promiseThen(this Value, args []Value) Value {
+	if !isPromise(this) {
+		i.throwError("TypeError", "Method Promise.prototype.then called on incompatible receiver %s", this.ToString())
+	}
+	capability := i.newPromiseCapabilityFrom(i.speciesConstructor(this, i.promiseConstructor))
+	i.performPromiseThen(this, argument(args, 0), argument(args, 1), capability)
+	return capability.promise
+}
+
+// promiseFinally implements Promise.prototype.finally: onFinally runs
+// when the promise settles, and the outcome passes through unchanged once
+// the promise onFinally returns has settled, unless that is rejected.
+func (i *Interpreter) promiseFinally(this Value, args []Value) Value {
+	if this.Type != TypeObject && this.Type != TypeFunction {
+		i.throwError("TypeError", "Method Promise.prototype.finally called on incompatible receiver %s", this.ToString())
+	}
+	c := i.speciesConstructor(this, i.promiseConstructor)
+	onFinally := argument(args, 0)
+	if onFinally.Type != TypeFunction {
+		return i.invoke(this, "then", onFinally, onFinally)
+	}
+
+	thenFinally := i.newNativeFunction("", 1, func(_ Value, args []Value) Value {
+		value := argument(args, 0)
+		result := i.applyFunction(onFinally, Undefined, nil)
+		valueThunk := i.newNativeFunction("", 0, func(Value, []Value) Value {
+			return value
+		})
+		return i.invoke(i.promiseResolve(c, result), "then", valueThunk)
+	})
+	catchFinally := i.newNativeFunction("", 1, func(_ Value, args []Value) Value {
+		reason := argument(args, 0)
+		result := i.applyFunction(onFinally, Undefined, nil)
+		thrower := i.newNativeFunction("", 0, func(Value, []Value) Value {
+			panic(i.exception(reason))
+		})
+		return i.invoke(i.promiseResolve(c, result), "then", thrower)
+	})
+	return i.invoke(this, "then", thenFinally, catchFinally)
+}
+
+// promiseCombinator implements what Promise.all, allSettled, any and race
+// share: it passes each value of iterable through this.resolve and calls
+// each with the resulting promise and its index, then calls finish with
+// the number of values. Anything thrown along the way rejects the returned
+// promise.
+func (i *Interpreter) promiseCombinator(this Value, iterable Value, each func(capability *promiseCapability, next Value, index int), finish func(capability *promiseCapability, count int)) Value {
+	capability := i.newPromiseCapabilityFrom(this)
+
+	_, exception := i.tryCatch(func() Value {
+		resolve := i.getProperty(this, "resolve")
+		if resolve.Type != TypeFunction {
+			i.throwError("TypeError", "Promise resolve or reject function is not callable")
+		}
+		iterator := i.getIterator(iterable)
+		for index := 0; ; index++ {
+			value, done := i.iteratorStep(iterator)
+			if done {
+				finish(capability, index)
+				return Undefined
+			}
+			_, exception := i.tryCatch(func() Value {
+				each(capability, i.applyFunction(resolve, this, []Value{value}), index)
+				return Undefined
+			})
+			if exception != nil {
+				i.tryCatch(func() Value {
+					i.closeIterator(iterator)
+					return Undefined
+				})
+				panic(exception)
+			}
+		}
+	})
+	if exception != nil {
+		i.applyFunction(capability.reject, Undefined, []Value{exception.Value})
+	}
+	return capability.promise
+}
+
+// promiseElementFunction returns a function that records its argument at
+// index of values, once only, and calls done when it was the last one
+// outstanding.
+func (i *Interpreter) promiseElementFunction(values *[]Value, index int, remaining *int, wrap func(Value) Value, done func()) Value {
+	alreadyCalled := false
+	return i.newNativeFunction("", 1, func(this Value, args []Value) Value {
+		if alreadyCalled {
+			return Undefined
+		}
+		alreadyCalled = true
+		(*values)[index] = wrap(argument(args, 0))
+		*remaining--
+		if *remaining == 0 {
+			done()
+		}
+		return Undefined
+	})
+}
+
+// settlePromiseElements implements Promise.all and allSettled, which
+// differ only in how they record each outcome.
+func (i *Interpreter) settlePromiseElements(this Value, iterable Value, onFulfilled func(Value) Value, onRejected func(Value) Value) Value {
+	var values []Value
+	remaining := 1
+	return i.promiseCombinator(this, iterable, func(capability *promiseCapability, next Value, index int) {
+		values = append(values, Undefined)
+		resolveAll := func() {
+			i.applyFunction(capability.resolve, Undefined, []Value{i.newArray(values)})
+		}
+		remaining++
+		rejectElement := capability.reject
+		if onRejected != nil {
+			rejectElement = i.promiseElementFunction(&values, index, &remaining, onRejected, resolveAll)
+		}
+		resolveElement := i.promiseElementFunction(&values, index, &remaining, onFulfilled, resolveAll)
+		i.invoke(next, "then", resolveElement, rejectElement)
+	}, func(capability *promiseCapability, count int) {
+		remaining--
+		if remaining == 0 {
+			i.applyFunction(capability.resolve, Undefined, []Value{i.newArray(values)})
+		}
+	})
+}
+
+func (i *Interpreter) promiseAll(this Value, args []Value) Value {
+	fulfilled := func(v Value) Value { return v }
+	return i.settlePromiseElements(this, argument(args, 0), fulfilled, nil)
+}
+
+func (i *Interpreter) promiseAllSettled(this Value, args []Value) Value {
+	fulfilled := func(v Value) Value {
+		result := i.newObject()
+		result.Object.Properties["status"] = Value{Type: TypeString, Data: "fulfilled"}
+		result.Object.Properties["value"] = v
+		return result
+	}
+	rejected := func(reason Value) Value {
+		result := i.newObject()
+		result.Object.Properties["status"] = Value{Type: TypeString, Data: "rejected"}
+		result.Object.Properties["reason"] = reason
+		return result
+	}
+	return i.settlePromiseElements(this, argument(args, 0), fulfilled, rejected)
+}
+
+func (i *Interpreter) promiseAny(this Value, args []Value) Value {
+	var errors []Value
+	remaining := 1
+	rejectAll := func(capability *promiseCapability) {
+		err := i.NewError("AggregateError", "All promises were rejected")
+		err.Object.Properties["errors"] = i.newArray(errors)
+		i.applyFunction(capability.reject, Undefined, []Value{err})
+	}
+	return i.promiseCombinator(this, argument(args, 0), func(capability *promiseCapability, next Value, index int) {
+		errors = append(errors, Undefined)
+		remaining++
+		rejectElement := i.promiseElementFunction(&errors, index, &remaining, func(v Value) Value { return v }, func() {
+			rejectAll(capability)
+		})
+		i.invoke(next, "then", capability.resolve, rejectElement)
+	}, func(capability *promiseCapability, count int) {
+		remaining--
+		if remaining == 0 {
+			rejectAll(capability)
+		}
+	})
+}
+
+func (i *Interpreter) promiseRace(this Value, args []Value) Value {
+	return i.promiseCombinator(this, argument(args, 0), func(capability *promiseCapability, next Value, index int) {
+		i.invoke(next, "then", capability.resolve, capability.reject)
+	}, func(*promiseCapability, int) {})
+}
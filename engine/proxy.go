@@ -0,0 +1,423 @@
+package engine
+
+import "strconv"
+
+// Proxy is the internal state of a proxy object, which forwards the
+// internal methods of objects to the traps of its handler, falling back
+// to its target for traps the handler does not define. A revoked proxy
+// has a null target and handler, but stays a constructor if it was one.
+type Proxy struct {
+	target      Value
+	handler     Value
+	constructor bool
+}
+
+// newProxy creates a proxy, which is callable and constructible when its
+// target is.
+func (i *Interpreter) newProxy(target, handler Value) Value {
+	if !isObject(target) || !isObject(handler) {
+		i.throwError("TypeError", "Cannot create proxy with a non-object as target or handler")
+	}
+	typ := TypeObject
+	if target.Type == TypeFunction {
+		typ = TypeFunction
+	}
+	i.allocate(objectSize)
+	proxy := newObjectValue(typ, &Proxy{target: target, handler: handler, constructor: isConstructor(target)})
+	proxy.Object.interpreter = i
+	return proxy
+}
+
+// proxyObject implements the internal methods of a proxy. Each checks the
+// invariants the specification requires of the trap's result, so that a
+// proxy cannot misreport the non-configurable properties or the
+// extensibility of its target.
+type proxyObject struct {
+	i     *Interpreter
+	proxy *Proxy
+}
+
+// trap returns the handler's trap called name, or undefined when the
+// handler does not define it.
+func (p *proxyObject) trap(name string) Value {
+	if p.proxy.handler.Type == TypeNull {
+		p.i.throwError("TypeError", "Cannot perform '%s' on a proxy that has been revoked", name)
+	}
+	trap := p.i.getProperty(p.proxy.handler, name)
+	if isNullish(trap) {
+		return Undefined
+	}
+	if trap.Type != TypeFunction {
+		p.i.throwError("TypeError", "'%s' on proxy: trap is not a function", name)
+	}
+	return trap
+}
+
+func (p *proxyObject) call(trap Value, args ...Value) Value {
+	return p.i.applyFunction(trap, p.proxy.handler, args)
+}
+
+func (p *proxyObject) fail(trap string, format string, args ...interface{}) {
+	p.i.throwError("TypeError", "'"+trap+"' on proxy: "+format, args...)
+}
+
+func (p *proxyObject) getPrototypeOf(obj Value) Value {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("getPrototypeOf")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.prototypeOf(target)
+	}
+	proto := p.call(trap, target)
+	if !isObject(proto) && proto.Type != TypeNull {
+		p.fail("getPrototypeOf", "trap returned neither object nor null")
+	}
+	if !p.i.isExtensible(target) && !sameValue(proto, p.i.prototypeOf(target)) {
+		p.fail("getPrototypeOf", "proxy target is non-extensible but the trap did not return its actual prototype")
+	}
+	return proto
+}
+
+func (p *proxyObject) setPrototypeOf(obj Value, proto Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("setPrototypeOf")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.setPrototypeOf(target, proto)
+	}
+	if !p.call(trap, target, proto).ToBoolean() {
+		return false
+	}
+	if !p.i.isExtensible(target) && !sameValue(proto, p.i.prototypeOf(target)) {
+		p.fail("setPrototypeOf", "trap returned truish for setting a new prototype on the non-extensible proxy target")
+	}
+	return true
+}
+
+func (p *proxyObject) isExtensible(obj Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("isExtensible")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.isExtensible(target)
+	}
+	result := p.call(trap, target).ToBoolean()
+	if expected := p.i.isExtensible(target); result != expected {
+		p.fail("isExtensible", "trap result does not reflect extensibility of proxy target (which is '%t')", expected)
+	}
+	return result
+}
+
+func (p *proxyObject) preventExtensions(obj Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("preventExtensions")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.preventExtensions(target)
+	}
+	result := p.call(trap, target).ToBoolean()
+	if result && p.i.isExtensible(target) {
+		p.fail("preventExtensions", "trap returned truish but the proxy target is extensible")
+	}
+	return result
+}
+
+func (p *proxyObject) getOwnProperty(obj Value, key Value) (*propertyDescriptor, bool) {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("getOwnPropertyDescriptor")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.getOwnPropertyDescriptor(target, key)
+	}
+	result := p.call(trap, target, key)
+	if !isObject(result) && result.Type != TypeUndefined {
+		p.fail("getOwnPropertyDescriptor", "trap returned neither object nor undefined for property '%s'", key.ToString())
+	}
+	targetDesc, targetHas := p.i.getOwnPropertyDescriptor(target, key)
+	if result.Type == TypeUndefined {
+		if !targetHas {
+			return nil, false
+		}
+		if !targetDesc.configurable {
+			p.fail("getOwnPropertyDescriptor", "trap returned undefined for property '%s' which is non-configurable in the proxy target", key.ToString())
+		}
+		if !p.i.isExtensible(target) {
+			p.fail("getOwnPropertyDescriptor", "trap returned undefined for property '%s' which exists in the non-extensible proxy target", key.ToString())
+		}
+		return nil, false
+	}
+
+	desc := p.i.toPropertyDescriptor(result)
+	completePropertyDescriptor(desc)
+	if !validatePropertyDescriptor(p.i.isExtensible(target), desc, targetDesc, targetHas) {
+		p.fail("getOwnPropertyDescriptor", "trap returned descriptor for property '%s' that is incompatible with the existing property in the proxy target", key.ToString())
+	}
+	if !desc.configurable {
+		if !targetHas || targetDesc.configurable {
+			p.fail("getOwnPropertyDescriptor", "trap reported non-configurability for property '%s' which is either non-existent or configurable in the proxy target", key.ToString())
+		}
+		if desc.hasWritable && !desc.writable && targetDesc.writable {
+			p.fail("getOwnPropertyDescriptor", "trap reported non-configurable and writable for property '%s' which is non-configurable, non-writable in the proxy target", key.ToString())
+		}
+	}
+	return desc, true
+}
+
+// completePropertyDescriptor fills in the fields a descriptor lacks with
+// their defaults.
+func completePropertyDescriptor(desc *propertyDescriptor) {
+	if desc.isAccessor() {
+		if !desc.hasGet {
+			desc.get, desc.hasGet = Undefined, true
+		}
+		if !desc.hasSet {
+			desc.set, desc.hasSet = Undefined, true
+		}
+	} else {
+		if !desc.hasValue {
+			desc.value, desc.hasValue = Undefined, true
+		}
+		desc.hasWritable = true
+	}
+	desc.hasEnumerable, desc.hasConfigurable = true, true
+}
+
+func (p *proxyObject) defineOwnProperty(obj Value, key Value, desc *propertyDescriptor) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("defineProperty")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.defineOwnProperty(target, key, desc)
+	}
+	if !p.call(trap, target, key, fromPropertyDescriptor(desc)).ToBoolean() {
+		return false
+	}
+
+	targetDesc, targetHas := p.i.getOwnPropertyDescriptor(target, key)
+	settingConfigFalse := desc.hasConfigurable && !desc.configurable
+	if !targetHas {
+		if !p.i.isExtensible(target) {
+			p.fail("defineProperty", "trap returned truish for adding property '%s'  to the non-extensible proxy target", key.ToString())
+		}
+		if settingConfigFalse {
+			p.fail("defineProperty", "trap returned truish for defining non-configurable property '%s' which is either non-existent or configurable in the proxy target", key.ToString())
+		}
+		return true
+	}
+	if !validatePropertyDescriptor(p.i.isExtensible(target), desc, targetDesc, true) {
+		p.fail("defineProperty", "trap returned truish for adding property '%s'  that is incompatible with the existing property in the proxy target", key.ToString())
+	}
+	if settingConfigFalse && targetDesc.configurable {
+		p.fail("defineProperty", "trap returned truish for defining non-configurable property '%s' which is either non-existent or configurable in the proxy target", key.ToString())
+	}
+	if targetDesc.isData() && !targetDesc.configurable && targetDesc.writable && desc.hasWritable && !desc.writable {
+		p.fail("defineProperty", "trap returned truish for defining non-configurable property '%s' which cannot be non-writable, unless there exists a corresponding non-configurable, non-writable own property of the target object.", key.ToString())
+	}
+	return true
+}
+
+func (p *proxyObject) hasProperty(obj Value, key Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("has")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.hasMember(target, key)
+	}
+	if p.call(trap, target, key).ToBoolean() {
+		return true
+	}
+	if targetDesc, ok := p.i.getOwnPropertyDescriptor(target, key); ok {
+		if !targetDesc.configurable {
+			p.fail("has", "trap returned falsish for property '%s' which exists in the proxy target as non-configurable", key.ToString())
+		}
+		if !p.i.isExtensible(target) {
+			p.fail("has", "trap returned falsish for property '%s' but the proxy target is not extensible", key.ToString())
+		}
+	}
+	return false
+}
+
+func (p *proxyObject) get(obj Value, key Value, receiver Value) Value {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("get")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.lookupMember(target, key, receiver)
+	}
+	result := p.call(trap, target, key, receiver)
+	if targetDesc, ok := p.i.getOwnPropertyDescriptor(target, key); ok && !targetDesc.configurable {
+		if targetDesc.isData() && !targetDesc.writable && !sameValue(result, targetDesc.value) {
+			p.fail("get", "property '%s' is a read-only and non-configurable data property on the proxy target but the proxy did not return its actual value (expected '%s' but got '%s')", key.ToString(), targetDesc.value.ToString(), result.ToString())
+		}
+		if targetDesc.isAccessor() && targetDesc.get.Type == TypeUndefined && result.Type != TypeUndefined {
+			p.fail("get", "property '%s' is a non-configurable accessor property on the proxy target and does not have a getter function, but the trap did not return 'undefined' (got '%s')", key.ToString(), result.ToString())
+		}
+	}
+	return result
+}
+
+func (p *proxyObject) set(obj Value, key Value, val Value, receiver Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("set")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.methodsOf(target).set(target, key, val, receiver)
+	}
+	if !p.call(trap, target, key, val, receiver).ToBoolean() {
+		return false
+	}
+	if targetDesc, ok := p.i.getOwnPropertyDescriptor(target, key); ok && !targetDesc.configurable {
+		if targetDesc.isData() && !targetDesc.writable && !sameValue(val, targetDesc.value) {
+			p.fail("set", "trap returned truish for property '%s' which exists in the proxy target as a non-configurable and non-writable data property with a different value", key.ToString())
+		}
+		if targetDesc.isAccessor() && targetDesc.set.Type == TypeUndefined {
+			p.fail("set", "trap returned truish for property '%s' which exists in the proxy target as a non-configurable and non-writable accessor property without a setter", key.ToString())
+		}
+	}
+	return true
+}
+
+func (p *proxyObject) delete(obj Value, key Value) bool {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("deleteProperty")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.deleteMember(target, key)
+	}
+	if !p.call(trap, target, key).ToBoolean() {
+		return false
+	}
+	if targetDesc, ok := p.i.getOwnPropertyDescriptor(target, key); ok {
+		if !targetDesc.configurable {
+			p.fail("deleteProperty", "trap returned truish for property '%s' which is non-configurable in the proxy target", key.ToString())
+		}
+		if !p.i.isExtensible(target) {
+			p.fail("deleteProperty", "trap returned truish for property '%s' but the proxy target is non-extensible", key.ToString())
+		}
+	}
+	return true
+}
+
+// ownPropertyKeys requires the trap to list each key once, to include the
+// non-configurable keys of the target and, when the target is not
+// extensible, to list exactly the target's keys.
+func (p *proxyObject) ownPropertyKeys(obj Value) []Value {
+	p.i.pushNesting()
+	defer p.i.popNesting()
+	trap := p.trap("ownKeys")
+	target := p.proxy.target
+	if trap.Type == TypeUndefined {
+		return p.i.ownKeys(target)
+	}
+	result := p.call(trap, target)
+	if !isObject(result) {
+		p.i.throwError("TypeError", "CreateListFromArrayLike called on non-object")
+	}
+	keys := p.i.listFromArrayLike(result)
+	listed := make(map[propertyKey]bool, len(keys))
+	for _, key := range keys {
+		if key.Type != TypeString && key.Type != TypeSymbol {
+			p.i.throwError("TypeError", "%s is not a valid property name", key.ToString())
+		}
+		if listed[keyOf(key)] {
+			p.fail("ownKeys", "trap returned duplicate entries")
+		}
+		listed[keyOf(key)] = true
+	}
+
+	extensible := p.i.isExtensible(target)
+	targetKeys := p.i.ownKeys(target)
+	for _, key := range targetKeys {
+		desc, ok := p.i.getOwnPropertyDescriptor(target, key)
+		if (!extensible || ok && !desc.configurable) && !listed[keyOf(key)] {
+			p.fail("ownKeys", "trap result did not include '%s'", key.ToString())
+		}
+	}
+	if !extensible && len(keys) != len(targetKeys) {
+		p.fail("ownKeys", "trap returned extra keys but proxy target is non-extensible")
+	}
+	return keys
+}
+
+// proxyCall implements [[Call]] for a proxy around a function.
+func (i *Interpreter) proxyCall(proxy *Proxy, this Value, args []Value) Value {
+	i.pushNesting()
+	defer i.popNesting()
+	p := &proxyObject{i: i, proxy: proxy}
+	trap := p.trap("apply")
+	if trap.Type == TypeUndefined {
+		return i.applyFunction(proxy.target, this, args)
+	}
+	return p.call(trap, proxy.target, this, i.newArray(args))
+}
+
+// proxyConstruct implements [[Construct]] for a proxy around a
+// constructor.
+func (i *Interpreter) proxyConstruct(proxy *Proxy, args []Value, newTarget Value) Value {
+	i.pushNesting()
+	defer i.popNesting()
+	p := &proxyObject{i: i, proxy: proxy}
+	trap := p.trap("construct")
+	if trap.Type == TypeUndefined {
+		return i.construct(proxy.target, args, newTarget)
+	}
+	result := p.call(trap, proxy.target, i.newArray(args), newTarget)
+	if !isObject(result) {
+		p.fail("construct", "trap returned non-object ('%s')", result.ToString())
+	}
+	return result
+}
+
+// listFromArrayLike implements CreateListFromArrayLike, reading the
+// elements of an array-like object through its length and indexes. The
+// list may be no longer than an array or maxListLength.
+func (i *Interpreter) listFromArrayLike(obj Value) []Value {
+	if !isObject(obj) {
+		i.throwError("TypeError", "CreateListFromArrayLike called on non-object")
+	}
+	length := toLength(Value{Type: TypeNumber, Data: i.toNumber(i.getProperty(obj, "length"))})
+	if length > maxListLength {
+		i.throwError("RangeError", "Invalid array length")
+	}
+	i.checkArrayLength(int64(length))
+	i.allocate(length * propertySize)
+	list := make([]Value, length)
+	for idx := range list {
+		list[idx] = i.getMember(obj, stringKey(strconv.Itoa(idx)))
+	}
+	return list
+}
+
+// setupProxy defines the Proxy constructor, which cannot be called
+// without new and has no prototype property, and Proxy.revocable.
+func (i *Interpreter) setupProxy() {
+	proxy := i.newNativeFunction("Proxy", 2, func(this Value, args []Value) Value {
+		i.throwError("TypeError", "Constructor Proxy requires 'new'")
+		return Undefined
+	})
+	proxy.Data.(*NativeFunction).Construct = func(args []Value, newTarget Value) Value {
+		return i.newProxy(argument(args, 0), argument(args, 1))
+	}
+	i.defineMethod(proxy, "revocable", 2, func(this Value, args []Value) Value {
+		p := i.newProxy(argument(args, 0), argument(args, 1))
+		result := i.newObject()
+		result.Object.Properties["proxy"] = p
+		result.Object.Properties["revoke"] = i.newNativeFunction("", 0, func(this Value, args []Value) Value {
+			state := p.Data.(*Proxy)
+			state.target, state.handler = Value{Type: TypeNull}, Value{Type: TypeNull}
+			return Undefined
+		})
+		return result
+	})
+	i.env.Set("Proxy", proxy)
+}
@@ -0,0 +1,83 @@
+package engine
+
+import "testing"
+
+func TestProxyTraps(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let p = new Proxy({}, {get(t, k, r) { return k + "!"; }}); p.x`, "x!"},
+		{`let p = new Proxy({a: 1}, {}); p.b = 2; p.a + p.b`, "3"},
+		{`let log = ""; let p = new Proxy({}, {set(t, k, v, r) { log = k + "=" + v; t[k] = v * 2; return true; }}); p.x = 3; log + "," + p.x`, "x=3,6"},
+		{`let p = new Proxy({}, {has(t, k) { return k == "yes"; }}); ("yes" in p) + "," + ("no" in p)`, "true,false"},
+		{`let p = new Proxy({a: 1}, {deleteProperty(t, k) { return false; }}); delete p.a`, "false"},
+		{`let p = new Proxy({}, {ownKeys(t) { return ["b", "a"]; }}); Reflect.ownKeys(p).join()`, "b,a"},
+		{`let p = new Proxy({}, {defineProperty(t, k, d) { t[k] = d.value + 1; return true; }}); Object.defineProperty(p, "x", {value: 1}); p.x`, "2"},
+		{`let proto = {}; let p = new Proxy({}, {getPrototypeOf(t) { return proto; }}); Object.getPrototypeOf(p) === proto`, "true"},
+		{`let p = new Proxy({}, {setPrototypeOf(t, v) { return false; }}); Reflect.setPrototypeOf(p, null)`, "false"},
+		{`let p = new Proxy({}, {isExtensible(t) { return true; }}); Object.isExtensible(p)`, "true"},
+		{`let p = new Proxy({}, {preventExtensions(t) { Object.preventExtensions(t); return true; }}); Object.isExtensible(Object.preventExtensions(p))`, "false"},
+		{`let p = new Proxy(function (a) { return a; }, {apply(t, self, args) { return args[0] * 10; }}); p(4)`, "40"},
+		{`function F(v) { this.v = v; } let p = new Proxy(F, {construct(t, args, nt) { return {v: args[0] + 1}; }}); new p(1).v`, "2"},
+		{`let p = new Proxy({x: 1}, {get: undefined}); p.x`, "1"},
+		{`let p = new Proxy([1, 2, 3], {}); p.length + "," + Array.isArray(p)`, "3,false"},
+		{`let r = Proxy.revocable({x: 1}, {}); r.revoke(); r.proxy.x`, "Uncaught TypeError: Cannot perform 'get' on a proxy that has been revoked"},
+		{`let p = new Proxy({}, {get: 1}); p.x`, "Uncaught TypeError: 'get' on proxy: trap is not a function"},
+		{`new Proxy(1, {})`, "Uncaught TypeError: Cannot create proxy with a non-object as target or handler"},
+		{`Proxy({}, {})`, "Uncaught TypeError: Constructor Proxy requires 'new'"},
+		{`Reflect.get({x: 1}, "x") + Reflect.has({x: 1}, "x")`, "2"},
+		{`let o = {}; Reflect.set(o, "x", 5); Reflect.ownKeys(o).join() + o.x`, "x5"},
+		{`Reflect.apply(function (a, b) { return a - b; }, null, [5, 2])`, "3"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestProxyInvariants(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); new Proxy(t, {get() { return 2; }}).x`, "Uncaught TypeError: 'get' on proxy: property 'x' is a read-only and non-configurable data property on the proxy target but the proxy did not return its actual value (expected '1' but got '2')"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); new Proxy(t, {get() { return 1; }}).x`, "1"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); let p = new Proxy(t, {set() { return true; }}); Reflect.set(p, "x", 2)`, "Uncaught TypeError: 'set' on proxy: trap returned truish for property 'x' which exists in the proxy target as a non-configurable and non-writable data property with a different value"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); "x" in new Proxy(t, {has() { return false; }})`, "Uncaught TypeError: 'has' on proxy: trap returned falsish for property 'x' which exists in the proxy target as non-configurable"},
+		{`let t = {x: 1}; Object.preventExtensions(t); "x" in new Proxy(t, {has() { return false; }})`, "Uncaught TypeError: 'has' on proxy: trap returned falsish for property 'x' but the proxy target is not extensible"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); delete new Proxy(t, {deleteProperty() { return true; }}).x`, "Uncaught TypeError: 'deleteProperty' on proxy: trap returned truish for property 'x' which is non-configurable in the proxy target"},
+		{`Object.isExtensible(new Proxy({}, {isExtensible() { return false; }}))`, "Uncaught TypeError: 'isExtensible' on proxy: trap result does not reflect extensibility of proxy target (which is 'true')"},
+		{`Object.preventExtensions(new Proxy({}, {preventExtensions() { return true; }}))`, "Uncaught TypeError: 'preventExtensions' on proxy: trap returned truish but the proxy target is extensible"},
+		{`Object.getPrototypeOf(new Proxy({}, {getPrototypeOf() { return 1; }}))`, "Uncaught TypeError: 'getPrototypeOf' on proxy: trap returned neither object nor null"},
+		{`let t = Object.preventExtensions({}); Object.getPrototypeOf(new Proxy(t, {getPrototypeOf() { return null; }}))`, "Uncaught TypeError: 'getPrototypeOf' on proxy: proxy target is non-extensible but the trap did not return its actual prototype"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); Object.getOwnPropertyDescriptor(new Proxy(t, {getOwnPropertyDescriptor() { return undefined; }}), "x")`, "Uncaught TypeError: 'getOwnPropertyDescriptor' on proxy: trap returned undefined for property 'x' which is non-configurable in the proxy target"},
+		{`Object.defineProperty(new Proxy({}, {defineProperty() { return true; }}), "x", {value: 1, configurable: false})`, "Uncaught TypeError: 'defineProperty' on proxy: trap returned truish for defining non-configurable property 'x' which is either non-existent or configurable in the proxy target"},
+		{`let t = {}; Object.defineProperty(t, "x", {value: 1}); Reflect.ownKeys(new Proxy(t, {ownKeys() { return []; }}))`, "Uncaught TypeError: 'ownKeys' on proxy: trap result did not include 'x'"},
+		{`Reflect.ownKeys(new Proxy({}, {ownKeys() { return ["a", "a"]; }}))`, "Uncaught TypeError: 'ownKeys' on proxy: trap returned duplicate entries"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+// reflectTarget returns the target argument of the Reflect functions,
+// which all require an object.
+func (i *Interpreter) reflectTarget(args []Value, function string) Value {
+	target := argument(args, 0)
+	if !isObject(target) {
+		i.throwError("TypeError", "Reflect.%s called on non-object", function)
+	}
+	return target
+}
+
+// setupReflect defines the Reflect namespace, whose functions expose the
+// internal methods of objects and report failure by returning false where
+// the corresponding Object functions throw.
+func (i *Interpreter) setupReflect() {
+	reflect := i.newObject()
+	boolean := func(b bool) Value {
+		return Value{Type: TypeBoolean, Data: b}
+	}
+
+	i.defineMethod(reflect, "apply", 3, func(this Value, args []Value) Value {
+		target := argument(args, 0)
+		if target.Type != TypeFunction {
+			i.throwError("TypeError", "Function.prototype.apply was called on %s, which is %s and not a function", target.ToString(), target.TypeOf())
+		}
+		return i.applyFunction(target, argument(args, 1), i.listFromArrayLike(argument(args, 2)))
+	})
+	i.defineMethod(reflect, "construct", 2, func(this Value, args []Value) Value {
+		target := argument(args, 0)
+		if !isConstructor(target) {
+			i.throwError("TypeError", "%s is not a constructor", describeCallee(target))
+		}
+		newTarget := target
+		if len(args) > 2 {
+			newTarget = args[2]
+			if !isConstructor(newTarget) {
+				i.throwError("TypeError", "%s is not a constructor", describeCallee(newTarget))
+			}
+		}
+		return i.construct(target, i.listFromArrayLike(argument(args, 1)), newTarget)
+	})
+	i.defineMethod(reflect, "defineProperty", 3, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "defineProperty")
+		key := i.toPropertyKey(argument(args, 1))
+		return boolean(i.defineOwnProperty(target, key, i.toPropertyDescriptor(argument(args, 2))))
+	})
+	i.defineMethod(reflect, "deleteProperty", 2, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "deleteProperty")
+		return boolean(i.deleteMember(target, i.toPropertyKey(argument(args, 1))))
+	})
+	i.defineMethod(reflect, "get", 2, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "get")
+		receiver := target
+		if len(args) > 2 {
+			receiver = args[2]
+		}
+		return i.lookupMember(target, i.toPropertyKey(argument(args, 1)), receiver)
+	})
+	i.defineMethod(reflect, "getOwnPropertyDescriptor", 2, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "getOwnPropertyDescriptor")
+		if desc, ok := i.getOwnPropertyDescriptor(target, i.toPropertyKey(argument(args, 1))); ok {
+			return fromPropertyDescriptor(desc)
+		}
+		return Undefined
+	})
+	i.defineMethod(reflect, "getPrototypeOf", 1, func(this Value, args []Value) Value {
+		return i.prototypeOf(i.reflectTarget(args, "getPrototypeOf"))
+	})
+	i.defineMethod(reflect, "has", 2, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "has")
+		return boolean(i.hasMember(target, i.toPropertyKey(argument(args, 1))))
+	})
+	i.defineMethod(reflect, "isExtensible", 1, func(this Value, args []Value) Value {
+		return boolean(i.isExtensible(i.reflectTarget(args, "isExtensible")))
+	})
+	i.defineMethod(reflect, "ownKeys", 1, func(this Value, args []Value) Value {
+		return i.newArray(i.ownKeys(i.reflectTarget(args, "ownKeys")))
+	})
+	i.defineMethod(reflect, "preventExtensions", 1, func(this Value, args []Value) Value {
+		return boolean(i.preventExtensions(i.reflectTarget(args, "preventExtensions")))
+	})
+	i.defineMethod(reflect, "set", 3, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "set")
+		receiver := target
+		if len(args) > 3 {
+			receiver = args[3]
+		}
+		key := i.toPropertyKey(argument(args, 1))
+		return boolean(i.methodsOf(target).set(target, key, argument(args, 2), receiver))
+	})
+	i.defineMethod(reflect, "setPrototypeOf", 2, func(this Value, args []Value) Value {
+		target := i.reflectTarget(args, "setPrototypeOf")
+		proto := argument(args, 1)
+		if !isObject(proto) && proto.Type != TypeNull {
+			i.throwError("TypeError", "Object prototype may only be an Object or null: %s", proto.ToString())
+		}
+		return boolean(i.setPrototypeOf(target, proto))
+	})
+
+	setSymbolSlot(reflect, symbolToStringTag, Value{Type: TypeString, Data: "Reflect"})
+	i.env.Set("Reflect", reflect)
+}
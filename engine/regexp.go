@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// RegExp is the internal state of a regular expression object. The
+// pattern is compiled once, when the object is created.
+type RegExp struct {
+	Source string
+	Flags  string
+
+	program *regexpProgram
+}
+
+// regexpFlags lists the valid flags in the order the flags property
+// reports them, with the names of the properties that test for them.
+var regexpFlags = []struct {
+	flag     byte
+	property string
+}{
+	{'d', "hasIndices"},
+	{'g', "global"},
+	{'i', "ignoreCase"},
+	{'m', "multiline"},
+	{'s', "dotAll"},
+	{'u', "unicode"},
+	{'y', "sticky"},
+}
+
+// SetRegExpStepLimit bounds the backtracking steps a single regular
+// expression match may take before it throws a RangeError. A limit of
+// zero or less removes the bound.
+func (i *Interpreter) SetRegExpStepLimit(limit int) {
+	i.regexpStepLimit = limit
+}
+
+// newRegExp creates a regular expression object inheriting from proto,
+// throwing a SyntaxError when the pattern or flags are invalid. The flags
+// are kept in the order the flags property lists them.
+func (i *Interpreter) newRegExp(source, flags string, proto Value) Value {
+	for idx := 0; idx < len(flags); idx++ {
+		valid := false
+		for _, f := range regexpFlags {
+			valid = valid || f.flag == flags[idx]
+		}
+		if !valid || strings.IndexByte(flags[idx+1:], flags[idx]) >= 0 {
+			i.throwError("SyntaxError", "Invalid flags supplied to RegExp constructor '%s'", flags)
+		}
+	}
+	var canonical strings.Builder
+	for _, f := range regexpFlags {
+		if strings.IndexByte(flags, f.flag) >= 0 {
+			canonical.WriteByte(f.flag)
+		}
+	}
+	flags = canonical.String()
+
+	program, err := compileRegExp(source, flags)
+	if err != nil {
+		i.throwError("SyntaxError", "Invalid regular expression: /%s/%s: %s", source, flags, err)
+	}
+
+	obj := i.newObject()
+	obj.Object.Prototype = proto
+	obj.Data = &RegExp{Source: source, Flags: flags, program: program}
+	obj.Object.Properties["lastIndex"] = Value{Type: TypeNumber, Data: float64(0)}
+	return obj
+}
+
+// thisRegExp returns the regular expression a RegExp.prototype method was
+// called on.
+func (i *Interpreter) thisRegExp(this Value, method string) *RegExp {
+	re, ok := this.Data.(*RegExp)
+	if !ok || this.Type != TypeObject {
+		i.throwError("TypeError", "RegExp.prototype.%s requires that 'this' be a RegExp object", method)
+	}
+	return re
+}
+
+// regexpConstructor implements both RegExp(pattern, flags) and
+// new RegExp(pattern, flags). The pattern may be another regular
+// expression, whose flags are used unless others are given.
+func (i *Interpreter) regexpConstructor(args []Value, newTarget Value) Value {
+	pattern, flags := argument(args, 0), argument(args, 1)
+	source := ""
+	re, isRegExp := pattern.Data.(*RegExp)
+	switch {
+	case isRegExp && pattern.Type == TypeObject:
+		if newTarget.Type == TypeUndefined && flags.Type == TypeUndefined {
+			return pattern
+		}
+		source = re.Source
+		if flags.Type == TypeUndefined {
+			flags = Value{Type: TypeString, Data: re.Flags}
+		}
+	case pattern.Type != TypeUndefined:
+		source = i.toString(pattern)
+	}
+	flagString := ""
+	if flags.Type != TypeUndefined {
+		flagString = i.toString(flags)
+	}
+
+	proto := i.regexpPrototype
+	if newTarget.Type != TypeUndefined {
+		if p := i.getProperty(newTarget, "prototype"); p.Type == TypeObject || p.Type == TypeFunction {
+			proto = p
+		}
+	}
+	return i.newRegExp(source, flagString, proto)
+}
+
+// regexpExec implements RegExpBuiltinExec. Global and sticky expressions
+// start matching at lastIndex and update it, and sticky ones only match
+// there. The result is an array of the match and its groups with the
+// properties index, input and groups, plus indices with the d flag, or
+// null when there is no match.
+func (i *Interpreter) regexpExec(this Value, s string) Value {
+	re := i.thisRegExp(this, "exec")
+	global := strings.IndexByte(re.Flags, 'g') >= 0
+	sticky := strings.IndexByte(re.Flags, 'y') >= 0
+
+	lastIndex := 0
+	if global || sticky {
+		lastIndex = toLength(i.getProperty(this, "lastIndex"))
+	}
+
+	input := utf16.Encode([]rune(s))
+	m := &reMatch{input: input, stepLimit: i.regexpStepLimit, checkInterrupt: i.checkInterrupt}
+	var captures []int
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(reStepLimitError); !ok {
+					panic(r)
+				}
+				i.throwError("RangeError", "Maximum regular expression backtracking exceeded: /%s/%s", re.Source, re.Flags)
+			}
+		}()
+		for lastIndex <= len(input) {
+			if captures = re.program.matchAt(m, lastIndex); captures != nil || sticky {
+				break
+			}
+			lastIndex = re.program.advance(input, lastIndex)
+		}
+	}()
+
+	if captures == nil {
+		if global || sticky {
+			i.setProperty(this, "lastIndex", Value{Type: TypeNumber, Data: float64(0)})
+		}
+		return Value{Type: TypeNull}
+	}
+	if global || sticky {
+		i.setProperty(this, "lastIndex", Value{Type: TypeNumber, Data: float64(captures[1])})
+	}
+	return i.regexpResult(re, input, s, captures)
+}
+
+// advance returns the position after the one at pos, which skips a whole
+// surrogate pair in unicode mode.
+func (prog *regexpProgram) advance(input []uint16, pos int) int {
+	_, next, ok := prog.readChar(input, pos, true)
+	if !ok {
+		return pos + 1
+	}
+	return next
+}
+
+// regexpResult builds the array exec returns for a match.
+func (i *Interpreter) regexpResult(re *RegExp, input []uint16, s string, captures []int) Value {
+	pattern := re.program.pattern
+	elements := make([]Value, pattern.groupCount+1)
+	indices := make([]Value, pattern.groupCount+1)
+	for idx := range elements {
+		start, end := captures[2*idx], captures[2*idx+1]
+		if start < 0 || end < 0 {
+			elements[idx], indices[idx] = Undefined, Undefined
+			continue
+		}
+		elements[idx] = Value{Type: TypeString, Data: string(utf16.Decode(input[start:end]))}
+		indices[idx] = i.newArray([]Value{
+			{Type: TypeNumber, Data: float64(start)},
+			{Type: TypeNumber, Data: float64(end)},
+		})
+	}
+
+	result := i.newArray(elements)
+	result.Object.Properties["index"] = Value{Type: TypeNumber, Data: float64(captures[0])}
+	result.Object.Properties["input"] = Value{Type: TypeString, Data: s}
+	result.Object.Properties["groups"] = i.namedGroups(pattern, elements)
+	if strings.IndexByte(re.Flags, 'd') >= 0 {
+		indicesArray := i.newArray(indices)
+		indicesArray.Object.Properties["groups"] = i.namedGroups(pattern, indices)
+		result.Object.Properties["indices"] = indicesArray
+	}
+	return result
+}
+
+// namedGroups returns an object without a prototype that maps the names of
+// named groups to their values, or undefined if the pattern has none.
+func (i *Interpreter) namedGroups(pattern *rePattern, values []Value) Value {
+	groups := Undefined
+	for idx, name := range pattern.groupNames {
+		if name == "" {
+			continue
+		}
+		if groups.Type == TypeUndefined {
+			groups = i.newObject()
+			groups.Object.Prototype = Value{Type: TypeNull}
+		}
+		groups.Object.Properties[name] = values[idx]
+	}
+	return groups
+}
+
+// toLength converts a value to an integer index between 0 and 2^53-1.
+func toLength(v Value) int {
+	f := math.Trunc(v.ToNumber())
+	if math.IsNaN(f) || f <= 0 {
+		return 0
+	}
+	return int(math.Min(f, 1<<53-1))
+}
+
+// escapeRegExpSource escapes the slashes and line terminators of a
+// pattern, so that /source/ reads back as the same pattern.
+func escapeRegExpSource(source string) string {
+	if source == "" {
+		return "(?:)"
+	}
+	var b strings.Builder
+	inClass, escaped := false, false
+	for _, ch := range source {
+		switch {
+		case ch == '\n':
+			b.WriteString(`\n`)
+		case ch == '\r':
+			b.WriteString(`\r`)
+		case ch == '\u2028':
+			b.WriteString(`\u2028`)
+		case ch == '\u2029':
+			b.WriteString(`\u2029`)
+		case ch == '/' && !escaped && !inClass:
+			b.WriteString(`\/`)
+		default:
+			b.WriteRune(ch)
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == '[':
+			inClass = true
+		case ch == ']':
+			inClass = false
+		}
+	}
+	return b.String()
+}
+
+// setupRegExp defines the RegExp constructor and RegExp.prototype, whose
+// accessors report the source and flags of the expression they are read
+// from.
+func (i *Interpreter) setupRegExp() {
+	i.regexpPrototype = i.newObject()
+	regexp := i.newNativeFunction("RegExp", 2, func(this Value, args []Value) Value {
+		return i.regexpConstructor(args, Undefined)
+	})
+	regexp.Data.(*NativeFunction).Construct = i.regexpConstructor
+	regexp.Object.Properties["prototype"] = i.regexpPrototype
+	i.regexpPrototype.Object.Properties["constructor"] = regexp
+
+	i.defineMethod(i.regexpPrototype, "exec", 1, func(this Value, args []Value) Value {
+		return i.regexpExec(this, i.toString(argument(args, 0)))
+	})
+	i.defineMethod(i.regexpPrototype, "test", 1, func(this Value, args []Value) Value {
+		i.thisRegExp(this, "test")
+		return Value{Type: TypeBoolean, Data: i.regexpExec(this, i.toString(argument(args, 0))).Type != TypeNull}
+	})
+	i.defineMethod(i.regexpPrototype, "toString", 0, func(this Value, args []Value) Value {
+		if this.Type != TypeObject && this.Type != TypeFunction {
+			i.throwError("TypeError", "RegExp.prototype.toString requires that 'this' be an Object")
+		}
+		source := i.toString(i.getProperty(this, "source"))
+		flags := i.toString(i.getProperty(this, "flags"))
+		return Value{Type: TypeString, Data: "/" + source + "/" + flags}
+	})
+
+	// The accessors return undefined, or (?:) for source, when read from
+	// RegExp.prototype itself, as its properties are read when it is
+	// inspected.
+	defineGetter := func(name string, get func(this Value) Value) {
+		getter := i.newNativeFunction("get "+name, 0, func(this Value, args []Value) Value {
+			return get(this)
+		})
+		i.regexpPrototype.Object.Properties[name] = Value{Type: TypeAccessor, Data: &Accessor{Get: getter, Set: Undefined}}
+	}
+	defineGetter("source", func(this Value) Value {
+		if sameObject(this, i.regexpPrototype) {
+			return Value{Type: TypeString, Data: "(?:)"}
+		}
+		return Value{Type: TypeString, Data: escapeRegExpSource(i.thisRegExp(this, "source").Source)}
+	})
+	defineGetter("flags", func(this Value) Value {
+		if this.Type != TypeObject && this.Type != TypeFunction {
+			i.throwError("TypeError", "RegExp.prototype.flags getter called on non-object %s", this.ToString())
+		}
+		var flags strings.Builder
+		for _, f := range regexpFlags {
+			if i.getProperty(this, f.property).ToBoolean() {
+				flags.WriteByte(f.flag)
+			}
+		}
+		return Value{Type: TypeString, Data: flags.String()}
+	})
+	for _, f := range regexpFlags {
+		flag, property := f.flag, f.property
+		defineGetter(property, func(this Value) Value {
+			if sameObject(this, i.regexpPrototype) {
+				return Undefined
+			}
+			re := i.thisRegExp(this, property)
+			return Value{Type: TypeBoolean, Data: strings.IndexByte(re.Flags, flag) >= 0}
+		})
+	}
+
+	i.env.Set("RegExp", regexp)
+}
+
+// String renders a regular expression the way its toString method does.
+func (re *RegExp) String() string {
+	return "/" + escapeRegExpSource(re.Source) + "/" + re.Flags
+}
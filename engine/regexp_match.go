@@ -0,0 +1,467 @@
+package engine
+
+import (
+	"unicode"
+	"unicode/utf16"
+)
+
+// defaultRegExpStepLimit bounds the work a single match may do, so a
+// pattern that backtracks catastrophically throws a RangeError instead of
+// hanging the interpreter.
+const defaultRegExpStepLimit = 10000000
+
+// reInterruptInterval is the number of steps a match takes between checks
+// for an interrupt.
+const reInterruptInterval = 1024
+
+// reMatch is the state of an attempt to match a pattern against input.
+// Positions are indexes into input, which holds UTF-16 code units, and
+// captures holds the start and end of each group, or -1 for groups that
+// did not participate.
+type reMatch struct {
+	input    []uint16
+	captures []int
+
+	steps     int
+	stepLimit int
+	// checkInterrupt is called every reInterruptInterval steps, so that an
+	// interrupt stops a match that takes long without reaching its limit.
+	checkInterrupt func()
+}
+
+// reStepLimitError is what a match panics with when it exceeds its step
+// limit.
+type reStepLimitError struct{}
+
+func (m *reMatch) step() {
+	m.steps++
+	if m.stepLimit > 0 && m.steps > m.stepLimit {
+		panic(reStepLimitError{})
+	}
+	if m.steps%reInterruptInterval == 0 && m.checkInterrupt != nil {
+		m.checkInterrupt()
+	}
+}
+
+// A reMatcher tries to match part of a pattern at pos. On success it calls
+// k with the position where the match ended, and when k fails it
+// backtracks to try the next way of matching. It reports whether k
+// eventually succeeded.
+type reMatcher func(m *reMatch, pos int, k func(int) bool) bool
+
+// regexpProgram is a compiled pattern with the flags that affect how it
+// matches.
+type regexpProgram struct {
+	pattern    *rePattern
+	matcher    reMatcher
+	ignoreCase bool
+	multiline  bool
+	dotAll     bool
+	unicode    bool
+}
+
+// compileRegExp parses and compiles a pattern with the given flags, which
+// have already been validated.
+func compileRegExp(source, flags string) (*regexpProgram, error) {
+	prog := &regexpProgram{}
+	for _, flag := range flags {
+		switch flag {
+		case 'i':
+			prog.ignoreCase = true
+		case 'm':
+			prog.multiline = true
+		case 's':
+			prog.dotAll = true
+		case 'u':
+			prog.unicode = true
+		}
+	}
+	pattern, err := parseRegExpPattern(source, prog.unicode)
+	if err != nil {
+		return nil, err
+	}
+	prog.pattern = pattern
+	prog.matcher = prog.compile(pattern.root, true)
+	return prog, nil
+}
+
+// matchAt matches the program against input at exactly pos and returns
+// the captures, with the whole match as group 0, or nil if it does not
+// match there.
+func (prog *regexpProgram) matchAt(m *reMatch, pos int) []int {
+	m.captures = make([]int, 2*(prog.pattern.groupCount+1))
+	for idx := range m.captures {
+		m.captures[idx] = -1
+	}
+	matched := prog.matcher(m, pos, func(end int) bool {
+		m.captures[0], m.captures[1] = pos, end
+		return true
+	})
+	if !matched {
+		return nil
+	}
+	return m.captures
+}
+
+// readChar reads the character after pos, or before it when reading
+// backwards, and returns it with the position on its other side. In
+// unicode mode a surrogate pair is read as one character.
+func (prog *regexpProgram) readChar(input []uint16, pos int, forward bool) (rune, int, bool) {
+	if forward {
+		if pos >= len(input) {
+			return 0, pos, false
+		}
+		ch := rune(input[pos])
+		if prog.unicode && ch >= 0xd800 && ch < 0xdc00 && pos+1 < len(input) && input[pos+1] >= 0xdc00 && input[pos+1] <= 0xdfff {
+			return utf16.DecodeRune(ch, rune(input[pos+1])), pos + 2, true
+		}
+		return ch, pos + 1, true
+	}
+	if pos <= 0 {
+		return 0, pos, false
+	}
+	ch := rune(input[pos-1])
+	if prog.unicode && ch >= 0xdc00 && ch <= 0xdfff && pos >= 2 && input[pos-2] >= 0xd800 && input[pos-2] < 0xdc00 {
+		return utf16.DecodeRune(rune(input[pos-2]), ch), pos - 2, true
+	}
+	return ch, pos - 1, true
+}
+
+// canonicalize maps a character to the form the i flag compares: its
+// simple case folding in unicode mode and otherwise its upper case, unless
+// that would turn a non-ASCII character into an ASCII one.
+func (prog *regexpProgram) canonicalize(ch rune) rune {
+	if !prog.ignoreCase {
+		return ch
+	}
+	if prog.unicode {
+		folded := ch
+		for next := unicode.SimpleFold(ch); next != ch; next = unicode.SimpleFold(next) {
+			if next < folded {
+				folded = next
+			}
+		}
+		return folded
+	}
+	if ch >= 0xd800 && ch <= 0xdfff {
+		return ch
+	}
+	upper := unicode.ToUpper(ch)
+	if ch >= 0x80 && upper < 0x80 {
+		return ch
+	}
+	return upper
+}
+
+// classContains reports whether a class matches ch, which with the i flag
+// it does when it contains any character that is the same ignoring case.
+func (prog *regexpProgram) classContains(class *reClass, ch rune) bool {
+	found := class.set.contains(ch)
+	if !found && prog.ignoreCase {
+		canonical := prog.canonicalize(ch)
+		for variant := unicode.SimpleFold(ch); variant != ch; variant = unicode.SimpleFold(variant) {
+			if prog.canonicalize(variant) == canonical && class.set.contains(variant) {
+				found = true
+				break
+			}
+		}
+	}
+	return found != class.negated
+}
+
+func (prog *regexpProgram) isWordChar(input []uint16, pos int) bool {
+	if pos < 0 || pos >= len(input) {
+		return false
+	}
+	ch := rune(input[pos])
+	if prog.unicode && prog.ignoreCase && (ch == 0x017f || ch == 0x212a) {
+		return true
+	}
+	return isRegExpWordChar(ch)
+}
+
+// compile turns a node into a matcher that consumes input forwards, or
+// backwards inside a lookbehind.
+func (prog *regexpProgram) compile(node reNode, forward bool) reMatcher {
+	switch n := node.(type) {
+	case *reSequence:
+		matchers := make([]reMatcher, len(n.terms))
+		for idx, term := range n.terms {
+			matchers[idx] = prog.compile(term, forward)
+		}
+		if !forward {
+			for lo, hi := 0, len(matchers)-1; lo < hi; lo, hi = lo+1, hi-1 {
+				matchers[lo], matchers[hi] = matchers[hi], matchers[lo]
+			}
+		}
+		return sequenceMatcher(matchers)
+
+	case *reDisjunction:
+		alternatives := make([]reMatcher, len(n.alternatives))
+		for idx, alternative := range n.alternatives {
+			alternatives[idx] = prog.compile(alternative, forward)
+		}
+		return func(m *reMatch, pos int, k func(int) bool) bool {
+			for _, alternative := range alternatives {
+				if alternative(m, pos, k) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case *reCharacter, *reDot, *reClass:
+		test := prog.charTest(node)
+		return func(m *reMatch, pos int, k func(int) bool) bool {
+			m.step()
+			ch, next, ok := prog.readChar(m.input, pos, forward)
+			return ok && test(ch) && k(next)
+		}
+
+	case *reAssertion:
+		return prog.compileAssertion(n.kind)
+
+	case *reGroup:
+		body := prog.compile(n.body, forward)
+		if !n.capture {
+			return body
+		}
+		start, end := 2*n.index, 2*n.index+1
+		return func(m *reMatch, pos int, k func(int) bool) bool {
+			return body(m, pos, func(after int) bool {
+				savedStart, savedEnd := m.captures[start], m.captures[end]
+				if forward {
+					m.captures[start], m.captures[end] = pos, after
+				} else {
+					m.captures[start], m.captures[end] = after, pos
+				}
+				if k(after) {
+					return true
+				}
+				m.captures[start], m.captures[end] = savedStart, savedEnd
+				return false
+			})
+		}
+
+	case *reBackreference:
+		return prog.compileBackreference(n.index, forward)
+
+	case *reLookaround:
+		return prog.compileLookaround(n)
+
+	case *reQuantifier:
+		return prog.compileQuantifier(n, forward)
+	}
+	panic("regexp: unknown node")
+}
+
+func sequenceMatcher(matchers []reMatcher) reMatcher {
+	switch len(matchers) {
+	case 0:
+		return func(m *reMatch, pos int, k func(int) bool) bool {
+			return k(pos)
+		}
+	case 1:
+		return matchers[0]
+	}
+	first, rest := matchers[0], sequenceMatcher(matchers[1:])
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		return first(m, pos, func(next int) bool {
+			return rest(m, next, k)
+		})
+	}
+}
+
+// charTest returns the test a node that matches a single character
+// applies to it.
+func (prog *regexpProgram) charTest(node reNode) func(rune) bool {
+	switch n := node.(type) {
+	case *reCharacter:
+		want := prog.canonicalize(n.ch)
+		return func(ch rune) bool {
+			return ch == n.ch || prog.canonicalize(ch) == want
+		}
+	case *reDot:
+		if prog.dotAll {
+			return func(rune) bool { return true }
+		}
+		return func(ch rune) bool { return !isLineTerminator(ch) }
+	case *reClass:
+		return func(ch rune) bool { return prog.classContains(n, ch) }
+	}
+	return nil
+}
+
+func (prog *regexpProgram) compileAssertion(kind reAssertionKind) reMatcher {
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		var ok bool
+		switch kind {
+		case reLineStart:
+			ok = pos == 0 || prog.multiline && isLineTerminator(rune(m.input[pos-1]))
+		case reLineEnd:
+			ok = pos == len(m.input) || prog.multiline && isLineTerminator(rune(m.input[pos]))
+		case reWordBoundary, reNotWordBoundary:
+			boundary := prog.isWordChar(m.input, pos-1) != prog.isWordChar(m.input, pos)
+			ok = boundary == (kind == reWordBoundary)
+		}
+		return ok && k(pos)
+	}
+}
+
+// compileBackreference matches the text a group captured again, which
+// succeeds trivially when the group did not participate.
+func (prog *regexpProgram) compileBackreference(index int, forward bool) reMatcher {
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		start, end := m.captures[2*index], m.captures[2*index+1]
+		if start < 0 || end < 0 {
+			return k(pos)
+		}
+		captured := m.input[start:end]
+		var candidate []uint16
+		if forward {
+			if pos+len(captured) > len(m.input) {
+				return false
+			}
+			candidate = m.input[pos : pos+len(captured)]
+		} else {
+			if pos-len(captured) < 0 {
+				return false
+			}
+			candidate = m.input[pos-len(captured) : pos]
+		}
+		for at := 0; at < len(captured); {
+			m.step()
+			want, next, _ := prog.readChar(captured, at, true)
+			got, _, _ := prog.readChar(candidate, at, true)
+			if want != got && prog.canonicalize(want) != prog.canonicalize(got) {
+				return false
+			}
+			at = next
+		}
+		if forward {
+			return k(pos + len(captured))
+		}
+		return k(pos - len(captured))
+	}
+}
+
+// compileLookaround checks its body at the current position without
+// consuming input. Groups captured by a successful positive lookaround
+// stay set, while a negative one never leaves captures behind.
+func (prog *regexpProgram) compileLookaround(n *reLookaround) reMatcher {
+	body := prog.compile(n.body, !n.behind)
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		saved := append([]int(nil), m.captures...)
+		matched := body(m, pos, func(int) bool { return true })
+		if n.negated {
+			copy(m.captures, saved)
+			return !matched && k(pos)
+		}
+		if matched && k(pos) {
+			return true
+		}
+		copy(m.captures, saved)
+		return false
+	}
+}
+
+// compileQuantifier follows the RepeatMatcher of the specification: the
+// captures of the groups inside the body are reset before each
+// repetition, and a repetition beyond the minimum that matches the empty
+// string is rejected so that patterns such as (a*)* terminate.
+func (prog *regexpProgram) compileQuantifier(q *reQuantifier, forward bool) reMatcher {
+	switch q.body.(type) {
+	case *reCharacter, *reDot, *reClass:
+		return prog.compileSimpleQuantifier(q, forward)
+	}
+
+	body := prog.compile(q.body, forward)
+	first, last := 2*q.firstGroup, 2*(q.firstGroup+q.groupCount)
+
+	var repeat func(m *reMatch, pos int, k func(int) bool, min, max int) bool
+	repeat = func(m *reMatch, pos int, k func(int) bool, min, max int) bool {
+		m.step()
+		if max == 0 {
+			return k(pos)
+		}
+		next := func(after int) bool {
+			if min == 0 && after == pos {
+				return false
+			}
+			nextMin, nextMax := min, max
+			if nextMin > 0 {
+				nextMin--
+			}
+			if nextMax > 0 {
+				nextMax--
+			}
+			return repeat(m, after, k, nextMin, nextMax)
+		}
+
+		saved := append([]int(nil), m.captures[first:last]...)
+		tryBody := func() bool {
+			for idx := first; idx < last; idx++ {
+				m.captures[idx] = -1
+			}
+			if body(m, pos, next) {
+				return true
+			}
+			copy(m.captures[first:last], saved)
+			return false
+		}
+
+		if min > 0 {
+			return tryBody()
+		}
+		if !q.greedy {
+			return k(pos) || tryBody()
+		}
+		return tryBody() || k(pos)
+	}
+
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		return repeat(m, pos, k, q.min, q.max)
+	}
+}
+
+// compileSimpleQuantifier repeats a body that matches a single character
+// without recursing once per repetition, which keeps long runs such as
+// .* on large inputs cheap.
+func (prog *regexpProgram) compileSimpleQuantifier(q *reQuantifier, forward bool) reMatcher {
+	test := prog.charTest(q.body)
+	return func(m *reMatch, pos int, k func(int) bool) bool {
+		positions := []int{pos}
+		if q.greedy {
+			for q.max < 0 || len(positions)-1 < q.max {
+				m.step()
+				ch, next, ok := prog.readChar(m.input, positions[len(positions)-1], forward)
+				if !ok || !test(ch) {
+					break
+				}
+				positions = append(positions, next)
+			}
+			for count := len(positions) - 1; count >= q.min; count-- {
+				m.step()
+				if k(positions[count]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		for count := 0; ; count++ {
+			m.step()
+			if count >= q.min && k(positions[count]) {
+				return true
+			}
+			if q.max >= 0 && count >= q.max {
+				return false
+			}
+			ch, next, ok := prog.readChar(m.input, positions[count], forward)
+			if !ok || !test(ch) {
+				return false
+			}
+			positions = append(positions, next)
+		}
+	}
+}
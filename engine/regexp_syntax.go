@@ -0,0 +1,895 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// The nodes of a parsed regular expression pattern. Characters are code
+// points in unicode mode and UTF-16 code units otherwise, which is also
+// how the matcher reads its input.
+type reNode interface{}
+
+type reDisjunction struct {
+	alternatives []reNode
+}
+
+type reSequence struct {
+	terms []reNode
+}
+
+// reCharacter matches one character, which with the i flag may differ
+// from ch in case.
+type reCharacter struct {
+	ch rune
+}
+
+// reDot matches any character other than a line terminator, or any
+// character at all with the s flag.
+type reDot struct{}
+
+// reClass is a character class such as [a-z] or an escape such as \d.
+type reClass struct {
+	set     *reCharSet
+	negated bool
+}
+
+type reAssertionKind int
+
+const (
+	reLineStart reAssertionKind = iota
+	reLineEnd
+	reWordBoundary
+	reNotWordBoundary
+)
+
+type reAssertion struct {
+	kind reAssertionKind
+}
+
+// reLookaround is (?=...), (?!...), (?<=...) or (?<!...).
+type reLookaround struct {
+	behind  bool
+	negated bool
+	body    reNode
+}
+
+// reGroup is a group, which captures the text its body matches as group
+// index unless it is a (?:...) group.
+type reGroup struct {
+	capture bool
+	index   int
+	body    reNode
+}
+
+// reBackreference matches the text group index captured. References by
+// name are resolved to an index once the whole pattern has been parsed.
+type reBackreference struct {
+	index int
+	name  string
+}
+
+// reQuantifier repeats its body between min and max times, where a max of
+// -1 is unbounded. firstGroup and groupCount identify the groups inside
+// the body, whose captures are reset on every repetition.
+type reQuantifier struct {
+	body       reNode
+	min, max   int
+	greedy     bool
+	firstGroup int
+	groupCount int
+}
+
+// reCharSet is the set of characters a class matches: ranges of
+// characters plus classes such as \d or \p{L} given as predicates.
+type reCharSet struct {
+	ranges  []reRange
+	classes []func(rune) bool
+}
+
+type reRange struct {
+	lo, hi rune
+}
+
+func (cs *reCharSet) contains(ch rune) bool {
+	for _, r := range cs.ranges {
+		if r.lo <= ch && ch <= r.hi {
+			return true
+		}
+	}
+	for _, class := range cs.classes {
+		if class(ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// reSyntaxError is a malformed pattern. The parser panics with it and
+// parseRegExpPattern returns it.
+type reSyntaxError struct {
+	message string
+}
+
+func (e *reSyntaxError) Error() string {
+	return e.message
+}
+
+// rePattern is a parsed pattern.
+type rePattern struct {
+	root reNode
+	// groupCount counts the capturing groups, not including the whole
+	// match, and groupNames holds the names of named groups by index,
+	// with the empty string for unnamed ones.
+	groupCount int
+	groupNames []string
+}
+
+type reParser struct {
+	src     []rune
+	pos     int
+	unicode bool
+
+	groupCount int
+	groupNames []string
+	// totalGroups and namedGroups are found by a scan before parsing, as
+	// \N and \k<name> may refer to groups that come later.
+	totalGroups int
+	namedGroups bool
+	backrefs    []*reBackreference
+}
+
+// parseRegExpPattern parses a pattern, which in unicode mode (the u flag)
+// follows the strict grammar and otherwise the web-compatible one, where
+// for instance a lone { or an unknown escape stands for itself.
+func parseRegExpPattern(pattern string, unicodeMode bool) (result *rePattern, err error) {
+	p := &reParser{unicode: unicodeMode, groupNames: []string{""}}
+	if unicodeMode {
+		p.src = []rune(pattern)
+	} else {
+		for _, unit := range utf16.Encode([]rune(pattern)) {
+			p.src = append(p.src, rune(unit))
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*reSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, syntaxErr
+		}
+	}()
+
+	p.scanGroups()
+	root := p.parseDisjunction()
+	if p.pos < len(p.src) {
+		if p.src[p.pos] == ')' {
+			p.fail("Unmatched ')'")
+		}
+		p.fail("Unexpected character")
+	}
+	for _, ref := range p.backrefs {
+		if ref.name == "" {
+			continue
+		}
+		ref.index = -1
+		for idx, name := range p.groupNames {
+			if name == ref.name {
+				ref.index = idx
+			}
+		}
+		if ref.index < 0 {
+			p.fail("Invalid named capture referenced")
+		}
+	}
+	return &rePattern{root: root, groupCount: p.groupCount, groupNames: p.groupNames}, nil
+}
+
+func (p *reParser) fail(message string) {
+	panic(&reSyntaxError{message: message})
+}
+
+func (p *reParser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *reParser) peek() rune {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return -1
+}
+
+func (p *reParser) peekAt(offset int) rune {
+	if p.pos+offset < len(p.src) {
+		return p.src[p.pos+offset]
+	}
+	return -1
+}
+
+func (p *reParser) lookingAt(s string) bool {
+	for idx, ch := range []rune(s) {
+		if p.peekAt(idx) != ch {
+			return false
+		}
+	}
+	return true
+}
+
+// scanGroups counts the capturing groups of the pattern and notes whether
+// any of them are named.
+func (p *reParser) scanGroups() {
+	inClass := false
+	for idx := 0; idx < len(p.src); idx++ {
+		switch p.src[idx] {
+		case '\\':
+			idx++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '(':
+			if inClass {
+				continue
+			}
+			if idx+1 < len(p.src) && p.src[idx+1] == '?' {
+				if idx+3 < len(p.src) && p.src[idx+2] == '<' && p.src[idx+3] != '=' && p.src[idx+3] != '!' {
+					p.totalGroups++
+					p.namedGroups = true
+				}
+				continue
+			}
+			p.totalGroups++
+		}
+	}
+}
+
+func (p *reParser) parseDisjunction() reNode {
+	alternatives := []reNode{p.parseAlternative()}
+	for p.peek() == '|' {
+		p.pos++
+		alternatives = append(alternatives, p.parseAlternative())
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return &reDisjunction{alternatives: alternatives}
+}
+
+func (p *reParser) parseAlternative() reNode {
+	seq := &reSequence{}
+	for p.more() && p.peek() != '|' && p.peek() != ')' {
+		seq.terms = append(seq.terms, p.parseTerm())
+	}
+	return seq
+}
+
+func (p *reParser) parseTerm() reNode {
+	switch {
+	case p.peek() == '^':
+		p.pos++
+		return &reAssertion{kind: reLineStart}
+	case p.peek() == '$':
+		p.pos++
+		return &reAssertion{kind: reLineEnd}
+	case p.lookingAt(`\b`):
+		p.pos += 2
+		return &reAssertion{kind: reWordBoundary}
+	case p.lookingAt(`\B`):
+		p.pos += 2
+		return &reAssertion{kind: reNotWordBoundary}
+	case p.lookingAt("(?<=") || p.lookingAt("(?<!"):
+		negated := p.peekAt(3) == '!'
+		p.pos += 4
+		body := p.parseDisjunction()
+		p.expectGroupEnd()
+		return &reLookaround{behind: true, negated: negated, body: body}
+	case p.lookingAt("(?=") || p.lookingAt("(?!"):
+		negated := p.peekAt(2) == '!'
+		groupsBefore := p.groupCount
+		p.pos += 3
+		body := p.parseDisjunction()
+		p.expectGroupEnd()
+		look := &reLookaround{negated: negated, body: body}
+		// Lookaheads can be quantified for web compatibility.
+		if !p.unicode {
+			return p.parseQuantifier(look, groupsBefore)
+		}
+		return look
+	}
+
+	groupsBefore := p.groupCount
+	return p.parseQuantifier(p.parseAtom(), groupsBefore)
+}
+
+func (p *reParser) expectGroupEnd() {
+	if p.peek() != ')' {
+		p.fail("Unterminated group")
+	}
+	p.pos++
+}
+
+func (p *reParser) parseAtom() reNode {
+	ch := p.peek()
+	switch ch {
+	case '.':
+		p.pos++
+		return &reDot{}
+	case '(':
+		return p.parseGroup()
+	case '[':
+		return p.parseClass()
+	case '\\':
+		return p.parseAtomEscape()
+	case '*', '+', '?':
+		p.fail("Nothing to repeat")
+	case '{':
+		if p.unicode {
+			p.fail("Lone quantifier brackets")
+		}
+		if _, _, ok := p.scanBraceQuantifier(); ok {
+			p.fail("Nothing to repeat")
+		}
+	case '}', ']':
+		if p.unicode {
+			p.fail("Lone quantifier brackets")
+		}
+	}
+	p.pos++
+	return &reCharacter{ch: ch}
+}
+
+func (p *reParser) parseGroup() reNode {
+	p.pos++
+	if p.peek() != '?' {
+		p.groupCount++
+		group := &reGroup{capture: true, index: p.groupCount}
+		p.groupNames = append(p.groupNames, "")
+		group.body = p.parseDisjunction()
+		p.expectGroupEnd()
+		return group
+	}
+
+	switch p.peekAt(1) {
+	case ':':
+		p.pos += 2
+		group := &reGroup{body: p.parseDisjunction()}
+		p.expectGroupEnd()
+		return group
+	case '<':
+		p.pos += 2
+		name := p.parseGroupName()
+		for _, existing := range p.groupNames {
+			if existing == name {
+				p.fail("Duplicate capture group name")
+			}
+		}
+		p.groupCount++
+		group := &reGroup{capture: true, index: p.groupCount}
+		p.groupNames = append(p.groupNames, name)
+		group.body = p.parseDisjunction()
+		p.expectGroupEnd()
+		return group
+	}
+	p.fail("Invalid group")
+	return nil
+}
+
+// parseGroupName parses the name of a named group or backreference up to
+// and including the closing >.
+func (p *reParser) parseGroupName() string {
+	var name strings.Builder
+	for p.peek() != '>' {
+		ch := p.peek()
+		valid := ch == '$' || ch == '_' || unicode.IsLetter(ch) || unicode.Is(unicode.Nl, ch)
+		if name.Len() > 0 {
+			valid = valid || unicode.IsDigit(ch) || unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Pc) || ch == '\u200c' || ch == '\u200d'
+		}
+		if !valid {
+			p.fail("Invalid capture group name")
+		}
+		name.WriteRune(ch)
+		p.pos++
+	}
+	p.pos++
+	if name.Len() == 0 {
+		p.fail("Invalid capture group name")
+	}
+	return name.String()
+}
+
+// parseQuantifier parses the quantifier following atom, if any. Groups
+// numbered above groupsBefore are inside the atom.
+func (p *reParser) parseQuantifier(atom reNode, groupsBefore int) reNode {
+	q := &reQuantifier{body: atom, greedy: true, firstGroup: groupsBefore + 1, groupCount: p.groupCount - groupsBefore}
+	switch p.peek() {
+	case '*':
+		q.min, q.max = 0, -1
+		p.pos++
+	case '+':
+		q.min, q.max = 1, -1
+		p.pos++
+	case '?':
+		q.min, q.max = 0, 1
+		p.pos++
+	case '{':
+		min, max, ok := p.scanBraceQuantifier()
+		if !ok {
+			if p.unicode {
+				p.fail("Incomplete quantifier")
+			}
+			return atom
+		}
+		if max >= 0 && max < min {
+			p.fail("numbers out of order in {} quantifier")
+		}
+		q.min, q.max = min, max
+	default:
+		return atom
+	}
+	if p.peek() == '?' {
+		q.greedy = false
+		p.pos++
+	}
+	if _, ok := atom.(*reAssertion); ok {
+		p.fail("Nothing to repeat")
+	}
+	return q
+}
+
+// scanBraceQuantifier parses {n}, {n,} or {n,m} at the current position,
+// consuming it only when it is well formed.
+func (p *reParser) scanBraceQuantifier() (min, max int, ok bool) {
+	pos := p.pos + 1
+	readInt := func() (int, bool) {
+		start := pos
+		for pos < len(p.src) && p.src[pos] >= '0' && p.src[pos] <= '9' {
+			pos++
+		}
+		if pos == start {
+			return 0, false
+		}
+		n, err := strconv.Atoi(string(p.src[start:pos]))
+		if err != nil {
+			n = int(^uint(0) >> 1)
+		}
+		return n, true
+	}
+
+	min, ok = readInt()
+	if !ok {
+		return 0, 0, false
+	}
+	max = min
+	if pos < len(p.src) && p.src[pos] == ',' {
+		pos++
+		max = -1
+		if n, ok := readInt(); ok {
+			max = n
+		}
+	}
+	if pos >= len(p.src) || p.src[pos] != '}' {
+		return 0, 0, false
+	}
+	p.pos = pos + 1
+	return min, max, true
+}
+
+func (p *reParser) parseAtomEscape() reNode {
+	p.pos++
+	if !p.more() {
+		p.fail("\\ at end of pattern")
+	}
+	ch := p.peek()
+
+	switch {
+	case ch >= '1' && ch <= '9':
+		start := p.pos
+		n := 0
+		for p.more() && p.peek() >= '0' && p.peek() <= '9' {
+			n = n*10 + int(p.peek()-'0')
+			p.pos++
+			if n > p.totalGroups {
+				break
+			}
+		}
+		if n <= p.totalGroups {
+			ref := &reBackreference{index: n}
+			p.backrefs = append(p.backrefs, ref)
+			return ref
+		}
+		if p.unicode {
+			p.fail("Invalid escape")
+		}
+		// Without such a group, \N is a legacy octal escape or, for 8
+		// and 9, the digit itself.
+		p.pos = start
+		if ch >= '8' {
+			p.pos++
+			return &reCharacter{ch: ch}
+		}
+		return &reCharacter{ch: p.parseLegacyOctal()}
+	case ch == 'k' && (p.unicode || p.namedGroups):
+		p.pos++
+		if p.peek() != '<' {
+			p.fail("Invalid named reference")
+		}
+		p.pos++
+		ref := &reBackreference{name: p.parseGroupName()}
+		p.backrefs = append(p.backrefs, ref)
+		return ref
+	}
+
+	if set, ok := p.parseClassEscape(); ok {
+		return &reClass{set: set}
+	}
+	return &reCharacter{ch: p.parseCharacterEscape(false)}
+}
+
+// parseClassEscape parses \d, \D, \s, \S, \w, \W and, in unicode mode,
+// \p{...} and \P{...}, after the backslash.
+func (p *reParser) parseClassEscape() (*reCharSet, bool) {
+	var class func(rune) bool
+	negated := unicode.IsUpper(p.peek())
+	switch p.peek() {
+	case 'd', 'D':
+		class = isRegExpDigit
+	case 's', 'S':
+		class = isSpace
+	case 'w', 'W':
+		class = isRegExpWordChar
+	case 'p', 'P':
+		if !p.unicode {
+			return nil, false
+		}
+		class = p.parseUnicodeProperty()
+	default:
+		return nil, false
+	}
+
+	p.pos++
+	if negated {
+		inner := class
+		class = func(ch rune) bool { return !inner(ch) }
+	}
+	return &reCharSet{classes: []func(rune) bool{class}}, true
+}
+
+// parseUnicodeProperty parses the {name} or {name=value} of \p or \P,
+// leaving the closing brace as the current character.
+func (p *reParser) parseUnicodeProperty() func(rune) bool {
+	if p.peekAt(1) != '{' {
+		p.fail("Invalid property name")
+	}
+	start := p.pos + 2
+	end := start
+	for end < len(p.src) && p.src[end] != '}' {
+		end++
+	}
+	if end >= len(p.src) {
+		p.fail("Invalid property name")
+	}
+	name, value, _ := strings.Cut(string(p.src[start:end]), "=")
+	class, ok := lookupUnicodeProperty(name, value)
+	if !ok {
+		p.fail("Invalid property name")
+	}
+	p.pos = end
+	return class
+}
+
+// parseCharacterEscape parses an escape that stands for a single
+// character, after the backslash. In a class, \b is a backspace and, in
+// unicode mode, \- is a hyphen.
+func (p *reParser) parseCharacterEscape(inClass bool) rune {
+	ch := p.peek()
+	p.pos++
+	switch ch {
+	case 't':
+		return '\t'
+	case 'n':
+		return '\n'
+	case 'v':
+		return '\v'
+	case 'f':
+		return '\f'
+	case 'r':
+		return '\r'
+	case 'c':
+		if letter := p.peek(); letter >= 'a' && letter <= 'z' || letter >= 'A' && letter <= 'Z' {
+			p.pos++
+			return letter % 32
+		}
+		if !p.unicode {
+			// \c without a control letter is a backslash followed by c.
+			p.pos -= 2
+			return '\\'
+		}
+	case '0':
+		if next := p.peek(); next >= '0' && next <= '9' {
+			if p.unicode {
+				p.fail("Invalid decimal escape")
+			}
+			p.pos--
+			return p.parseLegacyOctal()
+		}
+		return 0
+	case 'x':
+		if n, ok := p.parseHexDigits(2); ok {
+			return n
+		}
+		if !p.unicode {
+			return 'x'
+		}
+		p.fail("Invalid escape")
+	case 'u':
+		if n, ok := p.parseUnicodeEscape(); ok {
+			return n
+		}
+		if !p.unicode {
+			return 'u'
+		}
+		p.fail("Invalid Unicode escape")
+	case 'b':
+		if inClass {
+			return '\b'
+		}
+	case '-':
+		if inClass {
+			return '-'
+		}
+	}
+
+	if ch >= '1' && ch <= '9' && inClass && !p.unicode {
+		p.pos--
+		if ch >= '8' {
+			p.pos++
+			return ch
+		}
+		return p.parseLegacyOctal()
+	}
+	if p.unicode && !strings.ContainsRune(`^$\.*+?()[]{}|/`, ch) {
+		p.fail("Invalid escape")
+	}
+	return ch
+}
+
+// parseLegacyOctal parses up to three octal digits, whose value is at
+// most 0377.
+func (p *reParser) parseLegacyOctal() rune {
+	n := rune(0)
+	for digits := 0; digits < 3 && p.peek() >= '0' && p.peek() <= '7'; digits++ {
+		next := n*8 + p.peek() - '0'
+		if next > 0377 {
+			break
+		}
+		n = next
+		p.pos++
+	}
+	return n
+}
+
+func (p *reParser) parseHexDigits(count int) (rune, bool) {
+	if p.pos+count > len(p.src) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(p.src[p.pos:p.pos+count]), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	p.pos += count
+	return rune(n), true
+}
+
+// parseUnicodeEscape parses the rest of \uXXXX or, in unicode mode,
+// \u{X...}. A surrogate pair written as two escapes is one character in
+// unicode mode.
+func (p *reParser) parseUnicodeEscape() (rune, bool) {
+	if p.unicode && p.peek() == '{' {
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != '}' {
+			end++
+		}
+		n, err := strconv.ParseUint(string(p.src[p.pos+1:end]), 16, 32)
+		if end >= len(p.src) || err != nil || n > unicode.MaxRune {
+			return 0, false
+		}
+		p.pos = end + 1
+		return rune(n), true
+	}
+
+	n, ok := p.parseHexDigits(4)
+	if !ok {
+		return 0, false
+	}
+	if p.unicode && utf16.IsSurrogate(n) && n < 0xdc00 && p.lookingAt(`\u`) {
+		saved := p.pos
+		p.pos += 2
+		if low, ok := p.parseHexDigits(4); ok && low >= 0xdc00 && low <= 0xdfff {
+			return utf16.DecodeRune(n, low), true
+		}
+		p.pos = saved
+	}
+	return n, true
+}
+
+func (p *reParser) parseClass() reNode {
+	p.pos++
+	class := &reClass{set: &reCharSet{}}
+	if p.peek() == '^' {
+		class.negated = true
+		p.pos++
+	}
+
+	for p.peek() != ']' {
+		if !p.more() {
+			p.fail("Unterminated character class")
+		}
+		lo, loSet := p.parseClassAtom()
+		if p.peek() != '-' || p.peekAt(1) == ']' || p.peekAt(1) == -1 {
+			p.addClassAtom(class.set, lo, loSet)
+			continue
+		}
+		p.pos++
+		hi, hiSet := p.parseClassAtom()
+		if loSet != nil || hiSet != nil {
+			if p.unicode {
+				p.fail("Invalid character class")
+			}
+			p.addClassAtom(class.set, lo, loSet)
+			p.addClassAtom(class.set, '-', nil)
+			p.addClassAtom(class.set, hi, hiSet)
+			continue
+		}
+		if lo > hi {
+			p.fail("Range out of order in character class")
+		}
+		class.set.ranges = append(class.set.ranges, reRange{lo: lo, hi: hi})
+	}
+	p.pos++
+	return class
+}
+
+// parseClassAtom parses one character of a class, or a class escape such
+// as \d, which it returns as a set instead.
+func (p *reParser) parseClassAtom() (rune, *reCharSet) {
+	ch := p.peek()
+	p.pos++
+	if ch != '\\' {
+		return ch, nil
+	}
+	if !p.more() {
+		p.fail("\\ at end of pattern")
+	}
+	if set, ok := p.parseClassEscape(); ok {
+		return 0, set
+	}
+	return p.parseCharacterEscape(true), nil
+}
+
+func (p *reParser) addClassAtom(set *reCharSet, ch rune, atomSet *reCharSet) {
+	if atomSet != nil {
+		set.classes = append(set.classes, atomSet.classes...)
+		return
+	}
+	set.ranges = append(set.ranges, reRange{lo: ch, hi: ch})
+}
+
+func isRegExpDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isRegExpWordChar(ch rune) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_'
+}
+
+func isLineTerminator(ch rune) bool {
+	return ch == '\n' || ch == '\r' || ch == '\u2028' || ch == '\u2029'
+}
+
+// generalCategoryAliases maps the long names of general categories to the
+// short ones the unicode package uses.
+var generalCategoryAliases = map[string]string{
+	"Letter": "L", "Cased_Letter": "LC", "Uppercase_Letter": "Lu", "Lowercase_Letter": "Ll",
+	"Titlecase_Letter": "Lt", "Modifier_Letter": "Lm", "Other_Letter": "Lo",
+	"Mark": "M", "Combining_Mark": "M", "Nonspacing_Mark": "Mn", "Spacing_Mark": "Mc", "Enclosing_Mark": "Me",
+	"Number": "N", "Decimal_Number": "Nd", "digit": "Nd", "Letter_Number": "Nl", "Other_Number": "No",
+	"Punctuation": "P", "punct": "P", "Connector_Punctuation": "Pc", "Dash_Punctuation": "Pd",
+	"Open_Punctuation": "Ps", "Close_Punctuation": "Pe", "Initial_Punctuation": "Pi",
+	"Final_Punctuation": "Pf", "Other_Punctuation": "Po",
+	"Symbol": "S", "Math_Symbol": "Sm", "Currency_Symbol": "Sc", "Modifier_Symbol": "Sk", "Other_Symbol": "So",
+	"Separator": "Z", "Space_Separator": "Zs", "Line_Separator": "Zl", "Paragraph_Separator": "Zp",
+	"Other": "C", "Control": "Cc", "cntrl": "Cc", "Format": "Cf", "Unassigned": "Cn",
+	"Private_Use": "Co", "Surrogate": "Cs",
+}
+
+// scriptAliases maps the short names of common scripts to the long ones
+// the unicode package uses.
+var scriptAliases = map[string]string{
+	"Arab": "Arabic", "Armn": "Armenian", "Beng": "Bengali", "Cyrl": "Cyrillic", "Deva": "Devanagari",
+	"Ethi": "Ethiopic", "Geor": "Georgian", "Grek": "Greek", "Gujr": "Gujarati", "Guru": "Gurmukhi",
+	"Hang": "Hangul", "Hani": "Han", "Hebr": "Hebrew", "Hira": "Hiragana", "Kana": "Katakana",
+	"Khmr": "Khmer", "Knda": "Kannada", "Laoo": "Lao", "Latn": "Latin", "Mlym": "Malayalam",
+	"Mong": "Mongolian", "Mymr": "Myanmar", "Orya": "Oriya", "Sinh": "Sinhala", "Taml": "Tamil",
+	"Telu": "Telugu", "Thaa": "Thaana", "Tibt": "Tibetan", "Zinh": "Inherited", "Zyyy": "Common",
+}
+
+// lookupUnicodeProperty returns the predicate for \p{name} or
+// \p{name=value}: a general category, a script or a binary property.
+// Script_Extensions is approximated by Script.
+func lookupUnicodeProperty(name, value string) (func(rune) bool, bool) {
+	if value != "" {
+		switch name {
+		case "General_Category", "gc":
+			return generalCategory(value)
+		case "Script", "sc", "Script_Extensions", "scx":
+			if long, ok := scriptAliases[value]; ok {
+				value = long
+			}
+			if table, ok := unicode.Scripts[value]; ok {
+				return func(ch rune) bool { return unicode.Is(table, ch) }, true
+			}
+		}
+		return nil, false
+	}
+
+	if class, ok := generalCategory(name); ok {
+		return class, true
+	}
+	switch name {
+	case "Any":
+		return func(rune) bool { return true }, true
+	case "ASCII":
+		return func(ch rune) bool { return ch < 0x80 }, true
+	case "Assigned":
+		unassigned, _ := generalCategory("Cn")
+		return func(ch rune) bool { return !unassigned(ch) }, true
+	case "Alphabetic", "Alpha":
+		return func(ch rune) bool {
+			return unicode.IsLetter(ch) || unicode.In(ch, unicode.Nl, unicode.Other_Alphabetic)
+		}, true
+	case "Uppercase", "Upper":
+		return func(ch rune) bool { return unicode.In(ch, unicode.Lu, unicode.Other_Uppercase) }, true
+	case "Lowercase", "Lower":
+		return func(ch rune) bool { return unicode.In(ch, unicode.Ll, unicode.Other_Lowercase) }, true
+	case "White_Space", "space":
+		return func(ch rune) bool { return unicode.Is(unicode.White_Space, ch) }, true
+	}
+	if table, ok := unicode.Properties[name]; ok && !strings.HasPrefix(name, "Other_") {
+		return func(ch rune) bool { return unicode.Is(table, ch) }, true
+	}
+	return nil, false
+}
+
+// generalCategory returns the predicate for a general category, including
+// LC and Cn, which the unicode package has no tables for.
+func generalCategory(name string) (func(rune) bool, bool) {
+	if short, ok := generalCategoryAliases[name]; ok {
+		name = short
+	}
+	switch name {
+	case "LC":
+		return func(ch rune) bool { return unicode.In(ch, unicode.Lu, unicode.Ll, unicode.Lt) }, true
+	case "Cn":
+		return func(ch rune) bool { return !isAssigned(ch) }, true
+	case "C":
+		return func(ch rune) bool { return unicode.Is(unicode.C, ch) || !isAssigned(ch) }, true
+	}
+	if table, ok := unicode.Categories[name]; ok {
+		return func(ch rune) bool { return unicode.Is(table, ch) }, true
+	}
+	return nil, false
+}
+
+func isAssigned(ch rune) bool {
+	for _, table := range unicode.Categories {
+		if unicode.Is(table, ch) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegExp(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// Literals and the constructor.
+		{`/a+/.test("caab")`, "true"},
+		{`/a+/.test("bcd")`, "false"},
+		{`let re = /a/; 6 / 2 / 3`, "1"},
+		{`new RegExp("b+", "g").source + " " + RegExp("b+", "g").flags`, "b+ g"},
+		{`/a\/b/.source`, `a\/b`},
+		{`/x/gi.toString()`, "/x/gi"},
+		{`new RegExp("").source`, "(?:)"},
+
+		// Flags.
+		{`/x/yusmigd.flags`, "dgimsuy"},
+		{`let re = /x/dgimsuy; "" + re.hasIndices + re.global + re.ignoreCase + re.multiline + re.dotAll + re.unicode + re.sticky`, "truetruetruetruetruetruetrue"},
+		{`let re = /x/; "" + re.global + re.sticky`, "falsefalse"},
+		{`/ABC/i.test("xabcx")`, "true"},
+		{"/^b$/.test(\"a\nb\nc\")", "false"},
+		{"/^b$/m.test(\"a\nb\nc\")", "true"},
+		{"/a.c/.test(\"a\nc\")", "false"},
+		{"/a.c/s.test(\"a\nc\")", "true"},
+		{`/^.$/.test("😀")`, "false"},
+		{`/^.$/u.test("😀")`, "true"},
+		{`let m = /b(c)/d.exec("abcd"); m.indices[0][0] + "," + m.indices[0][1] + "," + m.indices[1][0]`, "1,3,2"},
+		{`/b(c)/.exec("abcd").indices`, "undefined"},
+
+		// Global and sticky matching and lastIndex.
+		{`let re = /o/g; re.exec("foo").index + "," + re.lastIndex + "," + re.exec("foo").index + "," + re.lastIndex`, "1,2,2,3"},
+		{`let re = /o/g; re.exec("foo"); re.exec("foo"); re.exec("foo") + "," + re.lastIndex`, "null,0"},
+		{`let re = /o/; re.exec("foo"); re.lastIndex`, "0"},
+		{`let re = /o/g; re.lastIndex = 2; re.exec("foo").index`, "2"},
+		{`let re = /o/y; re.test("foo")`, "false"},
+		{`let re = /o/y; re.lastIndex = 1; re.test("foo") + "," + re.lastIndex`, "true,2"},
+		{`let re = /o/y; re.lastIndex = 3; re.test("foo") + "," + re.lastIndex`, "false,0"},
+
+		// Groups and backreferences.
+		{`let m = /(\d+)-(\d+)/.exec("tel 555-1234"); m[0] + "|" + m[1] + "|" + m[2] + "|" + m.index + "|" + m.input`, "555-1234|555|1234|4|tel 555-1234"},
+		{`let m = /a(x)?b/.exec("ab"); m[1]`, "undefined"},
+		{`/(a)(?:b)(c)/.exec("abc").length`, "3"},
+		{`/(\w)\1/.exec("abccd")[0]`, "cc"},
+		{`/^(a+)b\1$/.test("aabaa")`, "true"},
+		{`/^(a+)b\1$/.test("aaba")`, "false"},
+		{`/\1(a)/.exec("a")[0]`, "a"},
+		{`/(?<year>\d{4})-(?<month>\d{2})/.exec("on 2024-05").groups.month`, "05"},
+		{`/(?<q>[ab]).*?\k<q>/.exec("xaybzaw")[0]`, "aybza"},
+		{`/(a)/.exec("a").groups`, "undefined"},
+		{`let m = /(?<x>a)|(?<y>b)/d.exec("b"); m.groups.x + "," + m.indices.groups.y[0]`, "undefined,0"},
+
+		// Lookaround.
+		{`/\d+(?=%)/.exec("10 of 25%")[0]`, "25"},
+		{`/\d+(?!%)/.exec("25% of 10")[0]`, "2"},
+		{`/(?<=\$)\d+/.exec("cost: $42")[0]`, "42"},
+		{`/(?<!\$)\b\d+/.exec("$4 or 7")[0]`, "7"},
+		{`/(?<=(\d)(\d))x/.exec("12x")[1] + /(?<=(\d)(\d))x/.exec("12x")[2]`, "12"},
+		{`/(?<=\1(a))b/.exec("aab")[0]`, "b"},
+
+		// Classes, quantifiers and alternation.
+		{`/[a-c]+/.exec("xxbcay")[0]`, "bca"},
+		{`/[^a-c]+/.exec("abxyc")[0]`, "xy"},
+		{`/a{2,3}/.exec("aaaa")[0]`, "aaa"},
+		{`/a{2,3}?/.exec("aaaa")[0]`, "aa"},
+		{`/a|ab/.exec("ab")[0]`, "a"},
+		{`/\bfoo\b/.test("a foo b") + "," + /\bfoo\b/.test("afoob")`, "true,false"},
+		{`/\s\S\w\W\d\D/.test(" x_!1a")`, "true"},
+		{`/(a*)*b/.test("aaab")`, "true"},
+
+		// Unicode property escapes.
+		{`/^\p{Lu}+$/u.test("ÀBC")`, "true"},
+		{`/^\p{Lu}+$/u.test("Abc")`, "false"},
+		{`/\P{L}/u.exec("ab1")[0]`, "1"},
+		{`/\p{Script=Greek}/u.exec("abc αβγ")[0]`, "α"},
+		{`/\p{White_Space}/u.exec("a　b")[0] == "　"`, "true"},
+		{`/\u{1F600}/u.test("😀")`, "true"},
+		{`/^[😀]$/u.test("😀") + "," + /^[😀]$/.test("😀")`, "true,false"},
+
+		// Errors.
+		{`/(/`, "SyntaxError"},
+		{`new RegExp("a", "gg")`, "SyntaxError: Invalid flags supplied to RegExp constructor 'gg'"},
+		{`new RegExp("a", "x")`, "SyntaxError: Invalid flags supplied to RegExp constructor 'x'"},
+		{`new RegExp("\\p{Nope}", "u")`, "SyntaxError: Invalid regular expression"},
+		{`new RegExp("(?<n>a)(?<n>b)")`, "SyntaxError: Invalid regular expression"},
+		{`RegExp.prototype.exec.call({}, "a")`, "TypeError: RegExp.prototype.exec requires that 'this' be a RegExp object"},
+	}
+	for _, tt := range tests {
+		v, err := NewInterpreter().Eval(tt.src)
+		got := v.ToString()
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.Contains(got, tt.want) || err == nil && got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRegExpStepLimit(t *testing.T) {
+	i := NewInterpreter()
+	i.SetRegExpStepLimit(10000)
+	_, err := i.Eval(`/^(a+)+$/.test("aaaaaaaaaaaaaaaaaaaaaaaaaaaaab")`)
+	if err == nil || !strings.Contains(err.Error(), "RangeError: Maximum regular expression backtracking exceeded") {
+		t.Fatalf("catastrophic backtracking = %v, want a RangeError", err)
+	}
+
+	// The limit applies to each match, not to the interpreter as a whole.
+	v, err := i.Eval(`/^(a+)+$/.test("aaaa") + "," + /^(a+)+$/.test("aaaa")`)
+	if err != nil || v.ToString() != "true,true" {
+		t.Errorf("matches after the limit was reached = %s %v, want true,true", v.ToString(), err)
+	}
+}
+
+func TestRegExpMatchIsInterrupted(t *testing.T) {
+	i := NewInterpreter()
+	i.SetRegExpStepLimit(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := i.EvalContext(ctx, `/^(a+)+$/.test("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab")`)
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the match interrupted by the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the match stopped after %v", elapsed)
+	}
+}
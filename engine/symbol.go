@@ -0,0 +1,187 @@
+package engine
+
+// Property keys are string values for names and symbol values for
+// symbols. Named properties live in Properties and symbol-keyed ones in
+// the object's symbols map.
+
+func stringKey(name string) Value {
+	return Value{Type: TypeString, Data: name}
+}
+
+func symbolKey(sym *Symbol) Value {
+	return Value{Type: TypeSymbol, Data: sym}
+}
+
+// getOwnMember is getOwnProperty for a property key.
+func (i *Interpreter) getOwnMember(obj Value, key Value) (Value, bool) {
+	if key.Type == TypeSymbol {
+		return ownSlot(obj, key)
+	}
+	return i.getOwnProperty(obj, key.Data.(string))
+}
+
+// ownSlot reads the property of obj stored under key, without the
+// properties functions compute on demand.
+func ownSlot(obj Value, key Value) (Value, bool) {
+	if obj.Object == nil {
+		return Undefined, false
+	}
+	if key.Type != TypeSymbol {
+		prop, ok := obj.Object.Properties[key.Data.(string)]
+		return prop, ok
+	}
+	prop, ok := obj.Object.symbols[key.Data.(*Symbol)]
+	return prop, ok
+}
+
+// setSymbolSlot stores a symbol-keyed property of obj.
+func setSymbolSlot(obj Value, sym *Symbol, val Value) {
+	if obj.Object == nil {
+		return
+	}
+	if obj.Object.symbols == nil {
+		obj.Object.symbols = make(map[*Symbol]Value)
+	}
+	obj.Object.symbols[sym] = val
+}
+
+// setOwnMember defines or overwrites the own property key of obj,
+// bypassing setters.
+func setOwnMember(obj Value, key Value, val Value) {
+	if key.Type == TypeSymbol {
+		setSymbolSlot(obj, key.Data.(*Symbol), val)
+		return
+	}
+	obj.Object.Properties[key.Data.(string)] = val
+}
+
+// defineSymbolMethod is defineMethod for a method keyed by a symbol, such
+// as [Symbol.iterator].
+func (i *Interpreter) defineSymbolMethod(obj Value, sym *Symbol, name string, length int, fn func(this Value, args []Value) Value) {
+	setSymbolSlot(obj, sym, i.newNativeFunction(name, length, fn))
+	setAttributes(obj, symbolKey(sym), nonEnumerable)
+}
+
+// functionNameForKey returns the name a function defined under key gets:
+// the name itself, or the symbol's description in brackets.
+func functionNameForKey(key Value) string {
+	if key.Type != TypeSymbol {
+		return key.ToString()
+	}
+	if description := key.Data.(*Symbol).Description; description.Type != TypeUndefined {
+		return "[" + description.ToString() + "]"
+	}
+	return ""
+}
+
+// thisSymbol returns the symbol a Symbol.prototype method was called on.
+func (i *Interpreter) thisSymbol(this Value, method string) *Symbol {
+	return i.thisPrimitive(this, TypeSymbol, "Symbol.prototype."+method).Data.(*Symbol)
+}
+
+// newSymbol creates a symbol, counting it against the memory limit.
+func (i *Interpreter) newSymbol(description Value) *Symbol {
+	i.allocate(objectSize)
+	return &Symbol{Description: description}
+}
+
+// setupSymbol defines the Symbol function, which creates symbols but is
+// not a constructor, and the well-known symbols the engine consults.
+func (i *Interpreter) setupSymbol() {
+	i.symbolRegistry = make(map[string]*Symbol)
+
+	symbol := i.newNativeFunction("Symbol", 0, func(this Value, args []Value) Value {
+		description := argument(args, 0)
+		if description.Type != TypeUndefined {
+			description = Value{Type: TypeString, Data: description.ToString()}
+		}
+		return symbolKey(i.newSymbol(description))
+	})
+
+	i.symbolPrototype = i.newObject()
+	symbol.Object.Properties["prototype"] = i.symbolPrototype
+	i.symbolPrototype.Object.Properties["constructor"] = symbol
+	i.defineMethod(i.symbolPrototype, "toString", 0, func(this Value, args []Value) Value {
+		return Value{Type: TypeString, Data: i.thisSymbol(this, "toString").descriptiveString()}
+	})
+	i.defineMethod(i.symbolPrototype, "valueOf", 0, func(this Value, args []Value) Value {
+		return symbolKey(i.thisSymbol(this, "valueOf"))
+	})
+	description := i.newNativeFunction("get description", 0, func(this Value, args []Value) Value {
+		return i.thisSymbol(this, "description").Description
+	})
+	i.symbolPrototype.Object.Properties["description"] = Value{Type: TypeAccessor, Data: &Accessor{Get: description, Set: Undefined}}
+	i.defineSymbolMethod(i.symbolPrototype, symbolToPrimitive, "[Symbol.toPrimitive]", 1, func(this Value, args []Value) Value {
+		return symbolKey(i.thisSymbol(this, "[Symbol.toPrimitive]"))
+	})
+	setSymbolSlot(i.symbolPrototype, symbolToStringTag, Value{Type: TypeString, Data: "Symbol"})
+
+	i.defineMethod(symbol, "for", 1, func(this Value, args []Value) Value {
+		key := argument(args, 0).ToString()
+		sym, ok := i.symbolRegistry[key]
+		if !ok {
+			sym = i.newSymbol(Value{Type: TypeString, Data: key})
+			i.symbolRegistry[key] = sym
+		}
+		return symbolKey(sym)
+	})
+	i.defineMethod(symbol, "keyFor", 1, func(this Value, args []Value) Value {
+		sym := argument(args, 0)
+		if sym.Type != TypeSymbol {
+			i.throwError("TypeError", "%s is not a symbol", sym.ToString())
+		}
+		if registered, ok := i.symbolRegistry[sym.Data.(*Symbol).Description.ToString()]; ok && registered == sym.Data {
+			return registered.Description
+		}
+		return Undefined
+	})
+
+	symbol.Object.Properties["hasInstance"] = symbolKey(symbolHasInstance)
+	symbol.Object.Properties["iterator"] = symbolKey(symbolIterator)
+	symbol.Object.Properties["toPrimitive"] = symbolKey(symbolToPrimitive)
+	symbol.Object.Properties["toStringTag"] = symbolKey(symbolToStringTag)
+
+	i.defineSymbolMethod(i.functionPrototype, symbolHasInstance, "[Symbol.hasInstance]", 1, func(this Value, args []Value) Value {
+		return Value{Type: TypeBoolean, Data: i.ordinaryHasInstance(this, argument(args, 0))}
+	})
+
+	i.env.Set("Symbol", symbol)
+}
+
+// objectToString implements Object.prototype.toString, which describes
+// its this value by its Symbol.toStringTag, if it has one.
+func (i *Interpreter) objectToString(this Value, args []Value) Value {
+	var builtinTag string
+	switch this.Type {
+	case TypeUndefined:
+		return Value{Type: TypeString, Data: "[object Undefined]"}
+	case TypeNull:
+		return Value{Type: TypeString, Data: "[object Null]"}
+	case TypeNumber:
+		builtinTag = "Number"
+	case TypeString:
+		builtinTag = "String"
+	case TypeBoolean:
+		builtinTag = "Boolean"
+	case TypeFunction:
+		builtinTag = "Function"
+	default:
+		builtinTag = "Object"
+		if this.Data == "Array" {
+			builtinTag = "Array"
+		}
+		switch this.Data.(type) {
+		case *RegExp:
+			builtinTag = "RegExp"
+		case *errorData:
+			builtinTag = "Error"
+		}
+		if wrapper, ok := this.Data.(*primitiveObject); ok && primitiveTypeNames[wrapper.value.Type] != "" {
+			builtinTag = primitiveTypeNames[wrapper.value.Type]
+		}
+	}
+	if tag := i.getMember(this, symbolKey(symbolToStringTag)); tag.Type == TypeString {
+		builtinTag = tag.Data.(string)
+	}
+	return Value{Type: TypeString, Data: "[object " + builtinTag + "]"}
+}
@@ -0,0 +1,43 @@
+package engine
+
+import "testing"
+
+func TestSymbols(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`typeof Symbol()`, "symbol"},
+		{`Symbol("a") === Symbol("a")`, "false"},
+		{`let s = Symbol("a"); s === s`, "true"},
+		{`Symbol("d").description + "," + Symbol().description`, "d,undefined"},
+		{`Symbol("d").toString()`, "Symbol(d)"},
+		{`Symbol.for("k") === Symbol.for("k")`, "true"},
+		{`Symbol.keyFor(Symbol.for("k")) + "," + Symbol.keyFor(Symbol("k"))`, "k,undefined"},
+		{`let s = Symbol("k"); let o = {}; o[s] = 1; o[s] + "," + o.k + "," + Reflect.ownKeys(o).length`, "1,undefined,1"},
+		{`let s = Symbol(); let o = {[s]: 2, a: 1}; Reflect.ownKeys(o)[0] + "," + (Reflect.ownKeys(o)[1] === s)`, "a,true"},
+		{`let o = {[Symbol.toPrimitive](hint) { return hint; }}; let r = {}; r[o] = 1; (+o) + "," + ("" + o) + "," + Reflect.ownKeys(r)[0]`, "NaN,default,string"},
+		{`let o = {[Symbol.toStringTag]: "Thing"}; Object.prototype.toString.call(o)`, "[object Thing]"},
+		{`let Even = {[Symbol.hasInstance](n) { return n % 2 == 0; }}; (2 instanceof Even) + "," + (3 instanceof Even)`, "true,false"},
+		{`let it = {[Symbol.iterator]() { let n = 0; return {next() { n = n + 1; return {value: n, done: n > 2}; }}; }}; function* g() { return yield* it; } let x = g(); x.next().value + x.next().value`, "3"},
+		{`typeof Symbol.iterator + "," + typeof Symbol.asyncIterator`, "symbol,undefined"},
+		{`Symbol() + ""`, "Uncaught TypeError: Cannot convert a Symbol value to a string"},
+		{`Symbol() * 2`, "Uncaught TypeError: Cannot convert a Symbol value to a number"},
+		{`new Symbol()`, "Uncaught TypeError: Symbol is not a constructor"},
+		{`Symbol.prototype.toString.call(1)`, "Uncaught TypeError: Symbol.prototype.toString requires that 'this' be a Symbol"},
+	}
+	for _, treeWalking := range []bool{false, true} {
+		for _, tt := range tests {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(tt.src)
+			got := v.ToString()
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("%s (tree walking %t) = %s, want %s", tt.src, treeWalking, got, tt.want)
+			}
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package engine
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 type ValueType int
 
@@ -13,13 +19,80 @@ const (
 	TypeFunction
 	TypeObject
 	TypeReturn
+	TypeAccessor
+	TypeSymbol
+	TypeBigInt
 )
 
+// Value is a JavaScript value. Primitives are held in Data, while objects
+// and functions are references to an Object, so that copies of the Value
+// all see the same properties and compare as the same object.
 type Value struct {
-	Type       ValueType
-	Data       interface{}
-	value      bool
+	Type  ValueType
+	Data  interface{}
+	value bool
+	// Object is the object a value of TypeObject or TypeFunction refers
+	// to. It is allocated once per object and is its identity. Data holds
+	// the object's kind, such as the *Function of a function or "Array".
+	Object *Object
+}
+
+// Object holds the properties and internal slots of an object.
+type Object struct {
+	// Properties holds the object's string-keyed properties.
 	Properties map[string]Value
+	// Prototype is [[Prototype]]; undefined stands for the intrinsic
+	// default of the value's type.
+	Prototype Value
+	// private holds the object's private fields, methods and accessors.
+	private map[*PrivateName]Value
+	// symbols holds the object's symbol-keyed properties, which Properties
+	// cannot, being keyed by strings.
+	symbols map[*Symbol]Value
+	// attributes holds the attributes of the properties that are not
+	// writable, enumerable and configurable.
+	attributes map[propertyKey]propertyAttributes
+	// nonExtensible is set once properties can no longer be added.
+	nonExtensible bool
+	// interpreter is the interpreter whose script created the object, or
+	// nil for objects the host created.
+	interpreter *Interpreter
+}
+
+// Symbol is the identity of a symbol value. Every call of Symbol() creates
+// a new one, while Symbol.for returns the one registered under its key.
+type Symbol struct {
+	// Description is undefined for symbols created without one.
+	Description Value
+}
+
+// descriptiveString renders a symbol the way String(symbol) does.
+func (s *Symbol) descriptiveString() string {
+	if s.Description.Type == TypeUndefined {
+		return "Symbol()"
+	}
+	return "Symbol(" + s.Description.ToString() + ")"
+}
+
+// The well-known symbols are shared by all interpreters. Symbol.asyncIterator
+// is left out, since nothing in the engine iterates asynchronously: it has
+// neither for await nor async generators.
+var (
+	symbolHasInstance = &Symbol{Description: Value{Type: TypeString, Data: "Symbol.hasInstance"}}
+	symbolIterator    = &Symbol{Description: Value{Type: TypeString, Data: "Symbol.iterator"}}
+	symbolToPrimitive = &Symbol{Description: Value{Type: TypeString, Data: "Symbol.toPrimitive"}}
+	symbolToStringTag = &Symbol{Description: Value{Type: TypeString, Data: "Symbol.toStringTag"}}
+)
+
+// NewBigInt returns a BigInt value. The value must not be modified
+// afterwards, since BigInts are immutable.
+func NewBigInt(x *big.Int) Value {
+	return Value{Type: TypeBigInt, Data: x}
+}
+
+// NewSymbol returns a new symbol with the given description.
+func NewSymbol(description string) Value {
+	return Value{Type: TypeSymbol, Data: &Symbol{Description: Value{Type: TypeString, Data: description}}}
 }
 
 var Undefined = Value{Type: TypeUndefined}
@@ -31,7 +104,7 @@ func (v Value) ToString() string {
 	case TypeNull:
 		return "null"
 	case TypeNumber:
-		return fmt.Sprintf("%v", v.Data)
+		return numberToString(v.Data.(float64))
 	case TypeString:
 		return v.Data.(string)
 	case TypeBoolean:
@@ -42,7 +115,20 @@ func (v Value) ToString() string {
 	case TypeFunction:
 		return "[Function]"
 	case TypeObject:
+		switch data := v.Data.(type) {
+		case *RegExp:
+			return data.String()
+		case *errorData:
+			return errorString(v)
+		}
+		if v.Data == "Array" {
+			return joinElements(v, nil)
+		}
 		return "[object Object]"
+	case TypeSymbol:
+		return v.Data.(*Symbol).descriptiveString()
+	case TypeBigInt:
+		return v.Data.(*big.Int).String()
 	case TypeReturn:
 		if ret, ok := v.Data.(*ReturnValue); ok {
 			return ret.Value.ToString()
@@ -53,12 +139,87 @@ func (v Value) ToString() string {
 	}
 }
 
+// errorString formats an error object as Error.prototype.toString does,
+// from the data properties it and its prototypes have.
+func errorString(err Value) string {
+	name, message := "Error", ""
+	if v, ok := errorField(err, "name"); ok && v.Type != TypeUndefined {
+		name = v.ToString()
+	}
+	if v, ok := errorField(err, "message"); ok && v.Type != TypeUndefined {
+		message = v.ToString()
+	}
+	switch {
+	case name == "":
+		return message
+	case message == "":
+		return name
+	}
+	return name + ": " + message
+}
+
+// joinElements formats an array as Array.prototype.join does with its
+// default separator, from the own data properties of the array and of
+// the arrays inside it. visiting holds the arrays being joined, an array
+// inside itself joining as an empty string.
+func joinElements(arr Value, visiting []*Object) string {
+	for _, obj := range visiting {
+		if obj == arr.Object {
+			return ""
+		}
+	}
+	visiting = append(visiting, arr.Object)
+	var b strings.Builder
+	length := min(toLength(arr.Object.Properties["length"]), maxListLength)
+	for idx := 0; idx < length; idx++ {
+		if idx > 0 {
+			b.WriteByte(',')
+		}
+		el := arr.Object.Properties[strconv.Itoa(idx)]
+		switch {
+		case isNullish(el) || el.Type == TypeAccessor:
+		case el.Type == TypeObject && el.Data == "Array" && el.Object != nil:
+			b.WriteString(joinElements(el, visiting))
+		default:
+			b.WriteString(el.ToString())
+		}
+	}
+	return b.String()
+}
+
+// TypeOf returns the result of the typeof operator for the value.
+func (v Value) TypeOf() string {
+	switch v.Type {
+	case TypeUndefined:
+		return "undefined"
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeBoolean:
+		return "boolean"
+	case TypeFunction:
+		return "function"
+	case TypeSymbol:
+		return "symbol"
+	case TypeBigInt:
+		return "bigint"
+	default:
+		return "object"
+	}
+}
+
+// ToNumber converts a primitive to a number: undefined is NaN, null and
+// false are 0, true is 1 and strings are parsed as numeric literals.
+// Objects, which need their methods called to be converted, are NaN.
 func (v Value) ToNumber() float64 {
 	switch v.Type {
+	case TypeUndefined:
+		return math.NaN()
 	case TypeNumber:
 		return v.Data.(float64)
 	case TypeString:
-		return 0
+		return stringToNumber(v.Data.(string))
 	case TypeBoolean:
 		if v.Data != nil {
 			if v.Data.(bool) {
@@ -68,9 +229,28 @@ func (v Value) ToNumber() float64 {
 			return 1
 		}
 		return 0
+	case TypeBigInt:
+		f, _ := new(big.Float).SetInt(v.Data.(*big.Int)).Float64()
+		return f
+	case TypeNull:
+		return 0
 	default:
+		return math.NaN()
+	}
+}
+
+// toInt32 converts a value to a number and then to a 32-bit integer the
+// way the bitwise operators do, wrapping around modulo 2^32.
+func toInt32(v Value) int32 {
+	return int32(toUint32(v))
+}
+
+func toUint32(v Value) uint32 {
+	f := v.ToNumber()
+	if math.IsNaN(f) || math.IsInf(f, 0) {
 		return 0
 	}
+	return uint32(int64(math.Mod(math.Trunc(f), 1<<32)))
 }
 
 func (v Value) ToBoolean() bool {
@@ -84,6 +264,8 @@ func (v Value) ToBoolean() bool {
 		return v.Data.(float64) != 0
 	case TypeString:
 		return v.Data.(string) != ""
+	case TypeBigInt:
+		return v.Data.(*big.Int).Sign() != 0
 	case TypeNull, TypeUndefined:
 		return false
 	default:
@@ -91,6 +273,8 @@ func (v Value) ToBoolean() bool {
 	}
 }
 
+// Equals reports whether two values are strictly equal, as === compares
+// them.
 func (v Value) Equals(other Value) bool {
 	if v.Type != other.Type {
 		return false
@@ -107,148 +291,372 @@ func (v Value) Equals(other Value) bool {
 		return v.value == other.value
 	case TypeNull, TypeUndefined:
 		return true
+	case TypeSymbol:
+		return v.Data == other.Data
+	case TypeBigInt:
+		return v.Data.(*big.Int).Cmp(other.Data.(*big.Int)) == 0
+	case TypeObject, TypeFunction:
+		return sameObject(v, other)
 	default:
 		return false
 	}
 }
 
+// looselyEqual implements IsLooselyEqual, as == compares values, for
+// operands that need no conversion by ToPrimitive: primitives, and
+// objects compared with objects, undefined or null.
+func looselyEqual(x, y Value) bool {
+	switch {
+	case x.Type == y.Type:
+		return x.Equals(y)
+	case isNullish(x) || isNullish(y):
+		return isNullish(x) && isNullish(y)
+	case x.Type == TypeBoolean:
+		return looselyEqual(Value{Type: TypeNumber, Data: x.ToNumber()}, y)
+	case y.Type == TypeBoolean:
+		return looselyEqual(x, Value{Type: TypeNumber, Data: y.ToNumber()})
+	case x.Type == TypeBigInt || y.Type == TypeBigInt:
+		if !isLooselyComparableToBigInt(x) || !isLooselyComparableToBigInt(y) {
+			return false
+		}
+		cmp, comparable := compareBigInt(x, y)
+		return comparable && cmp == 0
+	case isStringOrNumber(x) && isStringOrNumber(y):
+		return x.ToNumber() == y.ToNumber()
+	}
+	return false
+}
+
+// sameObject reports whether a and b are the same object, which is the
+// case when they refer to the same Object.
+func sameObject(a, b Value) bool {
+	return a.Object != nil && a.Object == b.Object
+}
+
 func (v Value) IsFunction() bool {
 	return v.Type == TypeFunction
 }
 
-func (v Value) GetProperty(name string) Value {
-	if v.Type == TypeObject && v.Properties != nil {
-		if prop, ok := v.Properties[name]; ok {
-			return prop
+// GetProperty reads the property name of an object as Interpreter's
+// GetProperty does, through the interpreter that created it, and returns
+// the exception a getter or proxy trap threw. Objects the host created
+// have only their own properties and those of their Prototype. Reading a
+// property of a primitive gives undefined. It may only be called on the
+// goroutine running the object's interpreter.
+func (v Value) GetProperty(name string) (Value, error) {
+	if v.Object == nil {
+		return Undefined, nil
+	}
+	if i := v.interpreter(); i != nil {
+		return i.GetProperty(v, name)
+	}
+	prop, ok := v.Object.Properties[name]
+	switch {
+	case !ok:
+		return v.Object.Prototype.GetProperty(name)
+	case prop.Type == TypeAccessor:
+		getter := prop.Data.(*Accessor).Get
+		if getter.Type != TypeFunction {
+			return Undefined, nil
 		}
+		return getter.call(v, nil)
 	}
+	return prop, nil
+}
 
-	if v.Type == TypeObject && v.Data != nil {
-		if v.Data.(string) == "console" && name == "log" {
-			return Value{
-				Type: TypeFunction,
-				Data: &ConsoleLogFunction{},
+// SetProperty writes the property name of an object as Interpreter's
+// SetProperty does, through the interpreter that created it. Objects the
+// host created call the setter they or their Prototype have, and refuse
+// to change read-only properties or to grow once not extensible. A write
+// that is refused is returned as a TypeError. Setting a property of a
+// primitive does nothing.
+func (v Value) SetProperty(name string, value Value) error {
+	if v.Object == nil {
+		return nil
+	}
+	if i := v.interpreter(); i != nil {
+		return i.SetProperty(v, name, value)
+	}
+	key := stringKey(name)
+	for o := v; o.Object != nil; o = o.Object.Prototype {
+		prop, ok := o.Object.Properties[name]
+		if !ok {
+			continue
+		}
+		if prop.Type == TypeAccessor {
+			setter := prop.Data.(*Accessor).Set
+			if setter.Type != TypeFunction {
+				return &JSException{Value: newError("TypeError", "Cannot set property "+name+" which has only a getter", nil)}
 			}
+			_, err := setter.call(v, []Value{value})
+			return err
+		}
+		if attributesOf(o, key)&nonWritable != 0 {
+			return &JSException{Value: newError("TypeError", "Cannot assign to read only property '"+name+"'", nil)}
 		}
+		break
 	}
-
-	return Undefined
-}
-
-func (v Value) SetProperty(name string, value Value) {
-	if v.Type != TypeObject {
-		return
+	if _, own := v.Object.Properties[name]; !own && v.Object.nonExtensible {
+		return &JSException{Value: newError("TypeError", "Cannot add property "+name+", object is not extensible", nil)}
 	}
-
-	if v.Properties == nil {
-		v.Properties = make(map[string]Value)
+	if v.Object.Properties == nil {
+		v.Object.Properties = make(map[string]Value)
 	}
-
-	v.Properties[name] = value
+	v.Object.Properties[name] = value
+	return nil
 }
 
+type FunctionKind int
+
+const (
+	NormalFunction FunctionKind = iota
+	// MethodFunction is an object or class method, getter or setter. Methods
+	// are not constructors.
+	MethodFunction
+	ClassConstructor
+	// DerivedConstructor is the constructor of a class with an extends
+	// clause, whose this is bound by calling super().
+	DerivedConstructor
+	// ArrowFunction takes this, super and new.target from the scope it was
+	// defined in and is not a constructor.
+	ArrowFunction
+)
+
 type Function struct {
+	Name       string
 	Parameters []*Identifier
 	Body       *BlockStatement
 	Env        *Environment
+	Strict     bool
+	Kind       FunctionKind
+	Generator  bool
+	Async      bool
+	// HomeObject is the object a method was defined on; super property
+	// lookups start at its prototype.
+	HomeObject Value
+
+	// Class constructors install these on each instance they construct.
+	privateMethods []*classElement
+	fields         []*classElement
+
+	// interpreter is the interpreter that evaluated the function's
+	// definition, which Value.Call runs it on, and source the code the
+	// definition is part of.
+	interpreter *Interpreter
+	source      *source
+	// literal is the definition, which caches the body's bytecode, and
+	// text its source code, which Function.prototype.toString returns.
+	literal *FunctionLiteral
+	text    string
+	// scope is shared by the calls of a function whose bytecode is
+	// scopeless.
+	scope *Environment
 }
 
-type ConsoleLogFunction struct{}
+// Accessor is a property defined by a getter and/or setter. Accessors
+// only appear as values stored in property maps.
+type Accessor struct {
+	Get Value
+	Set Value
+}
 
-func (clf *ConsoleLogFunction) Call(args ...Value) Value {
-	for _, arg := range args {
-		fmt.Println(arg.ToString())
-	}
-	return Undefined
+// NativeFunction is a host function that, unlike a plain
+// func(...Value) Value, receives the this value of the call.
+type NativeFunction struct {
+	Name   string
+	Length int
+	Fn     func(this Value, args []Value) Value
+	// Construct handles new; functions without it are not constructors.
+	Construct func(args []Value, newTarget Value) Value
 }
 
-func (v Value) Call(args ...Value) Value {
-	if v.Type != TypeFunction {
-		return Undefined
-	}
+// BoundFunction is the result of Function.prototype.bind: calling it calls
+// Target with BoundThis and BoundArgs prepended to the call's arguments.
+type BoundFunction struct {
+	Target    Value
+	BoundThis Value
+	BoundArgs []Value
+}
 
-	if consoleLog, ok := v.Data.(*ConsoleLogFunction); ok {
-		return consoleLog.Call(args...)
+// FunctionName returns the value of the function's name property.
+func (v Value) FunctionName() string {
+	switch f := v.Data.(type) {
+	case *Function:
+		return f.Name
+	case *NativeFunction:
+		return f.Name
+	case *BoundFunction:
+		return "bound " + f.Target.FunctionName()
 	}
+	return ""
+}
 
-	fn, ok := v.Data.(*Function)
-	if !ok {
-		return Undefined
+// FunctionLength returns the value of the function's length property, the
+// number of arguments it expects.
+func (v Value) FunctionLength() int {
+	switch f := v.Data.(type) {
+	case *Function:
+		return len(f.Parameters)
+	case *NativeFunction:
+		return f.Length
+	case *BoundFunction:
+		if n := f.Target.FunctionLength() - len(f.BoundArgs); n > 0 {
+			return n
+		}
 	}
+	return 0
+}
+
+// NewObject returns an empty object.
+func NewObject() Value {
+	return newObjectValue(TypeObject, nil)
+}
+
+// NewFunction returns a function object calling fn, which is a
+// *NativeFunction or a func(...Value) Value.
+func NewFunction(fn interface{}) Value {
+	return newObjectValue(TypeFunction, fn)
+}
+
+// newObjectValue allocates a new object of type typ, which is TypeObject
+// or TypeFunction, whose kind is data.
+func newObjectValue(typ ValueType, data interface{}) Value {
+	return Value{Type: typ, Data: data, Object: &Object{Properties: make(map[string]Value)}}
+}
 
-	newEnv := NewEnvironment()
-	newEnv.store = fn.Env.store
+// newObject, newFunctionObject and newArray create objects on behalf of
+// scripts, counting them against the memory limit and recording the
+// interpreter whose internal methods the host reaches them through.
+func (i *Interpreter) newObject() Value {
+	i.allocate(objectSize)
+	obj := NewObject()
+	obj.Object.interpreter = i
+	return obj
+}
+
+func (i *Interpreter) newFunctionObject(fn interface{}) Value {
+	i.allocate(objectSize)
+	fnObj := NewFunction(fn)
+	fnObj.Object.interpreter = i
+	return fnObj
+}
+
+func (i *Interpreter) newArray(elements []Value) Value {
+	i.allocate(objectSize + len(elements)*propertySize)
+	arr := NewArray(elements)
+	arr.Object.interpreter = i
+	return arr
+}
+
+// NewArray returns an array object holding elements at its indexed
+// properties.
+func NewArray(elements []Value) Value {
+	arr := newObjectValue(TypeObject, "Array")
+	for idx, el := range elements {
+		arr.Object.Properties[strconv.Itoa(idx)] = el
+	}
+	arr.Object.Properties["length"] = Value{Type: TypeNumber, Data: float64(len(elements))}
+	setAttributes(arr, stringKey("length"), nonEnumerable|nonConfigurable)
+	return arr
+}
 
-	for i, param := range fn.Parameters {
-		if i < len(args) {
-			newEnv.Set(param.Value, args[i])
-		} else {
-			newEnv.Set(param.Value, Undefined)
+// ArrayElements returns the own indexed properties of an array-like
+// value, from 0 up to its length or maxListLength, whichever is less.
+func (v Value) ArrayElements() []Value {
+	if v.Type != TypeObject || v.Object == nil {
+		return nil
+	}
+	length := min(toLength(v.Object.Properties["length"]), maxListLength)
+	elements := make([]Value, length)
+	for idx := range elements {
+		if el, ok := v.Object.Properties[strconv.Itoa(idx)]; ok {
+			elements[idx] = el
 		}
 	}
+	return elements
+}
 
-	tempInterpreter := &Interpreter{env: newEnv}
+// Call calls a function with undefined as this, exactly as a call from a
+// script would, and returns its result or the exception it threw. It may
+// only be called on the goroutine running the function's interpreter.
+func (v Value) Call(args ...Value) (Value, error) {
+	return v.call(Undefined, args)
+}
 
-	var result Value = Undefined
-	for _, stmt := range fn.Body.Statements {
-		result = tempInterpreter.evalStatement(stmt)
-		if ret, ok := stmt.(*ReturnStatement); ok {
-			return tempInterpreter.evalExpression(ret.ReturnValue)
+// call is Call with the given this value.
+func (v Value) call(this Value, args []Value) (Value, error) {
+	if v.Type != TypeFunction {
+		return Undefined, &JSException{Value: newError("TypeError", describeCallee(v)+" is not a function", nil)}
+	}
+	if i := v.interpreter(); i != nil {
+		return i.Call(v, this, args...)
+	}
+	// Host functions run without an interpreter, but may still throw.
+	var exception *JSException
+	result := func() Value {
+		defer func() {
+			if r := recover(); r != nil {
+				e, ok := r.(*JSException)
+				if !ok {
+					panic(r)
+				}
+				exception = e
+			}
+		}()
+		switch f := v.Data.(type) {
+		case func(...Value) Value:
+			return f(args...)
+		case *NativeFunction:
+			return f.Fn(this, args)
 		}
+		return Undefined
+	}()
+	if exception != nil {
+		return Undefined, exception
 	}
+	return result, nil
+}
 
-	return result
+// interpreter returns the interpreter that created an object or a
+// function defined by a script, or nil for objects and functions the host
+// created.
+func (v Value) interpreter() *Interpreter {
+	if v.Object != nil && v.Object.interpreter != nil {
+		return v.Object.interpreter
+	}
+	switch f := v.Data.(type) {
+	case *Function:
+		return f.interpreter
+	case *BoundFunction:
+		return f.Target.interpreter()
+	case *Proxy:
+		return f.target.interpreter()
+	}
+	return nil
 }
 
+// Add implements + for primitives: strings are concatenated when either
+// operand is a string, and other values are added as numbers.
 func (v Value) Add(other Value) Value {
-	if v.Type == TypeNumber && other.Type == TypeNumber {
-		result := v.Data.(float64) + other.Data.(float64)
-		return Value{
-			Type: TypeNumber,
-			Data: result,
-		}
-	}
 	if v.Type == TypeString || other.Type == TypeString {
-		return Value{
-			Type: TypeString,
-			Data: v.ToString() + other.ToString(),
-		}
+		return Value{Type: TypeString, Data: v.ToString() + other.ToString()}
 	}
-	return Undefined
+	return Value{Type: TypeNumber, Data: v.ToNumber() + other.ToNumber()}
 }
 
+// Subtract implements - for primitives, which are converted to numbers.
 func (v Value) Subtract(other Value) Value {
-	if v.Type == TypeNumber && other.Type == TypeNumber {
-		result := v.Data.(float64) - other.Data.(float64)
-		return Value{
-			Type: TypeNumber,
-			Data: result,
-		}
-	}
-	return Undefined
+	return Value{Type: TypeNumber, Data: v.ToNumber() - other.ToNumber()}
 }
 
+// Multiply implements * for primitives, which are converted to numbers.
 func (v Value) Multiply(other Value) Value {
-	if v.Type == TypeNumber && other.Type == TypeNumber {
-		result := v.Data.(float64) * other.Data.(float64)
-		return Value{
-			Type: TypeNumber,
-			Data: result,
-		}
-	}
-	return Undefined
+	return Value{Type: TypeNumber, Data: v.ToNumber() * other.ToNumber()}
 }
 
+// Divide implements / for primitives, which are converted to numbers.
+// Division by zero gives an infinity, or NaN for 0 / 0, whose sign follows
+// the signs of the operands as IEEE 754 specifies.
 func (v Value) Divide(other Value) Value {
-	if v.Type == TypeNumber && other.Type == TypeNumber {
-		if other.Data.(float64) == 0 {
-			return Undefined
-		}
-		result := v.Data.(float64) / other.Data.(float64)
-		return Value{
-			Type: TypeNumber,
-			Data: result,
-		}
-	}
-	return Undefined
+	return Value{Type: TypeNumber, Data: v.ToNumber() / other.ToNumber()}
 }
@@ -0,0 +1,86 @@
+package engine
+
+import "testing"
+
+func TestValueGetProperty(t *testing.T) {
+	i := NewInterpreter()
+	obj, err := i.Eval(`class Base { greet() { return "hi"; } get size() { return 3; } }
+		let o = new Base();
+		o.own = 1;
+		o`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := i.Eval(`new Proxy({}, { get: function (target, key) { return key + "!"; } })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := NewObject()
+	host.Object.Prototype = obj
+
+	tests := []struct {
+		obj  Value
+		name string
+		want string
+	}{
+		{obj, "own", "1"},
+		{obj, "size", "3"},
+		{obj, "missing", "undefined"},
+		{proxy, "x", "x!"},
+		{host, "size", "3"},
+	}
+	for _, tt := range tests {
+		got, err := tt.obj.GetProperty(tt.name)
+		if err != nil || got.ToString() != tt.want {
+			t.Errorf("GetProperty(%q) = %s, %v, want %s", tt.name, got.ToString(), err, tt.want)
+		}
+	}
+
+	greet, err := obj.GetProperty("greet")
+	if err != nil || greet.Type != TypeFunction {
+		t.Fatalf("GetProperty(\"greet\") = %s, %v, want the inherited method", greet.ToString(), err)
+	}
+	thrower, err := i.Eval(`Object.defineProperty({}, "boom", { get: function () { return (1)(); } })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := thrower.GetProperty("boom"); err == nil {
+		t.Error("GetProperty(\"boom\") returned no error for a throwing getter")
+	}
+}
+
+func TestValueSetProperty(t *testing.T) {
+	i := NewInterpreter()
+	frozen, err := i.Eval(`Object.freeze({a: 1})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := frozen.SetProperty("a", Value{Type: TypeNumber, Data: 2.0}); err == nil {
+		t.Error("SetProperty changed a property of a frozen object")
+	}
+	if err := frozen.SetProperty("b", Value{Type: TypeNumber, Data: 2.0}); err == nil {
+		t.Error("SetProperty added a property to a frozen object")
+	}
+	if got, _ := frozen.GetProperty("a"); got.ToString() != "1" {
+		t.Errorf("frozen.a = %s, want 1", got.ToString())
+	}
+
+	obj, err := i.Eval(`let seen = 0;
+		let o = Object.defineProperty({}, "x", { set: function (v) { seen = v; } });
+		o`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := obj.SetProperty("x", Value{Type: TypeNumber, Data: 5.0}); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := i.Eval(`seen`); seen.ToString() != "5" {
+		t.Errorf("setter saw %s, want 5", seen.ToString())
+	}
+
+	host := NewObject()
+	host.Object.nonExtensible = true
+	if err := host.SetProperty("y", Undefined); err == nil {
+		t.Error("SetProperty added a property to a non-extensible host object")
+	}
+}
@@ -0,0 +1,555 @@
+package engine
+
+import "math"
+
+// unboundSlot marks the slot of a local whose declaration has not run
+// yet. Code reading or assigning such a local reaches the binding of the
+// same name in an enclosing scope instead, as it does in the tree-walker,
+// which only binds locals once their declarations run.
+type unboundSlot struct{}
+
+var unbound = Value{Type: TypeUndefined, Data: unboundSlot{}}
+
+func isUnbound(v Value) bool {
+	_, ok := v.Data.(unboundSlot)
+	return ok && v.Type == TypeUndefined
+}
+
+// run executes bytecode in the current scope and frame, and returns what
+// it returns. slots holds the locals of a function body, with room for the
+// operand stack after them; it is nil for a script.
+//
+// Calls of scopeless functions are made in place: run saves the state of
+// the caller in an activation and continues with the callee's code, so
+// that such calls take no Go call and deep recursion in scripts leaves
+// the Go stack as it is.
+func (i *Interpreter) run(b *bytecode, slots []Value) Value {
+	stack := slots[len(slots):cap(slots)]
+	if len(stack) < b.stackSize {
+		stack = make([]Value, b.stackSize)
+	}
+	sp := 0
+	code := b.code
+	// The activations are kept for the next run to reuse, unless one
+	// that runs meanwhile has taken them. deepest counts those used, which
+	// are cleared when it returns.
+	calls, deepest := i.activations, 0
+	i.activations = nil
+	defer func() {
+		// An exception unwinds the calls in progress.
+		for idx := len(calls) - 1; idx >= 0; idx-- {
+			i.leaveScopeless(&calls[idx])
+		}
+		clear(calls[:deepest])
+		i.activations = calls[:0]
+	}()
+	for pc := 0; pc < len(code); pc++ {
+		in := code[pc]
+		switch in.op() {
+		case opConstant:
+			stack[sp] = b.constants[in.arg()]
+			sp++
+		case opUndefined:
+			stack[sp] = Undefined
+			sp++
+		case opPop:
+			sp--
+		case opDup:
+			stack[sp] = stack[sp-1]
+			sp++
+
+		case opGetLocal:
+			if val := &slots[in.arg()]; !isUnbound(*val) {
+				stack[sp] = *val
+			} else {
+				stack[sp], _ = i.lookupIdentifier(b.locals[in.arg()])
+			}
+			sp++
+		case opSetLocal:
+			i.setLocal(b, slots, in.arg(), stack[sp-1])
+		case opInitLocal:
+			sp--
+			nameFunction(stack[sp], b.locals[in.arg()])
+			slots[in.arg()] = stack[sp]
+		case opGetName:
+			stack[sp], _ = i.lookupIdentifier(b.names[in.arg()])
+			sp++
+		case opSetName:
+			i.assignIdentifier(b.names[in.arg()], stack[sp-1])
+		case opDeclareName:
+			sp--
+			nameFunction(stack[sp], b.names[in.arg()])
+			i.env.Set(b.names[in.arg()], stack[sp])
+		case opThis:
+			stack[sp] = i.resolveThis()
+			sp++
+
+		case opGetMember:
+			site := &b.members[in.arg()]
+			stack[sp-1] = i.vmGetMember(stack[sp-1], site.key, site.offset)
+		case opGetIndex:
+			sp--
+			stack[sp-1] = i.vmGetIndex(stack[sp-1], stack[sp], b.members[in.arg()].offset)
+		case opSetMember:
+			site := &b.members[in.arg()]
+			sp--
+			i.vmSetMember(stack[sp], site.key, stack[sp-1], site.offset)
+		case opSetIndex:
+			sp -= 2
+			i.vmSetIndex(stack[sp], stack[sp+1], stack[sp-1], b.members[in.arg()].offset)
+		case opCall:
+			site := &b.calls[in.arg()]
+			sp -= site.argc + 2
+			args := stack[sp+2 : sp+2+site.argc : sp+2+site.argc]
+			f, callee := i.scopelessCallee(stack[sp+1])
+			if callee == nil {
+				stack[sp] = i.vmCall(site, stack[sp+1], stack[sp], args)
+				sp++
+				break
+			}
+			i.setOffset(site.offset)
+			i.beginScopeless(f, stack[sp], Undefined)
+			calls = append(calls, activation{code: b, slots: slots, stack: stack, pc: pc, sp: sp})
+			deepest = max(deepest, len(calls))
+			slots = i.enterScopeless(f, callee, args, &calls[len(calls)-1])
+			b, code = callee, callee.code
+			stack, sp, pc = slots[len(slots):cap(slots)], 0, -1
+		case opNew:
+			sp = i.vmNew(&b.calls[in.arg()], stack, sp)
+
+		case opArray:
+			sp = i.vmArray(in.arg(), stack, sp)
+		case opObject:
+			stack[sp] = i.newObject()
+			i.allocate(in.arg() * propertySize)
+			sp++
+		case opPropertyKey:
+			stack[sp-1] = i.toPropertyKey(stack[sp-1])
+		case opDefineField:
+			sp--
+			key := b.constants[in.arg()]
+			nameFunction(stack[sp], functionNameForKey(key))
+			setOwnMember(stack[sp-1], key, stack[sp])
+		case opDefineComputed:
+			sp -= 2
+			key := stack[sp]
+			nameFunction(stack[sp+1], functionNameForKey(key))
+			setOwnMember(stack[sp-1], key, stack[sp+1])
+		case opDefineMethod:
+			sp = i.vmDefineMethod(b.methods[in.arg()], stack, sp)
+
+		case opFunction:
+			stack[sp] = i.evalFunctionLiteral(b.functions[in.arg()])
+			sp++
+		case opClass:
+			sp = i.vmClass(b.classes[in.arg()], stack, sp)
+
+		case opEval:
+			stack[sp] = i.evalExpression(b.expressions[in.arg()])
+			sp++
+		case opExec:
+			// Only code that is not scopeless has opExec, so no call
+			// made in place is in progress when it returns.
+			val := i.evalStatement(b.statements[in.arg()])
+			if val.Type == TypeReturn {
+				if returnValue, ok := val.Data.(*ReturnValue); ok {
+					return returnValue.Value
+				}
+				return val
+			}
+			stack[sp] = val
+			sp++
+
+		case opJump:
+			pc = in.arg() - 1
+		case opJumpIfFalse:
+			sp--
+			if !stack[sp].ToBoolean() {
+				pc = in.arg() - 1
+			}
+		case opReturn:
+			if len(calls) == 0 {
+				return stack[sp-1]
+			}
+			result := stack[sp-1]
+			caller := &calls[len(calls)-1]
+			i.leaveScopeless(caller)
+			b, code, slots, stack = caller.code, caller.code.code, caller.slots, caller.stack
+			pc, sp = caller.pc, caller.sp
+			calls = calls[:len(calls)-1]
+			stack[sp] = result
+			sp++
+
+		case opTypeof:
+			stack[sp-1] = Value{Type: TypeString, Data: stack[sp-1].TypeOf()}
+		case opPrefix:
+			stack[sp-1] = i.prefixOperation(b.operators[in.arg()], stack[sp-1])
+
+		case opAdd, opSubtract, opMultiply, opDivide, opRemainder:
+			sp--
+			if left, right := &stack[sp-1], &stack[sp]; left.Type == TypeNumber && right.Type == TypeNumber {
+				stack[sp-1] = numberValue(arithmetic(in.op(), left.Data.(float64), right.Data.(float64)))
+				break
+			}
+			stack[sp-1] = i.vmInfix(&b.infixes[in.arg()], stack[sp-1], stack[sp])
+		case opLess, opGreater, opLessEqual, opGreaterEqual, opStrictEqual, opStrictNotEqual, opEqual, opNotEqual:
+			sp--
+			left, right := &stack[sp-1], &stack[sp]
+			if left.Type != TypeNumber || right.Type != TypeNumber {
+				stack[sp-1] = i.vmInfix(&b.infixes[in.arg()], stack[sp-1], stack[sp])
+				break
+			}
+			result := compareNumbers(in.op(), left.Data.(float64), right.Data.(float64))
+			// A comparison is most often the condition of an if, whose
+			// jump it takes at once rather than pushing a boolean.
+			if next := code[pc+1]; next.op() == opJumpIfFalse {
+				sp--
+				pc++
+				if !result {
+					pc = next.arg() - 1
+				}
+				break
+			}
+			stack[sp-1] = Value{Type: TypeBoolean, Data: result}
+		default:
+			sp--
+			stack[sp-1] = i.vmInfix(&b.infixes[in.arg()], stack[sp-1], stack[sp])
+		}
+	}
+	return Undefined
+}
+
+// activation is a call of a scopeless function that run makes in place:
+// the code that made it, which resumes when it returns, with that code's
+// locals and operand stack, and the state of the interpreter the call
+// changes.
+type activation struct {
+	code   *bytecode
+	slots  []Value
+	stack  []Value
+	pc, sp int
+
+	// env and reserved are the scope and the interpreter's slots from
+	// before the call, and chunked is set when the callee's slots were
+	// reserved in a chunk of their own.
+	env      *Environment
+	reserved []Value
+	chunked  bool
+}
+
+// setLocal assigns val to the local in slot.
+func (i *Interpreter) setLocal(b *bytecode, slots []Value, slot int, val Value) {
+	name := b.locals[slot]
+	if isUnbound(slots[slot]) {
+		i.assignIdentifier(name, val)
+		return
+	}
+	nameFunction(val, name)
+	slots[slot] = val
+}
+
+// slotsChunk is the fewest slots the interpreter sets aside at a time for
+// the calls of scopeless functions.
+const slotsChunk = 1024
+
+// scopelessCallee returns the function fn calls and its bytecode when a
+// call of it can be made in place: fn is a plain function whose bytecode
+// is scopeless. Otherwise the bytecode is nil.
+func (i *Interpreter) scopelessCallee(fn Value) (*Function, *bytecode) {
+	f, ok := fn.Data.(*Function)
+	if !ok || fn.Type != TypeFunction || f.Body == nil {
+		return nil, nil
+	}
+	if f.Kind == ClassConstructor || f.Kind == DerivedConstructor || f.Generator || f.Async {
+		return nil, nil
+	}
+	if code := i.functionCode(f); code != nil && code.scopeless {
+		return f, code
+	}
+	return nil, nil
+}
+
+// callScopeless calls f, whose bytecode is scopeless, in the scope its
+// calls share, keeping its slots in the interpreter's rather than
+// allocating a scope and slots for each call.
+func (i *Interpreter) callScopeless(f *Function, code *bytecode, this Value, args []Value, newTarget Value) Value {
+	if f.Body == nil {
+		return Undefined
+	}
+	i.beginScopeless(f, this, newTarget)
+	var caller activation
+	slots := i.enterScopeless(f, code, args, &caller)
+	defer i.leaveScopeless(&caller)
+	return i.run(code, slots)
+}
+
+// beginScopeless begins a call of f, whose bytecode is scopeless, with
+// this, or constructing an object when newTarget is defined: it throws
+// when the call may not be made, and otherwise enters its frame.
+func (i *Interpreter) beginScopeless(f *Function, this Value, newTarget Value) {
+	i.checkInterrupt()
+	i.pushCallFrame(f, this, newTarget)
+}
+
+// enterScopeless enters the body of f, whose call beginScopeless has
+// begun, binding its parameters to args. It records in caller what
+// leaveScopeless restores once the call is over, and returns the slots of
+// the call.
+func (i *Interpreter) enterScopeless(f *Function, code *bytecode, args []Value, caller *activation) []Value {
+	if f.scope == nil {
+		f.scope = &Environment{outer: f.Env, strict: f.Strict}
+		if f.Kind == ArrowFunction {
+			f.scope.arrow = true
+		} else {
+			f.scope.hasThis = true
+		}
+	}
+
+	caller.env, caller.reserved = i.env, i.slots
+	size := len(code.locals) + code.stackSize
+	caller.chunked = cap(i.slots)-len(i.slots) < size
+	if caller.chunked {
+		i.slots = i.reserveSlots(size)
+	}
+	base := len(i.slots)
+	slots := i.slots[base : base+len(code.locals) : base+size]
+	i.slots = i.slots[:base+size]
+	for idx := range slots {
+		slots[idx] = unbound
+	}
+	for idx, slot := range code.params {
+		if idx < len(args) {
+			slots[slot] = args[idx]
+		} else {
+			slots[slot] = Undefined
+		}
+	}
+	i.env = f.scope
+	return slots
+}
+
+// leaveScopeless ends a call entered by enterScopeless.
+func (i *Interpreter) leaveScopeless(caller *activation) {
+	base := len(caller.reserved)
+	if caller.chunked {
+		base = 0
+	}
+	// Clearing the slots lets what they held be collected.
+	clear(i.slots[base:])
+	if caller.chunked {
+		i.spareSlots = append(i.spareSlots, i.slots[:0])
+	}
+	i.env, i.slots = caller.env, caller.reserved
+	i.popFrame()
+}
+
+// reserveSlots returns an empty chunk with room for at least size slots,
+// reusing one set aside when it can. Recursion deeper than a chunk holds
+// would otherwise allocate chunks afresh each time it goes that deep.
+func (i *Interpreter) reserveSlots(size int) []Value {
+	if n := len(i.spareSlots); n > 0 && cap(i.spareSlots[n-1]) >= size {
+		chunk := i.spareSlots[n-1]
+		i.spareSlots = i.spareSlots[:n-1]
+		return chunk
+	}
+	return make([]Value, 0, max(size, slotsChunk))
+}
+
+// smallIntegers holds the numbers 0 to 1023 ready to be stored in a Value,
+// which saves allocating them each time arithmetic produces one.
+var smallIntegers = func() (numbers [1024]interface{}) {
+	for n := range numbers {
+		numbers[n] = float64(n)
+	}
+	return numbers
+}()
+
+// numberValue returns the Value of a number.
+func numberValue(x float64) Value {
+	if n := int(x); float64(n) == x && n >= 0 && n < len(smallIntegers) && (n != 0 || !math.Signbit(x)) {
+		return Value{Type: TypeNumber, Data: smallIntegers[n]}
+	}
+	return Value{Type: TypeNumber, Data: x}
+}
+
+// arithmetic applies the arithmetic operator of an instruction to two
+// numbers.
+func arithmetic(op opcode, x, y float64) float64 {
+	switch op {
+	case opAdd:
+		return x + y
+	case opSubtract:
+		return x - y
+	case opMultiply:
+		return x * y
+	case opDivide:
+		return x / y
+	}
+	// math.Mod is slow, and remainders of integers are common enough to
+	// take them directly. The result has the sign of x, even when it is
+	// zero.
+	if n, d := int64(x), int64(y); float64(n) == x && float64(d) == y && d != 0 &&
+		n > -1<<53 && n < 1<<53 && d > -1<<53 && d < 1<<53 {
+		if r := n % d; r != 0 || !math.Signbit(x) {
+			return float64(r)
+		}
+		return math.Copysign(0, -1)
+	}
+	return math.Mod(x, y)
+}
+
+// compareNumbers applies the comparison or equality operator of an
+// instruction to two numbers.
+func compareNumbers(op opcode, x, y float64) bool {
+	switch op {
+	case opLess:
+		return x < y
+	case opGreater:
+		return x > y
+	case opLessEqual:
+		return x <= y
+	case opGreaterEqual:
+		return x >= y
+	case opStrictEqual, opEqual:
+		return x == y
+	}
+	return x != y
+}
+
+// numberOperation applies the binary operator of an instruction below
+// opInfix to two numbers.
+func numberOperation(op opcode, x, y float64) Value {
+	if op < opLess {
+		return numberValue(arithmetic(op, x, y))
+	}
+	return Value{Type: TypeBoolean, Data: compareNumbers(op, x, y)}
+}
+
+// vmInfix applies the binary operator at site to operands other than two
+// numbers.
+func (i *Interpreter) vmInfix(site *infixSite, left, right Value) Value {
+	i.setOffset(site.offset)
+	return i.infixOperation(site.operator, left, right)
+}
+
+// vmCall calls fn for the call expression at site, other than calls of
+// scopeless functions, which run makes in place.
+func (i *Interpreter) vmCall(site *callSite, fn Value, this Value, args []Value) Value {
+	i.setOffset(site.offset)
+	if fn.Type != TypeFunction {
+		i.throwError("TypeError", "%s is not a function", site.callee)
+	}
+	if _, ok := fn.Data.(*Function); !ok {
+		// Functions defined by scripts copy their arguments into their
+		// scope, but others may keep them.
+		args = append([]Value(nil), args...)
+	}
+	return i.applyFunction(fn, this, args)
+}
+
+// vmNew replaces a constructor and the arguments above it on the stack
+// with the object it constructs for the new expression at site, and
+// returns the new top of the stack.
+func (i *Interpreter) vmNew(site *callSite, stack []Value, sp int) int {
+	args := make([]Value, site.argc)
+	copy(args, stack[sp-site.argc:sp])
+	sp -= site.argc + 1
+	i.setOffset(site.offset)
+	stack[sp] = i.construct(stack[sp], args, stack[sp])
+	return sp + 1
+}
+
+// vmArray replaces the n elements on top of the stack with an array of
+// them, and returns the new top of the stack.
+func (i *Interpreter) vmArray(n int, stack []Value, sp int) int {
+	elements := make([]Value, n)
+	copy(elements, stack[sp-n:sp])
+	sp -= n
+	i.checkArrayLength(int64(n))
+	stack[sp] = i.newArray(elements)
+	return sp + 1
+}
+
+// vmDefineMethod defines a method or accessor of an object literal on the
+// object on the stack, and returns the new top of the stack.
+func (i *Interpreter) vmDefineMethod(prop *ObjectProperty, stack []Value, sp int) int {
+	key := stringKey(prop.Key)
+	if prop.ComputedKey != nil {
+		sp--
+		key = stack[sp]
+	}
+	i.defineObjectMethod(stack[sp-1], prop, key)
+	return sp
+}
+
+// vmClass replaces the superclass and the computed keys of a class
+// literal on the stack with the class it defines, and returns the new top
+// of the stack.
+func (i *Interpreter) vmClass(class *ClassLiteral, stack []Value, sp int) int {
+	top := sp
+	for _, member := range class.Members {
+		if member.ComputedKey != nil {
+			sp--
+		}
+	}
+	keys := append([]Value(nil), stack[sp:top]...)
+	superclass := Undefined
+	if class.SuperClass != nil {
+		sp--
+		superclass = stack[sp]
+	}
+	stack[sp] = i.defineClass(class, superclass, keys)
+	return sp + 1
+}
+
+// vmGetMember reads a property of obj for code at offset.
+func (i *Interpreter) vmGetMember(obj Value, key Value, offset int) Value {
+	i.setOffset(offset)
+	if isNullish(obj) {
+		i.throwError("TypeError", "Cannot read properties of %s (reading '%s')", obj.ToString(), key.ToString())
+	}
+	if prop, ok := ownDataProperty(obj, key); ok {
+		return prop
+	}
+	return i.getMember(obj, key)
+}
+
+// vmGetIndex reads the property of obj a computed key names for code at
+// offset.
+func (i *Interpreter) vmGetIndex(obj Value, key Value, offset int) Value {
+	return i.vmGetMember(obj, i.toPropertyKey(key), offset)
+}
+
+// vmSetIndex assigns the property of obj a computed key names for code at
+// offset.
+func (i *Interpreter) vmSetIndex(obj Value, key Value, val Value, offset int) {
+	i.vmSetMember(obj, i.toPropertyKey(key), val, offset)
+}
+
+// vmSetMember assigns a property of obj for code at offset.
+func (i *Interpreter) vmSetMember(obj Value, key Value, val Value, offset int) {
+	i.setOffset(offset)
+	if isNullish(obj) {
+		i.throwError("TypeError", "Cannot set properties of %s (setting '%s')", obj.ToString(), key.ToString())
+	}
+	if _, ok := ownDataProperty(obj, key); ok && (len(obj.Object.attributes) == 0 || attributesOf(obj, key)&nonWritable == 0) && !isArrayLength(obj, key) {
+		setOwnMember(obj, key, val)
+		return
+	}
+	i.setMember(obj, key, val)
+}
+
+// ownDataProperty returns the own data property key of an ordinary
+// object, which is what reading it gives and what writing it replaces.
+// It lets property accesses that need nothing more skip the object's
+// internal methods.
+func ownDataProperty(obj Value, key Value) (Value, bool) {
+	if obj.Type != TypeObject || obj.Object == nil || key.Type != TypeString {
+		return Undefined, false
+	}
+	if _, ok := obj.Data.(*Proxy); ok {
+		return Undefined, false
+	}
+	prop, ok := obj.Object.Properties[key.Data.(string)]
+	return prop, ok && prop.Type != TypeAccessor
+}
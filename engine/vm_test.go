@@ -0,0 +1,133 @@
+package engine
+
+import "testing"
+
+// TestBytecodeMatchesTreeWalking runs each script compiled to bytecode and
+// walking its syntax tree, and expects the same result or error from both.
+func TestBytecodeMatchesTreeWalking(t *testing.T) {
+	scripts := []string{
+		// Numbers.
+		`1 + 2 * 3 - 4 / 8`,
+		`7 % 3 + -7 % 3 + 7.5 % 2`,
+		`0.1 + 0.2`,
+		`1 / 0 - 1 / 0`,
+		`let z = -0; 1 / z`,
+		`(2 < 3) + (3 <= 3) + (4 > 5) + (5 >= 6)`,
+		`(1 == 1) + (1 != 2) + (1 === 1) + (1 !== "1")`,
+		`"3" * "4" + true`,
+		`null + 1`,
+		`undefined + 1`,
+		`10n * 3n + 1n`,
+		`typeof 1 + typeof "" + typeof undefined + typeof null + typeof {} + typeof function () {}`,
+		`let n = 5; -n + +"2" + !n`,
+
+		// Strings.
+		`"a" + 1 + 2`,
+		`1 + 2 + "a"`,
+		`"x" + 0.5 + -0 + null + undefined + true`,
+		`"a" < "b"`,
+		`"10" == 10`,
+		`"" + {}`,
+		`function rep(s, n) { if (n == 0) { return s; } return rep(s + n, n - 1); } rep("", 20)`,
+
+		// Functions and scopes.
+		`function fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); } fib(20)`,
+		`function acc(n, total) { if (n == 0) { return total; } return acc(n - 1, total + n / 4); } acc(500, 0)`,
+		`function f(a, b) { return b; } f(1)`,
+		`function f(a) { return a; } f(1, 2, 3)`,
+		`function counter() { let n = 0; return function () { n = n + 1; return n; }; } let c = counter(); c(); c(); c()`,
+		`let x = 1; function f() { let y = x; let x = 2; return y; } f()`,
+		`let x = 1; function f() { x = x + 10; return x; } f() + x`,
+		`function f() { return this; } f()`,
+		`let o = {v: 3, f: function () { return this.v; }}; o.f()`,
+		`let add = (a, b) => a + b; add(2, 3)`,
+		`function outer() { function inner(n) { if (n == 0) { return "done"; } return inner(n - 1); } return inner(50); } outer()`,
+
+		// Objects and properties.
+		`let o = {count: 0}; o.count = o.count + 1; o.count = o.count + 1; o.count`,
+		`let o = {}; o.a = 1; o["b"] = 2; o.a + o.b`,
+		`let o = {a: {b: {c: 4}}}; o.a.b.c`,
+		`let o = {}; o.missing`,
+		`let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2] + a.length`,
+		`let p = {x: 1}; let o = Object.setPrototypeOf({}, p); o.x = 2; p.x + o.x`,
+		`let o = Object.freeze({x: 1}); o.x = 2; o.x`,
+		`"use strict"; let o = Object.freeze({x: 1}); o.x = 2; o.x`,
+		`let o = {}; Object.defineProperty(o, "x", {value: 1, writable: false}); o.x = 5; o.x`,
+		`let seen = 0; let o = {}; Object.defineProperty(o, "x", {get: function () { return 7; }, set: function (v) { seen = v; }}); o.x = 3; o.x + seen`,
+		`let p = new Proxy({x: 1}, {get: function (t, k) { return 40; }}); p.x + 2`,
+		`let log = ""; let p = new Proxy({x: 1}, {set: function (t, k, v) { log = k + v; return true; }}); p.x = 9; log`,
+		`let k = "a"; let o = {[k]: 1, b: 2}; o.a + o.b`,
+
+		// Classes, generators and optional chains.
+		`class A { constructor(v) { this.v = v; } get double() { return this.v * 2; } } new A(4).double`,
+		`class A { m() { return 1; } } class B extends A { m() { return super.m() + 1; } } new B().m()`,
+		`function* g() { yield 1; yield 2; } let it = g(); it.next().value + it.next().value`,
+		`let o = null; o?.a.b`,
+		`let o = {f: function () { return 6; }}; o.f?.()`,
+
+		// Errors.
+		`let o = undefined; o.x`,
+		`let o = null; o.x = 1`,
+		`let f = 1; f()`,
+		`let o = {}; o.m()`,
+		`notDefined + 1`,
+		`class A {} A()`,
+		`function f() { return g(); } function g() { return 1 + {}.x.y; } f()`,
+	}
+	for _, src := range scripts {
+		results := make(map[bool]string)
+		for _, treeWalking := range []bool{false, true} {
+			i := NewInterpreter()
+			i.SetTreeWalking(treeWalking)
+			v, err := i.Eval(src)
+			results[treeWalking] = v.ToString()
+			if err != nil {
+				results[treeWalking] = err.Error()
+			}
+		}
+		if results[false] != results[true] {
+			t.Errorf("%s = %s as bytecode and %s walking the tree", src, results[false], results[true])
+		}
+	}
+}
+
+// benchmarkScripts are the numeric, string and object workloads the
+// bytecode is measured on against the tree-walker.
+var benchmarkScripts = []struct {
+	name   string
+	source string
+}{
+	{"Fib", `function fib(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); } fib(20)`},
+	{"Arithmetic", `function sum(n, total) { if (n == 0) { return total; } return sum(n - 1, total + n * n % 7 / 3 - n / 5); } sum(5000, 0)`},
+	{"Strings", `function pad(s, width) { if (width == 0) { return s; } return pad("0" + s, width - 1); }
+		function count(n, total) { if (n == 0) { return total; } let s = pad("" + n % 97, 3); if (s < "0050") { return count(n - 1, total + 1); } return count(n - 1, total + (s == "0096")); }
+		count(2000, 0)`},
+	{"Objects", `function Point(x, y) { this.x = x; this.y = y; }
+		function walk(p, n) { if (n == 0) { return p.x + p.y; } p.x = p.x + n; p.y = p.y - p.x % 3; return walk(p, n - 1); }
+		walk(new Point(1, 2), 5000)`},
+}
+
+// BenchmarkScripts runs each of the benchmark scripts as bytecode and
+// walking its syntax tree.
+func BenchmarkScripts(b *testing.B) {
+	for _, script := range benchmarkScripts {
+		program, err := Parse(script.name, script.source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, mode := range []struct {
+			name        string
+			treeWalking bool
+		}{{"Bytecode", false}, {"TreeWalking", true}} {
+			b.Run(script.name+"/"+mode.name, func(b *testing.B) {
+				i := NewInterpreter()
+				i.SetTreeWalking(mode.treeWalking)
+				for n := 0; n < b.N; n++ {
+					if _, err := i.RunProgram(program); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
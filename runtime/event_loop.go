@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"math"
 	"sync"
 	"time"
 )
@@ -10,17 +11,26 @@ type Task struct {
 	when     time.Time
 }
 
+// EventLoop queues tasks, such as timer callbacks, for Run to execute one
+// at a time on the goroutine that owns the interpreter. Tasks may be added
+// from any goroutine.
 type EventLoop struct {
 	tasks []Task
-	mu    sync.Mutex
+	// refs counts host operations in flight that will add a task once
+	// they complete. Clear forgets them by starting a new generation.
+	refs       int
+	generation int
+	mu         sync.Mutex
+	// wake interrupts Run's wait for the next task when tasks or refs
+	// change.
+	wake chan struct{}
 }
 
 func NewEventLoop() *EventLoop {
-	el := &EventLoop{
+	return &EventLoop{
 		tasks: make([]Task, 0),
+		wake:  make(chan struct{}, 1),
 	}
-	go el.run()
-	return el
 }
 
 func (el *EventLoop) AddTask(callback func(), delay time.Duration) {
@@ -30,30 +40,99 @@ func (el *EventLoop) AddTask(callback func(), delay time.Duration) {
 		callback: callback,
 		when:     time.Now().Add(delay),
 	})
+	el.notify()
 }
 
+// Ref keeps Run waiting for a host operation that will add a task when it
+// completes, even while no tasks are queued. Each Ref must be matched by an
+// Unref, passed the generation Ref returned, once the operation has added
+// its task.
+func (el *EventLoop) Ref() (generation int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.refs++
+	return el.generation
+}
+
+// Unref ends a Ref. It has no effect when the loop has been cleared since,
+// as Clear already dropped the Ref.
+func (el *EventLoop) Unref(generation int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if generation != el.generation {
+		return
+	}
+	el.refs--
+	el.notify()
+}
+
+// Clear discards the queued tasks and the pending Refs, so that Run
+// returns.
 func (el *EventLoop) Clear() {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 	el.tasks = nil
+	el.refs = 0
+	el.generation++
+	el.notify()
 }
 
-func (el *EventLoop) run() {
-	ticker := time.NewTicker(10 * time.Millisecond)
-	for range ticker.C {
-		el.mu.Lock()
-		now := time.Now()
-		remaining := make([]Task, 0)
+// notify wakes Run if it is waiting. el.mu must be held.
+func (el *EventLoop) notify() {
+	select {
+	case el.wake <- struct{}{}:
+	default:
+	}
+}
 
-		for _, task := range el.tasks {
-			if now.After(task.when) {
-				go task.callback()
-			} else {
-				remaining = append(remaining, task)
+// Run executes tasks on the calling goroutine as they become due, in the
+// order of their due times, calling afterTask after each one. It returns
+// once no tasks are queued and no host operations are in flight.
+func (el *EventLoop) Run(afterTask func()) {
+	for {
+		task, wait, ok := el.next()
+		if !ok {
+			return
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-el.wake:
+				timer.Stop()
 			}
+			continue
 		}
+		task.callback()
+		afterTask()
+	}
+}
+
+// next removes and returns the earliest task if it is due. Otherwise it
+// returns how long to wait before checking again, which is indefinitely
+// while only host operations are pending. ok is false once there is
+// nothing left to wait for.
+func (el *EventLoop) next() (task Task, wait time.Duration, ok bool) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
 
-		el.tasks = remaining
-		el.mu.Unlock()
+	if len(el.tasks) == 0 {
+		if el.refs > 0 {
+			return Task{}, time.Duration(math.MaxInt64), true
+		}
+		return Task{}, 0, false
+	}
+
+	earliest := 0
+	for idx, t := range el.tasks {
+		if t.when.Before(el.tasks[earliest].when) {
+			earliest = idx
+		}
+	}
+	if wait := time.Until(el.tasks[earliest].when); wait > 0 {
+		return Task{}, wait, true
 	}
+	task = el.tasks[earliest]
+	el.tasks = append(el.tasks[:earliest], el.tasks[earliest+1:]...)
+	return task, 0, true
 }
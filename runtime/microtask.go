@@ -0,0 +1,32 @@
+package runtime
+
+// MicrotaskQueue holds the promise jobs of a runtime's interpreter. They
+// run in order once the current script or event loop task has finished,
+// ahead of the next task. It is only used on the goroutine running the
+// interpreter.
+type MicrotaskQueue struct {
+	jobs []func()
+}
+
+func NewMicrotaskQueue() *MicrotaskQueue {
+	return &MicrotaskQueue{jobs: make([]func(), 0)}
+}
+
+func (q *MicrotaskQueue) EnqueueJob(job func()) {
+	q.jobs = append(q.jobs, job)
+}
+
+// Drain runs queued jobs, including the ones they queue in turn, until
+// none remain.
+func (q *MicrotaskQueue) Drain() {
+	for len(q.jobs) > 0 {
+		job := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		job()
+	}
+}
+
+func (q *MicrotaskQueue) Clear() {
+	q.jobs = nil
+}
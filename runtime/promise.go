@@ -0,0 +1,34 @@
+package runtime
+
+import (
+	"mini-js/engine"
+	"sync"
+)
+
+// NewPromise creates a pending promise for host code to settle, typically
+// once an asynchronous operation it started on another goroutine
+// completes. resolve and reject may be called from any goroutine: the
+// promise is settled by an event loop task, and the event loop keeps
+// running until one of them has been called. Only the first call has an
+// effect.
+func (r *Runtime) NewPromise() (promise engine.Value, resolve func(engine.Value), reject func(engine.Value)) {
+	promise, resolvePromise, rejectPromise := r.interpreter.NewPromise()
+
+	var once sync.Once
+	generation := r.eventLoop.Ref()
+	settle := func(fn func(engine.Value), val engine.Value) {
+		once.Do(func() {
+			r.eventLoop.AddTask(func() {
+				fn(val)
+			}, 0)
+			r.eventLoop.Unref(generation)
+		})
+	}
+	resolve = func(val engine.Value) {
+		settle(resolvePromise, val)
+	}
+	reject = func(reason engine.Value) {
+		settle(rejectPromise, reason)
+	}
+	return promise, resolve, reject
+}
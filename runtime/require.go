@@ -0,0 +1,240 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mini-js/engine"
+	"path"
+	"strings"
+)
+
+// moduleWrapper turns the source of a CommonJS module into a function
+// expression, so the module runs in its own scope with its own bindings of
+// exports, require and module. The wrapper starts on the module's first
+// line so that line numbers in stack traces match the file, and columns
+// leave it out.
+const (
+	moduleWrapperStart = "(function (exports, require, module, __filename, __dirname) { "
+	moduleWrapperEnd   = "\n})"
+)
+
+// SetRequireFS sets the files that require loads modules from. Names are
+// resolved the way Node.js resolves them, with the root of fsys standing
+// for the directory of the script passed to Execute.
+func (r *Runtime) SetRequireFS(fsys fs.FS) {
+	r.requireFS = fsys
+	r.moduleCache = make(map[string]engine.Value)
+}
+
+// newRequire returns the require function for the module in dir, whose
+// relative names are resolved against it.
+func (r *Runtime) newRequire(dir string) engine.Value {
+	require := newHostFunction("require", 1, func(args []engine.Value) engine.Value {
+		return r.require(argumentString(args), dir)
+	})
+	require.Object.Properties["resolve"] = newHostFunction("resolve", 1, func(args []engine.Value) engine.Value {
+		request := argumentString(args)
+		name, ok := r.resolveModule(request, dir)
+		if !ok {
+			r.throwModuleNotFound(request)
+		}
+		return engine.Value{Type: engine.TypeString, Data: name}
+	})
+	return require
+}
+
+// require loads the module request names, or returns the exports of the
+// cached module. A module in a cycle of requires sees the exports of the
+// module that started the cycle as they are when it requires it.
+func (r *Runtime) require(request string, dir string) engine.Value {
+	name, ok := r.resolveModule(request, dir)
+	if !ok {
+		r.throwModuleNotFound(request)
+	}
+	if module, ok := r.moduleCache[name]; ok {
+		return module.Object.Properties["exports"]
+	}
+
+	src, err := fs.ReadFile(r.requireFS, name)
+	if err != nil {
+		r.throwError("Error", err.Error())
+	}
+
+	module := engine.NewObject()
+	module.Object.Properties["id"] = engine.Value{Type: engine.TypeString, Data: name}
+	module.Object.Properties["filename"] = engine.Value{Type: engine.TypeString, Data: name}
+	module.Object.Properties["loaded"] = engine.Value{Type: engine.TypeBoolean, Data: false}
+	module.Object.Properties["exports"] = engine.NewObject()
+	r.moduleCache[name] = module
+
+	if path.Ext(name) == ".json" {
+		var data interface{}
+		if err := json.Unmarshal(src, &data); err != nil {
+			delete(r.moduleCache, name)
+			r.throwError("SyntaxError", fmt.Sprintf("%s: %s", name, err))
+		}
+		module.Object.Properties["exports"] = fromJSON(data)
+	} else if err := r.runModule(module, name, string(src)); err != nil {
+		delete(r.moduleCache, name)
+		// An interrupt or exceeded limit stops the requiring script too,
+		// rather than becoming an exception it could catch.
+		var exception *engine.JSException
+		var interrupted *engine.InterruptedError
+		if errors.As(err, &exception) {
+			panic(exception)
+		} else if errors.As(err, &interrupted) {
+			panic(interrupted)
+		}
+		r.throwError("Error", err.Error())
+	}
+
+	module.Object.Properties["loaded"] = engine.Value{Type: engine.TypeBoolean, Data: true}
+	return module.Object.Properties["exports"]
+}
+
+// runModule evaluates the source of a CommonJS module, which fills in
+// module.exports.
+func (r *Runtime) runModule(module engine.Value, name string, src string) error {
+	wrapper, err := r.interpreter.EvalWrappedScript(name, moduleWrapperStart, src, moduleWrapperEnd)
+	if err != nil {
+		return err
+	}
+	dir := path.Dir(name)
+	_, err = r.interpreter.Call(wrapper, module.Object.Properties["exports"],
+		module.Object.Properties["exports"],
+		r.newRequire(dir),
+		module,
+		engine.Value{Type: engine.TypeString, Data: name},
+		engine.Value{Type: engine.TypeString, Data: dir},
+	)
+	return err
+}
+
+// resolveModule finds the file request names when it is required from
+// dir: relative names are files or directories relative to dir, and
+// others are looked up in the node_modules directories of dir and each of
+// its parents.
+func (r *Runtime) resolveModule(request string, dir string) (string, bool) {
+	if r.requireFS == nil || request == "" {
+		return "", false
+	}
+	if strings.HasPrefix(request, "./") || strings.HasPrefix(request, "../") || strings.HasPrefix(request, "/") || request == "." || request == ".." {
+		if strings.HasPrefix(request, "/") {
+			dir = "."
+		}
+		return r.resolvePath(path.Join(dir, request))
+	}
+
+	for {
+		if name, ok := r.resolvePath(path.Join(dir, "node_modules", request)); ok {
+			return name, true
+		}
+		if dir == "." {
+			return "", false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// resolvePath resolves name as a file, trying the .js and .json
+// extensions, and then as a directory.
+func (r *Runtime) resolvePath(name string) (string, bool) {
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	if file, ok := r.resolveFile(name); ok {
+		return file, true
+	}
+	return r.resolveDirectory(name)
+}
+
+func (r *Runtime) resolveFile(name string) (string, bool) {
+	for _, candidate := range []string{name, name + ".js", name + ".json"} {
+		if info, err := fs.Stat(r.requireFS, candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// resolveDirectory resolves the main file named by the package.json of
+// the directory, falling back to its index.js or index.json.
+func (r *Runtime) resolveDirectory(dir string) (string, bool) {
+	if data, err := fs.ReadFile(r.requireFS, path.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Main string `json:"main"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && pkg.Main != "" {
+			main := path.Join(dir, pkg.Main)
+			if fs.ValidPath(main) {
+				if file, ok := r.resolveFile(main); ok {
+					return file, true
+				}
+				if file, ok := r.resolveFile(path.Join(main, "index")); ok {
+					return file, true
+				}
+			}
+		}
+	}
+	return r.resolveFile(path.Join(dir, "index"))
+}
+
+// fromJSON converts a value decoded by encoding/json to a JavaScript
+// value.
+func fromJSON(data interface{}) engine.Value {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		obj := engine.NewObject()
+		for key, val := range d {
+			obj.Object.Properties[key] = fromJSON(val)
+		}
+		return obj
+	case []interface{}:
+		elements := make([]engine.Value, len(d))
+		for idx, val := range d {
+			elements[idx] = fromJSON(val)
+		}
+		return engine.NewArray(elements)
+	case string:
+		return engine.Value{Type: engine.TypeString, Data: d}
+	case float64:
+		return engine.Value{Type: engine.TypeNumber, Data: d}
+	case bool:
+		return engine.Value{Type: engine.TypeBoolean, Data: d}
+	}
+	return engine.Value{Type: engine.TypeNull}
+}
+
+// newHostFunction returns a function implemented by the runtime that can
+// carry properties of its own.
+func newHostFunction(name string, length int, fn func(args []engine.Value) engine.Value) engine.Value {
+	return engine.NewFunction(&engine.NativeFunction{
+		Name:   name,
+		Length: length,
+		Fn: func(this engine.Value, args []engine.Value) engine.Value {
+			return fn(args)
+		},
+	})
+}
+
+func argumentString(args []engine.Value) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0].ToString()
+}
+
+// throwError throws a JavaScript error from a host function, with the
+// stack of the script that called it.
+func (r *Runtime) throwError(name string, message string) {
+	err := r.interpreter.NewError(name, message)
+	panic(&engine.JSException{Value: err, Stack: engine.ErrorStack(err)})
+}
+
+func (r *Runtime) throwModuleNotFound(request string) {
+	err := r.interpreter.NewError("Error", fmt.Sprintf("Cannot find module '%s'", request))
+	err.Object.Properties["code"] = engine.Value{Type: engine.TypeString, Data: "MODULE_NOT_FOUND"}
+	panic(&engine.JSException{Value: err, Stack: engine.ErrorStack(err)})
+}
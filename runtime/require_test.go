@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"mini-js/engine"
+)
+
+func TestRequire(t *testing.T) {
+	file := func(src string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(src)} }
+	fsys := fstest.MapFS{
+		"lib/math.js":                    file(`exports.add = function (a, b) { return a + b; }; exports.dir = __dirname; exports.file = __filename;`),
+		"lib/conf.json":                  file(`{"name": "cfg", "list": [1, 2, 3], "nested": {"ok": true}, "none": null}`),
+		"lib/pkg/index.js":               file(`module.exports = "index of pkg";`),
+		"lib/up.js":                      file(`module.exports = require("../count").n;`),
+		"node_modules/left/package.json": file(`{"main": "src/main"}`),
+		"node_modules/left/src/main.js":  file(`module.exports = function (s) { return "  " + s; };`),
+		"a.js":                           file(`exports.loaded = false; let b = require("./b"); exports.fromB = b.sawA; exports.loaded = true;`),
+		"b.js":                           file(`let a = require("./a.js"); exports.sawA = a.loaded;`),
+		"count.js":                       file(`globalThis.evaluated = globalThis.evaluated + 1; module.exports = {n: 1};`),
+		"bad.js":                         file(`undefinedThing();`),
+		"bad.json":                       file(`{"a": }`),
+		"syntax.js":                      file(`let = ;`),
+	}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let m = require("./lib/math"); m.add(2, 3) + " " + m.dir + " " + m.file`, "5 lib lib/math.js"},
+		{`let c = require("./lib/conf.json"); c.name + c.list.length + c.list[2] + c.nested.ok + c.none`, "cfg33truenull"},
+		{`require("./lib/pkg")`, "index of pkg"},
+		{`require("./lib/pkg/")`, "index of pkg"},
+		{`require("left")("pad")`, "  pad"},
+		{`require("./lib/up")`, "1"},
+		{`let a = require("./a"); a.loaded + "," + a.fromB`, "true,false"},
+		{`require("./count") === require("./count.js")`, "true"},
+		{`globalThis.evaluated = 0; require("./count"); require("./count"); globalThis.evaluated`, "1"},
+		{`require.resolve("left") + " " + require.resolve("./lib/conf")`, "node_modules/left/src/main.js lib/conf.json"},
+		{`require("nope")`, "Uncaught Error: Cannot find module 'nope'"},
+		{`require.resolve("./nope")`, "Uncaught Error: Cannot find module './nope'"},
+		{`require("./bad")`, "Uncaught TypeError: undefinedThing is not a function"},
+		{`require("./syntax")`, "Uncaught Error: syntax.js:1:5: SyntaxError: Unexpected token '='"},
+	}
+	for _, tt := range tests {
+		rt := NewRuntime()
+		rt.SetRequireFS(fsys)
+		v, err := rt.Execute(tt.src)
+		got := v.ToString()
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	// A module that fails to load is not cached, and a missing one throws
+	// an error with the code Node.js gives it.
+	rt := NewRuntime()
+	rt.SetRequireFS(fsys)
+	_, err := rt.Execute(`require("./bad.json")`)
+	var exception *engine.JSException
+	if !errors.As(err, &exception) || exception.Value.Object.Properties["name"].ToString() != "SyntaxError" {
+		t.Errorf("require of invalid JSON: err = %v, want a SyntaxError", err)
+	}
+	if v, err := rt.Execute(`require("./bad.json")`); err == nil {
+		t.Errorf("second require of invalid JSON = %s, want it to fail again", v.ToString())
+	}
+	_, err = rt.Execute(`require("nope")`)
+	if !errors.As(err, &exception) || exception.Value.Object.Properties["code"].ToString() != "MODULE_NOT_FOUND" {
+		t.Errorf("require(nope): err = %v, want code MODULE_NOT_FOUND", err)
+	}
+}
@@ -1,23 +1,43 @@
 package runtime
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"mini-js/engine"
+	"sync"
 )
 
 type Runtime struct {
 	interpreter *engine.Interpreter
 	eventLoop   *EventLoop
+	microtasks  *MicrotaskQueue
 	isRunning   bool
+
+	// requireFS holds the CommonJS modules require loads, which
+	// moduleCache caches by file name.
+	requireFS   fs.FS
+	moduleCache map[string]engine.Value
+
+	// uncaught is the exception an event loop task threw, which ends the
+	// event loop.
+	uncaught error
+
+	// interrupted is the pending Interrupt, which other goroutines set.
+	interruptMu sync.Mutex
+	interrupted *engine.InterruptedError
 }
 
 func NewRuntime() *Runtime {
 	r := &Runtime{
 		interpreter: engine.NewInterpreter(),
 		eventLoop:   NewEventLoop(),
+		microtasks:  NewMicrotaskQueue(),
 		isRunning:   true,
+		moduleCache: make(map[string]engine.Value),
 	}
+	r.interpreter.SetJobQueue(r.microtasks)
 
 	if err := r.injectGlobals(); err != nil {
 		panic("Failed to initialize runtime: " + err.Error())
@@ -30,22 +50,8 @@ func (r *Runtime) injectGlobals() error {
 		return errors.New("interpreter not initialized")
 	}
 
-	consoleObj := engine.Value{
-		Type: engine.TypeObject,
-		Data: "console",
-		Properties: map[string]engine.Value{
-			"log": {
-				Type: engine.TypeFunction,
-				Data: func(args ...engine.Value) engine.Value {
-					for _, arg := range args {
-						fmt.Print(arg.ToString(), " ")
-					}
-					fmt.Println()
-					return engine.Undefined
-				},
-			},
-		},
-	}
+	consoleObj := engine.NewObject()
+	consoleObj.Object.Properties["log"] = engine.NewFunction(ConsoleLog)
 
 	if err := r.interpreter.SetGlobal("console", consoleObj); err != nil {
 		return err
@@ -54,9 +60,25 @@ func (r *Runtime) injectGlobals() error {
 	if err := r.interpreter.SetGlobal("setTimeout", r.setTimeout); err != nil {
 		return err
 	}
+
+	if err := r.interpreter.SetGlobal("require", r.newRequire(".")); err != nil {
+		return err
+	}
 	return nil
 }
 
+// SetGlobal defines a global variable, such as a host function or a
+// promise made with NewPromise.
+func (r *Runtime) SetGlobal(name string, value interface{}) error {
+	return r.interpreter.SetGlobal(name, value)
+}
+
+// SetLimits sets the limits on the resources scripts may use. Memory is
+// counted across every Execute until SetLimits is called again.
+func (r *Runtime) SetLimits(limits engine.Limits) {
+	r.interpreter.SetLimits(limits)
+}
+
 func (r *Runtime) EnableDebug() {
 	r.interpreter.EnableDebug()
 }
@@ -65,22 +87,173 @@ func (r *Runtime) DisableDebug() {
 	r.interpreter.DisableDebug()
 }
 
+// SetTreeWalking sets whether scripts are evaluated by walking their
+// syntax trees instead of running as bytecode.
+func (r *Runtime) SetTreeWalking(enabled bool) {
+	r.interpreter.SetTreeWalking(enabled)
+}
+
+// SetOptimizations sets the passes made over the scripts and modules
+// before they run.
+func (r *Runtime) SetOptimizations(opts engine.Optimizations) {
+	r.interpreter.SetOptimizations(opts)
+}
+
+// Execute runs code and then the event loop until no tasks remain, so
+// timers and awaited promises complete before it returns. The microtask
+// queue is drained after the script and after each task.
 func (r *Runtime) Execute(code string) (engine.Value, error) {
+	return r.ExecuteScript("", code)
+}
+
+// ExecuteScript is Execute for a script called name, such as the file it
+// was read from, which the stack traces of errors refer to it by.
+func (r *Runtime) ExecuteScript(name string, code string) (engine.Value, error) {
 	if !r.isRunning {
 		return engine.Value{}, errors.New("runtime is stopped")
 	}
 	if code == "" {
 		return engine.Value{}, errors.New("empty code string")
 	}
-	return r.interpreter.Eval(code)
+	result, err := r.interpreter.EvalScript(name, code)
+	if err == nil {
+		r.drainMicrotasks()
+		r.eventLoop.Run(r.drainMicrotasks)
+		err = r.takeUncaught()
+	}
+	if interrupted := r.takeInterrupt(); err == nil && interrupted != nil {
+		err = interrupted
+	}
+	return result, err
+}
+
+// ExecuteContext is Execute for a script that is stopped, along with the
+// event loop, once ctx is done, as if by Interrupt.
+func (r *Runtime) ExecuteContext(ctx context.Context, code string) (engine.Value, error) {
+	if ctx.Err() != nil {
+		return engine.Undefined, &engine.InterruptedError{Reason: context.Cause(ctx)}
+	}
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(interrupted)
+		r.Interrupt(context.Cause(ctx))
+	})
+	defer func() {
+		// An interrupt that came too late to stop anything must not stop
+		// the next script.
+		if !stop() {
+			<-interrupted
+			r.takeInterrupt()
+		}
+	}()
+	return r.Execute(code)
+}
+
+// Interrupt stops the script or event loop task that is running, the next
+// time it calls a function, and the event loop, so that Execute returns an
+// *engine.InterruptedError for reason. If nothing is running the next
+// script is stopped instead. Interrupt may be called from any goroutine.
+func (r *Runtime) Interrupt(reason error) {
+	r.interruptMu.Lock()
+	defer r.interruptMu.Unlock()
+	r.interrupted = &engine.InterruptedError{Reason: reason}
+	r.interpreter.Interrupt(reason)
+	r.eventLoop.Clear()
+}
+
+// takeInterrupt returns and withdraws the pending Interrupt, if any.
+func (r *Runtime) takeInterrupt() error {
+	r.interruptMu.Lock()
+	defer r.interruptMu.Unlock()
+	if r.interrupted == nil {
+		return nil
+	}
+	err := r.interrupted
+	r.interrupted = nil
+	r.interpreter.ClearInterrupt()
+	return err
+}
+
+// drainMicrotasks runs the queued promise jobs. An Interrupt that stops a
+// job is reported like an exception thrown by a task.
+func (r *Runtime) drainMicrotasks() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			interrupted, ok := rec.(*engine.InterruptedError)
+			if !ok {
+				panic(rec)
+			}
+			r.reportUncaught(interrupted)
+		}
+	}()
+	r.microtasks.Drain()
+}
+
+// reportUncaught records an exception thrown by a task, such as a timer
+// callback, that no script can catch. Like an exception thrown by the
+// script itself, it stops the runtime from running further tasks.
+func (r *Runtime) reportUncaught(err error) {
+	if r.uncaught == nil {
+		r.uncaught = err
+	}
+	r.eventLoop.Clear()
+	r.microtasks.Clear()
+}
+
+// takeUncaught returns and forgets the exception reportUncaught recorded.
+func (r *Runtime) takeUncaught() error {
+	err := r.uncaught
+	r.uncaught = nil
+	return err
+}
+
+// SetModuleLoader sets the loader that import declarations, import() and
+// RunModule load modules with.
+func (r *Runtime) SetModuleLoader(loader engine.ModuleLoader) {
+	r.interpreter.SetModuleLoader(loader)
+}
+
+// RunModule imports the module specifier refers to and runs the event loop
+// until it has been evaluated and no tasks remain. It returns the module's
+// namespace object, or the exception its evaluation threw.
+func (r *Runtime) RunModule(specifier string) (engine.Value, error) {
+	if !r.isRunning {
+		return engine.Value{}, errors.New("runtime is stopped")
+	}
+	promise, err := r.interpreter.ImportModule(specifier)
+	if err != nil {
+		return engine.Undefined, err
+	}
+	r.drainMicrotasks()
+	r.eventLoop.Run(r.drainMicrotasks)
+	err = r.takeUncaught()
+	if interrupted := r.takeInterrupt(); err == nil && interrupted != nil {
+		err = interrupted
+	}
+	if err != nil {
+		return engine.Undefined, err
+	}
+
+	state, result, _ := engine.PromiseResult(promise)
+	switch state {
+	case engine.PromiseFulfilled:
+		return result, nil
+	case engine.PromiseRejected:
+		return engine.Undefined, &engine.JSException{Value: result, Stack: engine.ErrorStack(result)}
+	}
+	return engine.Undefined, fmt.Errorf("module '%s' did not finish evaluating", specifier)
 }
 
 func (r *Runtime) Stop() {
 	r.isRunning = false
 	r.eventLoop.Clear()
+	r.microtasks.Clear()
 }
 
+// Close stops the runtime and the generators and async functions its
+// scripts left suspended, releasing the goroutines they hold.
 func (r *Runtime) Close() error {
 	r.Stop()
+	r.interpreter.Close()
 	return nil
 }
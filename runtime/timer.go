@@ -1,10 +1,14 @@
 package runtime
 
 import (
+	"math"
 	"mini-js/engine"
 	"time"
 )
 
+// setTimeout calls a callback, with any further arguments, once delay
+// milliseconds have passed. A delay that is not a positive number runs
+// the callback as soon as possible.
 func (r *Runtime) setTimeout(args ...engine.Value) engine.Value {
 	if len(args) < 2 {
 		return engine.Undefined
@@ -12,14 +16,20 @@ func (r *Runtime) setTimeout(args ...engine.Value) engine.Value {
 
 	callback := args[0]
 	delay := args[1].ToNumber()
+	if math.IsNaN(delay) || delay < 0 {
+		delay = 0
+	}
+	callbackArgs := append([]engine.Value{}, args[2:]...)
 
 	if !callback.IsFunction() {
 		return engine.Undefined
 	}
 
 	r.eventLoop.AddTask(func() {
-		callback.Call()
-	}, time.Duration(delay)*time.Millisecond)
+		if _, err := callback.Call(callbackArgs...); err != nil {
+			r.reportUncaught(err)
+		}
+	}, time.Duration(delay*float64(time.Millisecond)))
 
 	return engine.Undefined
 }